@@ -5,7 +5,9 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
+	"os"
 
 	_ "net/http/pprof"
 
@@ -45,12 +47,61 @@ var (
 			CountryTSV: []string{},
 			CountryCSV: "",
 			AsnCSV:     "",
+			GeoLite2:   []string{},
+			GeoLang:    "en",
+			IP2LocGeo:  []string{},
+			IP2LocASN:  []string{},
+			DBIPGeo:    []string{},
+			DBIPASN:    []string{},
+			SchemaFile: "",
 			IPver:      "all",
+			Precedence: []string{},
+			Strict:     false,
+			MaxSkip:    0,
+			Workers:    0,
+			Progress:   5,
+			Manifest:   "",
+			Signature:  "",
+			PubKey:     "",
+			RequireSig: false,
+			Index:      "sorted",
+			MmapBase:   "",
+			MmapAdvice: "random",
+			ExplainRow: false,
+			MaxAge:     0,
+			Overlay:    "",
+			OverlayRe:  10,
+			FlagLists:  []string{},
+			FlagListRe: 60,
+			BlockDir:   "",
+			BlockDirRe: 60,
+		},
+		Snapshots: config.Snapshots{
+			SnapshotDir:    "",
+			SnapshotBudget: 512,
+		},
+		Datasets: config.Datasets{
+			DatasetsFile:   "",
+			DatasetName:    "default",
+			DefaultDataset: "",
 		},
 	}
 )
 
 func main() {
+	if err := ipcsv2base.RegisterCommands(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if err, ok := toolkit.RunAdditional(); ok || err != nil {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var logapp model.Logger
 
 	root := toolkit.InitAppStart(
@@ -0,0 +1,351 @@
+package ipcsv2base
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eterline/ipcsv2base/internal/config"
+	ipbaseProvide "github.com/eterline/ipcsv2base/internal/infra/ipbase"
+	"github.com/eterline/ipcsv2base/internal/model"
+	"github.com/eterline/ipcsv2base/internal/service/ipbase"
+	"github.com/eterline/ipcsv2base/pkg/ipsetdata"
+	"github.com/eterline/ipcsv2base/pkg/manifest"
+	mmaprc "github.com/eterline/ipcsv2base/pkg/mmapread"
+)
+
+// Base - Loaded IP base registry.
+type Base interface {
+	ipbase.MetaLookuper
+	Size() int
+	LoadReport() model.LoadReport
+	Stats() model.BaseStats
+}
+
+// Base source names, used by precedence rules of composed sources.
+const (
+	sourceTSV         = "tsv"
+	sourceCSV         = "csv"
+	sourceGeoLite2    = "geolite2"
+	sourceIP2Location = "ip2location"
+	sourceDBIP        = "dbip"
+	sourceSchema      = "schema"
+)
+
+// baseSource - Loader of a configured base source.
+type baseSource struct {
+	name string
+	load func(ctx context.Context, opts []ipbaseProvide.LoadOption) (Base, error)
+}
+
+/*
+loadOptions - Returns the load options of the configured base.
+
+	The manifest verifier is loaded once and shared by the base sources
+	and the past versions of the dataset.
+*/
+func loadOptions(log model.Logger, cfg config.Base) ([]ipbaseProvide.LoadOption, error) {
+	index, err := ipsetdata.ParseIndexKind(cfg.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []ipbaseProvide.LoadOption{
+		ipbaseProvide.WithStrict(cfg.Strict),
+		ipbaseProvide.WithMaxSkipRate(cfg.MaxSkip),
+		ipbaseProvide.WithWorkers(cfg.Workers),
+		ipbaseProvide.WithProgress(log, time.Duration(cfg.Progress)*time.Second),
+		ipbaseProvide.WithRowOrigins(cfg.ExplainRow),
+		ipbaseProvide.WithLookupIndex(index),
+	}
+
+	if cfg.Manifest != "" {
+		verifier, err := sourceVerifier(log, cfg)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, ipbaseProvide.WithVerifier(verifier))
+	}
+	return opts, nil
+}
+
+/*
+loadBase - Registry factory, loads the IP base from the configured sources with opts.
+
+	Several configured sources are loaded one after another and composed
+	field by field, with precedence rules from the configuration.
+*/
+func loadBase(ctx context.Context, log model.Logger, cfg config.Base, opts []ipbaseProvide.LoadOption) (Base, error) {
+	if cfg.MmapBase != "" {
+		return openMmapBase(ctx, log, cfg, opts)
+	}
+
+	sources, err := baseSources(log, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(sources) {
+	case 0:
+		return nil, errors.New("base did not prepared")
+	case 1:
+		if len(cfg.Precedence) > 0 {
+			log.Warn("precedence rules are ignored for a single base source")
+		}
+		return sources[0].load(ctx, opts)
+	}
+
+	precedence, err := ipbase.ParsePrecedence(cfg.Precedence)
+	if err != nil {
+		return nil, err
+	}
+	if err := ipbase.CheckPrecedence(sourceNames(sources), precedence); err != nil {
+		return nil, err
+	}
+
+	named := make([]ipbase.NamedLookuper, 0, len(sources))
+	for _, src := range sources {
+		base, err := src.load(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s base source: %w", src.name, err)
+		}
+		named = append(named, ipbase.NamedLookuper{Name: src.name, Lookup: base})
+	}
+
+	composite, err := ipbase.NewCompositeLookuper(named, precedence)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info(
+		"base sources composed",
+		model.FieldStringJoin("sources", ", ", sourceNames(sources)...),
+		model.FieldStringJoin("precedence", "; ", cfg.Precedence...),
+	)
+	return composite, nil
+}
+
+// baseSources - Returns loaders of the configured sources in default precedence order.
+func baseSources(log model.Logger, cfg config.Base) ([]baseSource, error) {
+	ver := ipbaseProvide.IPVersionStr(cfg.IPver)
+	var sources []baseSource
+
+	if len(cfg.CountryTSV) > 0 {
+		sources = append(sources, baseSource{sourceTSV, func(ctx context.Context, opts []ipbaseProvide.LoadOption) (Base, error) {
+			log.Info(
+				"loading CSV files",
+				model.FieldStringJoin("tsv_files", ", ", cfg.CountryTSV...),
+			)
+			return ipbaseProvide.NewRegistryIPTSV(ctx, cfg.CountryTSV, opts...)
+		}})
+	}
+
+	if cfg.CountryCSV != "" && cfg.AsnCSV != "" {
+		sources = append(sources, baseSource{sourceCSV, func(ctx context.Context, opts []ipbaseProvide.LoadOption) (Base, error) {
+			log.Info(
+				"loading CSV files",
+				model.FieldString("ip_version", cfg.IPver),
+				model.FieldString("asn_base", cfg.AsnCSV),
+				model.FieldString("country_base", cfg.CountryCSV),
+			)
+			return ipbaseProvide.NewRegistryIP(ctx, cfg.CountryCSV, cfg.AsnCSV, ver, opts...)
+		}})
+	}
+
+	if len(cfg.GeoLite2) > 0 {
+		sources = append(sources, baseSource{sourceGeoLite2, func(ctx context.Context, opts []ipbaseProvide.LoadOption) (Base, error) {
+			log.Info(
+				"loading GeoLite2 bundles",
+				model.FieldString("ip_version", cfg.IPver),
+				model.FieldString("language", cfg.GeoLang),
+				model.FieldStringJoin("bundles", ", ", cfg.GeoLite2...),
+			)
+			return ipbaseProvide.NewRegistryGeoLite2(ctx, cfg.GeoLang, ver, cfg.GeoLite2, opts...)
+		}})
+	}
+
+	if len(cfg.IP2LocGeo) > 0 || len(cfg.IP2LocASN) > 0 {
+		sources = append(sources, baseSource{sourceIP2Location, func(ctx context.Context, opts []ipbaseProvide.LoadOption) (Base, error) {
+			log.Info(
+				"loading IP2Location files",
+				model.FieldString("ip_version", cfg.IPver),
+				model.FieldStringJoin("geo_base", ", ", cfg.IP2LocGeo...),
+				model.FieldStringJoin("asn_base", ", ", cfg.IP2LocASN...),
+			)
+			return ipbaseProvide.NewRegistryIP2Location(ctx, cfg.IP2LocGeo, cfg.IP2LocASN, ver, opts...)
+		}})
+	}
+
+	if len(cfg.DBIPGeo) > 0 || len(cfg.DBIPASN) > 0 {
+		sources = append(sources, baseSource{sourceDBIP, func(ctx context.Context, opts []ipbaseProvide.LoadOption) (Base, error) {
+			log.Info(
+				"loading DB-IP files",
+				model.FieldString("ip_version", cfg.IPver),
+				model.FieldStringJoin("geo_base", ", ", cfg.DBIPGeo...),
+				model.FieldStringJoin("asn_base", ", ", cfg.DBIPASN...),
+			)
+			return ipbaseProvide.NewRegistryDBIP(ctx, cfg.DBIPGeo, cfg.DBIPASN, ver, opts...)
+		}})
+	}
+
+	if cfg.SchemaFile != "" {
+		schemaSources, err := ipbaseProvide.LoadSchemaFile(cfg.SchemaFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema file: %w", err)
+		}
+
+		sources = append(sources, baseSource{sourceSchema, func(ctx context.Context, opts []ipbaseProvide.LoadOption) (Base, error) {
+			paths := make([]string, 0, len(schemaSources))
+			for _, src := range schemaSources {
+				paths = append(paths, src.Path)
+			}
+
+			log.Info(
+				"loading schema mapped CSV files",
+				model.FieldString("ip_version", cfg.IPver),
+				model.FieldString("schema_file", cfg.SchemaFile),
+				model.FieldStringJoin("csv_files", ", ", paths...),
+			)
+			return ipbaseProvide.NewRegistrySchema(ctx, ver, schemaSources, opts...)
+		}})
+	}
+
+	return sources, nil
+}
+
+// openMmapBase - Maps the compiled base file, its ranges and records are paged in on lookups.
+func openMmapBase(ctx context.Context, log model.Logger, cfg config.Base, opts []ipbaseProvide.LoadOption) (Base, error) {
+	advice, err := mmaprc.ParseAdvice(cfg.MmapAdvice)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info(
+		"mapping compiled base file",
+		model.FieldString("mmap_base", cfg.MmapBase),
+		model.FieldString("advice", cfg.MmapAdvice),
+	)
+	return ipbaseProvide.OpenRegistryMmap(ctx, cfg.MmapBase, advice, opts...)
+}
+
+func sourceNames(sources []baseSource) []string {
+	names := make([]string, 0, len(sources))
+	for _, src := range sources {
+		names = append(names, src.name)
+	}
+	return names
+}
+
+// logLoadReport - Logs per source row statistics, sources with rejected rows are logged as warnings.
+func logLoadReport(log model.Logger, report model.LoadReport) {
+	for _, src := range report.Sources {
+		if src.RowsSkipped > 0 {
+			log.Warn("base source loaded with rejected rows", src.FieldsLog()...)
+			continue
+		}
+		log.Info("base source loaded", src.FieldsLog()...)
+	}
+}
+
+/*
+sourceVerifier - Loads the signed manifest of the base files.
+
+	With require-signed any manifest, signature or checksum failure refuses the load,
+	otherwise failures are logged and the files are loaded unverified.
+*/
+func sourceVerifier(log model.Logger, cfg config.Base) (ipbaseProvide.SourceVerifier, error) {
+	sigFile := cfg.Signature
+	if sigFile == "" {
+		sigFile = cfg.Manifest + manifest.SigSuffix
+	}
+
+	v, err := manifest.LoadVerifier(cfg.Manifest, sigFile, cfg.PubKey)
+	if err != nil {
+		if cfg.RequireSig {
+			return nil, fmt.Errorf("failed to verify base manifest: %w", err)
+		}
+
+		log.Warn(
+			"base manifest verification failed, files are loaded unverified",
+			model.FieldString("manifest", cfg.Manifest),
+			model.FieldError(err),
+		)
+		return warnVerifier{log: log}, nil
+	}
+
+	log.Info("base manifest signature verified", model.FieldString("manifest", cfg.Manifest))
+
+	if cfg.RequireSig {
+		return v, nil
+	}
+	return warnVerifier{log: log, v: v}, nil
+}
+
+// warnVerifier - Logs source verification failures without refusing the load.
+type warnVerifier struct {
+	log model.Logger
+	v   *manifest.Verifier
+}
+
+func (w warnVerifier) Verify(file, sum string) error {
+	if w.v == nil {
+		return nil
+	}
+
+	if err := w.v.Verify(file, sum); err != nil {
+		w.log.Warn(
+			"base file failed manifest check",
+			model.FieldString("file", file),
+			model.FieldString("sha256", sum),
+			model.FieldError(err),
+		)
+	}
+	return nil
+}
+
+/*
+openSnapshots - Opens the store of past base versions, nil without a snapshots directory.
+
+	Snapshots are mapped with the access hint and verified with the load options of the served base.
+*/
+func openSnapshots(log model.Logger, cfg config.Base, snaps config.Snapshots, opts []ipbaseProvide.LoadOption) (*ipbaseProvide.SnapshotStore, error) {
+	if snaps.SnapshotDir == "" {
+		return nil, nil
+	}
+
+	advice, err := mmaprc.ParseAdvice(cfg.MmapAdvice)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := ipbaseProvide.NewSnapshotStore(log, snaps.SnapshotDir, advice, int64(snaps.SnapshotBudget)<<20, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info(
+		"base snapshots found",
+		model.FieldString("snapshots_dir", snaps.SnapshotDir),
+		model.Field("versions", len(store.Versions())),
+		model.Field("budget_mb", snaps.SnapshotBudget),
+	)
+	return store, nil
+}
+
+// snapshotVersions - Adapts the snapshot store to the lookup service.
+type snapshotVersions struct {
+	store *ipbaseProvide.SnapshotStore
+}
+
+func (v snapshotVersions) Acquire(ctx context.Context, at time.Time) (ipbase.MetaLookuper, time.Time, func(), error) {
+	base, dataTime, release, err := v.store.Acquire(ctx, at)
+	if err != nil {
+		return nil, time.Time{}, nil, err
+	}
+	return base, dataTime, release, nil
+}
+
+func (v snapshotVersions) Versions() []model.BaseVersion {
+	return v.store.Versions()
+}
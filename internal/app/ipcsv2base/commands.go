@@ -0,0 +1,195 @@
+package ipcsv2base
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/alexflint/go-arg"
+	"github.com/eterline/ipcsv2base/internal/config"
+	ipbaseProvide "github.com/eterline/ipcsv2base/internal/infra/ipbase"
+	logging "github.com/eterline/ipcsv2base/internal/infra/log"
+	"github.com/eterline/ipcsv2base/pkg/manifest"
+	"github.com/eterline/ipcsv2base/pkg/toolkit"
+)
+
+// RegisterCommands - Registers additional CLI commands run instead of the server.
+// Commands loading the base start from the server defaults.
+func RegisterCommands(defaults config.Configuration) error {
+	return errors.Join(
+		toolkit.RegisterCommand("keygen", keygenCommand),
+		toolkit.RegisterCommand("sign", signCommand),
+		toolkit.RegisterCommand("compile", func(args ...string) error {
+			return compileCommand(defaults, args...)
+		}),
+		toolkit.RegisterCommand("diff", func(args ...string) error {
+			return diffCommand(defaults, args...)
+		}),
+	)
+}
+
+type keygenArgs struct {
+	Out string `arg:"--out,-o" help:"Key files prefix, writes <prefix>.key and <prefix>.pub" default:"base"`
+}
+
+// keygenCommand - Generates an ed25519 key pair for manifest signing.
+func keygenCommand(args ...string) error {
+	var a keygenArgs
+	if done, err := parseCommandArgs("keygen", &a, args); done || err != nil {
+		return err
+	}
+
+	priv, pub, err := manifest.GenerateKey()
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(a.Out+".key", priv, 0o600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(a.Out+".pub", pub, 0o644); err != nil {
+		return err
+	}
+
+	fmt.Printf("private key: %s.key\npublic key: %s.pub\n", a.Out, a.Out)
+	return nil
+}
+
+type signArgs struct {
+	Key   string   `arg:"--key,-k,required" help:"ed25519 private key (PEM) signing the manifest"`
+	Out   string   `arg:"--out,-o" help:"Manifest output file, the signature is written with .sig suffix" default:"manifest.sha256"`
+	Files []string `arg:"positional,required" help:"Base files listed in the manifest by their path relative to its directory"`
+}
+
+// signCommand - Writes the SHA-256 manifest of base files and its detached signature.
+func signCommand(args ...string) error {
+	var a signArgs
+	if done, err := parseCommandArgs("sign", &a, args); done || err != nil {
+		return err
+	}
+
+	key, err := manifest.ReadPrivateKey(a.Key)
+	if err != nil {
+		return err
+	}
+
+	m, err := manifest.Build(filepath.Dir(a.Out), a.Files...)
+	if err != nil {
+		return err
+	}
+
+	data := m.Marshal()
+	if err := os.WriteFile(a.Out, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(a.Out+manifest.SigSuffix, manifest.Sign(data, key), 0o644); err != nil {
+		return err
+	}
+
+	fmt.Printf("manifest: %s (%d files)\nsignature: %s%s\n", a.Out, len(m), a.Out, manifest.SigSuffix)
+	return nil
+}
+
+type compileArgs struct {
+	Out string `arg:"--out,-o,required" help:"Compiled base output file, served with --mmap-base"`
+	config.Log
+	config.Base
+}
+
+/*
+compileCommand - Loads the configured base and writes it as a compiled base file.
+
+	The file is written next to the output and renamed into place once
+	complete, so a serving process never maps a partial file.
+*/
+func compileCommand(defaults config.Configuration, args ...string) error {
+	a := compileArgs{Log: defaults.Log, Base: defaults.Base}
+	if done, err := parseCommandArgs("compile", &a, args); done || err != nil {
+		return err
+	}
+	if err := config.Validate(&a); err != nil {
+		return err
+	}
+	if a.MmapBase != "" {
+		return errors.New("compile loads base sources, mmap-base is already compiled")
+	}
+
+	log, err := logging.NewZapLoggerWithConfig(os.Stderr, a.LogLevel, false, a.JSONlog, a.Colored)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	opts, err := loadOptions(log, a.Base)
+	if err != nil {
+		return err
+	}
+
+	base, err := loadBase(ctx, log, a.Base, opts)
+	if err != nil {
+		return err
+	}
+	logLoadReport(log, base.LoadReport())
+
+	compilable, ok := base.(ipbaseProvide.Compilable)
+	if !ok {
+		return errors.New("composed base sources can not be compiled, configure a single source")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(a.Out), filepath.Base(a.Out)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := compilable.WriteCompiled(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write compiled base: %w", err)
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), a.Out); err != nil {
+		return err
+	}
+
+	st, err := os.Stat(a.Out)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("compiled base: %s (%d ranges, %d bytes)\n", a.Out, base.Size(), st.Size())
+	return nil
+}
+
+// parseCommandArgs parses command arguments, done is set when help was printed.
+func parseCommandArgs(name string, dest any, args []string) (done bool, err error) {
+	p, err := arg.NewParser(arg.Config{Program: selfExecName() + " " + name}, dest)
+	if err != nil {
+		return false, err
+	}
+
+	err = p.Parse(args)
+	if err == arg.ErrHelp {
+		p.WriteHelp(os.Stdout)
+		return true, nil
+	}
+	return false, err
+}
+
+func selfExecName() string {
+	if len(os.Args) > 0 {
+		return os.Args[0]
+	}
+	return "ipcsv2base"
+}
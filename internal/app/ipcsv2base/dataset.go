@@ -0,0 +1,187 @@
+package ipcsv2base
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/eterline/ipcsv2base/internal/config"
+	"github.com/eterline/ipcsv2base/internal/infra/blocklists"
+	ipbaseProvide "github.com/eterline/ipcsv2base/internal/infra/ipbase"
+	"github.com/eterline/ipcsv2base/internal/infra/netflags"
+	"github.com/eterline/ipcsv2base/internal/infra/overlay"
+	"github.com/eterline/ipcsv2base/internal/interface/http/baseapi"
+	"github.com/eterline/ipcsv2base/internal/model"
+	"github.com/eterline/ipcsv2base/internal/service/ipbase"
+	"github.com/eterline/ipcsv2base/pkg/toolkit"
+	"github.com/go-chi/chi/v5"
+)
+
+// freshnessCheckInterval - Interval of base age checks.
+const freshnessCheckInterval = time.Hour
+
+/*
+openDataset - Loads the base of a dataset with its overlay, flag lists, blocklists and past versions.
+
+	Every dataset has its own cache, lookup service and freshness monitor,
+	its reload workers run with the app. closeSet releases the mapped past
+	versions once the server stopped.
+*/
+func openDataset(root *toolkit.AppStarter, log model.Logger, set config.Dataset) (handlers *baseapi.BaseAPIHandlerGroup, closeSet func(), err error) {
+	ctx := root.Context
+
+	log.Info("setup IP base initialization")
+	startInit := time.Now()
+
+	opts, err := loadOptions(log, set.Base)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lookuper, err := loadBase(ctx, log, set.Base, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report := lookuper.LoadReport()
+	logLoadReport(log, report)
+
+	log.Info(
+		"ip base loaded successfully",
+		append([]model.LogField{
+			model.Field("base_records", lookuper.Size()),
+			model.FieldString("data_time", report.DataTime().Format(time.RFC3339)),
+			model.Field("initialization_time_ms", time.Since(startInit).Milliseconds()),
+		}, lookuper.Stats().FieldsLog()...)...,
+	)
+
+	var netOverlay ipbase.OverlayLookuper
+	if set.Overlay != "" {
+		ov, err := overlay.NewOverlay(log, set.Overlay)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load overlay: %w", err)
+		}
+
+		log.Info(
+			"overlay loaded",
+			model.FieldString("file", set.Overlay),
+			model.Field("networks", ov.Size()),
+		)
+
+		if set.OverlayRe > 0 {
+			root.WrapWorker(func() {
+				ov.Run(ctx, time.Duration(set.OverlayRe)*time.Second)
+			})
+		}
+		netOverlay = ov
+	}
+
+	var netFlags ipbase.FlagLookuper
+	if len(set.FlagLists) > 0 {
+		specs := make([]netflags.Spec, 0, len(set.FlagLists))
+		for _, arg := range set.FlagLists {
+			spec, err := netflags.ParseSpec(arg)
+			if err != nil {
+				return nil, nil, err
+			}
+			specs = append(specs, spec)
+		}
+
+		lists, err := netflags.NewLists(log, specs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load flag lists: %w", err)
+		}
+
+		log.Info(
+			"flag lists loaded",
+			model.Field("lists", len(specs)),
+			model.Field("ranges", lists.Size()),
+		)
+
+		if set.FlagListRe > 0 {
+			root.WrapWorker(func() {
+				lists.Run(ctx, time.Duration(set.FlagListRe)*time.Second)
+			})
+		}
+		netFlags = lists
+	}
+
+	var netBlocklists ipbase.BlocklistLookuper
+	if set.BlockDir != "" {
+		store, err := blocklists.NewStore(log, set.BlockDir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load blocklists: %w", err)
+		}
+
+		log.Info(
+			"blocklists loaded",
+			model.FieldString("dir", set.BlockDir),
+			model.Field("lists", len(store.Lists())),
+			model.Field("ranges", store.Size()),
+		)
+
+		if set.BlockDirRe > 0 {
+			root.WrapWorker(func() {
+				store.Run(ctx, time.Duration(set.BlockDirRe)*time.Second)
+			})
+		}
+		netBlocklists = store
+	}
+
+	closeSet = func() {}
+	var versions ipbase.VersionStore
+	snapshots, err := openSnapshots(log, set.Base, set.Snapshots, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open base snapshots: %w", err)
+	}
+	if snapshots != nil {
+		closeSet = func() { snapshots.Close() }
+		versions = snapshotVersions{store: snapshots}
+	}
+
+	baseSrvc := ipbase.NewIPBaseService(log, lookuper, netOverlay, netFlags, netBlocklists, &ipbaseProvide.IPbaseCacheMock{}, versions)
+
+	freshness := ipbase.NewFreshnessMonitor(log, set.MaxAge, baseSrvc.LoadReport)
+	root.WrapWorker(func() {
+		freshness.Run(ctx, freshnessCheckInterval)
+	})
+
+	return baseapi.NewBaseAPIHandlerGroup(log, baseSrvc, freshness, true), closeSet, nil
+}
+
+// baseRoutes - Registers the lookup, statistics and info routes of a dataset.
+func baseRoutes(r chi.Router, baseHandlers *baseapi.BaseAPIHandlerGroup) {
+	// Readiness probe, fails on stale base data
+	r.Get("/ready", baseHandlers.ReadyHandler)
+
+	r.Route("/base", func(r chi.Router) {
+		// Rows read, accepted and rejected per source of the loaded base
+		r.Get("/report", baseHandlers.LoadReportHandler)
+		// Source files, checksums, build dates and base age
+		r.Get("/info", baseHandlers.BaseInfoHandler)
+		// Ranges, address space, records and heap usage of the loaded base
+		r.Get("/stats", baseHandlers.StatsHandler)
+		// Served base and past versions answering lookups with ?at=
+		r.Get("/versions", baseHandlers.VersionsHandler)
+	})
+
+	// AS search by name, org and domain
+	r.Get("/search", baseHandlers.SearchHandler)
+	r.Get("/domain/{domain}", baseHandlers.DomainHandler)
+	// Country and AS statistics precomputed on load
+	r.Get("/country/{cc}", baseHandlers.CountrySummaryHandler)
+	r.Get("/asn/{asn}", baseHandlers.ASSummaryHandler)
+	// Aggregated networks of a country or an AS, JSON or plain text
+	r.Get("/country/{cc}/prefixes", baseHandlers.CountryPrefixesHandler)
+	r.Get("/asn/{asn}/prefixes", baseHandlers.ASNPrefixesHandler)
+
+	r.Route("/lookup", func(r chi.Router) {
+		// Lookup by IP, path parameter or fallback to request IP
+		r.Get("/ip/{ip}", baseHandlers.LookupIPHandler)
+		r.Get("/ip/", baseHandlers.LookupIPHandler) // fallback: extract IP from request
+		r.Get("/ip", baseHandlers.LookupIPHandler)  // fallback: extract IP from request
+	})
+
+	// Loaded blocklists and membership of an address in one of them
+	r.Get("/lists", baseHandlers.BlocklistsHandler)
+	r.Get("/lists/{name}/check/{ip}", baseHandlers.BlocklistCheckHandler)
+}
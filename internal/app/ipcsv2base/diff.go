@@ -0,0 +1,316 @@
+package ipcsv2base
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net/netip"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/eterline/ipcsv2base/internal/config"
+	ipbaseProvide "github.com/eterline/ipcsv2base/internal/infra/ipbase"
+	logging "github.com/eterline/ipcsv2base/internal/infra/log"
+	"github.com/eterline/ipcsv2base/internal/model"
+	mmaprc "github.com/eterline/ipcsv2base/pkg/mmapread"
+)
+
+type diffArgs struct {
+	Old             string  `arg:"--old,required" help:"Compiled base file of the old version, written by the compile command"`
+	Format          string  `arg:"--format" help:"Output format: text|json" default:"text" validate:"oneof=text json"`
+	Limit           int     `arg:"--limit" help:"Largest number of listed prefixes and changes of each kind, 0 lists all" default:"100" validate:"gte=0"`
+	MaxAdded        float64 `arg:"--max-added" help:"Fail when added address space exceeds this share of the old base: 0..1, 0 disables" validate:"gte=0,lte=1"`
+	MaxRemoved      float64 `arg:"--max-removed" help:"Fail when removed address space exceeds this share of the old base: 0..1, 0 disables" validate:"gte=0,lte=1"`
+	MaxCountryMoved float64 `arg:"--max-country-moved" help:"Fail when address space with changed country exceeds this share of the old base: 0..1, 0 disables" validate:"gte=0,lte=1"`
+	MaxASMoved      float64 `arg:"--max-as-moved" help:"Fail when address space with changed AS exceeds this share of the old base: 0..1, 0 disables" validate:"gte=0,lte=1"`
+	config.Log
+	config.Base
+}
+
+/*
+diffCommand - Compares the configured base against a compiled old version.
+
+	The new version is loaded like the server base. The command fails when
+	a change share exceeds its threshold, after the diff is written, so a
+	deploy pipeline can stop a suspicious base update.
+*/
+func diffCommand(defaults config.Configuration, args ...string) error {
+	a := diffArgs{Log: defaults.Log, Base: defaults.Base}
+	if done, err := parseCommandArgs("diff", &a, args); done || err != nil {
+		return err
+	}
+	if err := config.Validate(&a); err != nil {
+		return err
+	}
+
+	log, err := logging.NewZapLoggerWithConfig(os.Stderr, a.LogLevel, false, a.JSONlog, a.Colored)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	old, err := ipbaseProvide.OpenRegistryMmap(ctx, a.Old, mmaprc.AdviceSequential)
+	if err != nil {
+		return fmt.Errorf("failed to open old base: %w", err)
+	}
+	defer old.Close()
+
+	opts, err := loadOptions(log, a.Base)
+	if err != nil {
+		return err
+	}
+
+	base, err := loadBase(ctx, log, a.Base, opts)
+	if err != nil {
+		return err
+	}
+	logLoadReport(log, base.LoadReport())
+
+	diffable, ok := base.(ipbaseProvide.Diffable)
+	if !ok {
+		return errors.New("composed base sources can not be diffed, configure a single source")
+	}
+
+	diff := ipbaseProvide.Diff(old, diffable, a.Limit)
+	thresholds := ipbaseProvide.DiffThresholds{
+		Added:        a.MaxAdded,
+		Removed:      a.MaxRemoved,
+		CountryMoved: a.MaxCountryMoved,
+		ASMoved:      a.MaxASMoved,
+	}
+	exceeded := thresholds.Exceeded(diff)
+
+	switch a.Format {
+	case "json":
+		err = writeDiffJSON(os.Stdout, diff, exceeded)
+	default:
+		err = writeDiffText(os.Stdout, diff, exceeded)
+	}
+	if err != nil {
+		return err
+	}
+	return thresholds.Check(diff)
+}
+
+// diffSpaceDTO - Address space of a diff total with its shares of the old base.
+type diffSpaceDTO struct {
+	Prefixes      int      `json:"prefix_count"`
+	IPv4Addresses uint64   `json:"ipv4_addresses"`
+	IPv6Addresses string   `json:"ipv6_addresses"`
+	IPv4Share     *float64 `json:"ipv4_share"` // null for a change of an empty old space
+	IPv6Share     *float64 `json:"ipv6_share"`
+}
+
+// diffCountryDTO - Address space gained and lost by a country.
+type diffCountryDTO struct {
+	CountryCode string `json:"country_code"`
+	GainedIPv4  uint64 `json:"gained_ipv4"`
+	GainedIPv6  string `json:"gained_ipv6"`
+	LostIPv4    uint64 `json:"lost_ipv4"`
+	LostIPv6    string `json:"lost_ipv6"`
+}
+
+// diffCountryChangeDTO - Network answered with another country code.
+type diffCountryChangeDTO struct {
+	Network string `json:"network"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+}
+
+// diffASChangeDTO - Network answered with another AS number.
+type diffASChangeDTO struct {
+	Network string `json:"network"`
+	From    int32  `json:"from"`
+	To      int32  `json:"to"`
+}
+
+// diffDTO - JSON output of the diff command.
+type diffDTO struct {
+	OldSpace        diffSpaceDTO           `json:"old_space"`
+	NewSpace        diffSpaceDTO           `json:"new_space"`
+	Added           diffSpaceDTO           `json:"added"`
+	Removed         diffSpaceDTO           `json:"removed"`
+	CountryMoved    diffSpaceDTO           `json:"country_moved"`
+	ASMoved         diffSpaceDTO           `json:"asn_moved"`
+	Countries       []diffCountryDTO       `json:"countries"`
+	AddedPrefixes   []string               `json:"added_prefixes"`
+	RemovedPrefixes []string               `json:"removed_prefixes"`
+	CountryChanges  []diffCountryChangeDTO `json:"country_changes"`
+	ASChanges       []diffASChangeDTO      `json:"asn_changes"`
+	Truncated       bool                   `json:"truncated"`
+	Exceeded        []string               `json:"thresholds_exceeded"`
+}
+
+func writeDiffJSON(w io.Writer, d model.BaseDiff, exceeded []error) error {
+	space := func(s model.AddressSpace) diffSpaceDTO {
+		v4, v6 := ipbaseProvide.DiffShares(s, d.OldSpace)
+		return diffSpaceDTO{
+			Prefixes:      s.Prefixes,
+			IPv4Addresses: s.IPv4,
+			IPv6Addresses: bigString(s.IPv6),
+			IPv4Share:     finiteShare(v4),
+			IPv6Share:     finiteShare(v6),
+		}
+	}
+
+	dto := diffDTO{
+		OldSpace:        space(d.OldSpace),
+		NewSpace:        space(d.NewSpace),
+		Added:           space(d.Added),
+		Removed:         space(d.Removed),
+		CountryMoved:    space(d.CountryMoved),
+		ASMoved:         space(d.ASMoved),
+		Countries:       make([]diffCountryDTO, 0, len(d.Countries)),
+		AddedPrefixes:   prefixStrings(d.AddedPrefixes),
+		RemovedPrefixes: prefixStrings(d.RemovedPrefixes),
+		CountryChanges:  make([]diffCountryChangeDTO, 0, len(d.CountryChanges)),
+		ASChanges:       make([]diffASChangeDTO, 0, len(d.ASChanges)),
+		Truncated:       d.Truncated,
+		Exceeded:        make([]string, 0, len(exceeded)),
+	}
+
+	for _, e := range exceeded {
+		dto.Exceeded = append(dto.Exceeded, e.Error())
+	}
+	for _, c := range d.Countries {
+		dto.Countries = append(dto.Countries, diffCountryDTO{
+			CountryCode: c.CountryCode.String(),
+			GainedIPv4:  c.Gained.IPv4,
+			GainedIPv6:  bigString(c.Gained.IPv6),
+			LostIPv4:    c.Lost.IPv4,
+			LostIPv6:    bigString(c.Lost.IPv6),
+		})
+	}
+	for _, c := range d.CountryChanges {
+		dto.CountryChanges = append(dto.CountryChanges, diffCountryChangeDTO{
+			Network: c.Network.String(),
+			From:    c.From.String(),
+			To:      c.To.String(),
+		})
+	}
+	for _, c := range d.ASChanges {
+		dto.ASChanges = append(dto.ASChanges, diffASChangeDTO{
+			Network: c.Network.String(),
+			From:    c.From,
+			To:      c.To,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(dto)
+}
+
+// diffTextCountries - Number of countries listed by the text summary.
+const diffTextCountries = 20
+
+func writeDiffText(w io.Writer, d model.BaseDiff, exceeded []error) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "\tprefixes\tIPv4\tIPv6\tIPv4 share\tIPv6 share")
+	for _, row := range []struct {
+		name  string
+		space model.AddressSpace
+	}{
+		{"old", d.OldSpace},
+		{"new", d.NewSpace},
+		{"added", d.Added},
+		{"removed", d.Removed},
+		{"country moved", d.CountryMoved},
+		{"AS moved", d.ASMoved},
+	} {
+		v4, v6 := ipbaseProvide.DiffShares(row.space, d.OldSpace)
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%.4f\t%.4f\n",
+			row.name, row.space.Prefixes, row.space.IPv4, bigString(row.space.IPv6), v4, v6)
+	}
+
+	if len(d.Countries) > 0 {
+		fmt.Fprintln(tw, "\ncountry\tgained IPv4\tgained IPv6\tlost IPv4\tlost IPv6\t")
+		for i, c := range d.Countries {
+			if i == diffTextCountries {
+				fmt.Fprintf(tw, "... %d more\n", len(d.Countries)-i)
+				break
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t%s\t\n",
+				countryLabel(c.CountryCode), c.Gained.IPv4, bigString(c.Gained.IPv6), c.Lost.IPv4, bigString(c.Lost.IPv6))
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	writePrefixList(w, "added", d.AddedPrefixes)
+	writePrefixList(w, "removed", d.RemovedPrefixes)
+
+	if len(d.CountryChanges) > 0 {
+		fmt.Fprintln(w, "\ncountry changes:")
+		for _, c := range d.CountryChanges {
+			fmt.Fprintf(w, "  %s %s -> %s\n", c.Network, countryLabel(c.From), countryLabel(c.To))
+		}
+	}
+	if len(d.ASChanges) > 0 {
+		fmt.Fprintln(w, "\nAS changes:")
+		for _, c := range d.ASChanges {
+			fmt.Fprintf(w, "  %s AS%d -> AS%d\n", c.Network, c.From, c.To)
+		}
+	}
+	if d.Truncated {
+		fmt.Fprintln(w, "\nlists are truncated, raise --limit to list more")
+	}
+
+	if len(exceeded) > 0 {
+		fmt.Fprintln(w, "\nthresholds exceeded:")
+		for _, e := range exceeded {
+			fmt.Fprintf(w, "  %s\n", e)
+		}
+	}
+	return nil
+}
+
+func writePrefixList(w io.Writer, name string, prefixes []netip.Prefix) {
+	if len(prefixes) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n%s prefixes:\n", name)
+	for _, p := range prefixes {
+		fmt.Fprintf(w, "  %s\n", p)
+	}
+}
+
+func countryLabel(cc model.GeoCode) string {
+	if cc == "" {
+		return "-"
+	}
+	return cc.String()
+}
+
+func prefixStrings(prefixes []netip.Prefix) []string {
+	s := make([]string, 0, len(prefixes))
+	for _, p := range prefixes {
+		s = append(s, p.String())
+	}
+	return s
+}
+
+func bigString(n *big.Int) string {
+	if n == nil {
+		return "0"
+	}
+	return n.String()
+}
+
+// finiteShare returns nil for the infinite share of a change of an empty old space, JSON has no infinity.
+func finiteShare(f float64) *float64 {
+	if math.IsInf(f, 0) {
+		return nil
+	}
+	return &f
+}
@@ -1,15 +1,16 @@
 package ipcsv2base
 
 import (
+	"cmp"
+	"context"
+	"errors"
 	"time"
 
 	"github.com/eterline/ipcsv2base/internal/config"
-	ipbaseProvide "github.com/eterline/ipcsv2base/internal/infra/ipbase"
 	"github.com/eterline/ipcsv2base/internal/interface/http/api"
 	"github.com/eterline/ipcsv2base/internal/interface/http/baseapi"
 	"github.com/eterline/ipcsv2base/internal/interface/http/server"
 	"github.com/eterline/ipcsv2base/internal/model"
-	"github.com/eterline/ipcsv2base/internal/service/ipbase"
 	"github.com/eterline/ipcsv2base/pkg/toolkit"
 	"github.com/go-chi/chi/v5"
 )
@@ -26,59 +27,33 @@ func Execute(root *toolkit.AppStarter, log model.Logger, flags InitFlags, cfg co
 
 	// ========================================================
 
-	log.Info("setup IP base initialization")
-	startInit := time.Now()
-
-	// TODO: registry factory later...
-
-	type Base interface {
-		ipbase.MetaLookuper
-		Size() int
-	}
-
-	var lookuper Base
-
-	switch {
-	case len(cfg.CountryTSV) > 0:
-		log.Info(
-			"loading CSV files",
-			model.FieldStringJoin("tsv_files", ", ", cfg.CountryTSV...),
-		)
-
-		base, err := ipbaseProvide.NewRegistryIPTSV(ctx, cfg.CountryTSV...)
-		if err != nil {
-			log.Error("failed to prepare IP base", model.FieldError(err))
-			root.MustStopApp(1)
+	sets := append([]config.Dataset{{
+		Name:      cfg.DatasetName,
+		Base:      cfg.Base,
+		Snapshots: cfg.Snapshots,
+	}}, cfg.DatasetList...)
+	defaultSet := cmp.Or(cfg.DefaultDataset, cfg.DatasetName)
+
+	served := make([]baseapi.Dataset, 0, len(sets))
+	for _, set := range sets {
+		baseHandlers, closeSet, err := openDataset(root, log.With(model.FieldString("dataset", set.Name)), set)
+		if errors.Is(err, context.Canceled) {
+			log.Info("ip base loading cancelled")
+			return
 		}
-		lookuper = base
-
-	case cfg.CountryCSV != "" && cfg.AsnCSV != "":
-		log.Info(
-			"loading CSV files",
-			model.FieldString("ip_version", cfg.Base.IPver),
-			model.FieldString("asn_base", cfg.AsnCSV),
-			model.FieldString("country_base", cfg.CountryCSV),
-		)
-
-		base, err := ipbaseProvide.NewRegistryIP(ctx, cfg.CountryCSV, cfg.AsnCSV, ipbaseProvide.IPVersionStr(cfg.IPver))
 		if err != nil {
-			log.Fatal("failed to prepare IP base", model.FieldError(err))
+			log.Fatal("failed to prepare IP base", model.FieldString("dataset", set.Name), model.FieldError(err))
 		}
-		lookuper = base
+		defer closeSet()
 
-	default:
-		log.Fatal("base did not prepared")
+		served = append(served, baseapi.Dataset{
+			Name:        set.Name,
+			Description: set.Description,
+			Default:     set.Name == defaultSet,
+			Handlers:    baseHandlers,
+		})
 	}
-
-	log.Info(
-		"ip base loaded successfully",
-		model.Field("base_records", lookuper.Size()),
-		model.Field("initialization_time_ms", time.Since(startInit).Milliseconds()),
-	)
-
-	baseSrvc := ipbase.NewIPBaseService(log, lookuper, &ipbaseProvide.IPbaseCacheMock{})
-	baseHandlers := baseapi.NewBaseAPIHandlerGroup(log, baseSrvc, true)
-	log.Info("base API handler group created")
+	log.Info("base API handler groups created", model.Field("datasets", len(served)))
 
 	// ========================================================
 
@@ -86,15 +61,20 @@ func Execute(root *toolkit.AppStarter, log model.Logger, flags InitFlags, cfg co
 	rootMux.NotFound(api.HandleNotFound)
 	rootMux.MethodNotAllowed(api.HandleNotAllowedMethod)
 
-	// Types usage description
-	rootMux.Get("/types", baseHandlers.AvailableTypes())
+	// Served datasets with their freshness and size
+	rootMux.Get("/datasets", baseapi.DatasetsHandler(served))
 
-	rootMux.Route("/lookup", func(r chi.Router) {
-		// Lookup by IP, path parameter or fallback to request IP
-		r.Get("/ip/{ip}", baseHandlers.LookupIPHandler)
-		r.Get("/ip/", baseHandlers.LookupIPHandler) // fallback: extract IP from request
-		r.Get("/ip", baseHandlers.LookupIPHandler)  // fallback: extract IP from request
-	})
+	for _, set := range served {
+		// Every dataset under its name, the default one also at the root
+		rootMux.Route("/datasets/"+set.Name, func(r chi.Router) {
+			baseRoutes(r, set.Handlers)
+		})
+		if set.Default {
+			// Types usage description
+			rootMux.Get("/types", set.Handlers.AvailableTypes())
+			baseRoutes(rootMux, set.Handlers)
+		}
+	}
 
 	{
 		srv := server.NewServer(
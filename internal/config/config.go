@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"time"
 
 	"github.com/alexflint/go-arg"
 	"github.com/eterline/ipcsv2base/pkg/validate"
@@ -35,10 +37,48 @@ type (
 	}
 
 	Base struct {
-		CountryTSV []string `arg:"--country-tsvs" help:"Path to the country TSV files"`
-		CountryCSV string   `arg:"--country-csv" help:"Path to the country CSV file"`
-		AsnCSV     string   `arg:"--asn-csv" help:"Path to the ASN CSV file"`
-		IPver      string   `arg:"--ip-ver" help:"IP version in base selector: all|v4|v6" validate:"oneof=all v4 v6"`
+		CountryTSV []string      `arg:"--country-tsvs" help:"Path to the country TSV files"`
+		CountryCSV string        `arg:"--country-csv" help:"Path to the country CSV file"`
+		AsnCSV     string        `arg:"--asn-csv" help:"Path to the ASN CSV file"`
+		GeoLite2   []string      `arg:"--geolite2" help:"Path to the MaxMind GeoLite2 CSV bundles (directories or zip archives)"`
+		GeoLang    string        `arg:"--geolite2-lang" help:"GeoLite2 locations language" validate:"required_with=GeoLite2"`
+		IP2LocGeo  []string      `arg:"--ip2location-csv" help:"Path to the IP2Location geo CSV files (DB1, DB3 and wider layouts)"`
+		IP2LocASN  []string      `arg:"--ip2location-asn-csv" help:"Path to the IP2Location ASN CSV files"`
+		DBIPGeo    []string      `arg:"--dbip-csv" help:"Path to the DB-IP country or city CSV files"`
+		DBIPASN    []string      `arg:"--dbip-asn-csv" help:"Path to the DB-IP ASN CSV files"`
+		SchemaFile string        `arg:"--schema-file" help:"Path to the JSON file mapping CSV sources to schemas"`
+		IPver      string        `arg:"--ip-ver" help:"IP version in base selector: all|v4|v6" validate:"oneof=all v4 v6"`
+		Precedence []string      `arg:"--precedence" help:"Composed sources precedence rules, space separated: field=source1,source2; field is geo, asn or a single field, sources are tsv, csv, geolite2, ip2location, dbip, schema"`
+		Strict     bool          `arg:"--strict" help:"Fail the base load on any rejected row"`
+		MaxSkip    float64       `arg:"--max-skip-rate" help:"Fail the base load when rejected rows of a source exceed this share: 0..1, 0 disables" validate:"gte=0,lte=1"`
+		Workers    int           `arg:"--load-workers" help:"Number of files and file parts parsed concurrently, 0 uses all CPUs" validate:"gte=0"`
+		Progress   int           `arg:"--load-progress" help:"Base load progress logging interval in seconds, 0 disables" validate:"gte=0"`
+		Manifest   string        `arg:"--manifest" help:"Path to the SHA-256 manifest of the base files" validate:"required_with=RequireSig"`
+		Signature  string        `arg:"--manifest-sig" help:"Path to the detached manifest signature, defaults to the manifest path with .sig suffix"`
+		PubKey     string        `arg:"--pubkey" help:"Path to the ed25519 public key (PEM) verifying the manifest signature" validate:"required_with=Manifest"`
+		RequireSig bool          `arg:"--require-signed" help:"Refuse to load base files failing the signed manifest check"`
+		Index      string        `arg:"--lookup-index" help:"Lookup structure of the base ranges: sorted|poptrie, poptrie speeds up IPv4 lookups and uses more memory, IPv6 lookups always use sorted ranges as a trie of them was slower and three times larger; both answer alike" validate:"oneof=sorted poptrie"`
+		MmapBase   string        `arg:"--mmap-base" help:"Path to a compiled base file served from a memory mapping instead of loading sources, written by the compile command"`
+		MmapAdvice string        `arg:"--mmap-advice" help:"Access pattern hint of the mapped base: normal|random|sequential|willneed" validate:"oneof=normal random sequential willneed"`
+		ExplainRow bool          `arg:"--explain-rows" help:"Keep the source file row of every base range for explained lookups, costs memory"`
+		MaxAge     time.Duration `arg:"--max-age" help:"Maximum age of the base data, e.g. 720h, older data is reported stale: 0 disables" validate:"gte=0"`
+		Overlay    string        `arg:"--overlay" help:"Path to the YAML or CSV overlay of annotated networks (labels, owner, country override, tags)"`
+		OverlayRe  int           `arg:"--overlay-reload" help:"Overlay file change check interval in seconds, 0 disables reloading" validate:"gte=0"`
+		FlagLists  []string      `arg:"--flag-lists" help:"Network flag list files of IPs, CIDRs or the Tor exit list, space separated: category[:name]=file; category is tor, vpn, proxy or hosting, name defaults to the file name"`
+		FlagListRe int           `arg:"--flag-lists-reload" help:"Flag list files change check interval in seconds, each list reloads on its own: 0 disables reloading" validate:"gte=0"`
+		BlockDir   string        `arg:"--blocklists-dir" help:"Directory of IP blocklists in FireHOL netset or Spamhaus DROP formats, every file is a list named by the file name"`
+		BlockDirRe int           `arg:"--blocklists-reload" help:"Blocklists directory change check interval in seconds, new, changed and removed files are applied: 0 disables reloading" validate:"gte=0"`
+	}
+
+	Snapshots struct {
+		SnapshotDir    string `arg:"--snapshots-dir" help:"Directory of compiled base files of past versions, keyed by their build date and answering lookups with ?at="`
+		SnapshotBudget int    `arg:"--snapshots-budget" help:"Mapped size in MB of past versions kept open between lookups, least recently used ones are unmapped beyond it" validate:"gte=0"`
+	}
+
+	Datasets struct {
+		DatasetsFile   string `arg:"--datasets" help:"Path to the YAML file of named datasets served next to the base flags dataset, each with its own base flags"`
+		DatasetName    string `arg:"--dataset-name" help:"Name of the dataset configured by the base flags" validate:"required"`
+		DefaultDataset string `arg:"--default-dataset" help:"Dataset served by the routes without the /datasets/{name} prefix, defaults to the base flags dataset"`
 	}
 
 	Configuration struct {
@@ -46,6 +86,9 @@ type (
 		Log
 		Server
 		Base
+		Snapshots
+		Datasets
+		DatasetList []Dataset `arg:"-" validate:"-"` // datasets of the datasets file, loaded by ParseArgs
 	}
 )
 
@@ -58,7 +101,11 @@ var (
 	}
 )
 
+// ParseArgs - Parses and validates the configuration, c holds the defaults.
+// Datasets of the datasets file are parsed from the same defaults.
 func ParseArgs(c *Configuration) error {
+	defaults := *c
+
 	p, err := arg.NewParser(parserConfig, c)
 	if err != nil {
 		return err
@@ -70,7 +117,35 @@ func ParseArgs(c *Configuration) error {
 		os.Exit(1)
 	}
 
-	if err := val.Struct(c); err != nil {
+	if err != nil {
+		return err
+	}
+
+	if err := Validate(c); err != nil {
+		return err
+	}
+
+	if !datasetName.MatchString(c.DatasetName) {
+		return fmt.Errorf("invalid dataset name %q, expected lowercase letters, digits, - and _", c.DatasetName)
+	}
+	if c.DatasetsFile != "" {
+		c.DatasetList, err = LoadDatasets(c.DatasetsFile, defaults, c.DatasetName)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.DefaultDataset != "" && c.DefaultDataset != c.DatasetName &&
+		!slices.ContainsFunc(c.DatasetList, func(d Dataset) bool { return d.Name == c.DefaultDataset }) {
+		return fmt.Errorf("default dataset %s is not configured", c.DefaultDataset)
+	}
+
+	return nil
+}
+
+// Validate - Checks tagged fields of a parsed configuration or of a command arguments struct embedding its parts.
+func Validate(v any) error {
+	if err := val.Struct(v); err != nil {
 		switch errs := err.(type) {
 		case validator.ValidationErrors:
 			wrapped := validate.NewValidationErrorWrapper()
@@ -84,7 +159,7 @@ func ParseArgs(c *Configuration) error {
 		}
 	}
 
-	return err
+	return nil
 }
 
 func selfExec() string {
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/alexflint/go-arg"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+Dataset - Named IP base served next to the base configured by flags.
+
+	Datasets are listed in a YAML file, every dataset sets its base with
+	the command line flags of the base, starting from their defaults:
+
+		datasets:
+		  - name: commercial
+		    description: Licensed GeoIP2 for fraud checks
+		    args: [--geolite2, /data/geoip2.zip, --max-age, 720h]
+*/
+type Dataset struct {
+	Name        string
+	Description string
+	Base
+	Snapshots
+}
+
+// datasetEntry - Dataset as written in the datasets file.
+type datasetEntry struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Args        []string `yaml:"args"`
+}
+
+// datasetArgs - Flags parsed from the args of a dataset.
+type datasetArgs struct {
+	Base
+	Snapshots
+}
+
+// datasetName - Dataset names are used as URL path segments.
+var datasetName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// LoadDatasets - Reads the datasets file, dataset args start from the defaults.
+// reserved is the name of the dataset configured by flags.
+func LoadDatasets(path string, defaults Configuration, reserved string) ([]Dataset, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read datasets file: %w", err)
+	}
+
+	var file struct {
+		Datasets []datasetEntry `yaml:"datasets"`
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("failed to parse datasets file: %w", err)
+	}
+
+	names := map[string]struct{}{reserved: {}}
+	sets := make([]Dataset, 0, len(file.Datasets))
+	for i, e := range file.Datasets {
+		if !datasetName.MatchString(e.Name) {
+			return nil, fmt.Errorf("dataset %d: invalid name %q, expected lowercase letters, digits, - and _", i+1, e.Name)
+		}
+		if _, ok := names[e.Name]; ok {
+			return nil, fmt.Errorf("dataset %s: duplicate name", e.Name)
+		}
+		names[e.Name] = struct{}{}
+
+		a := datasetArgs{Base: defaults.Base, Snapshots: defaults.Snapshots}
+		p, err := arg.NewParser(arg.Config{Program: "dataset " + e.Name, IgnoreEnv: true}, &a)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.Parse(e.Args); err != nil {
+			if errors.Is(err, arg.ErrHelp) {
+				err = errors.New("help is not a dataset argument")
+			}
+			return nil, fmt.Errorf("dataset %s: %w", e.Name, err)
+		}
+		if err := Validate(&a); err != nil {
+			return nil, fmt.Errorf("dataset %s: %w", e.Name, err)
+		}
+
+		sets = append(sets, Dataset{
+			Name:        e.Name,
+			Description: e.Description,
+			Base:        a.Base,
+			Snapshots:   a.Snapshots,
+		})
+	}
+	return sets, nil
+}
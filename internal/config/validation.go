@@ -5,26 +5,48 @@ import "github.com/go-playground/validator/v10"
 func baseStructValidation(sl validator.StructLevel) {
 	b := sl.Current().Interface().(Base)
 
-	hasTSV := len(b.CountryTSV) > 0
-	hasCSVPair := b.CountryCSV != "" && b.AsnCSV != ""
+	sources := 0
+	for _, has := range []bool{
+		len(b.CountryTSV) > 0,
+		b.CountryCSV != "" && b.AsnCSV != "",
+		len(b.GeoLite2) > 0,
+		len(b.IP2LocGeo) > 0 || len(b.IP2LocASN) > 0,
+		len(b.DBIPGeo) > 0 || len(b.DBIPASN) > 0,
+		b.SchemaFile != "",
+	} {
+		if has {
+			sources++
+		}
+	}
 
 	switch {
-	case hasTSV && hasCSVPair:
+	case b.MmapBase != "" && sources > 0:
+		// a compiled base is served alone, it is not composed with loaded sources
 		sl.ReportError(
-			b.CountryTSV,
-			"CountryTSV",
-			"country-tsvs",
-			"mutuallyexclusive",
-			"",
+			b.MmapBase,
+			"MmapBase",
+			"mmap-base",
+			"excluded_with",
+			"base sources",
+		)
+
+	case sources > 0 && (b.CountryCSV != "") != (b.AsnCSV != ""):
+		// a lone country or ASN CSV would be silently dropped from the composition
+		sl.ReportError(
+			b.CountryCSV,
+			"CountryCSV",
+			"country-csv",
+			"required_with",
+			"asn-csv",
 		)
 
-	case !hasTSV && !hasCSVPair:
+	case sources == 0 && b.MmapBase == "":
 		sl.ReportError(
 			b.CountryTSV,
 			"CountryTSV",
 			"country-tsvs",
 			"required",
-			"country-tsvs or (country-csv + asn-csv)",
+			"country-tsvs or (country-csv + asn-csv) or geolite2 or ip2location-csv or dbip-csv or schema-file or mmap-base",
 		)
 	}
 }
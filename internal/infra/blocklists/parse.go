@@ -0,0 +1,106 @@
+package blocklists
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/eterline/ipcsv2base/internal/infra/listfile"
+	"github.com/eterline/ipcsv2base/pkg/ipsetdata"
+)
+
+// Blocklist file formats.
+const (
+	FormatNetset   = "netset"    // FireHOL netset and ipset, '#' comments
+	FormatDROP     = "drop"      // Spamhaus DROP text, ';' comments holding SBL ids
+	FormatDROPJSON = "drop-json" // Spamhaus DROP JSON lines with cidr and sblid
+)
+
+// listedNetworks - Disjoint networks of a blocklist with the comments of their entries.
+type listedNetworks = ipsetdata.IPContainerSet[string]
+
+// parsedList - Blocklist file contents.
+type parsedList struct {
+	nets        *listedNetworks
+	format      string
+	description string
+	entries     int
+}
+
+// dropRecord - Line of the Spamhaus DROP JSON format, the last line holds the list metadata.
+type dropRecord struct {
+	Type  string `json:"type"`
+	CIDR  string `json:"cidr"`
+	SBLID string `json:"sblid"`
+}
+
+/*
+parseFile - Reads a blocklist file of addresses, networks and ranges.
+
+	Every line holds an IP address, a CIDR network or a start-end range,
+	text after '#' or ';' is a comment. A comment on the line of an entry
+	is the entry comment, e.g. the SBL id of "1.10.16.0/20 ; SBL256894",
+	the first header comment describes the list. Lines starting with '{'
+	are read as Spamhaus DROP JSON records. Nested entries keep the comment
+	of the narrowest one.
+*/
+func parseFile(file string) (parsedList, error) {
+	var (
+		pl        = parsedList{format: FormatNetset}
+		raw       = ipsetdata.NewIPContainerSet[string](0)
+		semicolon bool
+		jsonLines bool
+	)
+
+	err := listfile.ReadLines(file, func(ln listfile.Line) error {
+		entry, comment := ln.Entry, ln.Comment
+		if strings.HasPrefix(ln.Text, "{") {
+			var rec dropRecord
+			if err := json.Unmarshal([]byte(ln.Text), &rec); err != nil {
+				return fmt.Errorf("blocklist %s line %d: %w", file, ln.Num, err)
+			}
+			if rec.Type == "metadata" {
+				return nil
+			}
+			jsonLines = true
+			entry, comment = rec.CIDR, rec.SBLID
+		} else {
+			semicolon = semicolon || ln.Marker == ';'
+		}
+
+		if entry == "" {
+			if pl.entries == 0 && pl.description == "" {
+				pl.description = strings.TrimSpace(strings.TrimLeft(comment, "#;"))
+			}
+			return nil
+		}
+
+		rng, err := ipsetdata.ParseRange(entry)
+		if err != nil {
+			return fmt.Errorf("blocklist %s line %d: %w", file, ln.Num, err)
+		}
+		raw.AddIPRange(rng, comment)
+		pl.entries++
+		return nil
+	})
+	if err != nil {
+		return parsedList{}, err
+	}
+
+	switch {
+	case jsonLines:
+		pl.format = FormatDROPJSON
+	case semicolon:
+		pl.format = FormatDROP
+	}
+
+	// overlapping entries are split, so every lookup resolves to a single range
+	raw.Prepare()
+	pl.nets = ipsetdata.NewIPContainerSet[string](raw.Size())
+	for rng, comment := range raw.Segments() {
+		pl.nets.AddIPRange(rng, comment)
+	}
+	pl.nets.Prepare()
+
+	return pl, nil
+}
@@ -0,0 +1,81 @@
+package blocklists
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		format      string
+		description string
+		entries     int
+		ranges      int
+		lookups     map[string]string // address to the comment of its entry, missing addresses map to "-"
+		wantErr     bool
+	}{
+		{
+			name: "FireHOL netset",
+			data: "#\n# firehol_level1\n#\n# Maintainer: FireHOL\n0.0.0.0/8\n1.10.16.0/20\n5.0.0.1\n10.0.0.0-10.0.0.9 # range\n",
+			// the first comment with text describes the list
+			format: FormatNetset, description: "firehol_level1", entries: 4, ranges: 4,
+			lookups: map[string]string{"1.10.20.1": "", "5.0.0.1": "", "10.0.0.9": "range", "10.0.0.10": "-"},
+		},
+		{
+			name:   "Spamhaus DROP text",
+			data:   "; Spamhaus DROP List 2026/10/18\n; Last-Modified: Sat, 18 Oct 2026\n1.10.16.0/20 ; SBL256894\n2.56.192.0/22 ; SBL459831\n",
+			format: FormatDROP, description: "Spamhaus DROP List 2026/10/18", entries: 2, ranges: 2,
+			lookups: map[string]string{"1.10.16.1": "SBL256894", "2.56.195.255": "SBL459831", "2.56.196.0": "-"},
+		},
+		{
+			name: "Spamhaus DROP JSON",
+			data: `{"cidr":"1.10.16.0/20","sblid":"SBL256894","rir":"apnic"}` + "\n" +
+				`{"cidr":"2001:db8::/32","sblid":"SBL1"}` + "\n" +
+				`{"type":"metadata","timestamp":1760745600,"size":2,"records":2}` + "\n",
+			format: FormatDROPJSON, entries: 2, ranges: 2,
+			lookups: map[string]string{"1.10.16.1": "SBL256894", "2001:db8::1": "SBL1", "2001:db9::": "-"},
+		},
+		{
+			name:   "nested entries keep the narrowest comment",
+			data:   "10.0.0.0/8 ; outer\n10.1.0.0/16 ; inner\n",
+			format: FormatDROP, entries: 2, ranges: 3,
+			lookups: map[string]string{"10.0.0.1": "outer", "10.1.2.3": "inner", "10.2.0.0": "outer"},
+		},
+		{name: "invalid entry", data: "1.10.16.0/20\nnot-an-address\n", wantErr: true},
+		{name: "invalid JSON", data: `{"cidr":` + "\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		file := filepath.Join(t.TempDir(), "list.txt")
+		if err := os.WriteFile(file, []byte(tt.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		pl, err := parseFile(file)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+
+		if pl.format != tt.format || pl.description != tt.description || pl.entries != tt.entries || pl.nets.Size() != tt.ranges {
+			t.Errorf("%s: format %q, description %q, %d entries, %d ranges; want %q, %q, %d, %d",
+				tt.name, pl.format, pl.description, pl.entries, pl.nets.Size(), tt.format, tt.description, tt.entries, tt.ranges)
+		}
+
+		for addr, want := range tt.lookups {
+			_, comment, ok := pl.nets.Get(netip.MustParseAddr(addr))
+			if !ok {
+				comment = "-"
+			}
+			if comment != want {
+				t.Errorf("%s: comment of %s = %q, want %q", tt.name, addr, comment, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package blocklists
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/eterline/ipcsv2base/internal/infra/listfile"
+	"github.com/eterline/ipcsv2base/internal/model"
+)
+
+/*
+Store - Hot reloadable blocklists of a directory, one list per file.
+
+	Every file of the directory is a list named by the file name without its
+	extension, hidden files are ignored. Run rescans the directory: new files
+	are loaded, changed ones reloaded and lists of removed files dropped.
+	A failed reload keeps serving the previous networks of the list.
+*/
+type Store struct {
+	log    model.Logger
+	dir    string
+	lists  atomic.Pointer[[]*list]  // sorted by name, replaced as a whole
+	failed map[string]listfile.Stat // broken revisions by file, owned by Run
+}
+
+// list - Blocklist loaded from a file, immutable once loaded.
+type list struct {
+	info model.Blocklist
+	nets *listedNetworks
+	stat listfile.Stat
+}
+
+// NewStore - Loads every blocklist file of dir, any broken file fails it.
+func NewStore(log model.Logger, dir string) (*Store, error) {
+	s := &Store{
+		log:    log,
+		dir:    dir,
+		failed: map[string]listfile.Stat{},
+	}
+
+	lists, err := s.scan(true)
+	if err != nil {
+		return nil, err
+	}
+	s.lists.Store(&lists)
+	return s, nil
+}
+
+// LookupListings - Returns an entry of every list holding addr, nil without a match.
+func (s *Store) LookupListings(addr netip.Addr) []model.IPListing {
+	var listed []model.IPListing
+	for _, l := range *s.lists.Load() {
+		if listing, ok := l.check(addr); ok {
+			listed = append(listed, listing)
+		}
+	}
+	return listed
+}
+
+// CheckList - Returns the entry of the named list holding addr, model.ErrNoBlocklist for unknown lists.
+func (s *Store) CheckList(name string, addr netip.Addr) (model.IPListing, bool, error) {
+	lists := *s.lists.Load()
+	i, ok := slices.BinarySearchFunc(lists, name, func(l *list, name string) int {
+		return strings.Compare(l.info.Name, name)
+	})
+	if !ok {
+		return model.IPListing{}, false, fmt.Errorf("%w: %s", model.ErrNoBlocklist, name)
+	}
+
+	listing, listed := lists[i].check(addr)
+	return listing, listed, nil
+}
+
+// Lists - Returns the loaded lists sorted by name.
+func (s *Store) Lists() []model.Blocklist {
+	lists := *s.lists.Load()
+	out := make([]model.Blocklist, len(lists))
+	for i, l := range lists {
+		out[i] = l.info
+	}
+	return out
+}
+
+// Size - Returns the number of listed ranges of all lists.
+func (s *Store) Size() (n int) {
+	for _, l := range *s.lists.Load() {
+		n += l.info.Ranges
+	}
+	return n
+}
+
+// Run - Rescans the directory every interval until ctx is done.
+func (s *Store) Run(ctx context.Context, every time.Duration) {
+	listfile.RunEvery(ctx, every, func() {
+		lists, err := s.scan(false)
+		if err != nil {
+			s.log.Error("blocklists check failed", model.FieldString("dir", s.dir), model.FieldError(err))
+			return
+		}
+		s.lists.Store(&lists)
+	})
+}
+
+/*
+scan - Reads the directory into lists, unchanged files keep their loaded list.
+
+	In strict mode any broken file fails the scan, otherwise it is logged once
+	per revision and its previous list, if any, is kept.
+*/
+func (s *Store) scan(strict bool) ([]*list, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blocklists directory: %w", err)
+	}
+
+	present := make(map[string]struct{}, len(entries))
+	for _, e := range entries {
+		present[filepath.Join(s.dir, e.Name())] = struct{}{}
+	}
+
+	// loaded lists keep their names over new files of the same name
+	current := map[string]*list{}
+	names := make(map[string]string, len(entries)) // list name to its file
+	if p := s.lists.Load(); p != nil {
+		for _, l := range *p {
+			current[l.info.File] = l
+			if _, ok := present[l.info.File]; ok {
+				names[l.info.Name] = l.info.File
+			}
+		}
+	}
+
+	lists := make([]*list, 0, len(entries))
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+
+		file := filepath.Join(s.dir, e.Name())
+		st, err := os.Stat(file)
+		if err != nil || !st.Mode().IsRegular() {
+			continue
+		}
+		stat := listfile.StatOf(st)
+
+		name := strings.TrimSuffix(e.Name(), filepath.Ext(e.Name()))
+		old := current[file]
+		if other, ok := names[name]; ok && other != file {
+			old = nil // the name is held by a loaded list or a file sorted before
+			err = fmt.Errorf("blocklist %s: name %s is taken by %s", file, name, other)
+		} else if old != nil && old.stat == stat {
+			lists = append(lists, old)
+			names[name] = file
+			continue
+		} else {
+			var l *list
+			l, err = loadList(name, file, stat)
+			if err == nil {
+				delete(s.failed, file)
+				s.logLoaded(l, old != nil)
+				lists = append(lists, l)
+				names[name] = file
+				continue
+			}
+		}
+
+		if strict {
+			return nil, err
+		}
+		if failed, ok := s.failed[file]; !ok || failed != stat {
+			s.failed[file] = stat
+			msg := "blocklist load failed"
+			if old != nil {
+				msg = "blocklist reload failed, previous list is kept"
+			}
+			s.log.Error(msg, model.FieldString("file", file), model.FieldError(err))
+		}
+		if old != nil {
+			lists = append(lists, old)
+			names[name] = file
+		}
+	}
+
+	for _, l := range lists {
+		delete(current, l.info.File)
+	}
+	for file, l := range current {
+		s.log.Info("blocklist removed", model.FieldString("list", l.info.Name), model.FieldString("file", file))
+	}
+	for file := range s.failed {
+		if _, ok := present[file]; !ok {
+			delete(s.failed, file)
+		}
+	}
+
+	slices.SortFunc(lists, func(a, b *list) int {
+		return strings.Compare(a.info.Name, b.info.Name)
+	})
+	return lists, nil
+}
+
+func (s *Store) logLoaded(l *list, reloaded bool) {
+	msg := "blocklist loaded"
+	if reloaded {
+		msg = "blocklist reloaded"
+	}
+	s.log.Info(
+		msg,
+		model.FieldString("list", l.info.Name),
+		model.FieldString("format", l.info.Format),
+		model.Field("entries", l.info.Entries),
+		model.Field("ranges", l.info.Ranges),
+	)
+}
+
+// loadList reads a blocklist file of the given stat.
+func loadList(name, file string, stat listfile.Stat) (*list, error) {
+	pl, err := parseFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return &list{
+		info: model.Blocklist{
+			Name:        name,
+			File:        file,
+			Format:      pl.format,
+			Description: pl.description,
+			Entries:     pl.entries,
+			Ranges:      pl.nets.Size(),
+			ModTime:     stat.ModTime(),
+			LoadedAt:    time.Now(),
+		},
+		nets: pl.nets,
+		stat: stat,
+	}, nil
+}
+
+// check returns the entry holding addr.
+func (l *list) check(addr netip.Addr) (model.IPListing, bool) {
+	pfx, comment, ok := l.nets.Get(addr)
+	if !ok {
+		return model.IPListing{}, false
+	}
+	return model.IPListing{List: l.info.Name, Network: pfx, Comment: comment}, true
+}
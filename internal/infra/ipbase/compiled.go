@@ -0,0 +1,310 @@
+package ipbase
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/eterline/ipcsv2base/internal/model"
+	"github.com/eterline/ipcsv2base/pkg/ipsetdata"
+)
+
+/*
+Compiled base file layout, all integers little endian:
+
+	header     64 bytes
+	v4 ranges  16 bytes each: start, end (uint32), country, as (1-based record index, 0 for none)
+	v6 ranges  40 bytes each: start, end (16 bytes big endian), country, as
+	countries  64 bytes each: 7 string refs, flags, padding
+	ASes       40 bytes each: number, 4 string refs, padding
+	strings    deduplicated string blob, a string ref is offset and length (uint32)
+
+	Ranges are disjoint and sorted by start, so lookups are a binary search
+	over fixed width records without decoding the file.
+*/
+const (
+	compiledMagic       = "IPCBASE\x00"
+	compiledVersion     = 1
+	compiledHeaderSize  = 64
+	compiledRange4Size  = 16
+	compiledRange6Size  = 40
+	compiledCountrySize = 64
+	compiledASSize      = 40
+)
+
+// Country record flags.
+const (
+	compiledAnonymousProxy = 1 << iota
+	compiledSatelliteProvider
+)
+
+// ErrCompiledFormat - File is not a compiled base of a supported version.
+var ErrCompiledFormat = errors.New("invalid compiled base file")
+
+/*
+Compilable - Registry that can be written as a compiled base file.
+
+	The compiled base is served by RegistryMmap straight from the file.
+*/
+type Compilable interface {
+	WriteCompiled(w io.Writer) error
+}
+
+// compiledHeader - Decoded header of a compiled base file.
+type compiledHeader struct {
+	dataTime  time.Time // data time of the compiled sources, zero when unknown
+	n4, n6    int
+	countries int
+	ases      int
+	strings   int
+}
+
+// sections returns offsets of the range and record sections and of the string blob.
+func (h compiledHeader) sections() (off4, off6, offC, offA, offS, size int) {
+	off4 = compiledHeaderSize
+	off6 = off4 + h.n4*compiledRange4Size
+	offC = off6 + h.n6*compiledRange6Size
+	offA = offC + h.countries*compiledCountrySize
+	offS = offA + h.ases*compiledASSize
+	return off4, off6, offC, offA, offS, offS + h.strings
+}
+
+func (h compiledHeader) encode() []byte {
+	b := make([]byte, compiledHeaderSize)
+	copy(b, compiledMagic)
+	binary.LittleEndian.PutUint32(b[8:], compiledVersion)
+	if !h.dataTime.IsZero() {
+		binary.LittleEndian.PutUint64(b[16:], uint64(h.dataTime.Unix()))
+	}
+	binary.LittleEndian.PutUint64(b[24:], uint64(h.n4))
+	binary.LittleEndian.PutUint64(b[32:], uint64(h.n6))
+	binary.LittleEndian.PutUint32(b[40:], uint32(h.countries))
+	binary.LittleEndian.PutUint32(b[44:], uint32(h.ases))
+	binary.LittleEndian.PutUint64(b[48:], uint64(h.strings))
+	return b
+}
+
+// decodeCompiledHeader validates the header at the start of b against the file size.
+func decodeCompiledHeader(b []byte, fileSize int) (compiledHeader, error) {
+	if len(b) < compiledHeaderSize || string(b[:8]) != compiledMagic {
+		return compiledHeader{}, fmt.Errorf("%w: bad magic", ErrCompiledFormat)
+	}
+	if v := binary.LittleEndian.Uint32(b[8:]); v != compiledVersion {
+		return compiledHeader{}, fmt.Errorf("%w: unsupported version %d", ErrCompiledFormat, v)
+	}
+
+	var h compiledHeader
+	if sec := int64(binary.LittleEndian.Uint64(b[16:])); sec != 0 {
+		h.dataTime = time.Unix(sec, 0).UTC()
+	}
+
+	// counts are bounded by the file size before offsets are computed
+	n4, n6 := binary.LittleEndian.Uint64(b[24:]), binary.LittleEndian.Uint64(b[32:])
+	strs := binary.LittleEndian.Uint64(b[48:])
+	if n4 > uint64(fileSize)/compiledRange4Size || n6 > uint64(fileSize)/compiledRange6Size || strs > uint64(fileSize) {
+		return compiledHeader{}, fmt.Errorf("%w: section sizes exceed the file", ErrCompiledFormat)
+	}
+	h.n4, h.n6, h.strings = int(n4), int(n6), int(strs)
+	h.countries = int(binary.LittleEndian.Uint32(b[40:]))
+	h.ases = int(binary.LittleEndian.Uint32(b[44:]))
+
+	if _, _, _, _, _, size := h.sections(); size != fileSize {
+		return compiledHeader{}, fmt.Errorf("%w: expected %d bytes, file has %d", ErrCompiledFormat, size, fileSize)
+	}
+	return h, nil
+}
+
+// readCompiledHeader reads and validates the header of a compiled base file without mapping it.
+func readCompiledHeader(path string) (compiledHeader, os.FileInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return compiledHeader{}, nil, err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return compiledHeader{}, nil, err
+	}
+
+	b := make([]byte, compiledHeaderSize)
+	if _, err := io.ReadFull(f, b); err != nil {
+		return compiledHeader{}, nil, fmt.Errorf("%w: %w", ErrCompiledFormat, err)
+	}
+
+	hdr, err := decodeCompiledHeader(b, int(st.Size()))
+	if err != nil {
+		return compiledHeader{}, nil, err
+	}
+	return hdr, st, nil
+}
+
+// compiledStrings - Deduplicated string blob of a compiled base.
+type compiledStrings struct {
+	blob []byte
+	refs map[string]uint32
+}
+
+// appendRef appends the offset and length of s to b.
+func (cs *compiledStrings) appendRef(b []byte, s string) ([]byte, error) {
+	off, ok := cs.refs[s]
+	if !ok {
+		if len(cs.blob)+len(s) > math.MaxUint32 {
+			return b, errors.New("compiled base strings exceed 4 GiB")
+		}
+		off = uint32(len(cs.blob))
+		cs.blob = append(cs.blob, s...)
+		cs.refs[s] = off
+	}
+
+	b = binary.LittleEndian.AppendUint32(b, off)
+	return binary.LittleEndian.AppendUint32(b, uint32(len(s))), nil
+}
+
+/*
+writeCompiled - Writes the disjoint ranges of a prepared set with their records.
+
+	keys returns the 1-based country and AS record of range data, 0 for none.
+	Nested ranges are resolved to the narrowest one, as by set.Segments.
+*/
+func writeCompiled[T comparable](
+	w io.Writer, set *ipsetdata.IPContainerSet[T], keys func(T) (country, as uint32),
+	countries []model.IPGeo, ases []model.IPAS, dataTime time.Time,
+) error {
+	if len(countries) > math.MaxUint32-1 || len(ases) > math.MaxUint32-1 {
+		return errors.New("too many records for a compiled base")
+	}
+
+	var v4, v6 []byte
+	for rng, data := range set.Segments() {
+		country, as := keys(data)
+
+		if rng.From().Is4() {
+			from, to := rng.From().As4(), rng.To().As4()
+			v4 = binary.LittleEndian.AppendUint32(v4, binary.BigEndian.Uint32(from[:]))
+			v4 = binary.LittleEndian.AppendUint32(v4, binary.BigEndian.Uint32(to[:]))
+			v4 = binary.LittleEndian.AppendUint32(v4, country)
+			v4 = binary.LittleEndian.AppendUint32(v4, as)
+			continue
+		}
+
+		from, to := rng.From().As16(), rng.To().As16()
+		v6 = append(v6, from[:]...)
+		v6 = append(v6, to[:]...)
+		v6 = binary.LittleEndian.AppendUint32(v6, country)
+		v6 = binary.LittleEndian.AppendUint32(v6, as)
+	}
+
+	strs := &compiledStrings{refs: map[string]uint32{}}
+
+	recs := make([]byte, 0, len(countries)*compiledCountrySize+len(ases)*compiledASSize)
+	for _, c := range countries {
+		var err error
+		for _, s := range []string{
+			string(c.ContinentCode), string(c.CountryCode), c.CountryName, c.RegionName, c.CityName,
+			string(c.RegisteredCountryCode), string(c.RepresentedCountryCode),
+		} {
+			if recs, err = strs.appendRef(recs, s); err != nil {
+				return err
+			}
+		}
+
+		var flags uint32
+		if c.AnonymousProxy {
+			flags |= compiledAnonymousProxy
+		}
+		if c.SatelliteProvider {
+			flags |= compiledSatelliteProvider
+		}
+		recs = binary.LittleEndian.AppendUint32(recs, flags)
+		recs = binary.LittleEndian.AppendUint32(recs, 0)
+	}
+
+	for _, a := range ases {
+		var err error
+		recs = binary.LittleEndian.AppendUint32(recs, uint32(a.ASN))
+		for _, s := range []string{string(a.CountryCode), a.Name, a.Org, a.Domain} {
+			if recs, err = strs.appendRef(recs, s); err != nil {
+				return err
+			}
+		}
+		recs = binary.LittleEndian.AppendUint32(recs, 0)
+	}
+
+	hdr := compiledHeader{
+		dataTime:  dataTime,
+		n4:        len(v4) / compiledRange4Size,
+		n6:        len(v6) / compiledRange6Size,
+		countries: len(countries),
+		ases:      len(ases),
+		strings:   len(strs.blob),
+	}
+
+	bw := bufio.NewWriterSize(w, 1<<20)
+	for _, b := range [][]byte{hdr.encode(), v4, v6, recs, strs.blob} {
+		if _, err := bw.Write(b); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteCompiled writes the registry as a compiled base file served by RegistryMmap.
+func (base *RegistryIP) WriteCompiled(w io.Writer) error {
+	countries := make([]model.IPGeo, 0, len(base.countryTable))
+	for _, c := range base.countryTable {
+		countries = append(countries, model.IPGeo{
+			ContinentCode:          model.GeoCode(c.ContinentCode),
+			CountryCode:            model.GeoCode(c.CountryCode),
+			CountryName:            c.CountryName,
+			RegionName:             c.RegionName,
+			CityName:               c.CityName,
+			RegisteredCountryCode:  model.GeoCode(c.RegisteredCountryCode),
+			RepresentedCountryCode: model.GeoCode(c.RepresentedCountryCode),
+			AnonymousProxy:         c.AnonymousProxy,
+			SatelliteProvider:      c.SatelliteProvider,
+		})
+	}
+
+	ases := make([]model.IPAS, 0, len(base.asTable))
+	for _, a := range base.asTable {
+		ases = append(ases, model.IPAS{
+			ASN:         a.Number,
+			CountryCode: model.GeoCode(a.CountryCode),
+			Name:        a.Name,
+			Org:         a.Org,
+			Domain:      a.Domain,
+		})
+	}
+
+	// table ids of networkMeta are already 1-based
+	return writeCompiled(w, base.reg, func(meta networkMeta) (uint32, uint32) {
+		return meta.countryID, meta.asID
+	}, countries, ases, base.report.DataTime())
+}
+
+// WriteCompiled writes the registry as a compiled base file served by RegistryMmap.
+func (base *RegistryIPTSV) WriteCompiled(w io.Writer) error {
+	codes := make([]uint16, 0, len(base.codes))
+	for code := range base.codes {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+
+	countries := make([]model.IPGeo, len(codes))
+	ids := make(map[uint16]uint32, len(codes))
+	for i, code := range codes {
+		countries[i] = model.IPGeo{CountryCode: base.codes[code]}
+		ids[code] = uint32(i + 1)
+	}
+
+	return writeCompiled(w, base.reg, func(code uint16) (uint32, uint32) {
+		return ids[code], 0
+	}, countries, nil, base.report.DataTime())
+}
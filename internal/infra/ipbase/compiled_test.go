@@ -0,0 +1,154 @@
+package ipbase_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/eterline/ipcsv2base/internal/infra/ipbase"
+	mmaprc "github.com/eterline/ipcsv2base/pkg/mmapread"
+	"go4.org/netipx"
+)
+
+// testNetworks are the networks of newTestRegistryIP, nested and of both families.
+var testNetworks = []string{
+	"1.0.0.0/16", "1.0.5.0/24", "1.0.6.0/23", "8.8.8.0/24", "10.0.0.0/8", "10.1.0.0/16",
+	"2001:db8::/32", "2001:db8:1::/48", "2a00::/16",
+}
+
+// newTestRegistryIP loads a registry of nested IPv4 and IPv6 networks with country only and AS only rows.
+func newTestRegistryIP(t *testing.T) *ipbase.RegistryIP {
+	t.Helper()
+
+	dir := writeFiles(t, map[string]string{
+		"country.csv": "network,continent_code,country_code,country_name\n" +
+			"1.0.5.0/24,NA,US,United States\n" +
+			"1.0.6.0/23,EU,DE,Germany\n" +
+			"10.0.0.0/8,EU,NL,Netherlands\n" +
+			"10.1.0.0/16,EU,FR,France\n" +
+			"2001:db8::/32,EU,DE,Germany\n" +
+			"2001:db8:1::/48,AS,JP,Japan\n",
+		"asn.csv": "network,asn,country_code,name,org,domain\n" +
+			"1.0.0.0/16,13335,US,CLOUDFLARENET,Cloudflare,cloudflare.com\n" +
+			"8.8.8.0/24,15169,US,GOOGLE,Google,google.com\n" +
+			"10.1.0.0/16,64500,FR,EXAMPLE,Example,example.net\n" +
+			"2a00::/16,3320,DE,DTAG,Deutsche Telekom,telekom.de\n",
+	})
+
+	reg, err := ipbase.NewRegistryIP(context.Background(),
+		filepath.Join(dir, "country.csv"), filepath.Join(dir, "asn.csv"), ipbase.IPv4v6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
+
+// testAddrs returns the bounds of testNetworks with their neighbours.
+func testAddrs() []netip.Addr {
+	var addrs []netip.Addr
+	for _, s := range testNetworks {
+		rng := netipx.RangeOfPrefix(netip.MustParsePrefix(s))
+		for _, a := range []netip.Addr{rng.From(), rng.To()} {
+			addrs = append(addrs, a.Prev(), a, a.Next())
+		}
+	}
+	return addrs
+}
+
+// writeCompiledFile writes the compiled base of reg into a new file and returns its path.
+func writeCompiledFile(t *testing.T, reg ipbase.Compilable) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "base.ipc")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := reg.WriteCompiled(f); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCompiledRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	reg := newTestRegistryIP(t)
+
+	mm, err := ipbase.OpenRegistryMmap(ctx, writeCompiledFile(t, reg), mmaprc.AdviceRandom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mm.Close()
+
+	for _, addr := range testAddrs() {
+		if !addr.IsValid() {
+			continue
+		}
+
+		want, wantErr := reg.LookupIP(ctx, addr)
+		got, err := mm.LookupIP(ctx, addr)
+		if (err != nil) != (wantErr != nil) {
+			t.Fatalf("LookupIP(%s) error = %v, registry error %v", addr, err, wantErr)
+		}
+		if err != nil {
+			continue
+		}
+
+		// compiled ranges are resolved segments, their network is the part of the source network holding addr
+		if !got.Network.Contains(addr) || !want.Network.Contains(got.Network.Addr()) || got.Network.Bits() < want.Network.Bits() {
+			t.Errorf("LookupIP(%s) network = %s, not inside registry network %s", addr, got.Network, want.Network)
+		}
+		got.Network = want.Network
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("LookupIP(%s) = %+v, registry %+v", addr, got, want)
+		}
+	}
+}
+
+func TestCompiledRejectsCorruptFiles(t *testing.T) {
+	data, err := os.ReadFile(writeCompiledFile(t, newTestRegistryIP(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt := func(at int, v uint64) []byte {
+		b := append([]byte(nil), data...)
+		binary.LittleEndian.PutUint64(b[at:], v)
+		return b
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated header", data[:32]},
+		{"truncated body", data[:len(data)-1]},
+		{"trailing bytes", append(append([]byte(nil), data...), 0)},
+		{"bad magic", corrupt(0, 0)},
+		{"bad version", corrupt(8, 2)},
+		{"range count beyond the file", corrupt(24, 1<<40)},
+		{"range count off by one", corrupt(24, binary.LittleEndian.Uint64(data[24:])+1)},
+		{"string size beyond the file", corrupt(48, 1<<62)},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "base.ipc")
+		if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		mm, err := ipbase.OpenRegistryMmap(context.Background(), path, mmaprc.AdviceNormal)
+		if err == nil {
+			mm.Close()
+		}
+		if !errors.Is(err, ipbase.ErrCompiledFormat) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, ipbase.ErrCompiledFormat)
+		}
+	}
+}
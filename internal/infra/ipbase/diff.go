@@ -0,0 +1,397 @@
+package ipbase
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"iter"
+	"math"
+	"math/big"
+	"net/netip"
+	"slices"
+
+	"github.com/eterline/ipcsv2base/internal/model"
+	"go4.org/netipx"
+)
+
+// NetworkKey - Country code and AS number answering a network, empty code and zero number when unknown.
+type NetworkKey struct {
+	CountryCode model.GeoCode
+	ASN         int32
+}
+
+/*
+Diffable - Registry exposing the networks it answers for Diff.
+
+	DiffRanges yields disjoint ranges in address order, IPv4 ranges ordered
+	as their IPv4-mapped IPv6 addresses. Nested source ranges are resolved to
+	the narrowest one, as by IPContainerSet.Segments.
+*/
+type Diffable interface {
+	DiffRanges() iter.Seq2[netipx.IPRange, NetworkKey]
+}
+
+/*
+Diff - Compares the networks answered by two registry versions.
+
+	Both versions are walked once in address order. Prefix and change lists
+	keep at most limit entries each, zero or less keeps all of them.
+*/
+func Diff(old, new Diffable, limit int) model.BaseDiff {
+	d := newDiffBuilder(limit)
+
+	a := newDiffCursor(old.DiffRanges())
+	defer a.stop()
+	b := newDiffCursor(new.DiffRanges())
+	defer b.stop()
+
+	for a.ok || b.ok {
+		switch {
+		case !b.ok || a.ok && a.rng.start.Less(b.rng.start):
+			end := a.rng.end
+			if prev, _ := b.rng.start.Dec(); b.ok && prev.Less(end) {
+				end = prev
+			}
+			d.removed(rangeUint128t{start: a.rng.start, end: end}, a.key)
+			a.advance(end)
+
+		case !a.ok || b.rng.start.Less(a.rng.start):
+			end := b.rng.end
+			if prev, _ := a.rng.start.Dec(); a.ok && prev.Less(end) {
+				end = prev
+			}
+			d.added(rangeUint128t{start: b.rng.start, end: end}, b.key)
+			b.advance(end)
+
+		default:
+			end := a.rng.end
+			if b.rng.end.Less(end) {
+				end = b.rng.end
+			}
+			d.both(rangeUint128t{start: a.rng.start, end: end}, a.key, b.key)
+			a.advance(end)
+			b.advance(end)
+		}
+	}
+
+	return d.result()
+}
+
+// diffCursor - Unconsumed part of the current range of a registry version.
+type diffCursor struct {
+	next func() (netipx.IPRange, NetworkKey, bool)
+	stop func()
+	rng  rangeUint128t
+	key  NetworkKey
+	ok   bool
+}
+
+func newDiffCursor(seq iter.Seq2[netipx.IPRange, NetworkKey]) *diffCursor {
+	c := &diffCursor{}
+	c.next, c.stop = iter.Pull2(seq)
+	c.pull()
+	return c
+}
+
+func (c *diffCursor) pull() {
+	var r netipx.IPRange
+	r, c.key, c.ok = c.next()
+	if c.ok {
+		c.rng = rangeUint128t{start: Addr2Uint128t(r.From()), end: Addr2Uint128t(r.To())}
+	}
+}
+
+// advance consumes the current range up to end inclusive.
+func (c *diffCursor) advance(end uint128t) {
+	if end == c.rng.end {
+		c.pull()
+		return
+	}
+	c.rng.start, _ = end.Inc()
+}
+
+// diffList - Address space and coalesced ranges of a change kind.
+type diffList struct {
+	space    addrCount
+	prefixes int
+	run      rangeUint128t
+	from, to NetworkKey
+	pending  bool
+	same     func(a, b NetworkKey) bool
+	emit     func(pfx netip.Prefix, from, to NetworkKey)
+}
+
+func (l *diffList) add(seg rangeUint128t, from, to NetworkKey) {
+	l.space.add(seg)
+
+	if l.pending {
+		next, ok := l.run.end.Inc()
+		if ok && next == seg.start && is4Uint128t(l.run.end) == is4Uint128t(seg.start) &&
+			l.same(l.from, from) && l.same(l.to, to) {
+			l.run.end = seg.end
+			return
+		}
+		l.flush()
+	}
+	l.run, l.from, l.to, l.pending = seg, from, to, true
+}
+
+func (l *diffList) flush() {
+	if !l.pending {
+		return
+	}
+	l.pending = false
+
+	for _, p := range l.run.ToIPRange().Prefixes() {
+		l.prefixes++
+		l.emit(p, l.from, l.to)
+	}
+}
+
+func (l *diffList) addressSpace() model.AddressSpace {
+	l.flush()
+	return model.AddressSpace{Prefixes: l.prefixes, IPv4: l.space.v4, IPv6: l.space.v6.toBig()}
+}
+
+type diffBuilder struct {
+	diff  model.BaseDiff
+	limit int
+
+	oldNets, newNets       diffList
+	addedNets, removedNets diffList
+	countryMoves, asMoves  diffList
+	gained, lost           map[model.GeoCode]*addrCount
+}
+
+func newDiffBuilder(limit int) *diffBuilder {
+	d := &diffBuilder{
+		limit:  limit,
+		gained: map[model.GeoCode]*addrCount{},
+		lost:   map[model.GeoCode]*addrCount{},
+	}
+
+	anyKey := func(a, b NetworkKey) bool { return true }
+	d.oldNets = diffList{same: anyKey, emit: func(netip.Prefix, NetworkKey, NetworkKey) {}}
+	d.newNets = diffList{same: anyKey, emit: func(netip.Prefix, NetworkKey, NetworkKey) {}}
+	d.addedNets = diffList{same: anyKey, emit: func(p netip.Prefix, _, _ NetworkKey) {
+		if d.keep(len(d.diff.AddedPrefixes)) {
+			d.diff.AddedPrefixes = append(d.diff.AddedPrefixes, p)
+		}
+	}}
+	d.removedNets = diffList{same: anyKey, emit: func(p netip.Prefix, _, _ NetworkKey) {
+		if d.keep(len(d.diff.RemovedPrefixes)) {
+			d.diff.RemovedPrefixes = append(d.diff.RemovedPrefixes, p)
+		}
+	}}
+	d.countryMoves = diffList{
+		same: func(a, b NetworkKey) bool { return a.CountryCode == b.CountryCode },
+		emit: func(p netip.Prefix, from, to NetworkKey) {
+			if d.keep(len(d.diff.CountryChanges)) {
+				d.diff.CountryChanges = append(d.diff.CountryChanges, model.CountryChange{Network: p, From: from.CountryCode, To: to.CountryCode})
+			}
+		},
+	}
+	d.asMoves = diffList{
+		same: func(a, b NetworkKey) bool { return a.ASN == b.ASN },
+		emit: func(p netip.Prefix, from, to NetworkKey) {
+			if d.keep(len(d.diff.ASChanges)) {
+				d.diff.ASChanges = append(d.diff.ASChanges, model.ASChange{Network: p, From: from.ASN, To: to.ASN})
+			}
+		},
+	}
+	return d
+}
+
+// keep reports whether a list of n entries takes another one, marking the diff truncated otherwise.
+func (d *diffBuilder) keep(n int) bool {
+	if d.limit > 0 && n >= d.limit {
+		d.diff.Truncated = true
+		return false
+	}
+	return true
+}
+
+func (d *diffBuilder) removed(seg rangeUint128t, key NetworkKey) {
+	d.oldNets.add(seg, key, key)
+	d.removedNets.add(seg, key, NetworkKey{})
+	d.countryDelta(d.lost, key.CountryCode, seg)
+}
+
+func (d *diffBuilder) added(seg rangeUint128t, key NetworkKey) {
+	d.newNets.add(seg, key, key)
+	d.addedNets.add(seg, NetworkKey{}, key)
+	d.countryDelta(d.gained, key.CountryCode, seg)
+}
+
+func (d *diffBuilder) both(seg rangeUint128t, from, to NetworkKey) {
+	d.oldNets.add(seg, from, from)
+	d.newNets.add(seg, to, to)
+
+	if from.CountryCode != to.CountryCode {
+		d.countryMoves.add(seg, from, to)
+		d.countryDelta(d.lost, from.CountryCode, seg)
+		d.countryDelta(d.gained, to.CountryCode, seg)
+	}
+	if from.ASN != to.ASN {
+		d.asMoves.add(seg, from, to)
+	}
+}
+
+func (d *diffBuilder) countryDelta(m map[model.GeoCode]*addrCount, cc model.GeoCode, seg rangeUint128t) {
+	if cc == "" {
+		return
+	}
+
+	c, ok := m[cc]
+	if !ok {
+		c = &addrCount{}
+		m[cc] = c
+	}
+	c.add(seg)
+}
+
+func (d *diffBuilder) result() model.BaseDiff {
+	d.diff.OldSpace = d.oldNets.addressSpace()
+	d.diff.NewSpace = d.newNets.addressSpace()
+	d.diff.Added = d.addedNets.addressSpace()
+	d.diff.Removed = d.removedNets.addressSpace()
+	d.diff.CountryMoved = d.countryMoves.addressSpace()
+	d.diff.ASMoved = d.asMoves.addressSpace()
+
+	codes := map[model.GeoCode]struct{}{}
+	for cc := range d.gained {
+		codes[cc] = struct{}{}
+	}
+	for cc := range d.lost {
+		codes[cc] = struct{}{}
+	}
+
+	type moved struct {
+		delta model.CountryDelta
+		v4    uint64
+		v6    *big.Int
+	}
+	all := make([]moved, 0, len(codes))
+	for cc := range codes {
+		var g, l addrCount
+		if c := d.gained[cc]; c != nil {
+			g = *c
+		}
+		if c := d.lost[cc]; c != nil {
+			l = *c
+		}
+
+		m := moved{
+			delta: model.CountryDelta{
+				CountryCode: cc,
+				Gained:      model.AddressSpace{IPv4: g.v4, IPv6: g.v6.toBig()},
+				Lost:        model.AddressSpace{IPv4: l.v4, IPv6: l.v6.toBig()},
+			},
+			v4: g.v4 + l.v4,
+		}
+		m.v6 = new(big.Int).Add(m.delta.Gained.IPv6, m.delta.Lost.IPv6)
+		all = append(all, m)
+	}
+
+	slices.SortFunc(all, func(a, b moved) int {
+		return cmpSpace(a.v4, a.v6, b.v4, b.v6, cmp.Compare(a.delta.CountryCode, b.delta.CountryCode))
+	})
+
+	d.diff.Countries = make([]model.CountryDelta, 0, len(all))
+	for _, m := range all {
+		d.diff.Countries = append(d.diff.Countries, m.delta)
+	}
+	return d.diff
+}
+
+// ErrDiffThreshold - Base diff exceeds a configured change threshold.
+var ErrDiffThreshold = errors.New("base diff threshold exceeded")
+
+// DiffThresholds - Largest accepted changes as shares (0..1) of the old base address space, zero disables a check.
+// Every share is checked per IP version.
+type DiffThresholds struct {
+	Added        float64
+	Removed      float64
+	CountryMoved float64
+	ASMoved      float64
+}
+
+// Exceeded returns an error describing each exceeded threshold.
+func (t DiffThresholds) Exceeded(d model.BaseDiff) []error {
+	var exceeded []error
+
+	for _, c := range []struct {
+		name  string
+		max   float64
+		space model.AddressSpace
+	}{
+		{"added", t.Added, d.Added},
+		{"removed", t.Removed, d.Removed},
+		{"country moved", t.CountryMoved, d.CountryMoved},
+		{"AS moved", t.ASMoved, d.ASMoved},
+	} {
+		if c.max <= 0 {
+			continue
+		}
+
+		v4, v6 := DiffShares(c.space, d.OldSpace)
+		if v4 > c.max {
+			exceeded = append(exceeded, fmt.Errorf("%s IPv4 share %.4f exceeds %.4f", c.name, v4, c.max))
+		}
+		if v6 > c.max {
+			exceeded = append(exceeded, fmt.Errorf("%s IPv6 share %.4f exceeds %.4f", c.name, v6, c.max))
+		}
+	}
+	return exceeded
+}
+
+// Check returns ErrDiffThreshold joined with every exceeded threshold, nil when the diff is within all of them.
+func (t DiffThresholds) Check(d model.BaseDiff) error {
+	exceeded := t.Exceeded(d)
+	if len(exceeded) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %w", ErrDiffThreshold, errors.Join(exceeded...))
+}
+
+// DiffShares returns the IPv4 and IPv6 shares of part in total, infinite for a change of an empty total.
+func DiffShares(part, total model.AddressSpace) (v4, v6 float64) {
+	v4 = share(new(big.Int).SetUint64(part.IPv4), new(big.Int).SetUint64(total.IPv4))
+	v6 = share(part.IPv6, total.IPv6)
+	return v4, v6
+}
+
+func share(part, total *big.Int) float64 {
+	if part == nil || part.Sign() == 0 {
+		return 0
+	}
+	if total == nil || total.Sign() == 0 {
+		return math.Inf(1)
+	}
+
+	f, _ := new(big.Rat).SetFrac(part, total).Float64()
+	return f
+}
+
+// DiffRanges yields the networks of the registry with their country code and AS number.
+func (base *RegistryIP) DiffRanges() iter.Seq2[netipx.IPRange, NetworkKey] {
+	return func(yield func(netipx.IPRange, NetworkKey) bool) {
+		for rng, meta := range base.reg.Segments() {
+			cc, asn := base.reverseKeys(meta)
+			if !yield(rng, NetworkKey{CountryCode: model.GeoCode(cc), ASN: asn}) {
+				return
+			}
+		}
+	}
+}
+
+// DiffRanges yields the networks of the registry with their country code.
+func (base *RegistryIPTSV) DiffRanges() iter.Seq2[netipx.IPRange, NetworkKey] {
+	return func(yield func(netipx.IPRange, NetworkKey) bool) {
+		for rng, code := range base.reg.Segments() {
+			if !yield(rng, NetworkKey{CountryCode: base.countryCode(code)}) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package ipbase_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/eterline/ipcsv2base/internal/infra/ipbase"
+	"github.com/eterline/ipcsv2base/internal/model"
+	mmaprc "github.com/eterline/ipcsv2base/pkg/mmapread"
+)
+
+// emptySpace reports whether an address space holds no addresses.
+func emptySpace(s model.AddressSpace) bool {
+	return s.Prefixes == 0 && s.IPv4 == 0 && (s.IPv6 == nil || s.IPv6.Sign() == 0)
+}
+
+func TestDiffAgainstCompiled(t *testing.T) {
+	ctx := context.Background()
+	reg := newTestRegistryIP(t)
+
+	mm, err := ipbase.OpenRegistryMmap(ctx, writeCompiledFile(t, reg), mmaprc.AdviceRandom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mm.Close()
+
+	for _, versions := range [][2]ipbase.Diffable{{reg, mm}, {mm, reg}} {
+		d := ipbase.Diff(versions[0], versions[1], 0)
+
+		for name, s := range map[string]model.AddressSpace{
+			"added": d.Added, "removed": d.Removed, "country moved": d.CountryMoved, "AS moved": d.ASMoved,
+		} {
+			if !emptySpace(s) {
+				t.Errorf("%T to %T: %s %+v, want none", versions[0], versions[1], name, s)
+			}
+		}
+		if len(d.AddedPrefixes)+len(d.RemovedPrefixes)+len(d.CountryChanges)+len(d.ASChanges)+len(d.Countries) != 0 {
+			t.Errorf("%T to %T: changes listed %+v", versions[0], versions[1], d)
+		}
+		if emptySpace(d.OldSpace) || d.OldSpace.IPv4 != d.NewSpace.IPv4 || d.OldSpace.IPv6.Cmp(d.NewSpace.IPv6) != 0 {
+			t.Errorf("%T to %T: old space %+v, new space %+v", versions[0], versions[1], d.OldSpace, d.NewSpace)
+		}
+	}
+
+	for _, addr := range testAddrs() {
+		if !addr.IsValid() {
+			continue
+		}
+
+		want, wantErr := reg.LookupIP(ctx, addr)
+		got, err := mm.LookupIP(ctx, addr)
+		if (err != nil) != (wantErr != nil) {
+			t.Fatalf("LookupIP(%s) error = %v, registry error %v", addr, err, wantErr)
+		}
+		if err == nil && (got.Geo != want.Geo || got.ASN != want.ASN) {
+			t.Errorf("LookupIP(%s) = %v %v, registry %v %v", addr, got.Geo, got.ASN, want.Geo, want.ASN)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package ipbase
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/eterline/ipcsv2base/internal/model"
+)
+
+// buildDateFunc extracts the build date embedded into a source path, zero when there is none.
+type buildDateFunc func(path string) time.Time
+
+var (
+	// GeoLite2 bundles are named like GeoLite2-Country-CSV_20260101.
+	geoLite2DateRe = regexp.MustCompile(`_(\d{8})(?:\.zip)?(?:/|$)`)
+	// DB-IP files are named like dbip-country-lite-2026-01.csv.
+	dbipDateRe = regexp.MustCompile(`-(\d{4}-\d{2})\.csv`)
+)
+
+func geoLite2BuildDate(path string) time.Time {
+	return matchDate(geoLite2DateRe, "20060102", filepath.ToSlash(path))
+}
+
+func dbipBuildDate(path string) time.Time {
+	return matchDate(dbipDateRe, "2006-01", filepath.Base(path))
+}
+
+func matchDate(re *regexp.Regexp, layout, s string) time.Time {
+	m := re.FindAllStringSubmatch(s, -1)
+	if len(m) == 0 {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(layout, m[len(m)-1][1])
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// ErrSourceVerification - Source file rejected by the load verifier.
+var ErrSourceVerification = errors.New("source file verification failed")
+
+// describe collects metadata of source files not described yet.
+// Files are hashed concurrently and verified before loaders parse them.
+func (ls *loadState) describe(ctx context.Context) error {
+	byFile := map[string][]*sourceCounter{}
+	for _, c := range ls.sources {
+		if c.rep.File.Path == "" {
+			byFile[c.file] = append(byFile[c.file], c)
+		}
+	}
+
+	tasks := make([]func(context.Context) error, 0, len(byFile))
+	for file, counters := range byFile {
+		tasks = append(tasks, func(ctx context.Context) error {
+			info, err := ls.describeFile(ctx, file)
+			if err != nil {
+				return err
+			}
+
+			for _, c := range counters {
+				c.rep.File = info
+				if ls.buildDate != nil {
+					c.rep.File.BuildDate = ls.buildDate(c.rep.Path)
+				}
+			}
+			return nil
+		})
+	}
+
+	return runParallel(ctx, ls.opts.workers, tasks...)
+}
+
+// describedFile - Described source file with the status of the descriptor it was hashed from.
+type describedFile struct {
+	info model.SourceFile
+	st   os.FileInfo
+}
+
+// describeFile returns size, modification time and SHA-256 of a file and verifies it.
+// Files are described once per load, finish rejects files changed after they were hashed.
+func (ls *loadState) describeFile(ctx context.Context, file string) (model.SourceFile, error) {
+	ls.filesMu.Lock()
+	d, ok := ls.files[file]
+	ls.filesMu.Unlock()
+	if ok {
+		return d.info, nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return model.SourceFile{}, fmt.Errorf("failed to describe source file %s: %w", file, err)
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return model.SourceFile{}, fmt.Errorf("failed to describe source file %s: %w", file, err)
+	}
+
+	return ls.describeReader(ctx, file, st, f)
+}
+
+// readDescribed reads a whole file, describes and verifies its contents, so the returned bytes are the verified ones.
+func (ls *loadState) readDescribed(ctx context.Context, file string) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe source file %s: %w", file, err)
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe source file %s: %w", file, err)
+	}
+
+	data, err := io.ReadAll(&ctxReader{ctx: ctx, r: f})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe source file %s: %w", file, err)
+	}
+
+	if err := ls.describeData(ctx, file, st, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// describeData describes and verifies the contents of a file already read into data,
+// so the verified bytes are the ones served.
+func (ls *loadState) describeData(ctx context.Context, file string, st os.FileInfo, data []byte) error {
+	_, err := ls.describeReader(ctx, file, st, bytes.NewReader(data))
+	return err
+}
+
+// describeStat describes a file by its status without hashing it, for files served without a verifier.
+func (ls *loadState) describeStat(file string, st os.FileInfo) {
+	ls.filesMu.Lock()
+	defer ls.filesMu.Unlock()
+
+	ls.files[file] = describedFile{
+		info: model.SourceFile{Path: file, Size: st.Size(), ModTime: st.ModTime()},
+		st:   st,
+	}
+}
+
+// describeReader hashes the contents of a file read from r and verifies it, st is the status of the read descriptor.
+func (ls *loadState) describeReader(ctx context.Context, file string, st os.FileInfo, r io.Reader) (model.SourceFile, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, &ctxReader{ctx: ctx, r: r}); err != nil {
+		return model.SourceFile{}, fmt.Errorf("failed to describe source file %s: %w", file, err)
+	}
+
+	info := model.SourceFile{
+		Path:    file,
+		Size:    st.Size(),
+		ModTime: st.ModTime(),
+		SHA256:  hex.EncodeToString(h.Sum(nil)),
+	}
+
+	if ls.opts.verifier != nil {
+		if err := ls.opts.verifier.Verify(file, info.SHA256); err != nil {
+			return info, fmt.Errorf("%w: %w", ErrSourceVerification, err)
+		}
+	}
+
+	ls.filesMu.Lock()
+	ls.files[file] = describedFile{info: info, st: st}
+	ls.filesMu.Unlock()
+
+	return info, nil
+}
+
+/*
+checkUnchanged - Rejects described files replaced or modified since they were hashed.
+
+	Parsed bytes are compared with the described hash by checkContent, this
+	check covers the files served without being parsed, such as compiled
+	bases. The path must still name the described file with the same size
+	and modification time.
+*/
+func (ls *loadState) checkUnchanged() error {
+	ls.filesMu.Lock()
+	defer ls.filesMu.Unlock()
+
+	for file, d := range ls.files {
+		st, err := os.Stat(file)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrSourceVerification, file, err)
+		}
+		if !os.SameFile(st, d.st) || st.Size() != d.st.Size() || !st.ModTime().Equal(d.st.ModTime()) {
+			return fmt.Errorf("%w: %s changed while loading", ErrSourceVerification, file)
+		}
+	}
+	return nil
+}
+
+// checkContent rejects a source whose bytes hashed into h while parsing differ from the described file.
+func checkContent(src *sourceCounter, file string, h hash.Hash) error {
+	if want := src.rep.File.SHA256; want != "" && want != hex.EncodeToString(h.Sum(nil)) {
+		return fmt.Errorf("%w: %s changed while loading", ErrSourceVerification, file)
+	}
+	return nil
+}
+
+// ctxReader stops reading once ctx is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
@@ -0,0 +1,139 @@
+package ipbase_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eterline/ipcsv2base/internal/infra/ipbase"
+	mmaprc "github.com/eterline/ipcsv2base/pkg/mmapread"
+)
+
+// swapVerifier - Accepts every file and replaces it with the swap file right after its hash was checked.
+type swapVerifier struct {
+	swap map[string]string // verified file to its replacement
+}
+
+func (v swapVerifier) Verify(file, sum string) error {
+	if repl, ok := v.swap[file]; ok {
+		return os.Rename(repl, file)
+	}
+	return nil
+}
+
+func TestLoadRejectsFilesSwappedAfterVerification(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"country.csv": "network,continent_code,country_code,country_name\n" +
+			"1.0.0.0/24,NA,US,United States\n",
+		"swap.csv": "network,continent_code,country_code,country_name\n" +
+			"1.0.0.0/24,EU,RU,Russia\n",
+		"asn.csv": "network,asn,country_code,name,org,domain\n" +
+			"1.0.0.0/24,13335,US,CLOUDFLARENET,Cloudflare,cloudflare.com\n",
+	})
+	country := filepath.Join(dir, "country.csv")
+
+	_, err := ipbase.NewRegistryIP(context.Background(), country, filepath.Join(dir, "asn.csv"), ipbase.IPv4v6,
+		ipbase.WithVerifier(swapVerifier{swap: map[string]string{country: filepath.Join(dir, "swap.csv")}}))
+	if !errors.Is(err, ipbase.ErrSourceVerification) {
+		t.Fatalf("load of a swapped file: error = %v, want %v", err, ipbase.ErrSourceVerification)
+	}
+}
+
+// rewriteVerifier - Accepts every file and rewrites it in place right after its hash was checked,
+// keeping its size and modification time.
+type rewriteVerifier struct {
+	rewrite map[string]string // verified file to its new contents
+}
+
+func (v rewriteVerifier) Verify(file, sum string) error {
+	data, ok := v.rewrite[file]
+	if !ok {
+		return nil
+	}
+
+	st, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteAt([]byte(data), 0); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(file, st.ModTime(), st.ModTime())
+}
+
+func TestLoadRejectsFilesRewrittenAfterVerification(t *testing.T) {
+	const (
+		header    = "network,continent_code,country_code,country_name\n"
+		verified  = header + "1.0.0.0/24,NA,US,United States\n"
+		rewritten = header + "1.0.0.0/24,EU,RU,Russian Feder\n"
+	)
+	dir := writeFiles(t, map[string]string{
+		"country.csv": verified,
+		"asn.csv": "network,asn,country_code,name,org,domain\n" +
+			"1.0.0.0/24,13335,US,CLOUDFLARENET,Cloudflare,cloudflare.com\n",
+	})
+	country := filepath.Join(dir, "country.csv")
+
+	_, err := ipbase.NewRegistryIP(context.Background(), country, filepath.Join(dir, "asn.csv"), ipbase.IPv4v6,
+		ipbase.WithVerifier(rewriteVerifier{rewrite: map[string]string{country: rewritten}}))
+	if !errors.Is(err, ipbase.ErrSourceVerification) {
+		t.Fatalf("load of a file rewritten in place: error = %v, want %v", err, ipbase.ErrSourceVerification)
+	}
+}
+
+func TestOpenRegistryMmapVerifiesMappedBytes(t *testing.T) {
+	path := writeCompiledFile(t, newTestRegistryIP(t))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var verified string
+	mm, err := ipbase.OpenRegistryMmap(context.Background(), path, mmaprc.AdviceNormal,
+		ipbase.WithVerifier(verifierFunc(func(file, sum string) error {
+			verified = sum
+			return nil
+		})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mm.Close()
+
+	if info := mm.LoadReport().Sources[0].File; info.SHA256 != verified || info.Size != int64(len(data)) {
+		t.Fatalf("reported file %+v, verified sha256 %s of %d bytes", info, verified, len(data))
+	}
+}
+
+// verifierFunc - Function implementing ipbase.SourceVerifier.
+type verifierFunc func(file, sum string) error
+
+func (f verifierFunc) Verify(file, sum string) error { return f(file, sum) }
+
+func TestOpenRegistryMmapWithoutVerifierSkipsHashing(t *testing.T) {
+	path := writeCompiledFile(t, newTestRegistryIP(t))
+	st, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mm, err := ipbase.OpenRegistryMmap(context.Background(), path, mmaprc.AdviceRandom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mm.Close()
+
+	// hashing would read every page of the mapping
+	if info := mm.LoadReport().Sources[0].File; info.SHA256 != "" || info.Size != st.Size() || !info.ModTime.Equal(st.ModTime()) {
+		t.Fatalf("reported file %+v, want size %d and modification time %s without sha256", info, st.Size(), st.ModTime())
+	}
+}
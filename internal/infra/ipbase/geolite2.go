@@ -0,0 +1,325 @@
+package ipbase
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/netip"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/eterline/ipcsv2base/pkg/decompress"
+	"go4.org/netipx"
+)
+
+// GeoLite2 CSV column names.
+const (
+	glNetwork             = "network"
+	glGeonameID           = "geoname_id"
+	glRegisteredGeonameID = "registered_country_geoname_id"
+	glRepresentedGeoname  = "represented_country_geoname_id"
+	glAnonymousProxy      = "is_anonymous_proxy"
+	glSatelliteProvider   = "is_satellite_provider"
+	glContinentCode       = "continent_code"
+	glCountryISOCode      = "country_iso_code"
+	glCountryName         = "country_name"
+	glASNumber            = "autonomous_system_number"
+	glASOrganization      = "autonomous_system_organization"
+)
+
+// geoLite2Location is a joined row of the GeoLite2 Locations file.
+type geoLite2Location struct {
+	ContinentCode string
+	CountryCode   string
+	CountryName   string
+}
+
+// geoLite2Bundle holds the file set of one or more GeoLite2 CSV bundles.
+type geoLite2Bundle struct {
+	geoBlocks []geoLite2File
+	asnBlocks []geoLite2File
+	locations []geoLite2File
+}
+
+type geoLite2File struct {
+	fsys   fs.FS
+	bundle string
+	name   string
+	dir    bool // bundle is a directory, files are read by path
+}
+
+// NewRegistryGeoLite2 constructs a new RegistryIP from MaxMind GeoLite2 CSV bundles.
+// Each bundle is a directory or a zip archive with Country or City blocks, Locations
+// in the selected language and/or ASN blocks. Geo blocks are joined with locations by geoname_id.
+// Locations are read first, blocks files are parsed concurrently.
+// ver specifies the IP version filter (IPv4, IPv6, or both).
+func NewRegistryGeoLite2(ctx context.Context, lang string, ver IPVersion, bundles []string, opts ...LoadOption) (*RegistryIP, error) {
+	ls := newLoadState(opts...)
+	ls.buildDate = geoLite2BuildDate
+	defer ls.trackProgress(ctx)()
+
+	if lang == "" {
+		lang = "en"
+	}
+
+	bundle := &geoLite2Bundle{}
+	for _, b := range bundles {
+		if err := bundle.scan(ctx, ls, b, lang); err != nil {
+			return nil, fmt.Errorf("failed to open GeoLite2 bundle %s: %w", b, err)
+		}
+	}
+
+	if len(bundle.geoBlocks) == 0 && len(bundle.asnBlocks) == 0 {
+		return nil, errors.New("GeoLite2 bundles have no blocks files")
+	}
+
+	if len(bundle.geoBlocks) > 0 && len(bundle.locations) == 0 {
+		return nil, fmt.Errorf("GeoLite2 bundles have no Locations-%s file", lang)
+	}
+
+	var (
+		locations   = map[string]geoLite2Location{}
+		locationsMu sync.Mutex
+		tasks       []func(context.Context) error
+	)
+
+	for _, f := range bundle.locations {
+		src := ls.sourceIn(f.String(), f.file())
+		tasks = append(tasks, readTask("GeoLite2", f.name, src, func(ctx context.Context) error {
+			return f.forEach(ctx,
+				[]string{glGeonameID, glContinentCode, glCountryISOCode, glCountryName},
+				src,
+				func(rec csvRecord) error {
+					loc := geoLite2Location{
+						ContinentCode: rec.Get(glContinentCode),
+						CountryCode:   rec.Get(glCountryISOCode),
+						CountryName:   rec.Get(glCountryName),
+					}
+
+					locationsMu.Lock()
+					locations[rec.Get(glGeonameID)] = loc
+					locationsMu.Unlock()
+					return nil
+				},
+			)
+		}))
+	}
+
+	if err := ls.describe(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := runParallel(ctx, ls.opts.workers, tasks...); err != nil {
+		return nil, err
+	}
+
+	// blocks of the Country and ASN files nest into each other, so they are merged as ranges
+	countryTable := newUniqueRangeTable[countryData](0)
+	astable := newUniqueRangeTable[asData](0)
+	tasks = tasks[:0]
+
+	for _, f := range bundle.geoBlocks {
+		src := ls.sourceIn(f.String(), f.file())
+		tasks = append(tasks, readTask("GeoLite2", f.name, src, func(ctx context.Context) error {
+			return f.forEach(ctx,
+				[]string{glNetwork, glGeonameID, glRegisteredGeonameID, glRepresentedGeoname},
+				src,
+				func(rec csvRecord) error {
+					pfx, err := netip.ParsePrefix(rec.Get(glNetwork))
+					if err != nil {
+						return skipRow(SkipInvalidKey)
+					}
+					if !ver.validate(pfx.Addr()) {
+						return errRowFiltered
+					}
+					start, end := pfx.Masked().Addr(), netipx.PrefixLastIP(pfx)
+
+					data, ok := geoLite2CountryData(rec, locations)
+					if !ok {
+						return skipRow(SkipUnknownLocation)
+					}
+
+					countryTable.Add(start, end, data)
+					ls.origins.addGeo(src, rec.line, start, end)
+					return nil
+				},
+			)
+		}))
+	}
+
+	for _, f := range bundle.asnBlocks {
+		src := ls.sourceIn(f.String(), f.file())
+		tasks = append(tasks, readTask("GeoLite2", f.name, src, func(ctx context.Context) error {
+			return f.forEach(ctx,
+				[]string{glNetwork, glASNumber, glASOrganization},
+				src,
+				func(rec csvRecord) error {
+					pfx, err := netip.ParsePrefix(rec.Get(glNetwork))
+					if err != nil {
+						return skipRow(SkipInvalidKey)
+					}
+					if !ver.validate(pfx.Addr()) {
+						return errRowFiltered
+					}
+
+					start, end := pfx.Masked().Addr(), netipx.PrefixLastIP(pfx)
+
+					asn, err := strconv.ParseInt(rec.Get(glASNumber), 10, 32)
+					if err != nil {
+						return skipRow(SkipInvalidASN)
+					}
+
+					// GeoLite2 provides a single organization string per AS.
+					org := rec.Get(glASOrganization)
+					astable.Add(start, end, asData{
+						Number: int32(asn),
+						Name:   org,
+						Org:    org,
+					})
+					ls.origins.addAS(src, rec.line, start, end)
+
+					return nil
+				},
+			)
+		}))
+	}
+
+	if err := ls.describe(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := runParallel(ctx, ls.opts.workers, tasks...); err != nil {
+		return nil, err
+	}
+
+	if err := ls.finish(); err != nil {
+		return nil, err
+	}
+
+	reg := newRegistryIPFromRanges(countryTable, astable, ls.opts.index)
+	reg.report = ls.report()
+	reg.origins = ls.prepareOrigins()
+	return reg, nil
+}
+
+/*
+geoLite2CountryData - Resolves country data of a blocks record.
+
+	The located country (geoname_id) is preferred, the registered country is used
+	when the network has no location (e.g. anonymous proxies and satellite providers).
+	Registered and represented countries are kept only when they differ from the located one.
+*/
+func geoLite2CountryData(rec csvRecord, locations map[string]geoLite2Location) (countryData, bool) {
+	registered, hasRegistered := locations[rec.Get(glRegisteredGeonameID)]
+	represented := locations[rec.Get(glRepresentedGeoname)]
+
+	located, ok := locations[rec.Get(glGeonameID)]
+	if !ok {
+		located, ok = registered, hasRegistered
+	}
+
+	data := countryData{
+		ContinentCode:     located.ContinentCode,
+		CountryCode:       located.CountryCode,
+		CountryName:       located.CountryName,
+		AnonymousProxy:    rec.Get(glAnonymousProxy) == "1",
+		SatelliteProvider: rec.Get(glSatelliteProvider) == "1",
+	}
+
+	if registered.CountryCode != located.CountryCode {
+		data.RegisteredCountryCode = registered.CountryCode
+	}
+	if represented.CountryCode != located.CountryCode {
+		data.RepresentedCountryCode = represented.CountryCode
+	}
+
+	return data, ok || data.AnonymousProxy || data.SatelliteProvider
+}
+
+// scan registers GeoLite2 files of a directory or zip archive.
+// Zip archives are read into memory and verified before their directory is read, entries are parsed from the verified bytes.
+func (b *geoLite2Bundle) scan(ctx context.Context, ls *loadState, bundle, lang string) error {
+	st, err := os.Stat(bundle)
+	if err != nil {
+		return err
+	}
+
+	var fsys fs.FS
+	if st.IsDir() {
+		fsys = os.DirFS(bundle)
+	} else {
+		data, err := ls.readDescribed(ctx, bundle)
+		if err != nil {
+			return err
+		}
+
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return err
+		}
+		fsys = zr
+	}
+
+	locSuffix := "-Locations-" + lang + ".csv"
+
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		base := path.Base(name)
+		f := geoLite2File{fsys: fsys, bundle: bundle, name: name, dir: st.IsDir()}
+
+		switch {
+		case strings.Contains(base, "-ASN-Blocks-IPv"):
+			b.asnBlocks = append(b.asnBlocks, f)
+		case strings.Contains(base, "-Blocks-IPv"):
+			b.geoBlocks = append(b.geoBlocks, f)
+		case strings.Contains(base, locSuffix):
+			b.locations = append(b.locations, f)
+		}
+
+		return nil
+	})
+}
+
+// file returns the file on disk holding the bundle file.
+func (f geoLite2File) file() string {
+	if f.dir {
+		return filepath.Join(f.bundle, filepath.FromSlash(f.name))
+	}
+	return f.bundle
+}
+
+func (f geoLite2File) String() string {
+	return f.bundle + "/" + f.name
+}
+
+// forEach iterates over a headed GeoLite2 CSV file.
+// Files of directory bundles are read by path, so large raw files are parsed by parts.
+func (f geoLite2File) forEach(ctx context.Context, required []string, src *sourceCounter, do csvNamedEachFunc) error {
+	if f.dir {
+		return csvNamedForEach(ctx, fileSource(f.file(), csvFraming), required, src, do)
+	}
+
+	r, err := f.fsys.Open(f.name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	dr, _, err := decompress.Wrap(r)
+	if err != nil {
+		return err
+	}
+	defer dr.Close()
+
+	return csvNamedForEach(ctx, streamSource(dr), required, src, do)
+}
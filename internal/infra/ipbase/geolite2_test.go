@@ -0,0 +1,67 @@
+package ipbase_test
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eterline/ipcsv2base/internal/infra/ipbase"
+	"github.com/eterline/ipcsv2base/internal/model"
+)
+
+// writeFiles writes named file contents into a new temporary directory.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestGeoLite2NestedBlocks(t *testing.T) {
+	bundle := writeFiles(t, map[string]string{
+		"GeoLite2-Country-Locations-en.csv": "geoname_id,locale_code,continent_code,continent_name,country_iso_code,country_name,is_in_european_union\n" +
+			"6252001,en,NA,North America,US,United States,0\n" +
+			"2921044,en,EU,Europe,DE,Germany,1\n",
+		"GeoLite2-Country-Blocks-IPv4.csv": "network,geoname_id,registered_country_geoname_id,represented_country_geoname_id,is_anonymous_proxy,is_satellite_provider\n" +
+			"1.0.5.0/24,6252001,6252001,,0,0\n" +
+			"1.0.6.0/23,2921044,2921044,,0,0\n",
+		"GeoLite2-ASN-Blocks-IPv4.csv": "network,autonomous_system_number,autonomous_system_organization\n" +
+			"1.0.0.0/16,13335,CLOUDFLARENET\n",
+	})
+
+	reg, err := ipbase.NewRegistryGeoLite2(context.Background(), "en", ipbase.IPv4v6, []string{bundle})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		addr    string
+		country model.GeoCode
+		asn     int32
+	}{
+		{"1.0.5.1", "US", 13335},
+		{"1.0.7.255", "DE", 13335},
+		{"1.0.200.1", "", 13335},
+		{"1.0.0.0", "", 13335},
+	}
+	for _, tt := range tests {
+		meta, err := reg.LookupIP(context.Background(), netip.MustParseAddr(tt.addr))
+		if err != nil {
+			t.Fatalf("LookupIP(%s): %v", tt.addr, err)
+		}
+		if meta.Geo.CountryCode != tt.country || meta.ASN.ASN != tt.asn {
+			t.Errorf("LookupIP(%s) = %s AS%d, want %s AS%d", tt.addr, meta.Geo.CountryCode, meta.ASN.ASN, tt.country, tt.asn)
+		}
+	}
+
+	if _, err := reg.LookupIP(context.Background(), netip.MustParseAddr("1.1.0.1")); err == nil {
+		t.Error("LookupIP(1.1.0.1) outside every block succeeded")
+	}
+}
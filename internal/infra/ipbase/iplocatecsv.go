@@ -3,74 +3,112 @@ package ipbase
 import (
 	"context"
 	"errors"
-	"fmt"
 	"net/netip"
 	"strconv"
 
 	"github.com/eterline/ipcsv2base/internal/model"
 	"github.com/eterline/ipcsv2base/pkg/ipsetdata"
+	"go4.org/netipx"
 )
 
+// errLookupFailed - Address outside every registry range, shared to keep misses allocation free.
+var errLookupFailed = errors.New("failed lookup")
+
 // RegistryIP represents a lookup registry for IP metadata.
 type RegistryIP struct {
+	loadReporter
 	reg          *ipsetdata.IPContainerSet[networkMeta]
 	countryTable []countryData
 	asTable      []asData
+	origins      *registryOrigins // nil unless row origins are enabled
+	reverse      *reverseIndex
+	search       *asSearchIndex
+	stats        statsCache
 }
 
 // NewRegistryIP constructs a new RegistryIP by reading ASN and country CSV files.
+// Both files are parsed concurrently, the load is cancelled with ctx.
 // ver specifies the IP version filter (IPv4, IPv6, or both).
-func NewRegistryIP(ctx context.Context, countryCSV, asnCSV string, ver IPVersion) (*RegistryIP, error) {
+func NewRegistryIP(ctx context.Context, countryCSV, asnCSV string, ver IPVersion, opts ...LoadOption) (*RegistryIP, error) {
+	ls := newLoadState(opts...)
+	defer ls.trackProgress(ctx)()
 
 	countryTable := newUniquePrefixTable[countryData](0)
 	astable := newUniquePrefixTable[asData](0)
 
-	if err := csvForEach(
-		countryCSV, 4, ver,
-		func(network netip.Prefix, fields []string) error {
-
-			countryTable.Add(network, countryData{
-				ContinentCode: fields[0],
-				CountryCode:   fields[1],
-				CountryName:   fields[2],
-			})
+	countrySrc, asnSrc := ls.source(countryCSV), ls.source(asnCSV)
 
-			return nil
-		},
-	); err != nil {
-		return nil, fmt.Errorf("failed to read CSV file %s: %w", countryCSV, err)
+	if err := ls.describe(ctx); err != nil {
+		return nil, err
 	}
 
-	if err := csvForEach(
-		asnCSV, 6, ver,
-		func(network netip.Prefix, fields []string) error {
-
-			asn, err := strconv.ParseInt(fields[0], 0, 32)
-			if err != nil {
-				return err
-			}
-
-			astable.Add(network, asData{
-				Number:      int32(asn),
-				CountryCode: fields[1],
-				Name:        fields[2],
-				Org:         fields[3],
-				Domain:      fields[4],
-			})
+	err := runParallel(ctx, ls.opts.workers,
+		readTask("CSV", countryCSV, countrySrc, func(ctx context.Context) error {
+			return csvForEach(
+				ctx, countryCSV, IPLocateCountrySchema, ver, countrySrc,
+				func(rng netipx.IPRange, rec csvRecord) error {
+					network, _ := rng.Prefix()
+
+					countryTable.Add(network, countryData{
+						ContinentCode: rec.Get(FieldContinentCode),
+						CountryCode:   rec.Get(FieldCountryCode),
+						CountryName:   rec.Get(FieldCountryName),
+					})
+					ls.origins.addGeo(countrySrc, rec.line, rng.From(), rng.To())
+
+					return nil
+				},
+			)
+		}),
+		readTask("CSV", asnCSV, asnSrc, func(ctx context.Context) error {
+			return csvForEach(
+				ctx, asnCSV, IPLocateASNSchema, ver, asnSrc,
+				func(rng netipx.IPRange, rec csvRecord) error {
+					network, _ := rng.Prefix()
+
+					asn, err := strconv.ParseInt(rec.Get(FieldASN), 0, 32)
+					if err != nil {
+						return skipRow(SkipInvalidASN)
+					}
+
+					astable.Add(network, asData{
+						Number:      int32(asn),
+						CountryCode: rec.Get(FieldASCountryCode),
+						Name:        rec.Get(FieldASName),
+						Org:         rec.Get(FieldASOrg),
+						Domain:      rec.Get(FieldASDomain),
+					})
+					ls.origins.addAS(asnSrc, rec.line, rng.From(), rng.To())
+
+					return nil
+				},
+			)
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
 
-			return nil
-		},
-	); err != nil {
-		return nil, fmt.Errorf("failed to read CSV file %s: %w", asnCSV, err)
+	if err := ls.finish(); err != nil {
+		return nil, err
 	}
 
+	reg := newRegistryIPFromTables(countryTable, astable, ls.opts.index)
+	reg.report = ls.report()
+	reg.origins = ls.prepareOrigins()
+	return reg, nil
+}
+
+// newRegistryIPFromTables merges country and AS tables by network into a prepared RegistryIP.
+// AS networks without an exact country match inherit the country of the AS record.
+func newRegistryIPFromTables(countryTable *uniquePrefixTable[countryData], astable *uniquePrefixTable[asData], index ipsetdata.IndexKind) *RegistryIP {
 	netMap := map[netip.Prefix]networkMeta{}
 	cIDByC := map[string]uint32{}
 
 	countryTable.TableForEach(func(id uint32, prefixes []netip.Prefix, data countryData) {
 		for _, pfx := range prefixes {
 			netMap[pfx] = networkMeta{countryID: id}
-			if _, ok := cIDByC[data.CountryCode]; !ok {
+			if _, ok := cIDByC[data.CountryCode]; !ok && data.CountryCode != "" {
 				cIDByC[data.CountryCode] = id
 			}
 		}
@@ -88,7 +126,7 @@ func NewRegistryIP(ctx context.Context, countryCSV, asnCSV string, ver IPVersion
 		}
 	})
 
-	set := ipsetdata.NewIPContainerSet[networkMeta](1 << 22)
+	set := ipsetdata.NewIPContainerSet[networkMeta](1<<22, ipsetdata.WithIndex(index))
 	for pfx, meta := range netMap {
 		set.AddPrefix(pfx, meta)
 	}
@@ -99,13 +137,57 @@ func NewRegistryIP(ctx context.Context, countryCSV, asnCSV string, ver IPVersion
 
 	set.Prepare()
 
-	reg := &RegistryIP{
+	return newRegistryIPFromSet(set, countryTable.Table(), astable.Table())
+}
+
+// newRegistryIPFromSet builds the reverse index of a prepared set.
+func newRegistryIPFromSet(set *ipsetdata.IPContainerSet[networkMeta], countryTable []countryData, asTable []asData) *RegistryIP {
+	base := &RegistryIP{
 		reg:          set,
-		countryTable: countryTable.Table(),
-		asTable:      astable.Table(),
+		countryTable: countryTable,
+		asTable:      asTable,
 	}
+	base.reverse = buildReverseIndex(set, base.reverseKeys)
+	base.summarize()
+	base.search = newASSearchIndex(asTable, func(asn int32) uint64 {
+		sum, _ := base.reverse.getASSummary(asn)
+		return sum.Space.IPv4
+	})
+	return base
+}
 
-	return reg, nil
+// summarize precomputes reverse index summaries, names come from the first table record of a code or number.
+func (base *RegistryIP) summarize() {
+	countries := make(map[string]int, 256)
+	for i, c := range base.countryTable {
+		if _, ok := countries[c.CountryCode]; !ok {
+			countries[c.CountryCode] = i
+		}
+	}
+
+	asns := make(map[int32]int, len(base.asTable))
+	for i, a := range base.asTable {
+		if _, ok := asns[a.Number]; !ok {
+			asns[a.Number] = i
+		}
+	}
+
+	base.reverse.summarize(
+		func(cc string) (string, string) {
+			c := base.countryTable[countries[cc]]
+			return c.ContinentCode, c.CountryName
+		},
+		func(asn int32) model.IPAS {
+			a := base.asTable[asns[asn]]
+			return model.IPAS{
+				ASN:         a.Number,
+				CountryCode: model.GeoCode(a.CountryCode),
+				Name:        a.Name,
+				Org:         a.Org,
+				Domain:      a.Domain,
+			}
+		},
+	)
 }
 
 // Size returns the number of IP prefixes in the registry.
@@ -115,27 +197,104 @@ func (base *RegistryIP) Size() int {
 
 // LookupIP returns metadata for a given IP address.
 func (base *RegistryIP) LookupIP(ctx context.Context, addr netip.Addr) (*model.IPMetadata, error) {
+	data := &model.IPMetadata{}
+	if err := base.LookupIPInto(ctx, addr, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// LookupIPInto fills dst with metadata for a given IP address without allocating.
+func (base *RegistryIP) LookupIPInto(ctx context.Context, addr netip.Addr, dst *model.IPMetadata) error {
 	pfx, meta, ok := base.reg.Get(addr)
 	if !ok {
-		return nil, errors.New("failed lookup")
+		return errLookupFailed
 	}
+	base.fillMetadata(dst, pfx, meta)
+	return nil
+}
+
+// ExplainIP returns metadata for a given IP address with the matched range and its source rows.
+func (base *RegistryIP) ExplainIP(ctx context.Context, addr netip.Addr) (*model.IPMetadata, []model.LookupMatch, error) {
+	rng, meta, ok := base.reg.GetRange(addr)
+	if !ok {
+		return nil, nil, errLookupFailed
+	}
+
+	match := explainMatch(rng, addr, base.origins.rows(addr, base.report))
+	return base.metadata(match.Network, meta), []model.LookupMatch{match}, nil
+}
+
+// CountryPrefixes returns the aggregated networks answered with the country code.
+func (base *RegistryIP) CountryPrefixes(cc string) []netip.Prefix {
+	return base.reverse.countryPrefixes(cc)
+}
 
-	data := &model.IPMetadata{
+// ASNPrefixes returns the aggregated networks answered with the AS number.
+func (base *RegistryIP) ASNPrefixes(asn int32) []netip.Prefix {
+	return base.reverse.asPrefixes(asn)
+}
+
+// CountrySummary returns the precomputed statistics of a country.
+func (base *RegistryIP) CountrySummary(cc string) (model.CountrySummary, bool) {
+	return base.reverse.getCountrySummary(cc)
+}
+
+// ASSummary returns the precomputed statistics of an autonomous system.
+func (base *RegistryIP) ASSummary(asn int32) (model.ASSummary, bool) {
+	return base.reverse.getASSummary(asn)
+}
+
+// SearchAS returns the page of autonomous systems matching query by name, org or domain.
+func (base *RegistryIP) SearchAS(query string, offset, limit int) model.ASSearchResult {
+	return base.search.search(query, offset, limit)
+}
+
+// ASByDomain returns the autonomous systems of the domain or of its closest registered parent domain.
+func (base *RegistryIP) ASByDomain(domain string) model.DomainASes {
+	return base.search.byDomain(domain)
+}
+
+func (base *RegistryIP) reverseKeys(meta networkMeta) (cc string, asn int32) {
+	if idx, ok := meta.getCountryIdxID(); ok {
+		cc = base.countryTable[idx].CountryCode
+	}
+	if idx, ok := meta.getAsIdxID(); ok {
+		asn = base.asTable[idx].Number
+	}
+	return cc, asn
+}
+
+func (base *RegistryIP) metadata(pfx netip.Prefix, meta networkMeta) *model.IPMetadata {
+	data := &model.IPMetadata{}
+	base.fillMetadata(data, pfx, meta)
+	return data
+}
+
+// fillMetadata overwrites data with the network and the table records of meta.
+func (base *RegistryIP) fillMetadata(data *model.IPMetadata, pfx netip.Prefix, meta networkMeta) {
+	*data = model.IPMetadata{
 		Type:    model.NetworkGlobal,
 		Network: pfx,
 	}
 
 	if idx, ok := meta.getCountryIdxID(); ok {
-		c := base.countryTable[idx]
+		c := &base.countryTable[idx]
 		data.Geo = model.IPGeo{
-			ContinentCode: model.GeoCode(c.ContinentCode),
-			CountryCode:   model.GeoCode(c.CountryCode),
-			CountryName:   c.CountryName,
+			ContinentCode:          model.GeoCode(c.ContinentCode),
+			CountryCode:            model.GeoCode(c.CountryCode),
+			CountryName:            c.CountryName,
+			RegionName:             c.RegionName,
+			CityName:               c.CityName,
+			RegisteredCountryCode:  model.GeoCode(c.RegisteredCountryCode),
+			RepresentedCountryCode: model.GeoCode(c.RepresentedCountryCode),
+			AnonymousProxy:         c.AnonymousProxy,
+			SatelliteProvider:      c.SatelliteProvider,
 		}
 	}
 
 	if idx, ok := meta.getAsIdxID(); ok {
-		c := base.asTable[idx]
+		c := &base.asTable[idx]
 		data.ASN = model.IPAS{
 			ASN:         c.Number,
 			CountryCode: model.GeoCode(c.CountryCode),
@@ -144,16 +303,30 @@ func (base *RegistryIP) LookupIP(ctx context.Context, addr netip.Addr) (*model.I
 			Domain:      c.Domain,
 		}
 	}
+}
 
-	return data, nil
+// explainMatch describes the registry range holding addr.
+func explainMatch(rng netipx.IPRange, addr netip.Addr, rows []model.SourceRow) model.LookupMatch {
+	return model.LookupMatch{
+		Start:   rng.From(),
+		End:     rng.To(),
+		Network: ipsetdata.PrefixIn(rng, addr),
+		Rows:    rows,
+	}
 }
 
 // ===============================
 
 type countryData struct {
-	ContinentCode string
-	CountryCode   string
-	CountryName   string
+	ContinentCode          string
+	CountryCode            string
+	CountryName            string
+	RegionName             string
+	CityName               string
+	RegisteredCountryCode  string
+	RepresentedCountryCode string
+	AnonymousProxy         bool
+	SatelliteProvider      bool
 }
 
 type asData struct {
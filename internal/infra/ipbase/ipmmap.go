@@ -0,0 +1,396 @@
+package ipbase
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"iter"
+	"math/big"
+	"net/netip"
+	"os"
+	"sort"
+	"unsafe"
+
+	"github.com/eterline/ipcsv2base/internal/model"
+	"github.com/eterline/ipcsv2base/pkg/ipsetdata"
+	mmaprc "github.com/eterline/ipcsv2base/pkg/mmapread"
+	"go4.org/netipx"
+)
+
+/*
+RegistryMmap - Lookup registry served from a memory mapped compiled base file.
+
+	Ranges, records and strings stay in the file and are paged in by the
+	kernel on access, the heap holds only the mapping bounds. Resident
+	memory follows the looked up working set, not the dataset size.
+	Compiled bases are written by Compilable registries.
+*/
+type RegistryMmap struct {
+	loadReporter
+	m         *mmaprc.Mapping
+	advice    mmaprc.Advice
+	hdr       compiledHeader
+	v4, v6    []byte // range sections
+	countries []byte
+	ases      []byte
+	strs      []byte
+	stats     statsCache
+}
+
+// OpenRegistryMmap maps a compiled base file, advice hints the kernel about the lookup access pattern.
+// With a verifier the mapped bytes are hashed and verified like loaded sources, without one the file
+// is described by its status only, so no page is read before lookups. The file must stay unchanged until Close.
+func OpenRegistryMmap(ctx context.Context, path string, advice mmaprc.Advice, opts ...LoadOption) (*RegistryMmap, error) {
+	ls := newLoadState(opts...)
+	src := ls.source(path)
+
+	m, err := mapCompiled(ctx, ls, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ls.describe(ctx); err != nil {
+		m.Close()
+		return nil, err
+	}
+
+	base, err := newRegistryMmap(m)
+	if err != nil {
+		m.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	base.advice = advice
+	if err := m.Advise(advice); err != nil {
+		m.Close()
+		return nil, fmt.Errorf("failed to advise compiled base mapping: %w", err)
+	}
+
+	src.rep.File.BuildDate = base.hdr.dataTime
+	src.rep.RowsRead = int64(base.Size())
+	src.rep.RowsAccepted = src.rep.RowsRead
+	if err := ls.finish(); err != nil {
+		m.Close()
+		return nil, err
+	}
+
+	base.report = ls.report()
+	return base, nil
+}
+
+/*
+mapCompiled - Maps a compiled base file and describes it.
+
+	With a verifier the mapped bytes are verified, so lookups are served from
+	the verified data. Hashing faults in every page, the pages are released
+	afterwards and read again on access, resident memory keeps following the
+	looked up working set.
+*/
+func mapCompiled(ctx context.Context, ls *loadState, path string) (*mmaprc.Mapping, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map compiled base: %w", err)
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to map compiled base: %w", err)
+	}
+
+	m, err := mmaprc.MapFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map compiled base: %w", err)
+	}
+
+	if ls.opts.verifier == nil {
+		ls.describeStat(path, st)
+		return m, nil
+	}
+
+	if err := ls.describeData(ctx, path, st, m.Bytes()); err != nil {
+		m.Close()
+		return nil, err
+	}
+	if err := m.Advise(mmaprc.AdviceDontNeed); err != nil {
+		m.Close()
+		return nil, fmt.Errorf("failed to release hashed compiled base pages: %w", err)
+	}
+	return m, nil
+}
+
+// newRegistryMmap slices the sections of a mapped compiled base.
+func newRegistryMmap(m *mmaprc.Mapping) (*RegistryMmap, error) {
+	b := m.Bytes()
+
+	hdr, err := decodeCompiledHeader(b, len(b))
+	if err != nil {
+		return nil, err
+	}
+
+	off4, off6, offC, offA, offS, size := hdr.sections()
+	return &RegistryMmap{
+		m:         m,
+		hdr:       hdr,
+		v4:        b[off4:off6],
+		v6:        b[off6:offC],
+		countries: b[offC:offA],
+		ases:      b[offA:offS],
+		strs:      b[offS:size],
+	}, nil
+}
+
+// Size returns the number of IP ranges in the registry.
+func (base *RegistryMmap) Size() int {
+	return base.hdr.n4 + base.hdr.n6
+}
+
+// Close unmaps the compiled base, the registry must not be used afterwards.
+func (base *RegistryMmap) Close() error {
+	return base.m.Close()
+}
+
+// LookupIP returns metadata for a given IP address.
+func (base *RegistryMmap) LookupIP(ctx context.Context, addr netip.Addr) (*model.IPMetadata, error) {
+	data := &model.IPMetadata{}
+	if err := base.LookupIPInto(ctx, addr, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// LookupIPInto fills dst with metadata for a given IP address.
+// Strings are copied out of the mapping, so results outlive the registry.
+// The network is the widest prefix of the resolved range holding addr, nested source networks are not kept.
+func (base *RegistryMmap) LookupIPInto(ctx context.Context, addr netip.Addr, dst *model.IPMetadata) error {
+	rng, rec, ok := base.find(addr)
+	if !ok {
+		return errLookupFailed
+	}
+
+	base.fillMetadata(dst, ipsetdata.PrefixIn(rng, addr), rec)
+	return nil
+}
+
+// ExplainIP returns metadata for a given IP address with the matched range, compiled bases keep no source rows.
+func (base *RegistryMmap) ExplainIP(ctx context.Context, addr netip.Addr) (*model.IPMetadata, []model.LookupMatch, error) {
+	rng, rec, ok := base.find(addr)
+	if !ok {
+		return nil, nil, errLookupFailed
+	}
+
+	match := explainMatch(rng, addr, nil)
+	data := &model.IPMetadata{}
+	base.fillMetadata(data, match.Network, rec)
+	return data, []model.LookupMatch{match}, nil
+}
+
+// find returns the range holding addr and the country and AS record keys of the range.
+// IPv4 addresses may also fall into IPv6 ranges of the IPv4-mapped block.
+func (base *RegistryMmap) find(addr netip.Addr) (rng netipx.IPRange, rec []byte, ok bool) {
+	if addr.Is4() || addr.Is4In6() {
+		if rng, rec, ok := base.find4(addr.Unmap()); ok {
+			return rng, rec, true
+		}
+		addr = netip.AddrFrom16(addr.As16())
+	}
+	return base.find6(addr)
+}
+
+func (base *RegistryMmap) find4(addr netip.Addr) (netipx.IPRange, []byte, bool) {
+	a := addr.As4()
+	ip := binary.BigEndian.Uint32(a[:])
+
+	i := sort.Search(base.hdr.n4, func(i int) bool {
+		return binary.LittleEndian.Uint32(base.v4[i*compiledRange4Size:]) > ip
+	}) - 1
+	if i < 0 {
+		return netipx.IPRange{}, nil, false
+	}
+
+	r := base.v4[i*compiledRange4Size : (i+1)*compiledRange4Size]
+	end := binary.LittleEndian.Uint32(r[4:])
+	if ip > end {
+		return netipx.IPRange{}, nil, false
+	}
+
+	var from, to [4]byte
+	binary.BigEndian.PutUint32(from[:], binary.LittleEndian.Uint32(r))
+	binary.BigEndian.PutUint32(to[:], end)
+	return netipx.IPRangeFrom(netip.AddrFrom4(from), netip.AddrFrom4(to)), r[8:], true
+}
+
+func (base *RegistryMmap) find6(addr netip.Addr) (netipx.IPRange, []byte, bool) {
+	a := addr.As16()
+	hi, lo := binary.BigEndian.Uint64(a[:8]), binary.BigEndian.Uint64(a[8:])
+
+	i := sort.Search(base.hdr.n6, func(i int) bool {
+		r := base.v6[i*compiledRange6Size:]
+		shi, slo := binary.BigEndian.Uint64(r), binary.BigEndian.Uint64(r[8:])
+		return shi > hi || shi == hi && slo > lo
+	}) - 1
+	if i < 0 {
+		return netipx.IPRange{}, nil, false
+	}
+
+	r := base.v6[i*compiledRange6Size : (i+1)*compiledRange6Size]
+	ehi, elo := binary.BigEndian.Uint64(r[16:]), binary.BigEndian.Uint64(r[24:])
+	if hi > ehi || hi == ehi && lo > elo {
+		return netipx.IPRange{}, nil, false
+	}
+
+	return netipx.IPRangeFrom(netip.AddrFrom16([16]byte(r[:16])), netip.AddrFrom16([16]byte(r[16:32]))), r[32:], true
+}
+
+// DiffRanges yields the networks of the registry with their country code and AS number.
+// IPv6 ranges below the IPv4-mapped block come first, as the order of Diffable requires.
+func (base *RegistryMmap) DiffRanges() iter.Seq2[netipx.IPRange, NetworkKey] {
+	return func(yield func(netipx.IPRange, NetworkKey) bool) {
+		range6 := func(i int) (netipx.IPRange, NetworkKey) {
+			r := base.v6[i*compiledRange6Size:]
+			return netipx.IPRangeFrom(netip.AddrFrom16([16]byte(r[:16])), netip.AddrFrom16([16]byte(r[16:32]))), base.networkKey(r[32:])
+		}
+
+		i6 := 0
+		for ; i6 < base.hdr.n6; i6++ {
+			rng, key := range6(i6)
+			if !rng.From().Less(mapped4First) {
+				break
+			}
+			if !yield(rng, key) {
+				return
+			}
+		}
+
+		for i := range base.hdr.n4 {
+			r := base.v4[i*compiledRange4Size:]
+			var from, to [4]byte
+			binary.BigEndian.PutUint32(from[:], binary.LittleEndian.Uint32(r))
+			binary.BigEndian.PutUint32(to[:], binary.LittleEndian.Uint32(r[4:]))
+			if !yield(netipx.IPRangeFrom(netip.AddrFrom4(from), netip.AddrFrom4(to)), base.networkKey(r[8:])) {
+				return
+			}
+		}
+
+		for ; i6 < base.hdr.n6; i6++ {
+			if !yield(range6(i6)) {
+				return
+			}
+		}
+	}
+}
+
+// networkKey decodes the country code and AS number of the range keys in rec.
+func (base *RegistryMmap) networkKey(rec []byte) (key NetworkKey) {
+	if id := int(binary.LittleEndian.Uint32(rec)); id > 0 && id <= base.hdr.countries {
+		key.CountryCode = model.GeoCode(base.str(base.countries[(id-1)*compiledCountrySize+8:]))
+	}
+	if id := int(binary.LittleEndian.Uint32(rec[4:])); id > 0 && id <= base.hdr.ases {
+		key.ASN = int32(binary.LittleEndian.Uint32(base.ases[(id-1)*compiledASSize:]))
+	}
+	return key
+}
+
+// fillMetadata overwrites data with the network and the records of the range keys in rec.
+func (base *RegistryMmap) fillMetadata(data *model.IPMetadata, network netip.Prefix, rec []byte) {
+	*data = model.IPMetadata{
+		Type:    model.NetworkGlobal,
+		Network: network,
+	}
+
+	if id := int(binary.LittleEndian.Uint32(rec)); id > 0 && id <= base.hdr.countries {
+		c := base.countries[(id-1)*compiledCountrySize:]
+		flags := binary.LittleEndian.Uint32(c[56:])
+		data.Geo = model.IPGeo{
+			ContinentCode:          model.GeoCode(base.str(c)),
+			CountryCode:            model.GeoCode(base.str(c[8:])),
+			CountryName:            base.str(c[16:]),
+			RegionName:             base.str(c[24:]),
+			CityName:               base.str(c[32:]),
+			RegisteredCountryCode:  model.GeoCode(base.str(c[40:])),
+			RepresentedCountryCode: model.GeoCode(base.str(c[48:])),
+			AnonymousProxy:         flags&compiledAnonymousProxy != 0,
+			SatelliteProvider:      flags&compiledSatelliteProvider != 0,
+		}
+	}
+
+	if id := int(binary.LittleEndian.Uint32(rec[4:])); id > 0 && id <= base.hdr.ases {
+		a := base.ases[(id-1)*compiledASSize:]
+		data.ASN = model.IPAS{
+			ASN:         int32(binary.LittleEndian.Uint32(a)),
+			CountryCode: model.GeoCode(base.str(a[4:])),
+			Name:        base.str(a[12:]),
+			Org:         base.str(a[20:]),
+			Domain:      base.str(a[28:]),
+		}
+	}
+}
+
+// str copies the string of a string ref, refs outside the blob decode as empty.
+func (base *RegistryMmap) str(ref []byte) string {
+	off, n := uint64(binary.LittleEndian.Uint32(ref)), uint64(binary.LittleEndian.Uint32(ref[4:]))
+	if n == 0 || off+n > uint64(len(base.strs)) {
+		return ""
+	}
+	return string(base.strs[off : off+n])
+}
+
+// IPv4-mapped block boundaries, holes holding them separate the IPv6 ranges below and above the IPv4 ones.
+var (
+	mapped4First = netip.MustParseAddr("::ffff:0.0.0.0")
+	mapped4Last  = netip.MustParseAddr("::ffff:255.255.255.255")
+)
+
+/*
+Stats returns structure statistics of the registry, computed once.
+
+	Ranges are scanned from the file, their pages are released afterwards
+	so the scan does not stay in the working set. Compiled ranges are
+	disjoint and coalesced, overlaps and coalescable ranges are always zero.
+*/
+func (base *RegistryMmap) Stats() model.BaseStats {
+	return base.stats.get(func() model.BaseStats {
+		st := model.BaseStats{
+			Ranges4:   base.hdr.n4,
+			Ranges6:   base.hdr.n6,
+			Space6:    new(big.Int),
+			Countries: base.hdr.countries,
+			ASes:      base.hdr.ases,
+			Heap: []model.HeapUsage{
+				{Structure: "registry", Bytes: int64(unsafe.Sizeof(*base))},
+			},
+		}
+
+		var prevEnd4 uint32
+		for i := range base.hdr.n4 {
+			r := base.v4[i*compiledRange4Size:]
+			start, end := binary.LittleEndian.Uint32(r), binary.LittleEndian.Uint32(r[4:])
+			if i > 0 && start-prevEnd4 > 1 {
+				st.Gaps4++
+			}
+			prevEnd4 = end
+			st.Space4 += uint64(end-start) + 1
+		}
+
+		var prevEnd6 netip.Addr
+		for i := range base.hdr.n6 {
+			r := base.v6[i*compiledRange6Size:]
+			start, end := netip.AddrFrom16([16]byte(r[:16])), netip.AddrFrom16([16]byte(r[16:32]))
+
+			holdsMapped := prevEnd6.Less(mapped4First) && mapped4Last.Less(start)
+			if prevEnd6.IsValid() && prevEnd6.Next() != start && (base.hdr.n4 == 0 || !holdsMapped) {
+				st.Gaps6++
+			}
+			prevEnd6 = end
+
+			size := new(big.Int).Sub(new(big.Int).SetBytes(r[16:32]), new(big.Int).SetBytes(r[:16]))
+			st.Space6.Add(st.Space6, size.Add(size, big.NewInt(1)))
+		}
+
+		// release the scanned range pages, lookups page in their working set again
+		n := len(base.v4) + len(base.v6)
+		base.m.AdviseRange(mmaprc.AdviceDontNeed, compiledHeaderSize, n)
+		base.m.AdviseRange(base.advice, compiledHeaderSize, n)
+		return st
+	})
+}
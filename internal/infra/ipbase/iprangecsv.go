@@ -0,0 +1,408 @@
+package ipbase
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/eterline/ipcsv2base/pkg/ipsetdata"
+)
+
+// rangeParseFunc converts the first two fields of a record to an inclusive address range.
+type rangeParseFunc func(from, to string) (start, end netip.Addr, err error)
+
+// rangeEachFunc receives the range of a record, its remaining fields and its source line.
+type rangeEachFunc func(start, end netip.Addr, fields []string, line int64) error
+
+/*
+NewRegistryIP2Location constructs a new RegistryIP from IP2Location CSV files.
+
+	Geo files use the DB1 (country), DB3 (+ region, city) and wider layouts,
+	ASN files use the ip_from,ip_to,cidr,asn,as layout. Ranges are encoded as
+	decimal integers, 128-bit wide for the IPv6 databases.
+	ver specifies the IP version filter (IPv4, IPv6, or both).
+*/
+func NewRegistryIP2Location(ctx context.Context, geoCSV, asnCSV []string, ver IPVersion, opts ...LoadOption) (*RegistryIP, error) {
+	ls := newLoadState(opts...)
+	defer ls.trackProgress(ctx)()
+
+	countryTable := newUniqueRangeTable[countryData](0)
+	astable := newUniqueRangeTable[asData](0)
+
+	var tasks []func(context.Context) error
+
+	for _, file := range geoCSV {
+		src := ls.source(file)
+		tasks = append(tasks, readTask("CSV", file, src, func(ctx context.Context) error {
+			return rangeCSVForEach(
+				ctx, file, 4, ver, src, parseIP2LocationRange,
+				func(start, end netip.Addr, fields []string, line int64) error {
+					// "-" marks unallocated and reserved space
+					if fields[0] == "-" || fields[0] == "" {
+						return errRowFiltered
+					}
+
+					data := countryData{
+						CountryCode: fields[0],
+						CountryName: fields[1],
+					}
+					if len(fields) >= 4 {
+						data.RegionName = fields[2]
+						data.CityName = fields[3]
+					}
+
+					countryTable.Add(start, end, data)
+					ls.origins.addGeo(src, line, start, end)
+					return nil
+				},
+			)
+		}))
+	}
+
+	for _, file := range asnCSV {
+		src := ls.source(file)
+		tasks = append(tasks, readTask("CSV", file, src, func(ctx context.Context) error {
+			return rangeCSVForEach(
+				ctx, file, 5, ver, src, parseIP2LocationRange,
+				func(start, end netip.Addr, fields []string, line int64) error {
+					// fields: cidr, asn, as
+					if fields[1] == "-" {
+						return errRowFiltered
+					}
+
+					asn, err := strconv.ParseInt(fields[1], 10, 32)
+					if err != nil {
+						return skipRow(SkipInvalidASN)
+					}
+
+					astable.Add(start, end, asData{
+						Number: int32(asn),
+						Name:   fields[2],
+						Org:    fields[2],
+					})
+					ls.origins.addAS(src, line, start, end)
+					return nil
+				},
+			)
+		}))
+	}
+
+	if err := ls.describe(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := runParallel(ctx, ls.opts.workers, tasks...); err != nil {
+		return nil, err
+	}
+
+	if err := ls.finish(); err != nil {
+		return nil, err
+	}
+
+	reg := newRegistryIPFromRanges(countryTable, astable, ls.opts.index)
+	reg.report = ls.report()
+	reg.origins = ls.prepareOrigins()
+	return reg, nil
+}
+
+/*
+NewRegistryDBIP constructs a new RegistryIP from DB-IP CSV files.
+
+	Geo files use the country (start,end,country) or city
+	(start,end,continent,country,region,city,...) layouts,
+	ASN files use the start,end,asn,org layout.
+	ver specifies the IP version filter (IPv4, IPv6, or both).
+*/
+func NewRegistryDBIP(ctx context.Context, geoCSV, asnCSV []string, ver IPVersion, opts ...LoadOption) (*RegistryIP, error) {
+	ls := newLoadState(opts...)
+	ls.buildDate = dbipBuildDate
+	defer ls.trackProgress(ctx)()
+
+	countryTable := newUniqueRangeTable[countryData](0)
+	astable := newUniqueRangeTable[asData](0)
+
+	var tasks []func(context.Context) error
+
+	for _, file := range geoCSV {
+		src := ls.source(file)
+		tasks = append(tasks, readTask("CSV", file, src, func(ctx context.Context) error {
+			return rangeCSVForEach(
+				ctx, file, 3, ver, src, parseStartEndRange,
+				func(start, end netip.Addr, fields []string, line int64) error {
+					var data countryData
+
+					switch {
+					case len(fields) >= 4:
+						data = countryData{
+							ContinentCode: fields[0],
+							CountryCode:   fields[1],
+							RegionName:    fields[2],
+							CityName:      fields[3],
+						}
+					case len(fields) == 1:
+						data = countryData{CountryCode: fields[0]}
+					default:
+						return skipRow(SkipFieldCount)
+					}
+
+					// "ZZ" marks unallocated and reserved space
+					if data.CountryCode == "ZZ" || data.CountryCode == "" {
+						return errRowFiltered
+					}
+
+					countryTable.Add(start, end, data)
+					ls.origins.addGeo(src, line, start, end)
+					return nil
+				},
+			)
+		}))
+	}
+
+	for _, file := range asnCSV {
+		src := ls.source(file)
+		tasks = append(tasks, readTask("CSV", file, src, func(ctx context.Context) error {
+			return rangeCSVForEach(
+				ctx, file, 4, ver, src, parseStartEndRange,
+				func(start, end netip.Addr, fields []string, line int64) error {
+					// fields: asn, org
+					asn, err := strconv.ParseInt(fields[0], 10, 32)
+					if err != nil {
+						return skipRow(SkipInvalidASN)
+					}
+
+					astable.Add(start, end, asData{
+						Number: int32(asn),
+						Name:   fields[1],
+						Org:    fields[1],
+					})
+					ls.origins.addAS(src, line, start, end)
+					return nil
+				},
+			)
+		}))
+	}
+
+	if err := ls.describe(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := runParallel(ctx, ls.opts.workers, tasks...); err != nil {
+		return nil, err
+	}
+
+	if err := ls.finish(); err != nil {
+		return nil, err
+	}
+
+	reg := newRegistryIPFromRanges(countryTable, astable, ls.opts.index)
+	reg.report = ls.report()
+	reg.origins = ls.prepareOrigins()
+	return reg, nil
+}
+
+// rangeCSVForEach reads a headerless range CSV file with at least minFields columns.
+// Rows are counted in src, header lines are reported as rows with invalid keys.
+// Parts of large raw files are read concurrently, do must be safe for concurrent use.
+func rangeCSVForEach(
+	ctx context.Context,
+	file string,
+	minFields int,
+	verAllow IPVersion,
+	src *sourceCounter,
+	parse rangeParseFunc,
+	do rangeEachFunc,
+) error {
+	return fileSource(file, csvFraming)(ctx, false, src, nil,
+		func(ctx context.Context, part sourcePart, src *sourceCounter) error {
+			rd := newCSVRecordReader(part.r, ',', false, -1)
+
+			return readRecords(ctx, rd, part.line, src, func(line int64, recs []string) error {
+				if len(recs) < minFields {
+					return skipRow(SkipFieldCount)
+				}
+
+				start, end, err := parse(recs[0], recs[1])
+				if err != nil {
+					return skipRow(SkipInvalidKey)
+				}
+				if !verAllow.validate(start) {
+					return errRowFiltered
+				}
+
+				return do(start, end, recs[2:], line)
+			})
+		},
+	)
+}
+
+// parseStartEndRange parses a range of two textual addresses.
+func parseStartEndRange(from, to string) (start, end netip.Addr, err error) {
+	start, err = netip.ParseAddr(strings.TrimSpace(from))
+	if err != nil {
+		return start, end, err
+	}
+
+	end, err = netip.ParseAddr(strings.TrimSpace(to))
+	if err != nil {
+		return start, end, err
+	}
+
+	if start.Is4() != end.Is4() || end.Less(start) {
+		return start, end, errors.New("invalid address range")
+	}
+
+	return start, end, nil
+}
+
+/*
+parseIP2LocationRange parses a range of two decimal encoded addresses.
+
+	The address family is decided by the range end: values fitting into
+	32 bits are IPv4, anything wider is IPv6 with IPv4-mapped space normalized to IPv4.
+*/
+func parseIP2LocationRange(from, to string) (start, end netip.Addr, err error) {
+	fromU, err := ParseUint128tDecimal(strings.TrimSpace(from))
+	if err != nil {
+		return start, end, err
+	}
+
+	toU, err := ParseUint128tDecimal(strings.TrimSpace(to))
+	if err != nil {
+		return start, end, err
+	}
+
+	if toU.Less(fromU) {
+		return start, end, errors.New("invalid address range")
+	}
+
+	if toU.Is32() {
+		return fromU.ToAddr4(), toU.ToAddr4(), nil
+	}
+
+	start, end = fromU.ToAddr(), toU.ToAddr()
+	if start.Is4() != end.Is4() {
+		return start, end, errors.New("address range crosses IPv4-mapped space")
+	}
+
+	return start, end, nil
+}
+
+// ==========================
+
+// metaRange is an inclusive address range with merged network metadata.
+type metaRange struct {
+	start uint128t
+	end   uint128t
+	meta  networkMeta
+}
+
+// newRegistryIPFromRanges merges country and AS range tables into a prepared RegistryIP.
+func newRegistryIPFromRanges(countryTable *uniqueRangeTable[countryData], astable *uniqueRangeTable[asData], index ipsetdata.IndexKind) *RegistryIP {
+	merged := mergeIDRanges(countryTable.SortedRanges(), astable.SortedRanges())
+	countryTable.Clear()
+	astable.Clear()
+
+	set := ipsetdata.NewIPContainerSet[networkMeta](len(merged), ipsetdata.WithIndex(index))
+	for _, r := range merged {
+		set.AddStartEnd(r.start.ToAddr(), r.end.ToAddr(), r.meta)
+	}
+	set.Prepare()
+
+	return newRegistryIPFromSet(set, countryTable.Table(), astable.Table())
+}
+
+/*
+mergeIDRanges - Sweeps two sorted range lists into non-overlapping segments.
+
+	Every segment carries the country id and AS id covering it,
+	adjacent segments with equal metadata are coalesced.
+*/
+func mergeIDRanges(country, as []idRange) []metaRange {
+	var (
+		out  = make([]metaRange, 0, max(len(country), len(as)))
+		i, j int
+		pos  uint128t
+	)
+
+	for {
+		for i < len(country) && country[i].end.Less(pos) {
+			i++
+		}
+		for j < len(as) && as[j].end.Less(pos) {
+			j++
+		}
+
+		hasC, hasA := i < len(country), j < len(as)
+		if !hasC && !hasA {
+			return out
+		}
+
+		// segment starts at the nearest covered address
+		start := pos
+		switch {
+		case hasC && hasA:
+			start = maxUint128t(pos, minUint128t(country[i].start, as[j].start))
+		case hasC:
+			start = maxUint128t(pos, country[i].start)
+		default:
+			start = maxUint128t(pos, as[j].start)
+		}
+
+		end := uint128t{hi: ^uint64(0), lo: ^uint64(0)}
+		var meta networkMeta
+
+		if hasC {
+			if c := country[i]; !start.Less(c.start) {
+				meta.countryID = c.id
+				end = minUint128t(end, c.end)
+			} else {
+				prev, _ := c.start.Dec()
+				end = minUint128t(end, prev)
+			}
+		}
+
+		if hasA {
+			if a := as[j]; !start.Less(a.start) {
+				meta.setAsID(a.id)
+				end = minUint128t(end, a.end)
+			} else {
+				prev, _ := a.start.Dec()
+				end = minUint128t(end, prev)
+			}
+		}
+
+		if n := len(out); n > 0 && out[n-1].meta == meta && adjacentUint128t(out[n-1].end, start) {
+			out[n-1].end = end
+		} else {
+			out = append(out, metaRange{start: start, end: end, meta: meta})
+		}
+
+		next, ok := end.Inc()
+		if !ok {
+			return out
+		}
+		pos = next
+	}
+}
+
+// adjacentUint128t reports whether b directly follows a.
+func adjacentUint128t(a, b uint128t) bool {
+	next, ok := a.Inc()
+	return ok && next == b
+}
+
+func minUint128t(a, b uint128t) uint128t {
+	if a.Less(b) {
+		return a
+	}
+	return b
+}
+
+func maxUint128t(a, b uint128t) uint128t {
+	if a.Less(b) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,117 @@
+package ipbase
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestParseIP2LocationRange(t *testing.T) {
+	tests := []struct {
+		name       string
+		from, to   string
+		start, end string
+		wantErr    bool
+	}{
+		{name: "IPv4", from: "16777216", to: "16777471", start: "1.0.0.0", end: "1.0.0.255"},
+		{name: "IPv4 full", from: "0", to: "4294967295", start: "0.0.0.0", end: "255.255.255.255"},
+		{name: "IPv4-mapped", from: "281470698520576", to: "281470698520831", start: "1.0.0.0", end: "1.0.0.255"},
+		{name: "IPv4-mapped block", from: "281470681743360", to: "281474976710655", start: "0.0.0.0", end: "255.255.255.255"},
+		{name: "IPv6", from: "42540766411282592856903984951653826560", to: "42540766411282592875350729025363378175", start: "2001:db8::", end: "2001:db8::ffff:ffff:ffff:ffff"},
+		{name: "into IPv4-mapped", from: "281470681743359", to: "281470681743360", wantErr: true},
+		{name: "out of IPv4-mapped", from: "281474976710655", to: "281474976710656", wantErr: true},
+		{name: "reversed", from: "16777471", to: "16777216", wantErr: true},
+		{name: "not a number", from: "1.0.0.0", to: "16777216", wantErr: true},
+	}
+	for _, tt := range tests {
+		start, end, err := parseIP2LocationRange(tt.from, tt.to)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if start != netip.MustParseAddr(tt.start) || end != netip.MustParseAddr(tt.end) {
+			t.Errorf("%s: got %s-%s, want %s-%s", tt.name, start, end, tt.start, tt.end)
+		}
+	}
+}
+
+func TestMergeIDRanges(t *testing.T) {
+	u := func(s string) uint128t { return Addr2Uint128t(netip.MustParseAddr(s)) }
+	id := func(from, to string, id uint32) idRange { return idRange{start: u(from), end: u(to), id: id} }
+	seg := func(from, to string, country, as uint32) metaRange {
+		return metaRange{start: u(from), end: u(to), meta: networkMeta{countryID: country, asID: as}}
+	}
+
+	tests := []struct {
+		name        string
+		country, as []idRange
+		want        []metaRange
+	}{
+		{
+			name:    "country nested in AS",
+			country: []idRange{id("1.0.5.0", "1.0.5.255", 1), id("1.0.6.0", "1.0.7.255", 2)},
+			as:      []idRange{id("1.0.0.0", "1.0.255.255", 7)},
+			want: []metaRange{
+				seg("1.0.0.0", "1.0.4.255", 0, 7),
+				seg("1.0.5.0", "1.0.5.255", 1, 7),
+				seg("1.0.6.0", "1.0.7.255", 2, 7),
+				seg("1.0.8.0", "1.0.255.255", 0, 7),
+			},
+		},
+		{
+			name:    "AS nested in country",
+			country: []idRange{id("1.0.0.0", "1.0.255.255", 1)},
+			as:      []idRange{id("1.0.5.0", "1.0.5.255", 7)},
+			want: []metaRange{
+				seg("1.0.0.0", "1.0.4.255", 1, 0),
+				seg("1.0.5.0", "1.0.5.255", 1, 7),
+				seg("1.0.6.0", "1.0.255.255", 1, 0),
+			},
+		},
+		{
+			name:    "adjacent with equal ids coalesce",
+			country: []idRange{id("1.0.0.0", "1.0.0.255", 1), id("1.0.1.0", "1.0.1.255", 1), id("1.0.2.0", "1.0.2.255", 2)},
+			as:      []idRange{id("1.0.0.0", "1.0.0.127", 7), id("1.0.0.128", "1.0.2.255", 7)},
+			want: []metaRange{
+				seg("1.0.0.0", "1.0.1.255", 1, 7),
+				seg("1.0.2.0", "1.0.2.255", 2, 7),
+			},
+		},
+		{
+			name:    "partial overlap",
+			country: []idRange{id("1.0.0.0", "1.0.1.255", 1)},
+			as:      []idRange{id("1.0.1.0", "1.0.2.255", 7)},
+			want: []metaRange{
+				seg("1.0.0.0", "1.0.0.255", 1, 0),
+				seg("1.0.1.0", "1.0.1.255", 1, 7),
+				seg("1.0.2.0", "1.0.2.255", 0, 7),
+			},
+		},
+		{
+			name:    "gap between ranges",
+			country: []idRange{id("1.0.0.0", "1.0.0.255", 1)},
+			as:      []idRange{id("1.0.2.0", "1.0.2.255", 7)},
+			want: []metaRange{
+				seg("1.0.0.0", "1.0.0.255", 1, 0),
+				seg("1.0.2.0", "1.0.2.255", 0, 7),
+			},
+		},
+		{
+			name:    "last address",
+			country: []idRange{id("ffff::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", 1)},
+			as:      []idRange{id("ffff:ffff::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", 7)},
+			want: []metaRange{
+				seg("ffff::", "ffff:fffe:ffff:ffff:ffff:ffff:ffff:ffff", 1, 0),
+				seg("ffff:ffff::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", 1, 7),
+			},
+		},
+	}
+	for _, tt := range tests {
+		if got := mergeIDRanges(tt.country, tt.as); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: mergeIDRanges = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
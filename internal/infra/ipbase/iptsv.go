@@ -4,65 +4,131 @@ import (
 	"bufio"
 	"bytes"
 	"context"
-	"errors"
 	"io"
 	"net/netip"
+	"sync"
 
 	"github.com/eterline/ipcsv2base/internal/model"
 	"github.com/eterline/ipcsv2base/pkg/ipsetdata"
-	mmaprc "github.com/eterline/ipcsv2base/pkg/mmapread"
 	"github.com/eterline/ipcsv2base/pkg/toolkit"
 )
 
 type RegistryIPTSV struct {
-	reg *ipsetdata.IPContainerSet[uint16]
+	loadReporter
+	reg     *ipsetdata.IPContainerSet[uint16]
+	origins *registryOrigins // nil unless row origins are enabled
+	reverse *reverseIndex
+	codes   map[uint16]model.GeoCode // decoded country codes of the set
+	stats   statsCache
 }
 
-func NewRegistryIPTSV(ctx context.Context, files ...string) (*RegistryIPTSV, error) {
-	set := ipsetdata.NewIPContainerSet[uint16](1 << 22)
+// NewRegistryIPTSV constructs a new RegistryIPTSV from start, end, country code TSV files.
+// Files and parts of large raw files are parsed concurrently, the load is cancelled with ctx.
+func NewRegistryIPTSV(ctx context.Context, files []string, opts ...LoadOption) (*RegistryIPTSV, error) {
+	ls := newLoadState(opts...)
+	defer ls.trackProgress(ctx)()
 
+	set := &lockedSet[uint16]{set: ipsetdata.NewIPContainerSet[uint16](1<<22, ipsetdata.WithIndex(ls.opts.index))}
+
+	tasks := make([]func(context.Context) error, 0, len(files))
 	for _, file := range files {
-		err := func() error {
-			src, err := mmaprc.OpenMMapReadCloser(file)
-			if err != nil {
+		src := ls.source(file)
+		tasks = append(tasks, readTask("TSV", file, src, func(ctx context.Context) error {
+			return fileSource(file, lineFraming)(ctx, false, src, nil,
+				func(ctx context.Context, part sourcePart, src *sourceCounter) error {
+					return readTSVPart(ctx, part, src, set, ls.origins)
+				},
+			)
+		}))
+	}
+
+	if err := ls.describe(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := runParallel(ctx, ls.opts.workers, tasks...); err != nil {
+		return nil, err
+	}
+
+	if err := ls.finish(); err != nil {
+		return nil, err
+	}
+
+	set.set.Prepare()
+
+	reverse := buildReverseIndex(set.set, func(code uint16) (string, int32) {
+		return string(tsvCountryCode(code)), 0
+	})
+	reverse.summarize(nil, nil)
+
+	return &RegistryIPTSV{
+		loadReporter: loadReporter{report: ls.report()},
+		reg:          set.set,
+		origins:      ls.prepareOrigins(),
+		reverse:      reverse,
+		codes:        tsvCountryCodes(set.set),
+	}, nil
+}
+
+// readTSVPart reads TSV lines of a source part into the set, origins may be nil.
+func readTSVPart(ctx context.Context, part sourcePart, counter *sourceCounter, set *lockedSet[uint16], origins *registryOrigins) error {
+	r := bufio.NewReaderSize(part.r, 1<<20)
+
+	var (
+		lineNum  = part.line
+		tooLong  bool // rest of an overlong line is being discarded
+		lastLine bool
+	)
+
+	for !lastLine {
+		if counter.checkpoint() {
+			if err := ctx.Err(); err != nil {
 				return err
 			}
-			defer src.Close()
-
-			r := bufio.NewReaderSize(src, 1<<20)
+		}
 
-			for {
-				line, err := r.ReadSlice('\n')
-				if err == bufio.ErrBufferFull {
-					continue
-				}
-				if err == io.EOF {
-					if len(line) > 0 {
-						if err := addToSet(set, line); err != nil {
-							return err
-						}
-					}
-					break
-				}
-				if err != nil {
+		line, err := r.ReadSlice('\n')
+		switch {
+		case err == bufio.ErrBufferFull:
+			if !tooLong {
+				lineNum++
+				counter.read()
+				if err := counter.skip(lineNum, SkipLineTooLong); err != nil {
 					return err
 				}
+			}
+			tooLong = true
+			continue
 
-				if err := addToSet(set, line); err != nil {
-					return err
-				}
+		case err == io.EOF:
+			lastLine = true
+			if len(line) == 0 {
+				continue
 			}
 
-			return nil
-		}()
+		case err != nil:
+			return err
+		}
+
+		if tooLong {
+			tooLong = false
+			continue
+		}
 
-		if err != nil {
-			return nil, err
+		lineNum++
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		counter.read()
+		if err := counter.handle(lineNum, addToSet(set, line, func(start, end netip.Addr) {
+			origins.addGeo(counter, lineNum, start, end)
+		})); err != nil {
+			return err
 		}
 	}
 
-	set.Prepare()
-	return &RegistryIPTSV{reg: set}, nil
+	return nil
 }
 
 // Size returns the number of IP prefixes in the registry.
@@ -72,36 +138,122 @@ func (base *RegistryIPTSV) Size() int {
 
 // LookupIP returns metadata for a given IP address.
 func (base *RegistryIPTSV) LookupIP(ctx context.Context, addr netip.Addr) (*model.IPMetadata, error) {
+	data := &model.IPMetadata{}
+	if err := base.LookupIPInto(ctx, addr, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// LookupIPInto fills dst with metadata for a given IP address without allocating.
+func (base *RegistryIPTSV) LookupIPInto(ctx context.Context, addr netip.Addr, dst *model.IPMetadata) error {
 	pfx, code, ok := base.reg.Get(addr)
 	if !ok {
-		return nil, errors.New("failed lookup")
+		return errLookupFailed
+	}
+	*dst = model.IPMetadata{
+		Type:    model.NetworkGlobal,
+		Network: pfx,
+		Geo:     model.IPGeo{CountryCode: base.countryCode(code)},
 	}
+	return nil
+}
 
-	codeBytes := make([]byte, 2)
-	toolkit.Uint16ToBytesLE(code, codeBytes)
+// ExplainIP returns metadata for a given IP address with the matched range and its source row.
+func (base *RegistryIPTSV) ExplainIP(ctx context.Context, addr netip.Addr) (*model.IPMetadata, []model.LookupMatch, error) {
+	rng, code, ok := base.reg.GetRange(addr)
+	if !ok {
+		return nil, nil, errLookupFailed
+	}
 
-	data := &model.IPMetadata{
+	match := explainMatch(rng, addr, base.origins.rows(addr, base.report))
+	return &model.IPMetadata{
 		Type:    model.NetworkGlobal,
-		Network: pfx,
-		Geo:     model.IPGeo{CountryCode: model.GeoCode(codeBytes)},
+		Network: match.Network,
+		Geo:     model.IPGeo{CountryCode: base.countryCode(code)},
+	}, []model.LookupMatch{match}, nil
+}
+
+// CountryPrefixes returns the aggregated networks answered with the country code.
+func (base *RegistryIPTSV) CountryPrefixes(cc string) []netip.Prefix {
+	return base.reverse.countryPrefixes(cc)
+}
+
+// ASNPrefixes returns nothing, TSV files carry no AS data.
+func (base *RegistryIPTSV) ASNPrefixes(asn int32) []netip.Prefix {
+	return nil
+}
+
+// CountrySummary returns the precomputed statistics of a country.
+func (base *RegistryIPTSV) CountrySummary(cc string) (model.CountrySummary, bool) {
+	return base.reverse.getCountrySummary(cc)
+}
+
+// ASSummary reports nothing, TSV files carry no AS data.
+func (base *RegistryIPTSV) ASSummary(asn int32) (model.ASSummary, bool) {
+	return model.ASSummary{}, false
+}
+
+// countryCode returns the decoded country code, precomputed for codes of the set.
+func (base *RegistryIPTSV) countryCode(code uint16) model.GeoCode {
+	if cc, ok := base.codes[code]; ok {
+		return cc
 	}
+	return tsvCountryCode(code)
+}
 
-	return data, nil
+// tsvCountryCodes decodes the distinct country codes of a prepared set.
+func tsvCountryCodes(set *ipsetdata.IPContainerSet[uint16]) map[uint16]model.GeoCode {
+	codes := make(map[uint16]model.GeoCode, 256)
+	for _, code := range set.All() {
+		if _, ok := codes[code]; !ok {
+			codes[code] = tsvCountryCode(code)
+		}
+	}
+	return codes
 }
 
-func addToSet(set *ipsetdata.IPContainerSet[uint16], line []byte) error {
-	rec := bytes.Split(line, []byte{'\t'})
+// tsvCountryCode decodes a country code packed by addToSet.
+func tsvCountryCode(code uint16) model.GeoCode {
+	codeBytes := make([]byte, 2)
+	toolkit.Uint16ToBytesLE(code, codeBytes)
+	return model.GeoCode(codeBytes)
+}
+
+// addToSet parses a TSV line into the set, added is called with the range of an accepted line.
+func addToSet(set *lockedSet[uint16], line []byte, added func(start, end netip.Addr)) error {
+	rec := bytes.Split(bytes.TrimRight(line, "\r\n"), []byte{'\t'})
 	if len(rec) != 3 {
-		return nil
+		return skipRow(SkipFieldCount)
 	}
 
 	if len(rec[2]) < 2 {
-		return nil
+		return skipRow(SkipShortCode)
 	}
 
-	return set.AddStartEndStrings(
-		toolkit.BytesToString(rec[0]),
-		toolkit.BytesToString(rec[1]),
-		toolkit.BytesToUint16LE(rec[2]),
-	)
+	start, err := netip.ParseAddr(toolkit.BytesToString(rec[0]))
+	if err != nil {
+		return skipRow(SkipInvalidKey)
+	}
+
+	end, err := netip.ParseAddr(toolkit.BytesToString(rec[1]))
+	if err != nil {
+		return skipRow(SkipInvalidKey)
+	}
+
+	set.AddStartEnd(start, end, toolkit.BytesToUint16LE(rec[2]))
+	added(start, end)
+	return nil
+}
+
+// lockedSet serializes additions of concurrent readers to the set.
+type lockedSet[T comparable] struct {
+	mu  sync.Mutex
+	set *ipsetdata.IPContainerSet[T]
+}
+
+func (s *lockedSet[T]) AddStartEnd(start, end netip.Addr, value T) {
+	s.mu.Lock()
+	s.set.AddStartEnd(start, end, value)
+	s.mu.Unlock()
 }
@@ -0,0 +1,127 @@
+package ipbase_test
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eterline/ipcsv2base/internal/infra/ipbase"
+	"github.com/eterline/ipcsv2base/internal/model"
+)
+
+const benchNetworks = 1 << 16
+
+// writeBenchFile writes rows produced per network index into a file of dir.
+func writeBenchFile(b *testing.B, dir, name, header string, row func(i int) string) string {
+	var sb strings.Builder
+	sb.WriteString(header)
+	for i := range benchNetworks {
+		sb.WriteString(row(i))
+	}
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(sb.String()), 0o644); err != nil {
+		b.Fatal(err)
+	}
+	return path
+}
+
+func benchAddrs() []netip.Addr {
+	addrs := make([]netip.Addr, benchNetworks)
+	for i := range addrs {
+		addrs[i] = netip.AddrFrom4([4]byte{10, byte(i >> 8), byte(i), byte(i * 7)})
+	}
+	return addrs
+}
+
+func newBenchRegistryIP(b *testing.B) *ipbase.RegistryIP {
+	dir := b.TempDir()
+	country := writeBenchFile(b, dir, "country.csv", "network,continent_code,country_code,country_name\n", func(i int) string {
+		return fmt.Sprintf("10.%d.%d.0/24,EU,C%c,Country %d\n", i>>8, i&0xff, 'A'+i%26, i%26)
+	})
+	asn := writeBenchFile(b, dir, "asn.csv", "network,asn,country_code,name,org,domain\n", func(i int) string {
+		return fmt.Sprintf("10.%d.%d.0/24,%d,C%c,NAME%d,Org %d,d%d.com\n", i>>8, i&0xff, 1000+i%512, 'A'+i%26, i%512, i%512, i%512)
+	})
+
+	reg, err := ipbase.NewRegistryIP(context.Background(), country, asn, ipbase.IPv4v6)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return reg
+}
+
+func newBenchRegistryIPTSV(b *testing.B) *ipbase.RegistryIPTSV {
+	file := writeBenchFile(b, b.TempDir(), "country.tsv", "", func(i int) string {
+		return fmt.Sprintf("10.%d.%d.0\t10.%d.%d.255\tC%c\n", i>>8, i&0xff, i>>8, i&0xff, 'A'+i%26)
+	})
+
+	reg, err := ipbase.NewRegistryIPTSV(context.Background(), []string{file})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return reg
+}
+
+// BenchmarkRegistryIPLookupInto - Lookup filling caller metadata, expected to be allocation free.
+func BenchmarkRegistryIPLookupInto(b *testing.B) {
+	reg, addrs := newBenchRegistryIP(b), benchAddrs()
+	ctx := context.Background()
+
+	var meta model.IPMetadata
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := reg.LookupIPInto(ctx, addrs[i&(benchNetworks-1)], &meta); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRegistryIPLookupIP - Lookup returning new metadata, one allocation per call.
+func BenchmarkRegistryIPLookupIP(b *testing.B) {
+	reg, addrs := newBenchRegistryIP(b), benchAddrs()
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := reg.LookupIP(ctx, addrs[i&(benchNetworks-1)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRegistryIPTSVLookupInto - TSV lookup filling caller metadata, expected to be allocation free.
+func BenchmarkRegistryIPTSVLookupInto(b *testing.B) {
+	reg, addrs := newBenchRegistryIPTSV(b), benchAddrs()
+	ctx := context.Background()
+
+	var meta model.IPMetadata
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := reg.LookupIPInto(ctx, addrs[i&(benchNetworks-1)], &meta); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRegistryIPLookupMiss - Lookup of addresses outside the registry.
+func BenchmarkRegistryIPLookupMiss(b *testing.B) {
+	reg := newBenchRegistryIP(b)
+	ctx := context.Background()
+	addr := netip.MustParseAddr("192.0.2.1")
+
+	var meta model.IPMetadata
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := reg.LookupIPInto(ctx, addr, &meta); err == nil {
+			b.Fatal("unexpected match")
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package ipbase
+
+import (
+	"net/netip"
+	"slices"
+	"sync"
+
+	"github.com/eterline/ipcsv2base/internal/model"
+)
+
+// Source row kinds of explained lookups.
+const (
+	RowKindGeo = "geo"
+	RowKindASN = "asn"
+)
+
+// rowOrigin - Address range of an accepted source row.
+type rowOrigin struct {
+	start uint128t
+	end   uint128t
+	src   uint32 // source index in the load report
+	line  uint32
+}
+
+/*
+originIndex - Source rows of accepted ranges of one kind.
+
+	add is safe for concurrent use, find requires prepare.
+*/
+type originIndex struct {
+	mu   sync.Mutex
+	rows []rowOrigin
+}
+
+func (x *originIndex) add(src *sourceCounter, line int64, start, end netip.Addr) {
+	x.mu.Lock()
+	x.rows = append(x.rows, rowOrigin{
+		start: Addr2Uint128t(start),
+		end:   Addr2Uint128t(end),
+		src:   src.id,
+		line:  uint32(line),
+	})
+	x.mu.Unlock()
+}
+
+func (x *originIndex) prepare() {
+	slices.SortFunc(x.rows, func(a, b rowOrigin) int {
+		return a.start.Compare(b.start)
+	})
+	x.rows = slices.Clip(x.rows)
+}
+
+// find returns the containing row with the latest start, the narrowest one of nested prefixes.
+// Rows are scanned back from addr, explain lookups only pay for it.
+func (x *originIndex) find(addr netip.Addr) (rowOrigin, bool) {
+	ip := Addr2Uint128t(addr)
+
+	// first row starting after addr
+	i, _ := slices.BinarySearchFunc(x.rows, ip, func(r rowOrigin, ip uint128t) int {
+		if ip.Less(r.start) {
+			return 1
+		}
+		return -1
+	})
+
+	var (
+		best  rowOrigin
+		found bool
+	)
+	for i--; i >= 0; i-- {
+		r := x.rows[i]
+		if found && r.start != best.start {
+			break
+		}
+		if r.end.Less(ip) {
+			continue
+		}
+		if !found || r.end.Less(best.end) {
+			best, found = r, true
+		}
+	}
+
+	return best, found
+}
+
+// registryOrigins - Source rows of geo and AS ranges, kept when row origins are enabled.
+type registryOrigins struct {
+	geo originIndex
+	as  originIndex
+}
+
+func (o *registryOrigins) addGeo(src *sourceCounter, line int64, start, end netip.Addr) {
+	if o != nil {
+		o.geo.add(src, line, start, end)
+	}
+}
+
+func (o *registryOrigins) addAS(src *sourceCounter, line int64, start, end netip.Addr) {
+	if o != nil {
+		o.as.add(src, line, start, end)
+	}
+}
+
+func (o *registryOrigins) prepare() {
+	if o != nil {
+		o.geo.prepare()
+		o.as.prepare()
+	}
+}
+
+// rows returns the geo and AS source rows of addr, nil without recorded origins.
+func (o *registryOrigins) rows(addr netip.Addr, report model.LoadReport) []model.SourceRow {
+	if o == nil {
+		return nil
+	}
+
+	var rows []model.SourceRow
+	for _, idx := range []struct {
+		kind string
+		x    *originIndex
+	}{
+		{RowKindGeo, &o.geo},
+		{RowKindASN, &o.as},
+	} {
+		r, ok := idx.x.find(addr)
+		if !ok {
+			continue
+		}
+
+		row := model.SourceRow{
+			Kind:  idx.kind,
+			Line:  int64(r.line),
+			Start: r.start.ToAddr(),
+			End:   r.end.ToAddr(),
+		}
+		if int(r.src) < len(report.Sources) {
+			row.Path = report.Sources[r.src].Path
+			row.File = report.Sources[r.src].File.Path
+		}
+		rows = append(rows, row)
+	}
+
+	return rows
+}
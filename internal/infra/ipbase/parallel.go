@@ -0,0 +1,387 @@
+package ipbase
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eterline/ipcsv2base/pkg/decompress"
+)
+
+// minPartSize - Size of the parts raw sources are cut into, a part is parsed by its own worker.
+// A variable, so tests cut small sources into several parts.
+var minPartSize = 4 << 20
+
+// sourcePart is a record aligned part of a source.
+type sourcePart struct {
+	r    io.Reader
+	line int64 // number of lines preceding the part
+}
+
+type (
+	// headFunc receives the header line of a source.
+	headFunc func(line []byte) error
+	// partFunc reads a source part, rows are counted in its own part counter.
+	partFunc func(ctx context.Context, part sourcePart, src *sourceCounter) error
+)
+
+// sourceReader reads a source by parts, head is called before any part is read when header is set.
+type sourceReader func(ctx context.Context, header bool, src *sourceCounter, head headFunc, do partFunc) error
+
+// framing - Record framing of a raw source, it tells where the source may be cut into parts.
+type framing struct {
+	split  bool // records are found without parsing, otherwise the source is read as a single part
+	quoted bool // RFC 4180 double quotes, line breaks inside quoted fields do not end a record
+	delim  byte // field delimiter of quoted records
+}
+
+var (
+	lineFraming = framing{split: true}                           // every line is a record
+	csvFraming  = framing{split: true, quoted: true, delim: ','} // RFC 4180 comma separated records
+)
+
+/*
+fileSource - Reads a source file through a single descriptor, hashing the read bytes.
+
+	Raw files are cut at record boundaries of fr into parts parsed
+	concurrently. Compressed files are read as a single stream, zip archives
+	are read into memory before their entry is opened. A file whose read
+	bytes differ from the described ones is rejected, so the parsed data is
+	the verified data even when the file is rewritten in place.
+*/
+func fileSource(file string, fr framing) sourceReader {
+	return func(ctx context.Context, header bool, src *sourceCounter, head headFunc, do partFunc) error {
+		name, entry := decompress.SplitEntry(file)
+
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		h := sha256.New()
+		br := bufio.NewReaderSize(io.TeeReader(f, h), 1<<16)
+		magic, _ := br.Peek(decompress.MagicLen)
+
+		switch format := decompress.Detect(magic); {
+		case format == decompress.FormatZip:
+			data, err := io.ReadAll(br)
+			if err != nil {
+				return err
+			}
+			if err := checkContent(src, name, h); err != nil {
+				return err
+			}
+
+			rc, err := decompress.OpenEntry(bytes.NewReader(data), int64(len(data)), entry)
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+
+			return streamSource(rc)(ctx, header, src, head, do)
+
+		case entry != "":
+			return fmt.Errorf("%s is not a zip archive", name)
+
+		case format == decompress.FormatRaw:
+			if err := readParts(ctx, br, fr, header, src, head, do); err != nil {
+				return err
+			}
+
+		default:
+			dr, _, err := decompress.Wrap(br)
+			if err != nil {
+				return err
+			}
+			defer dr.Close()
+
+			if err := streamSource(dr)(ctx, header, src, head, do); err != nil {
+				return err
+			}
+		}
+
+		// bytes following the parsed data are part of the described file too
+		if _, err := io.Copy(io.Discard, br); err != nil {
+			return err
+		}
+		return checkContent(src, name, h)
+	}
+}
+
+// streamSource - Reads a source stream as a single part.
+func streamSource(r io.Reader) sourceReader {
+	return func(ctx context.Context, header bool, src *sourceCounter, head headFunc, do partFunc) error {
+		br := bufio.NewReaderSize(&countingReader{r: r, n: &src.progress.bytes}, 1<<16)
+
+		part := sourcePart{r: br}
+		if header {
+			line, err := br.ReadBytes('\n')
+			if err != nil && (err != io.EOF || len(line) == 0) {
+				return err
+			}
+			if err := head(line); err != nil {
+				return err
+			}
+			part.line = 1
+		}
+
+		return readPart(ctx, part, src, do)
+	}
+}
+
+/*
+readParts - Reads a raw source sequentially and cuts it into parts parsed concurrently.
+
+	Parts end at record boundaries of fr, line numbers of the parts are
+	counted while cutting. At most one part per worker is parsed while the
+	next one is read. Sources that can not be split and loads with a single
+	worker are parsed as a single part.
+*/
+func readParts(ctx context.Context, r io.Reader, fr framing, header bool, src *sourceCounter, head headFunc, do partFunc) error {
+	br := bufio.NewReaderSize(&countingReader{r: r, n: &src.progress.bytes}, 1<<16)
+
+	var line int64
+	if header {
+		hdr, err := readFirstRecord(br, fr)
+		if err != nil {
+			return err
+		}
+		if err := head(hdr); err != nil {
+			return err
+		}
+		line = max(int64(bytes.Count(hdr, []byte{'\n'})), 1)
+	}
+
+	if !fr.split || src.opts.workers <= 1 {
+		return readPart(ctx, sourcePart{r: br, line: line}, src, do)
+	}
+
+	type chunk struct {
+		data []byte
+		line int64
+	}
+
+	var (
+		chunks = make(chan chunk)
+		bufs   sync.Pool
+	)
+
+	cut := func(ctx context.Context) error {
+		defer close(chunks)
+
+		var carry []byte // start of a record following the last cut
+		for {
+			buf, _ := bufs.Get().([]byte)
+			if need := len(carry) + minPartSize; cap(buf) < need {
+				buf = make([]byte, 0, need)
+			}
+			buf = append(buf[:0], carry...)
+
+			n, err := io.ReadFull(br, buf[len(buf):len(buf)+minPartSize])
+			buf = buf[:len(buf)+n]
+
+			eof := err == io.EOF || err == io.ErrUnexpectedEOF
+			if err != nil && !eof {
+				return err
+			}
+
+			end := len(buf)
+			if !eof {
+				end = lastRecordEnd(buf, fr)
+			}
+			if end < 0 {
+				carry = buf // a record longer than the part, read on
+				continue
+			}
+
+			carry = bytes.Clone(buf[end:])
+			if end > 0 {
+				select {
+				case chunks <- chunk{data: buf[:end], line: line}:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				line += int64(bytes.Count(buf[:end], []byte{'\n'}))
+			}
+
+			if eof {
+				return nil
+			}
+		}
+	}
+
+	parse := func(ctx context.Context) error {
+		for c := range chunks {
+			if err := readPart(ctx, sourcePart{r: bytes.NewReader(c.data), line: c.line}, src, do); err != nil {
+				return err
+			}
+			bufs.Put(c.data[:0])
+		}
+		return nil
+	}
+
+	tasks := make([]func(context.Context) error, 0, src.opts.workers+1)
+	tasks = append(tasks, cut)
+	for range src.opts.workers {
+		tasks = append(tasks, parse)
+	}
+	return runParallel(ctx, len(tasks), tasks...)
+}
+
+// readFirstRecord reads the first record of a source, io.EOF for an empty source.
+func readFirstRecord(br *bufio.Reader, fr framing) ([]byte, error) {
+	var (
+		rec    []byte
+		quoted bool
+	)
+	for {
+		line, err := br.ReadBytes('\n')
+		rec = append(rec, line...)
+		if err != nil {
+			if err == io.EOF && len(rec) > 0 {
+				return rec, nil
+			}
+			return nil, err
+		}
+
+		if quoted = fr.quotedAfter(line, quoted); !quoted {
+			return rec, nil
+		}
+	}
+}
+
+// lastRecordEnd returns the offset following the last complete record of b, -1 when b ends inside its first record.
+// b starts at a record beginning.
+func lastRecordEnd(b []byte, fr framing) int {
+	if !fr.quoted {
+		if i := bytes.LastIndexByte(b, '\n'); i >= 0 {
+			return i + 1
+		}
+		return -1
+	}
+
+	end, quoted := -1, false
+	for off := 0; ; {
+		i := bytes.IndexByte(b[off:], '\n')
+		if i < 0 {
+			return end
+		}
+		quoted = fr.quotedAfter(b[off:off+i], quoted)
+		off += i + 1
+		if !quoted {
+			end = off
+		}
+	}
+}
+
+/*
+quotedAfter - Reports whether a quoted field is open at the end of line.
+
+	quoted tells whether the line starts inside a quoted field, otherwise it
+	starts a record. As in RFC 4180, a quote opens a field only at its start
+	and a doubled quote inside a field is an escaped quote, bare quotes of
+	malformed unquoted fields are ignored.
+*/
+func (fr framing) quotedAfter(line []byte, quoted bool) bool {
+	if !fr.quoted || !quoted && bytes.IndexByte(line, '"') < 0 {
+		return quoted
+	}
+
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] != '"':
+		case !quoted:
+			quoted = i == 0 || line[i-1] == fr.delim
+		case i+1 < len(line) && line[i+1] == '"':
+			i++
+		default:
+			quoted = false
+		}
+	}
+	return quoted
+}
+
+// readPart reads a part with its own counter merged into src.
+func readPart(ctx context.Context, part sourcePart, src *sourceCounter, do partFunc) error {
+	cnt := src.part()
+	defer src.merge(cnt)
+	return do(ctx, part, cnt)
+}
+
+// countingReader adds the number of read bytes to n.
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n.Add(int64(n))
+	return n, err
+}
+
+// ==========================
+
+// readTask returns a task reading a single source, its errors are wrapped with the file kind and name.
+// The read duration is recorded in src.
+func readTask(kind, file string, src *sourceCounter, read func(ctx context.Context) error) func(context.Context) error {
+	return func(ctx context.Context) error {
+		startAt := time.Now()
+		err := read(ctx)
+		src.rep.Duration = time.Since(startAt)
+
+		if err != nil {
+			return fmt.Errorf("failed to read %s file %s: %w", kind, file, err)
+		}
+		return nil
+	}
+}
+
+// runParallel runs tasks with at most limit of them at once.
+// The first failed task cancels the others and its error is returned.
+func runParallel(ctx context.Context, limit int, tasks ...func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg    sync.WaitGroup
+		once  sync.Once
+		first error
+		sem   = make(chan struct{}, max(limit, 1))
+	)
+
+loop:
+	for _, task := range tasks {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break loop
+		}
+
+		wg.Go(func() {
+			defer func() { <-sem }()
+
+			if err := task(ctx); err != nil {
+				once.Do(func() {
+					first = err
+					cancel()
+				})
+			}
+		})
+	}
+
+	wg.Wait()
+
+	if first != nil {
+		return first
+	}
+	return ctx.Err()
+}
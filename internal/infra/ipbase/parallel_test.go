@@ -0,0 +1,153 @@
+package ipbase
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// writeQuotedCSV writes a headed CSV file with quoted line breaks and malformed rows.
+// It returns the file with the fields of its records and the malformed rows by line.
+func writeQuotedCSV(t *testing.T, rows int) (file string, records map[int64][]string, malformed []int64) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"id", "note"})
+	w.Flush()
+
+	records = map[int64][]string{}
+	line := int64(2)
+	for i := range rows {
+		if i%17 == 16 {
+			// a bare quote in an unquoted field, the row is malformed and its quote opens nothing
+			fmt.Fprintf(&buf, "%d,bare \" quote\n", i)
+			malformed = append(malformed, line)
+			line++
+			continue
+		}
+
+		id := strconv.Itoa(i)
+		note := [...]string{
+			"plain " + id,
+			"two\nlines " + id,
+			`say "hi", ` + id,
+			"trailing line break\n",
+			"\n\n" + id + "\n",
+		}[i%5]
+
+		w.Write([]string{id, note})
+		w.Flush()
+		records[line] = []string{id, note}
+		line += 1 + int64(strings.Count(note, "\n"))
+	}
+
+	file = filepath.Join(t.TempDir(), "notes.csv")
+	if err := os.WriteFile(file, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return file, records, malformed
+}
+
+// readCSVParts reads a headed CSV file through fileSource and returns its records by line,
+// the lines of skipped rows and the number of parsed parts.
+func readCSVParts(t *testing.T, file string, fr framing, workers int) (map[int64][]string, []int64, int) {
+	t.Helper()
+
+	ls := newLoadState(WithWorkers(workers))
+	src := ls.source(file)
+
+	var (
+		mu      sync.Mutex
+		records = map[int64][]string{}
+		parts   atomic.Int32
+	)
+	err := fileSource(file, fr)(context.Background(), true, src,
+		func(line []byte) error {
+			if string(line) != "id,note\n" {
+				return fmt.Errorf("header %q", line)
+			}
+			return nil
+		},
+		func(ctx context.Context, part sourcePart, src *sourceCounter) error {
+			parts.Add(1)
+			rd := newCSVRecordReader(part.r, ',', false, -1)
+			return readRecords(ctx, rd, part.line, src, func(line int64, fields []string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				records[line] = slices.Clone(fields)
+				return nil
+			})
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var skipped []int64
+	for _, s := range src.rep.SkipSamples {
+		skipped = append(skipped, s.Line)
+	}
+	slices.Sort(skipped)
+	return records, skipped, int(parts.Load())
+}
+
+func TestFileSourceParts(t *testing.T) {
+	defer func(n int) { minPartSize = n }(minPartSize)
+	minPartSize = 64
+
+	file, want, malformed := writeQuotedCSV(t, 120)
+
+	for _, workers := range []int{1, 4} {
+		got, skipped, parts := readCSVParts(t, file, csvFraming, workers)
+		if workers > 1 && parts < 10 {
+			t.Errorf("%d workers: file read in %d parts, want it cut into small parts", workers, parts)
+		}
+		if !reflect.DeepEqual(got, want) {
+			for line, rec := range want {
+				if !slices.Equal(got[line], rec) {
+					t.Errorf("%d workers: record at line %d = %q, want %q", workers, line, got[line], rec)
+				}
+			}
+			t.Fatalf("%d workers: %d records, want %d", workers, len(got), len(want))
+		}
+		if !slices.Equal(skipped, malformed) {
+			t.Errorf("%d workers: skipped rows at lines %v, want %v", workers, skipped, malformed)
+		}
+	}
+}
+
+func TestLastRecordEnd(t *testing.T) {
+	semicolon := framing{split: true, quoted: true, delim: ';'}
+
+	tests := []struct {
+		data string
+		fr   framing
+		want int
+	}{
+		{"a,b\nc,d\ne", lineFraming, 8},
+		{"a,\"b\nc\"\n", lineFraming, 8},
+		{"a,\"b\nc\"\nd", csvFraming, 8},
+		{"a,\"b\nc", csvFraming, -1},
+		{"a,\"b\"\"\nc\"\"\"\nd", csvFraming, 12}, // doubled quotes are escaped quotes
+		{"a,b\"c\nd,e\n\"f\ng", csvFraming, 10},   // a bare quote opens no field
+		{"a;\"b\nc\";d\ne", semicolon, 10},        // quotes open fields after the delimiter
+		{"a,\"b\nc\",d\ne", semicolon, 10},        // a quote after another delimiter is bare
+		{"no line break", csvFraming, -1},
+	}
+	for _, tt := range tests {
+		if got := lastRecordEnd([]byte(tt.data), tt.fr); got != tt.want {
+			t.Errorf("lastRecordEnd(%q, %+v) = %d, want %d", tt.data, tt.fr, got, tt.want)
+		}
+	}
+}
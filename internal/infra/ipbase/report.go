@@ -0,0 +1,400 @@
+package ipbase
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eterline/ipcsv2base/internal/model"
+	"github.com/eterline/ipcsv2base/pkg/decompress"
+	"github.com/eterline/ipcsv2base/pkg/ipsetdata"
+)
+
+// Row skip reasons reported in model.SourceLoadReport.
+const (
+	SkipMalformedRow    = "malformed_row"    // CSV syntax error or wrong column count
+	SkipInvalidKey      = "invalid_key"      // unparsable network, address or range
+	SkipFieldCount      = "field_count"      // wrong number of fields
+	SkipShortCode       = "short_code"       // country code shorter than two letters
+	SkipLineTooLong     = "line_too_long"    // line does not fit into the read buffer
+	SkipInvalidASN      = "invalid_asn"      // unparsable AS number
+	SkipUnknownLocation = "unknown_location" // geoname id missing in locations
+	SkipNoData          = "no_data"          // record maps no metadata
+)
+
+// ErrStrictLoad - Load rejected by the strict parsing policy.
+var ErrStrictLoad = errors.New("strict load policy violated")
+
+const defaultSkipSamples = 10
+
+// rowsBatch - Number of rows between context checks and progress updates.
+const rowsBatch = 1 << 12
+
+type loadOptions struct {
+	strict      bool
+	maxSkipRate float64
+	samples     int
+	workers     int
+	log         model.Logger
+	every       time.Duration
+	verifier    SourceVerifier
+	origins     bool
+	index       ipsetdata.IndexKind
+}
+
+// SourceVerifier - Integrity check of source files.
+// Verify receives the SHA-256 of a file before the file is parsed, an error refuses the load.
+type SourceVerifier interface {
+	Verify(file, sha256 string) error
+}
+
+// LoadOption - Functional option of base loaders.
+type LoadOption func(*loadOptions)
+
+// WithStrict - Fails the load on the first rejected row.
+func WithStrict(strict bool) LoadOption {
+	return func(o *loadOptions) {
+		o.strict = strict
+	}
+}
+
+// WithMaxSkipRate - Fails the load when rejected rows of any source exceed the rate (0..1).
+// Zero disables the check.
+func WithMaxSkipRate(rate float64) LoadOption {
+	return func(o *loadOptions) {
+		o.maxSkipRate = rate
+	}
+}
+
+// WithSkipSamples - Sets the number of rejected line numbers kept per source.
+func WithSkipSamples(n int) LoadOption {
+	return func(o *loadOptions) {
+		o.samples = n
+	}
+}
+
+// WithWorkers - Sets the number of files and file parts parsed concurrently.
+// Zero or less uses GOMAXPROCS.
+func WithWorkers(n int) LoadOption {
+	return func(o *loadOptions) {
+		o.workers = n
+	}
+}
+
+// WithProgress - Logs bytes and rows read with their rates every interval during the load.
+func WithProgress(log model.Logger, every time.Duration) LoadOption {
+	return func(o *loadOptions) {
+		o.log = log
+		o.every = every
+	}
+}
+
+// WithVerifier - Verifies every source file before it is parsed.
+func WithVerifier(v SourceVerifier) LoadOption {
+	return func(o *loadOptions) {
+		o.verifier = v
+	}
+}
+
+// WithRowOrigins - Keeps the source file and row of every accepted range for explained lookups.
+// Costs memory proportional to the number of accepted rows.
+func WithRowOrigins(enabled bool) LoadOption {
+	return func(o *loadOptions) {
+		o.origins = enabled
+	}
+}
+
+// WithLookupIndex - Selects the lookup structure of the loaded ranges, sorted ranges by default.
+func WithLookupIndex(kind ipsetdata.IndexKind) LoadOption {
+	return func(o *loadOptions) {
+		o.index = kind
+	}
+}
+
+// ==========================
+
+// loadState - Per load bookkeeping shared by loaders.
+type loadState struct {
+	opts         loadOptions
+	sources      []*sourceCounter
+	progress     *loadProgress
+	stopProgress func()
+	buildDate    buildDateFunc
+	startAt      time.Time
+	origins      *registryOrigins // nil unless row origins are enabled
+
+	filesMu sync.Mutex
+	files   map[string]describedFile // described files by path
+}
+
+func newLoadState(opts ...LoadOption) *loadState {
+	ls := &loadState{
+		opts:     loadOptions{samples: defaultSkipSamples},
+		progress: &loadProgress{},
+		startAt:  time.Now(),
+		files:    map[string]describedFile{},
+	}
+	for _, opt := range opts {
+		opt(&ls.opts)
+	}
+	if ls.opts.workers <= 0 {
+		ls.opts.workers = runtime.GOMAXPROCS(0)
+	}
+	if ls.opts.origins {
+		ls.origins = &registryOrigins{}
+	}
+	return ls
+}
+
+// loadProgress - Bytes and rows read by all sources of a load.
+type loadProgress struct {
+	bytes atomic.Int64
+	rows  atomic.Int64
+}
+
+// trackProgress - Starts periodic progress logging until finish and returns its stop function.
+func (ls *loadState) trackProgress(ctx context.Context) (stop func()) {
+	ls.stopProgress = func() {}
+	if ls.opts.log == nil || ls.opts.every <= 0 {
+		return ls.stopProgress
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Go(func() {
+		startAt := time.Now()
+		ticker := time.NewTicker(ls.opts.every)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			elapsed := time.Since(startAt)
+			bytes, rows := ls.progress.bytes.Load(), ls.progress.rows.Load()
+
+			ls.opts.log.Info(
+				"ip base loading in progress",
+				model.Field("bytes_read", bytes),
+				model.Field("rows_read", rows),
+				model.FieldFloat("mb_per_sec", float64(bytes)/(1<<20)/elapsed.Seconds(), 2),
+				model.FieldFloat("rows_per_sec", float64(rows)/elapsed.Seconds(), 0),
+				model.Field("elapsed_ms", elapsed.Milliseconds()),
+			)
+		}
+	})
+
+	ls.stopProgress = sync.OnceFunc(func() {
+		close(done)
+		wg.Wait()
+	})
+	return ls.stopProgress
+}
+
+// source - Starts counting rows of a new source file, archive entries are described by their archive.
+func (ls *loadState) source(path string) *sourceCounter {
+	file, _ := decompress.SplitEntry(path)
+	return ls.sourceIn(path, file)
+}
+
+// sourceIn - Starts counting rows of a new source stored in file.
+func (ls *loadState) sourceIn(path, file string) *sourceCounter {
+	c := &sourceCounter{
+		id:       uint32(len(ls.sources)),
+		file:     file,
+		opts:     &ls.opts,
+		progress: ls.progress,
+		rep: model.SourceLoadReport{
+			Path:        path,
+			SkipReasons: map[string]int64{},
+		},
+	}
+	ls.sources = append(ls.sources, c)
+	return c
+}
+
+// report - Returns the collected load report.
+func (ls *loadState) report() model.LoadReport {
+	rep := model.LoadReport{
+		LoadedAt: time.Now(),
+		Duration: time.Since(ls.startAt),
+		Sources:  make([]model.SourceLoadReport, 0, len(ls.sources)),
+	}
+	for _, c := range ls.sources {
+		rep.Sources = append(rep.Sources, c.rep)
+	}
+	return rep
+}
+
+// prepareOrigins - Returns the recorded row origins ready for lookups, nil when disabled.
+func (ls *loadState) prepareOrigins() *registryOrigins {
+	ls.origins.prepare()
+	return ls.origins
+}
+
+// finish - Stops progress logging, checks described files are unchanged and applies the skip rate policy to all sources.
+func (ls *loadState) finish() error {
+	if ls.stopProgress != nil {
+		ls.stopProgress()
+	}
+
+	if err := ls.checkUnchanged(); err != nil {
+		return err
+	}
+
+	if ls.opts.maxSkipRate <= 0 {
+		return nil
+	}
+
+	for _, c := range ls.sources {
+		if rate := c.rep.SkipRate(); rate > ls.opts.maxSkipRate {
+			return fmt.Errorf("%w: %s skip rate %.4f exceeds %.4f",
+				ErrStrictLoad, c.rep.Path, rate, ls.opts.maxSkipRate)
+		}
+	}
+
+	return nil
+}
+
+// sourceCounter - Row counters of a single source or of a part of it.
+// Counters are not safe for concurrent use, concurrent parts count rows with their own counter.
+type sourceCounter struct {
+	id       uint32 // index of the source in the load report
+	file     string // file on disk holding the source
+	opts     *loadOptions
+	progress *loadProgress
+	rep      model.SourceLoadReport
+	mu       sync.Mutex // guards merge of parts
+}
+
+// part - Returns a counter of a source part, its rows are added to c by merge.
+func (c *sourceCounter) part() *sourceCounter {
+	return &sourceCounter{
+		id:       c.id,
+		opts:     c.opts,
+		progress: c.progress,
+		rep: model.SourceLoadReport{
+			Path:        c.rep.Path,
+			SkipReasons: map[string]int64{},
+		},
+	}
+}
+
+// merge - Adds counters of a finished part, skip samples are kept in line order.
+func (c *sourceCounter) merge(p *sourceCounter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.progress.rows.Add(p.rep.RowsRead % rowsBatch)
+
+	c.rep.RowsRead += p.rep.RowsRead
+	c.rep.RowsAccepted += p.rep.RowsAccepted
+	c.rep.RowsFiltered += p.rep.RowsFiltered
+	c.rep.RowsSkipped += p.rep.RowsSkipped
+	for reason, n := range p.rep.SkipReasons {
+		c.rep.SkipReasons[reason] += n
+	}
+
+	c.rep.SkipSamples = append(c.rep.SkipSamples, p.rep.SkipSamples...)
+	slices.SortFunc(c.rep.SkipSamples, func(a, b model.SkippedRow) int {
+		return cmp.Compare(a.Line, b.Line)
+	})
+	if len(c.rep.SkipSamples) > c.opts.samples {
+		c.rep.SkipSamples = c.rep.SkipSamples[:c.opts.samples]
+	}
+}
+
+// read - Counts a read row, the load progress is updated every rowsBatch rows.
+func (c *sourceCounter) read() {
+	c.rep.RowsRead++
+	if c.rep.RowsRead%rowsBatch == 0 {
+		c.progress.rows.Add(rowsBatch)
+	}
+}
+
+// checkpoint - Reports whether the row batch is complete and the load context should be checked.
+func (c *sourceCounter) checkpoint() bool {
+	return c.rep.RowsRead%rowsBatch == 0
+}
+
+func (c *sourceCounter) accept() {
+	c.rep.RowsAccepted++
+}
+
+func (c *sourceCounter) filter() {
+	c.rep.RowsFiltered++
+}
+
+// skip - Counts a rejected row, in strict mode returns an error stopping the load.
+func (c *sourceCounter) skip(line int64, reason string) error {
+	c.rep.RowsSkipped++
+	c.rep.SkipReasons[reason]++
+
+	if len(c.rep.SkipSamples) < c.opts.samples {
+		c.rep.SkipSamples = append(c.rep.SkipSamples, model.SkippedRow{Line: line, Reason: reason})
+	}
+
+	if c.opts.strict {
+		return fmt.Errorf("%w: %s line %d: %s", ErrStrictLoad, c.rep.Path, line, reason)
+	}
+	return nil
+}
+
+// handle - Counts the outcome of a row callback.
+// Row skip and filter results are consumed, other errors are returned.
+func (c *sourceCounter) handle(line int64, err error) error {
+	var rs rowSkipError
+
+	switch {
+	case err == nil:
+		c.accept()
+		return nil
+	case errors.Is(err, errRowFiltered):
+		c.filter()
+		return nil
+	case errors.As(err, &rs):
+		return c.skip(line, rs.reason)
+	default:
+		return err
+	}
+}
+
+// ==========================
+
+// errRowFiltered - Row callback result for rows excluded on purpose.
+var errRowFiltered = errors.New("row filtered")
+
+// rowSkipError - Row callback result for rejected rows.
+type rowSkipError struct {
+	reason string
+}
+
+func (e rowSkipError) Error() string {
+	return "row skipped: " + e.reason
+}
+
+func skipRow(reason string) error {
+	return rowSkipError{reason: reason}
+}
+
+// loadReporter - Registry holding the report of its load.
+type loadReporter struct {
+	report model.LoadReport
+}
+
+// LoadReport - Returns the report of the registry load.
+func (r *loadReporter) LoadReport() model.LoadReport {
+	return r.report
+}
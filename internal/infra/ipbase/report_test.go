@@ -0,0 +1,95 @@
+package ipbase_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/eterline/ipcsv2base/internal/infra/ipbase"
+	"github.com/eterline/ipcsv2base/internal/model"
+)
+
+// writeSkipSources writes country and ASN files, two of the five country rows are rejected.
+func writeSkipSources(t *testing.T) (country, asn string) {
+	t.Helper()
+
+	var asnRows strings.Builder
+	asnRows.WriteString("network,asn,country_code,name,org,domain\n")
+	for _, network := range []string{"1.0.0.0/24", "1.0.1.0/24", "1.0.2.0/24", "1.0.3.0/24", "1.0.4.0/24",
+		"1.0.5.0/24", "1.0.6.0/24", "1.0.7.0/24", "1.0.8.0/24", "1.0.9.0/24"} {
+		asnRows.WriteString(network + ",13335,US,CLOUDFLARENET,Cloudflare,cloudflare.com\n")
+	}
+
+	dir := writeFiles(t, map[string]string{
+		"country.csv": "network,continent_code,country_code,country_name\n" +
+			"1.0.0.0/24,NA,US,United States\n" +
+			"1.0.1.0/33,NA,US,United States\n" + // line 3: invalid network
+			"1.0.2.0/24,EU,DE,Germany\n" +
+			"1.0.3.0/24,EU,DE\n" + // line 5: missing column
+			"1.0.4.0/24,EU,FR,France\n",
+		"asn.csv": asnRows.String(),
+	})
+	return filepath.Join(dir, "country.csv"), filepath.Join(dir, "asn.csv")
+}
+
+func TestLoadReportCountsSkippedRows(t *testing.T) {
+	country, asn := writeSkipSources(t)
+
+	reg, err := ipbase.NewRegistryIP(context.Background(), country, asn, ipbase.IPv4v6)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]model.SourceLoadReport{
+		country: {
+			RowsRead: 5, RowsAccepted: 3, RowsSkipped: 2,
+			SkipReasons: map[string]int64{ipbase.SkipInvalidKey: 1, ipbase.SkipMalformedRow: 1},
+			SkipSamples: []model.SkippedRow{{Line: 3, Reason: ipbase.SkipInvalidKey}, {Line: 5, Reason: ipbase.SkipMalformedRow}},
+		},
+		asn: {RowsRead: 10, RowsAccepted: 10, SkipReasons: map[string]int64{}},
+	}
+
+	sources := reg.LoadReport().Sources
+	if len(sources) != len(want) {
+		t.Fatalf("report of %d sources, want %d", len(sources), len(want))
+	}
+	for _, src := range sources {
+		w := want[src.Path]
+		got := model.SourceLoadReport{
+			RowsRead: src.RowsRead, RowsAccepted: src.RowsAccepted, RowsFiltered: src.RowsFiltered, RowsSkipped: src.RowsSkipped,
+			SkipReasons: src.SkipReasons, SkipSamples: src.SkipSamples,
+		}
+		if !reflect.DeepEqual(got, w) {
+			t.Errorf("report of %s = %+v, want %+v", src.Path, got, w)
+		}
+	}
+}
+
+func TestStrictLoad(t *testing.T) {
+	country, asn := writeSkipSources(t)
+
+	tests := []struct {
+		name    string
+		opts    []ipbase.LoadOption
+		wantErr bool
+	}{
+		{"lenient", nil, false},
+		{"strict", []ipbase.LoadOption{ipbase.WithStrict(true)}, true},
+		{"skip rate above the rejected share", []ipbase.LoadOption{ipbase.WithMaxSkipRate(0.5)}, false},
+		// 2 of 15 rows are rejected in total, the rate holds for every source on its own
+		{"skip rate below the country rejected share", []ipbase.LoadOption{ipbase.WithMaxSkipRate(0.2)}, true},
+	}
+	for _, tt := range tests {
+		_, err := ipbase.NewRegistryIP(context.Background(), country, asn, ipbase.IPv4v6, tt.opts...)
+		if tt.wantErr != (err != nil) {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil && (!errors.Is(err, ipbase.ErrStrictLoad) || !strings.Contains(err.Error(), country)) {
+			t.Errorf("%s: error = %v, want %v of %s", tt.name, err, ipbase.ErrStrictLoad, country)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package ipbase
+
+import (
+	"cmp"
+	"math/big"
+	"math/bits"
+	"net/netip"
+	"slices"
+
+	"github.com/eterline/ipcsv2base/internal/model"
+	"github.com/eterline/ipcsv2base/pkg/ipsetdata"
+)
+
+/*
+reverseIndex - Address space of a registry grouped by country code and by AS number.
+
+	Every key holds sorted non-overlapping ranges the registry answers with
+	that key, adjacent ranges are coalesced. Nested ranges are owned by the
+	narrowest one, see IPContainerSet.Segments. Country and AS summaries are
+	computed once by summarize.
+*/
+type reverseIndex struct {
+	country map[string]*reverseEntry
+	as      map[int32]*reverseEntry
+	pairs   map[reversePair]*addrCount // space per country and AS, released by summarize
+
+	countrySummary map[string]*model.CountrySummary
+	asSummary      map[int32]*model.ASSummary
+}
+
+type reverseEntry struct {
+	spans []rangeUint128t
+	space addrCount
+}
+
+type reversePair struct {
+	country string
+	asn     int32
+}
+
+// buildReverseIndex indexes the segments of a prepared set, keys returns the country code and AS number of a value.
+func buildReverseIndex[T comparable](set *ipsetdata.IPContainerSet[T], keys func(T) (string, int32)) *reverseIndex {
+	x := &reverseIndex{
+		country: map[string]*reverseEntry{},
+		as:      map[int32]*reverseEntry{},
+		pairs:   map[reversePair]*addrCount{},
+	}
+
+	for rng, v := range set.Segments() {
+		cc, asn := keys(v)
+		seg := rangeUint128t{start: Addr2Uint128t(rng.From()), end: Addr2Uint128t(rng.To())}
+
+		if cc != "" {
+			entryOf(x.country, cc).add(seg)
+		}
+		if asn != 0 {
+			entryOf(x.as, asn).add(seg)
+		}
+		if cc != "" && asn != 0 {
+			pair := reversePair{cc, asn}
+			c, ok := x.pairs[pair]
+			if !ok {
+				c = &addrCount{}
+				x.pairs[pair] = c
+			}
+			c.add(seg)
+		}
+	}
+
+	for _, e := range x.country {
+		e.spans = slices.Clip(e.spans)
+	}
+	for _, e := range x.as {
+		e.spans = slices.Clip(e.spans)
+	}
+	return x
+}
+
+func entryOf[K comparable](m map[K]*reverseEntry, key K) *reverseEntry {
+	e, ok := m[key]
+	if !ok {
+		e = &reverseEntry{}
+		m[key] = e
+	}
+	return e
+}
+
+func (e *reverseEntry) add(seg rangeUint128t) {
+	e.spans = appendCoalesced(e.spans, seg)
+	e.space.add(seg)
+}
+
+// appendCoalesced appends a segment to sorted ranges, merging it into an adjacent last range of the same family.
+func appendCoalesced(spans []rangeUint128t, seg rangeUint128t) []rangeUint128t {
+	if n := len(spans); n > 0 {
+		last := &spans[n-1]
+		if next, ok := last.end.Inc(); ok && next == seg.start && is4Uint128t(last.end) == is4Uint128t(seg.start) {
+			last.end = seg.end
+			return spans
+		}
+	}
+	return append(spans, seg)
+}
+
+// is4Uint128t reports whether u is an IPv4-mapped address.
+func is4Uint128t(u uint128t) bool {
+	return u.hi == 0 && u.lo>>32 == 0xffff
+}
+
+func (x *reverseIndex) countryPrefixes(cc string) []netip.Prefix {
+	if x == nil || x.country[cc] == nil {
+		return nil
+	}
+	return spanPrefixes(x.country[cc].spans)
+}
+
+func (x *reverseIndex) asPrefixes(asn int32) []netip.Prefix {
+	if x == nil || x.as[asn] == nil {
+		return nil
+	}
+	return spanPrefixes(x.as[asn].spans)
+}
+
+// spanPrefixes returns the aggregated CIDRs covering spans, IPv4 networks first.
+func spanPrefixes(spans []rangeUint128t) []netip.Prefix {
+	var out []netip.Prefix
+	for _, s := range spans {
+		out = s.ToIPRange().AppendPrefixes(out)
+	}
+	slices.SortFunc(out, func(a, b netip.Prefix) int {
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c
+		}
+		return a.Bits() - b.Bits()
+	})
+	return out
+}
+
+// topASLimit - Autonomous systems kept in a country summary.
+const topASLimit = 20
+
+/*
+summarize - Precomputes country and AS summaries.
+
+	countryInfo returns the continent and name of a country code, asInfo the
+	AS record of a number, either may be nil. Shares are ranked by IPv4 space,
+	then by IPv6 space.
+*/
+func (x *reverseIndex) summarize(countryInfo func(cc string) (continent, name string), asInfo func(asn int32) model.IPAS) {
+	x.countrySummary = make(map[string]*model.CountrySummary, len(x.country))
+	x.asSummary = make(map[int32]*model.ASSummary, len(x.as))
+
+	for cc, e := range x.country {
+		sum := &model.CountrySummary{
+			CountryCode: model.GeoCode(cc),
+			Space:       e.addressSpace(),
+		}
+		if countryInfo != nil {
+			continent, name := countryInfo(cc)
+			sum.ContinentCode, sum.CountryName = model.GeoCode(continent), name
+		}
+		x.countrySummary[cc] = sum
+	}
+
+	for asn, e := range x.as {
+		sum := &model.ASSummary{
+			AS:    model.IPAS{ASN: asn},
+			Space: e.addressSpace(),
+		}
+		if asInfo != nil {
+			sum.AS = asInfo(asn)
+		}
+		x.asSummary[asn] = sum
+	}
+
+	for pair, c := range x.pairs {
+		v6 := c.v6.toBig()
+
+		cs := x.countrySummary[pair.country]
+		share := model.ASShare{ASN: pair.asn, IPv4: c.v4, IPv6: v6}
+		if as := x.asSummary[pair.asn]; as != nil {
+			share.Name = as.AS.Name
+		}
+		cs.TopAS = append(cs.TopAS, share)
+
+		as := x.asSummary[pair.asn]
+		as.Countries = append(as.Countries, model.CountryShare{
+			CountryCode: model.GeoCode(pair.country),
+			IPv4:        c.v4,
+			IPv6:        v6,
+		})
+	}
+	x.pairs = nil
+
+	for _, cs := range x.countrySummary {
+		slices.SortFunc(cs.TopAS, func(a, b model.ASShare) int {
+			return cmpSpace(a.IPv4, a.IPv6, b.IPv4, b.IPv6, cmp.Compare(a.ASN, b.ASN))
+		})
+		cs.ASCount = len(cs.TopAS)
+		cs.TopAS = slices.Clip(cs.TopAS[:min(len(cs.TopAS), topASLimit)])
+	}
+	for _, as := range x.asSummary {
+		slices.SortFunc(as.Countries, func(a, b model.CountryShare) int {
+			return cmpSpace(a.IPv4, a.IPv6, b.IPv4, b.IPv6, cmp.Compare(a.CountryCode, b.CountryCode))
+		})
+	}
+}
+
+// cmpSpace orders larger address space first, tie is returned for equal spaces.
+func cmpSpace(av4 uint64, av6 *big.Int, bv4 uint64, bv6 *big.Int, tie int) int {
+	if c := cmp.Compare(bv4, av4); c != 0 {
+		return c
+	}
+	if c := bv6.Cmp(av6); c != 0 {
+		return c
+	}
+	return tie
+}
+
+func (x *reverseIndex) getCountrySummary(cc string) (model.CountrySummary, bool) {
+	if x == nil || x.countrySummary[cc] == nil {
+		return model.CountrySummary{}, false
+	}
+	return *x.countrySummary[cc], true
+}
+
+func (x *reverseIndex) getASSummary(asn int32) (model.ASSummary, bool) {
+	if x == nil || x.asSummary[asn] == nil {
+		return model.ASSummary{}, false
+	}
+	return *x.asSummary[asn], true
+}
+
+func (e *reverseEntry) addressSpace() model.AddressSpace {
+	var (
+		n   int
+		buf []netip.Prefix
+	)
+	for _, s := range e.spans {
+		buf = s.ToIPRange().AppendPrefixes(buf[:0])
+		n += len(buf)
+	}
+
+	return model.AddressSpace{
+		Prefixes: n,
+		IPv4:     e.space.v4,
+		IPv6:     e.space.v6.toBig(),
+	}
+}
+
+// addrCount - Number of IPv4 and IPv6 addresses, the IPv6 count saturates at 2^128-1.
+type addrCount struct {
+	v4 uint64
+	v6 uint128t
+}
+
+func (c *addrCount) add(seg rangeUint128t) {
+	// size-1 of the range, the full IPv6 space does not fit 128 bits
+	lo, borrow := bits.Sub64(seg.end.lo, seg.start.lo, 0)
+	hi, _ := bits.Sub64(seg.end.hi, seg.start.hi, borrow)
+
+	if is4Uint128t(seg.start) {
+		c.v4 += lo + 1
+		return
+	}
+
+	size, ok := uint128t{hi: hi, lo: lo}.Inc()
+	if !ok {
+		c.v6 = uint128t{hi: ^uint64(0), lo: ^uint64(0)}
+		return
+	}
+
+	lo, carry := bits.Add64(c.v6.lo, size.lo, 0)
+	hi, carry = bits.Add64(c.v6.hi, size.hi, carry)
+	if carry != 0 {
+		c.v6 = uint128t{hi: ^uint64(0), lo: ^uint64(0)}
+		return
+	}
+	c.v6 = uint128t{hi: hi, lo: lo}
+}
+
+func (u uint128t) toBig() *big.Int {
+	n := new(big.Int).SetUint64(u.hi)
+	n.Lsh(n, 64)
+	return n.Or(n, new(big.Int).SetUint64(u.lo))
+}
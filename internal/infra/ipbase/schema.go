@@ -0,0 +1,533 @@
+package ipbase
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+
+	"go4.org/netipx"
+)
+
+// Schema field names, mapped to CSV columns and model.IPMetadata fields.
+const (
+	FieldNetwork       = "network"
+	FieldStart         = "start"
+	FieldEnd           = "end"
+	FieldContinentCode = "continent_code"
+	FieldCountryCode   = "country_code"
+	FieldCountryName   = "country_name"
+	FieldRegionName    = "region_name"
+	FieldCityName      = "city_name"
+	FieldASN           = "asn"
+	FieldASCountryCode = "as_country_code"
+	FieldASName        = "as_name"
+	FieldASOrg         = "as_org"
+	FieldASDomain      = "as_domain"
+)
+
+var (
+	geoSchemaFields = []string{FieldContinentCode, FieldCountryCode, FieldCountryName, FieldRegionName, FieldCityName}
+	asSchemaFields  = []string{FieldASN, FieldASCountryCode, FieldASName, FieldASOrg, FieldASDomain}
+)
+
+// KeyKind describes how the address key of a record is encoded.
+type KeyKind string
+
+const (
+	KeyCIDR     KeyKind = "cidr"      // single network column in CIDR notation
+	KeyStartEnd KeyKind = "start_end" // start and end address columns
+	KeyIntRange KeyKind = "int_range" // start and end decimal integer columns, up to 128 bits
+)
+
+// QuoteMode describes quote handling of CSV fields.
+type QuoteMode string
+
+const (
+	QuoteDouble QuoteMode = "double" // RFC 4180 double quotes
+	QuoteLazy   QuoteMode = "lazy"   // double quotes, bare quotes allowed inside fields
+	QuoteNone   QuoteMode = "none"   // no quoting, fields are split on the delimiter
+)
+
+/*
+ColumnRef - Reference to a CSV column by header name or zero based index.
+
+	In JSON it is written either as a number (index) or as a string (header name).
+	Strings holding only digits are treated as indices as well.
+*/
+type ColumnRef string
+
+// UnmarshalJSON accepts both numeric and string column references.
+func (c *ColumnRef) UnmarshalJSON(b []byte) error {
+	var idx int
+	if err := json.Unmarshal(b, &idx); err == nil {
+		*c = ColumnRef(strconv.Itoa(idx))
+		return nil
+	}
+
+	var name string
+	if err := json.Unmarshal(b, &name); err != nil {
+		return fmt.Errorf("column reference must be a number or a string: %w", err)
+	}
+	*c = ColumnRef(name)
+	return nil
+}
+
+// index returns the column index when the reference is numeric.
+func (c ColumnRef) index() (int, bool) {
+	i, err := strconv.Atoi(string(c))
+	return i, err == nil && i >= 0
+}
+
+/*
+CSVSchema - Description of a CSV source layout.
+
+	Columns maps schema fields (see Field* constants) to columns.
+	Fields, when positive, requires every record to have exactly that many columns.
+*/
+type CSVSchema struct {
+	Delimiter string               `json:"delimiter"`
+	Quote     QuoteMode            `json:"quote"`
+	Header    bool                 `json:"header"`
+	Key       KeyKind              `json:"key"`
+	Fields    int                  `json:"fields"`
+	Columns   map[string]ColumnRef `json:"columns"`
+}
+
+// SchemaSource - CSV file bound to its schema.
+type SchemaSource struct {
+	Path string `json:"path"`
+	CSVSchema
+}
+
+// schemaFile is the layout of the JSON mapping file.
+type schemaFile struct {
+	Sources []SchemaSource `json:"sources"`
+}
+
+// Default schemas of iplocate.io CSV files.
+var (
+	IPLocateCountrySchema = CSVSchema{
+		Delimiter: ",",
+		Quote:     QuoteDouble,
+		Header:    true,
+		Key:       KeyCIDR,
+		Fields:    4,
+		Columns: map[string]ColumnRef{
+			FieldNetwork:       "0",
+			FieldContinentCode: "1",
+			FieldCountryCode:   "2",
+			FieldCountryName:   "3",
+		},
+	}
+
+	IPLocateASNSchema = CSVSchema{
+		Delimiter: ",",
+		Quote:     QuoteDouble,
+		Header:    true,
+		Key:       KeyCIDR,
+		Fields:    6,
+		Columns: map[string]ColumnRef{
+			FieldNetwork:       "0",
+			FieldASN:           "1",
+			FieldASCountryCode: "2",
+			FieldASName:        "3",
+			FieldASOrg:         "4",
+			FieldASDomain:      "5",
+		},
+	}
+)
+
+// LoadSchemaFile reads CSV sources with their schemas from a JSON mapping file.
+func LoadSchemaFile(path string) ([]SchemaSource, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var sf schemaFile
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&sf); err != nil {
+		return nil, fmt.Errorf("invalid schema file %s: %w", path, err)
+	}
+
+	if len(sf.Sources) == 0 {
+		return nil, fmt.Errorf("schema file %s has no sources", path)
+	}
+
+	for i, src := range sf.Sources {
+		if src.Path == "" {
+			return nil, fmt.Errorf("schema file %s: source #%d has no path", path, i)
+		}
+		if err := src.Validate(); err != nil {
+			return nil, fmt.Errorf("schema file %s: source %s: %w", path, src.Path, err)
+		}
+	}
+
+	return sf.Sources, nil
+}
+
+// Validate checks the schema for consistency.
+func (s CSVSchema) Validate() error {
+	if _, err := s.delimiter(); err != nil {
+		return err
+	}
+
+	switch s.Quote {
+	case "", QuoteDouble, QuoteLazy, QuoteNone:
+	default:
+		return fmt.Errorf("unknown quote mode %q", s.Quote)
+	}
+
+	keys, err := s.keyFields()
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		if _, ok := s.Columns[k]; !ok {
+			return fmt.Errorf("key %s requires %q column", s.Key, k)
+		}
+	}
+
+	known := map[string]bool{FieldNetwork: true, FieldStart: true, FieldEnd: true}
+	for _, f := range append(geoSchemaFields, asSchemaFields...) {
+		known[f] = true
+	}
+
+	for field, col := range s.Columns {
+		if !known[field] {
+			return fmt.Errorf("unknown schema field %q", field)
+		}
+		if _, ok := col.index(); !ok && !s.Header {
+			return fmt.Errorf("field %q references column %q by name without header", field, col)
+		}
+	}
+
+	if !s.HasGeo() && !s.HasAS() {
+		return errors.New("schema maps no metadata fields")
+	}
+
+	return nil
+}
+
+// HasGeo reports whether the schema maps any geo field.
+func (s CSVSchema) HasGeo() bool {
+	return s.hasAny(geoSchemaFields)
+}
+
+// HasAS reports whether the schema maps any AS field.
+func (s CSVSchema) HasAS() bool {
+	return s.hasAny(asSchemaFields)
+}
+
+func (s CSVSchema) hasAny(fields []string) bool {
+	for _, f := range fields {
+		if _, ok := s.Columns[f]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s CSVSchema) keyFields() ([]string, error) {
+	switch s.Key {
+	case KeyCIDR:
+		return []string{FieldNetwork}, nil
+	case KeyStartEnd, KeyIntRange:
+		return []string{FieldStart, FieldEnd}, nil
+	default:
+		return nil, fmt.Errorf("unknown key kind %q", s.Key)
+	}
+}
+
+func (s CSVSchema) delimiter() (byte, error) {
+	switch d := s.Delimiter; {
+	case d == "":
+		return ',', nil
+	case d == `\t` || d == "tab":
+		return '\t', nil
+	case len(d) == 1 && d[0] != '"' && d[0] != '\r' && d[0] != '\n':
+		return d[0], nil
+	default:
+		return 0, fmt.Errorf("invalid delimiter %q", d)
+	}
+}
+
+// resolve maps schema fields to column indices using the header line when present.
+func (s CSVSchema) resolve(header []string) (map[string]int, error) {
+	byName := make(map[string]int, len(header))
+	for i, name := range header {
+		byName[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+
+	index := make(map[string]int, len(s.Columns))
+	for field, col := range s.Columns {
+		if i, ok := col.index(); ok {
+			index[field] = i
+			continue
+		}
+
+		i, ok := byName[string(col)]
+		if !ok {
+			return nil, fmt.Errorf("missing CSV column %q for field %q", col, field)
+		}
+		index[field] = i
+	}
+
+	return index, nil
+}
+
+// parseKey parses the address key of a record.
+func (s CSVSchema) parseKey(rec csvRecord) (netipx.IPRange, error) {
+	var (
+		start, end netip.Addr
+		err        error
+	)
+
+	switch s.Key {
+	case KeyCIDR:
+		pfx, err := netip.ParsePrefix(strings.TrimSpace(rec.Get(FieldNetwork)))
+		if err != nil {
+			return netipx.IPRange{}, err
+		}
+		return netipx.RangeOfPrefix(pfx), nil
+
+	case KeyStartEnd:
+		start, end, err = parseStartEndRange(rec.Get(FieldStart), rec.Get(FieldEnd))
+
+	case KeyIntRange:
+		start, end, err = parseIP2LocationRange(rec.Get(FieldStart), rec.Get(FieldEnd))
+
+	default:
+		err = fmt.Errorf("unknown key kind %q", s.Key)
+	}
+
+	if err != nil {
+		return netipx.IPRange{}, err
+	}
+	return netipx.IPRangeFrom(start, end), nil
+}
+
+// ==========================
+
+/*
+NewRegistrySchema constructs a new RegistryIP from CSV sources described by schemas.
+
+	Sources mapping geo fields fill the country table, sources mapping AS fields
+	fill the AS table, a source may fill both. Ranges of all sources are merged by address.
+	ver specifies the IP version filter (IPv4, IPv6, or both).
+*/
+func NewRegistrySchema(ctx context.Context, ver IPVersion, sources []SchemaSource, opts ...LoadOption) (*RegistryIP, error) {
+	ls := newLoadState(opts...)
+	defer ls.trackProgress(ctx)()
+
+	countryTable := newUniqueRangeTable[countryData](0)
+	astable := newUniqueRangeTable[asData](0)
+
+	tasks := make([]func(context.Context) error, 0, len(sources))
+
+	for _, src := range sources {
+		if err := src.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid schema of %s: %w", src.Path, err)
+		}
+
+		hasGeo, hasAS := src.HasGeo(), src.HasAS()
+		counter := ls.source(src.Path)
+
+		tasks = append(tasks, readTask("CSV", src.Path, counter, func(ctx context.Context) error {
+			return csvForEach(
+				ctx, src.Path, src.CSVSchema, ver, counter,
+				func(rng netipx.IPRange, rec csvRecord) error {
+					added := false
+
+					if hasGeo {
+						data := countryData{
+							ContinentCode: rec.Get(FieldContinentCode),
+							CountryCode:   rec.Get(FieldCountryCode),
+							CountryName:   rec.Get(FieldCountryName),
+							RegionName:    rec.Get(FieldRegionName),
+							CityName:      rec.Get(FieldCityName),
+						}
+						if data != (countryData{}) {
+							countryTable.Add(rng.From(), rng.To(), data)
+							ls.origins.addGeo(counter, rec.line, rng.From(), rng.To())
+							added = true
+						}
+					}
+
+					if hasAS {
+						asn, ok := parseASN(rec.Get(FieldASN))
+						if ok {
+							astable.Add(rng.From(), rng.To(), asData{
+								Number:      asn,
+								CountryCode: rec.Get(FieldASCountryCode),
+								Name:        rec.Get(FieldASName),
+								Org:         rec.Get(FieldASOrg),
+								Domain:      rec.Get(FieldASDomain),
+							})
+							ls.origins.addAS(counter, rec.line, rng.From(), rng.To())
+							added = true
+						} else if !added {
+							return skipRow(SkipInvalidASN)
+						}
+					}
+
+					if !added {
+						return skipRow(SkipNoData)
+					}
+					return nil
+				},
+			)
+		}))
+	}
+
+	if err := ls.describe(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := runParallel(ctx, ls.opts.workers, tasks...); err != nil {
+		return nil, err
+	}
+
+	if err := ls.finish(); err != nil {
+		return nil, err
+	}
+
+	reg := newRegistryIPFromRanges(countryTable, astable, ls.opts.index)
+	reg.report = ls.report()
+	reg.origins = ls.prepareOrigins()
+	return reg, nil
+}
+
+// parseASN parses an AS number with an optional "AS" prefix.
+func parseASN(s string) (int32, bool) {
+	s = strings.TrimSpace(s)
+	if len(s) > 2 && (s[:2] == "AS" || s[:2] == "as") {
+		s = s[2:]
+	}
+
+	asn, err := strconv.ParseInt(s, 10, 32)
+	if err != nil || asn <= 0 {
+		return 0, false
+	}
+	return int32(asn), true
+}
+
+// ==========================
+
+// recordReader reads CSV records one by one.
+// Records with a wrong number of fields are returned together with a *csv.ParseError.
+type recordReader interface {
+	Read() ([]string, error)
+	// Line returns the line number of the last read record.
+	Line() int64
+}
+
+// newRecordReader creates a record reader for the schema over r.
+func (s CSVSchema) newRecordReader(r io.Reader) (recordReader, error) {
+	delim, err := s.delimiter()
+	if err != nil {
+		return nil, err
+	}
+
+	fieldsCount := s.Fields
+	if fieldsCount <= 0 {
+		fieldsCount = -1
+	}
+
+	if s.Quote == QuoteNone {
+		return &splitReader{
+			br:     bufio.NewReaderSize(r, 1<<16),
+			delim:  delim,
+			fields: fieldsCount,
+		}, nil
+	}
+
+	return newCSVRecordReader(r, rune(delim), s.Quote == QuoteLazy, fieldsCount), nil
+}
+
+// framing returns the record framing of files laid out by the schema.
+// Bare quotes of lazy quoting hide record ends, so such files are not cut into parts.
+func (s CSVSchema) framing() framing {
+	delim, _ := s.delimiter() // an invalid delimiter fails the record reader
+	return framing{split: s.Quote != QuoteLazy, quoted: s.Quote != QuoteNone, delim: delim}
+}
+
+// csvRecordReader adapts csv.Reader to recordReader.
+type csvRecordReader struct {
+	rd *csv.Reader
+}
+
+func newCSVRecordReader(r io.Reader, comma rune, lazyQuotes bool, fieldsCount int) *csvRecordReader {
+	rd := csv.NewReader(r)
+	rd.Comma = comma
+	rd.LazyQuotes = lazyQuotes
+	rd.FieldsPerRecord = fieldsCount
+	rd.ReuseRecord = true
+	return &csvRecordReader{rd: rd}
+}
+
+func (cr *csvRecordReader) Read() ([]string, error) {
+	return cr.rd.Read()
+}
+
+func (cr *csvRecordReader) Line() int64 {
+	line, _ := cr.rd.FieldPos(0)
+	return int64(line)
+}
+
+// splitReader splits lines on the delimiter without quote handling.
+type splitReader struct {
+	br     *bufio.Reader
+	delim  byte
+	fields int
+	line   int64
+	rec    []string
+}
+
+func (sr *splitReader) Read() ([]string, error) {
+	for {
+		line, err := sr.br.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return nil, err
+		}
+		sr.line++
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			continue
+		}
+
+		sr.rec = sr.rec[:0]
+		for {
+			i := strings.IndexByte(line, sr.delim)
+			if i < 0 {
+				sr.rec = append(sr.rec, line)
+				break
+			}
+			sr.rec = append(sr.rec, line[:i])
+			line = line[i+1:]
+		}
+
+		if sr.fields > 0 && len(sr.rec) != sr.fields {
+			return sr.rec, &csv.ParseError{StartLine: int(sr.line), Line: int(sr.line), Err: csv.ErrFieldCount}
+		}
+
+		return sr.rec, nil
+	}
+}
+
+func (sr *splitReader) Line() int64 {
+	return sr.line
+}
@@ -0,0 +1,161 @@
+package ipbase
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eterline/ipcsv2base/internal/model"
+)
+
+func TestSchemaParseKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		key        KeyKind
+		fields     map[string]string
+		start, end string
+		wantErr    bool
+	}{
+		{name: "CIDR", key: KeyCIDR, fields: map[string]string{FieldNetwork: " 1.0.0.0/24 "}, start: "1.0.0.0", end: "1.0.0.255"},
+		{name: "CIDR IPv6", key: KeyCIDR, fields: map[string]string{FieldNetwork: "2001:db8::/32"}, start: "2001:db8::", end: "2001:db8:ffff:ffff:ffff:ffff:ffff:ffff"},
+		{name: "CIDR invalid", key: KeyCIDR, fields: map[string]string{FieldNetwork: "1.0.0.0/33"}, wantErr: true},
+		{name: "start/end", key: KeyStartEnd, fields: map[string]string{FieldStart: "1.0.0.0", FieldEnd: "1.0.0.9"}, start: "1.0.0.0", end: "1.0.0.9"},
+		{name: "start/end mixed families", key: KeyStartEnd, fields: map[string]string{FieldStart: "1.0.0.0", FieldEnd: "2001:db8::"}, wantErr: true},
+		{name: "start/end reversed", key: KeyStartEnd, fields: map[string]string{FieldStart: "1.0.0.9", FieldEnd: "1.0.0.0"}, wantErr: true},
+		{name: "int range", key: KeyIntRange, fields: map[string]string{FieldStart: "16777216", FieldEnd: "16777471"}, start: "1.0.0.0", end: "1.0.0.255"},
+		{name: "int range not a number", key: KeyIntRange, fields: map[string]string{FieldStart: "1.0.0.0", FieldEnd: "16777471"}, wantErr: true},
+		{name: "unknown key", key: "prefix", fields: map[string]string{FieldNetwork: "1.0.0.0/24"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		rec := csvRecord{index: map[string]int{}}
+		for field, value := range tt.fields {
+			rec.index[field] = len(rec.fields)
+			rec.fields = append(rec.fields, value)
+		}
+
+		rng, err := CSVSchema{Key: tt.key}.parseKey(rec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if rng.From() != netip.MustParseAddr(tt.start) || rng.To() != netip.MustParseAddr(tt.end) {
+			t.Errorf("%s: got %s, want %s-%s", tt.name, rng, tt.start, tt.end)
+		}
+	}
+}
+
+func TestLoadSchemaFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name: "named and numeric columns",
+			data: `{"sources": [
+				{"path": "geo.csv", "header": true, "key": "cidr", "columns": {"network": "net", "country_code": 2}},
+				{"path": "asn.tsv", "delimiter": "tab", "quote": "none", "key": "int_range", "fields": 3,
+				 "columns": {"start": 0, "end": "1", "asn": 2}}
+			]}`,
+		},
+		{name: "unknown JSON field", data: `{"sources": [{"path": "geo.csv", "key": "cidr", "keys": "cidr", "columns": {"network": 0, "country_code": 1}}]}`, wantErr: "unknown field"},
+		{name: "unknown schema field", data: `{"sources": [{"path": "geo.csv", "key": "cidr", "columns": {"network": 0, "country": 1}}]}`, wantErr: "unknown schema field"},
+		{name: "named column without header", data: `{"sources": [{"path": "geo.csv", "key": "cidr", "columns": {"network": "net", "country_code": 1}}]}`, wantErr: "without header"},
+		{name: "missing key column", data: `{"sources": [{"path": "geo.csv", "key": "start_end", "columns": {"start": 0, "country_code": 1}}]}`, wantErr: `requires "end" column`},
+		{name: "unknown key kind", data: `{"sources": [{"path": "geo.csv", "key": "prefix", "columns": {"network": 0, "country_code": 1}}]}`, wantErr: "unknown key kind"},
+		{name: "unknown quote mode", data: `{"sources": [{"path": "geo.csv", "key": "cidr", "quote": "single", "columns": {"network": 0, "country_code": 1}}]}`, wantErr: "unknown quote mode"},
+		{name: "invalid delimiter", data: `{"sources": [{"path": "geo.csv", "key": "cidr", "delimiter": "::", "columns": {"network": 0, "country_code": 1}}]}`, wantErr: "invalid delimiter"},
+		{name: "no metadata fields", data: `{"sources": [{"path": "geo.csv", "key": "cidr", "columns": {"network": 0}}]}`, wantErr: "no metadata fields"},
+		{name: "no path", data: `{"sources": [{"key": "cidr", "columns": {"network": 0, "country_code": 1}}]}`, wantErr: "has no path"},
+		{name: "no sources", data: `{"sources": []}`, wantErr: "has no sources"},
+	}
+	for _, tt := range tests {
+		file := filepath.Join(t.TempDir(), "schema.json")
+		if err := os.WriteFile(file, []byte(tt.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		sources, err := LoadSchemaFile(file)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error = %v", tt.name, err)
+			continue
+		}
+		if len(sources) != 2 || sources[0].Columns[FieldCountryCode] != "2" || sources[1].Columns[FieldEnd] != "1" {
+			t.Errorf("%s: sources = %+v", tt.name, sources)
+		}
+	}
+}
+
+func TestNewRegistrySchema(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		// named columns in another order than the schema fields
+		"geo.csv": "city;end;country;start\n" +
+			"Sydney;1.0.0.255;AU;1.0.0.0\n" +
+			"Tokyo;1.0.1.255;JP;1.0.1.0\n",
+		"asn.tsv": "16777216\t16777471\tAS13335\tCloudflare\n" +
+			"16777472\t16777727\t-\tnone\n", // no AS data
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sources := []SchemaSource{
+		{Path: filepath.Join(dir, "geo.csv"), CSVSchema: CSVSchema{
+			Delimiter: ";", Header: true, Key: KeyStartEnd,
+			Columns: map[string]ColumnRef{FieldStart: "start", FieldEnd: "end", FieldCountryCode: "country", FieldCityName: "city"},
+		}},
+		{Path: filepath.Join(dir, "asn.tsv"), CSVSchema: CSVSchema{
+			Delimiter: "tab", Quote: QuoteNone, Key: KeyIntRange, Fields: 4,
+			Columns: map[string]ColumnRef{FieldStart: "0", FieldEnd: "1", FieldASN: "2", FieldASName: "3"},
+		}},
+	}
+
+	reg, err := NewRegistrySchema(context.Background(), IPv4v6, sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		addr string
+		geo  model.IPGeo
+		as   model.IPAS
+	}{
+		{"1.0.0.1", model.IPGeo{CountryCode: "AU", CityName: "Sydney"}, model.IPAS{ASN: 13335, Name: "Cloudflare"}},
+		{"1.0.1.1", model.IPGeo{CountryCode: "JP", CityName: "Tokyo"}, model.IPAS{}},
+	}
+	for _, tt := range tests {
+		meta, err := reg.LookupIP(context.Background(), netip.MustParseAddr(tt.addr))
+		if err != nil {
+			t.Errorf("LookupIP(%s) error = %v", tt.addr, err)
+			continue
+		}
+		if meta.Geo != tt.geo || meta.ASN != tt.as {
+			t.Errorf("LookupIP(%s) = %+v %+v, want %+v %+v", tt.addr, meta.Geo, meta.ASN, tt.geo, tt.as)
+		}
+	}
+
+	asn := reg.LoadReport().Sources[1]
+	if asn.RowsAccepted != 1 || asn.SkipReasons[SkipInvalidASN] != 1 {
+		t.Errorf("AS source report = %+v, want one row skipped as %s", asn, SkipInvalidASN)
+	}
+
+	sources[0].Columns[FieldCountryCode] = "country_iso_code"
+	if _, err := NewRegistrySchema(context.Background(), IPv4v6, sources); err == nil || !strings.Contains(err.Error(), "missing CSV column") {
+		t.Errorf("NewRegistrySchema with a missing header column error = %v", err)
+	}
+}
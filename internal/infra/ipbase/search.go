@@ -0,0 +1,287 @@
+package ipbase
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/eterline/ipcsv2base/internal/model"
+)
+
+// Relevance of a query token matching a document token.
+const (
+	scoreTokenExact  = 3.0
+	scoreTokenPrefix = 2.0
+	scoreTokenFuzzy  = 1.0 // halved for every edit over one
+
+	scoreFieldExact    = 5.0 // whole name, org or domain equals the query
+	scoreFieldPrefix   = 2.0
+	scoreFieldContains = 1.0
+)
+
+/*
+asSearchIndex - Full-text index of AS names, orgs and domains.
+
+	Documents are autonomous systems, a token matches exactly, by prefix or
+	within a small edit distance. Every query token has to match. Built once
+	per registry, a reloaded base gets a new index with its registry.
+*/
+type asSearchIndex struct {
+	docs     []asDoc
+	tokens   []string   // sorted distinct tokens
+	postings [][]uint32 // documents per token, parallel to tokens
+	domains  map[string][]uint32
+}
+
+type asDoc struct {
+	as     model.IPAS
+	fields []string // normalized names, orgs and domains of all AS records
+	weight uint64   // IPv4 space, ranks equal scores
+}
+
+// newASSearchIndex indexes AS records by number, the first record of a number describes it.
+func newASSearchIndex(records []asData, weight func(asn int32) uint64) *asSearchIndex {
+	x := &asSearchIndex{domains: map[string][]uint32{}}
+
+	byASN := make(map[int32]uint32, len(records))
+	postings := map[string][]uint32{}
+
+	for _, r := range records {
+		id, ok := byASN[r.Number]
+		if !ok {
+			id = uint32(len(x.docs))
+			byASN[r.Number] = id
+			x.docs = append(x.docs, asDoc{
+				as: model.IPAS{
+					ASN:         r.Number,
+					CountryCode: model.GeoCode(r.CountryCode),
+					Name:        r.Name,
+					Org:         r.Org,
+					Domain:      r.Domain,
+				},
+			})
+			if weight != nil {
+				x.docs[id].weight = weight(r.Number)
+			}
+		}
+		doc := &x.docs[id]
+
+		for _, f := range []string{r.Name, r.Org, r.Domain} {
+			f = normalizeSearch(f)
+			if f == "" || slices.Contains(doc.fields, f) {
+				continue
+			}
+			doc.fields = append(doc.fields, f)
+
+			for _, tok := range searchTokens(f) {
+				if p := postings[tok]; len(p) == 0 || p[len(p)-1] != id {
+					postings[tok] = append(p, id)
+				}
+			}
+		}
+
+		if d := normalizeDomain(r.Domain); d != "" && !slices.Contains(x.domains[d], id) {
+			x.domains[d] = append(x.domains[d], id)
+		}
+	}
+
+	x.tokens = make([]string, 0, len(postings))
+	for tok := range postings {
+		x.tokens = append(x.tokens, tok)
+	}
+	slices.Sort(x.tokens)
+
+	x.postings = make([][]uint32, len(x.tokens))
+	for i, tok := range x.tokens {
+		x.postings[i] = slices.Clip(postings[tok])
+	}
+
+	return x
+}
+
+// search returns the page of documents matching query by relevance.
+func (x *asSearchIndex) search(query string, offset, limit int) model.ASSearchResult {
+	query = normalizeSearch(query)
+	qtokens := searchTokens(query)
+	if x == nil || len(qtokens) == 0 {
+		return model.ASSearchResult{}
+	}
+
+	var scores map[uint32]float64
+	for i, qt := range qtokens {
+		matched := x.matchToken(qt)
+
+		if i == 0 {
+			scores = matched
+			continue
+		}
+		for id, s := range scores {
+			if ms, ok := matched[id]; ok {
+				scores[id] = s + ms
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	matches := make([]model.ASMatch, 0, len(scores))
+	weights := make(map[int32]uint64, len(scores))
+	for id, s := range scores {
+		doc := &x.docs[id]
+		matches = append(matches, model.ASMatch{AS: doc.as, Score: s + fieldScore(doc.fields, query)})
+		weights[doc.as.ASN] = doc.weight
+	}
+
+	slices.SortFunc(matches, func(a, b model.ASMatch) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(weights[b.AS.ASN], weights[a.AS.ASN]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.AS.ASN, b.AS.ASN)
+	})
+
+	res := model.ASSearchResult{Total: len(matches)}
+	if offset < len(matches) {
+		res.Matches = matches[offset:min(len(matches), offset+limit)]
+	}
+	return res
+}
+
+// matchToken returns the best score of every document holding a token matching qt.
+func (x *asSearchIndex) matchToken(qt string) map[uint32]float64 {
+	matched := map[uint32]float64{}
+	add := func(i int, score float64) {
+		for _, id := range x.postings[i] {
+			if score > matched[id] {
+				matched[id] = score
+			}
+		}
+	}
+
+	// exact and prefix matches are a sorted run
+	i, _ := slices.BinarySearch(x.tokens, qt)
+	for j := i; j < len(x.tokens) && strings.HasPrefix(x.tokens[j], qt); j++ {
+		if x.tokens[j] == qt {
+			add(j, scoreTokenExact)
+		} else if len(qt) > 1 {
+			add(j, scoreTokenPrefix)
+		}
+	}
+
+	maxDist := fuzzyDistance(qt)
+	if maxDist == 0 {
+		return matched
+	}
+
+	for j, tok := range x.tokens {
+		if d := len(tok) - len(qt); d > maxDist || -d > maxDist {
+			continue
+		}
+		if dist := editDistance(qt, tok, maxDist); dist > 0 && dist <= maxDist {
+			add(j, scoreTokenFuzzy/float64(int(1)<<(dist-1)))
+		}
+	}
+	return matched
+}
+
+// byDomain returns the documents of the domain or of its closest registered parent.
+func (x *asSearchIndex) byDomain(domain string) model.DomainASes {
+	domain = normalizeDomain(domain)
+	if x == nil {
+		return model.DomainASes{}
+	}
+
+	// parents are tried while they keep a dot, a bare top-level domain matches only itself
+	for d := domain; d != ""; {
+		ids, ok := x.domains[d]
+		if !ok {
+			dot := strings.IndexByte(d, '.')
+			if dot < 0 || !strings.Contains(d[dot+1:], ".") {
+				break
+			}
+			d = d[dot+1:]
+			continue
+		}
+
+		res := model.DomainASes{Domain: d, AS: make([]model.IPAS, 0, len(ids))}
+		for _, id := range ids {
+			res.AS = append(res.AS, x.docs[id].as)
+		}
+		return res
+	}
+	return model.DomainASes{}
+}
+
+// fieldScore rewards names, orgs or domains equal to, starting with or holding the whole query.
+func fieldScore(fields []string, query string) float64 {
+	var best float64
+	for _, f := range fields {
+		switch {
+		case f == query:
+			best = max(best, scoreFieldExact)
+		case strings.HasPrefix(f, query):
+			best = max(best, scoreFieldPrefix)
+		case strings.Contains(f, query):
+			best = max(best, scoreFieldContains)
+		}
+	}
+	return best
+}
+
+// fuzzyDistance returns the edit distance allowed for a query token, short tokens match exactly.
+func fuzzyDistance(token string) int {
+	switch n := len(token); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// editDistance returns the Levenshtein distance of a and b, or limit+1 once it exceeds limit.
+func editDistance(a, b string, limit int) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func normalizeSearch(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+func normalizeDomain(s string) string {
+	s = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), ".")
+	return strings.TrimPrefix(s, "www.")
+}
+
+// searchTokens splits a normalized string into letter and digit runs.
+func searchTokens(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
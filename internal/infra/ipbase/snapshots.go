@@ -0,0 +1,330 @@
+package ipbase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/eterline/ipcsv2base/internal/model"
+	mmaprc "github.com/eterline/ipcsv2base/pkg/mmapread"
+)
+
+/*
+SnapshotStore - Compiled base files of past versions in a directory, keyed by their build date.
+
+	A version answers lookups from its data time until the next version.
+	Files are mapped on first use, outside the store lock, and verified with
+	the load options of the dataset. Mapped versions are kept while their
+	mapped size fits the budget, least recently used unreferenced versions
+	are closed beyond it. The files of the directory are checked at most once
+	per snapshotRescanInterval, so new, replaced and removed snapshots are
+	picked up without a restart.
+*/
+type SnapshotStore struct {
+	log    model.Logger
+	dir    string
+	advice mmaprc.Advice
+	budget int64
+	opts   []LoadOption
+
+	mu       sync.Mutex
+	scanned  time.Time              // last check of the directory
+	versions []*snapshot            // sorted by data time
+	skipped  map[string]os.FileInfo // files that are no compiled bases, not read again while unchanged
+	mapped   int64                  // total size of mapped versions
+	clock    uint64                 // last use counter of the LRU order
+	closed   bool
+}
+
+// snapshotRescanInterval - Shortest interval between checks of the snapshots directory.
+const snapshotRescanInterval = time.Second
+
+// snapshot - Compiled base file of a past version.
+type snapshot struct {
+	path     string
+	dataTime time.Time
+	modTime  time.Time
+	size     int64
+
+	mapMu   sync.Mutex    // serializes mapping of the file, taken without the store lock
+	base    *RegistryMmap // nil until mapped
+	refs    int           // running lookups holding the version
+	used    uint64
+	dropped bool // replaced or removed from the directory, closed once unreferenced
+}
+
+// NewSnapshotStore - Scans dir for compiled base files, budget is the mapped size in bytes kept open.
+// Files other than compiled bases are skipped with a warning. Versions are opened with opts,
+// so a verifier rejects snapshots missing from the manifest.
+func NewSnapshotStore(log model.Logger, dir string, advice mmaprc.Advice, budget int64, opts ...LoadOption) (*SnapshotStore, error) {
+	s := &SnapshotStore{
+		log:    log,
+		dir:    dir,
+		advice: advice,
+		budget: budget,
+		opts:   opts,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.rescan(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+/*
+Acquire - Returns the newest version built at or before at.
+
+	The registry stays mapped until release is called, which must happen
+	exactly once after the lookup. Returns model.ErrNoBaseVersion when every
+	version is newer than at.
+*/
+func (s *SnapshotStore) Acquire(ctx context.Context, at time.Time) (base *RegistryMmap, dataTime time.Time, release func(), err error) {
+	v, err := s.pin(at)
+	if err != nil {
+		return nil, time.Time{}, nil, err
+	}
+
+	release = func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		v.refs--
+		if v.dropped || s.closed {
+			s.closeIdle(v)
+		}
+		s.evict()
+	}
+
+	if base, err = s.mapVersion(ctx, v); err != nil {
+		release()
+		return nil, time.Time{}, nil, fmt.Errorf("failed to open base snapshot: %w", err)
+	}
+	return base, v.dataTime, release, nil
+}
+
+// pin returns the newest version built at or before at, referenced so it is not closed until released.
+func (s *SnapshotStore) pin(at time.Time) (*snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, errors.New("base snapshots are closed")
+	}
+	if err := s.rescan(); err != nil {
+		return nil, err
+	}
+
+	i, _ := slices.BinarySearchFunc(s.versions, at, func(v *snapshot, at time.Time) int {
+		if v.dataTime.After(at) {
+			return 1
+		}
+		return -1
+	})
+	if i == 0 {
+		return nil, fmt.Errorf("%w: %s", model.ErrNoBaseVersion, at.Format(time.RFC3339))
+	}
+
+	v := s.versions[i-1]
+	s.clock++
+	v.used = s.clock
+	v.refs++
+	return v, nil
+}
+
+/*
+mapVersion - Returns the mapping of a pinned version, mapping its file on first use.
+
+	The file is mapped and verified without the store lock, so lookups of
+	other versions are not blocked, concurrent lookups of the same version
+	wait for a single mapping.
+*/
+func (s *SnapshotStore) mapVersion(ctx context.Context, v *snapshot) (*RegistryMmap, error) {
+	v.mapMu.Lock()
+	defer v.mapMu.Unlock()
+
+	s.mu.Lock()
+	base := v.base
+	s.mu.Unlock()
+	if base != nil {
+		return base, nil
+	}
+
+	base, err := OpenRegistryMmap(ctx, v.path, s.advice, s.opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		base.Close()
+		return nil, errors.New("base snapshots are closed")
+	}
+
+	v.base = base
+	s.mapped += v.size
+	s.log.Debug(
+		"base snapshot mapped",
+		model.FieldString("file", v.path),
+		model.FieldString("data_time", v.dataTime.Format(time.RFC3339)),
+		model.Field("mapped_bytes", s.mapped),
+	)
+	s.evict()
+	return base, nil
+}
+
+// Versions - Returns the known versions, oldest first.
+func (s *SnapshotStore) Versions() []model.BaseVersion {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.rescan(); err != nil {
+		s.log.Warn("base snapshots rescan failed", model.FieldError(err))
+	}
+
+	list := make([]model.BaseVersion, 0, len(s.versions))
+	for _, v := range s.versions {
+		list = append(list, model.BaseVersion{
+			DataTime: v.dataTime,
+			File:     v.path,
+			Size:     v.size,
+			Loaded:   v.base != nil,
+		})
+	}
+	return list
+}
+
+// Close - Unmaps every unreferenced version, versions held by lookups are unmapped on release.
+// The store must not be used afterwards.
+func (s *SnapshotStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	var errs []error
+	for _, v := range s.versions {
+		if v.base != nil && v.refs == 0 {
+			errs = append(errs, v.base.Close())
+			v.base = nil
+			s.mapped -= v.size
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// rescan checks the files of the directory, the caller holds mu.
+// Files are checked at most once per snapshotRescanInterval, in place rewrites change no directory
+// modification time, so every file is compared by size and modification time. Versions whose file is
+// unchanged are kept with their mapping, their header is not read again.
+func (s *SnapshotStore) rescan() error {
+	if s.versions != nil && time.Since(s.scanned) < snapshotRescanInterval {
+		return nil
+	}
+	s.scanned = time.Now()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read base snapshots: %w", err)
+	}
+
+	known := make(map[string]*snapshot, len(s.versions))
+	for _, v := range s.versions {
+		known[v.path] = v
+	}
+
+	versions := make([]*snapshot, 0, len(entries))
+	skipped := make(map[string]os.FileInfo)
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		path := filepath.Join(s.dir, e.Name())
+
+		entry, err := e.Info()
+		if err != nil {
+			continue // removed since the directory was read
+		}
+		if v, ok := known[path]; ok && v.size == entry.Size() && v.modTime.Equal(entry.ModTime()) {
+			delete(known, path)
+			versions = append(versions, v)
+			continue
+		}
+		if prev, ok := s.skipped[path]; ok && prev.Size() == entry.Size() && prev.ModTime().Equal(entry.ModTime()) {
+			skipped[path] = entry
+			continue
+		}
+
+		hdr, fi, err := readCompiledHeader(path)
+		if err != nil {
+			s.log.Warn("base snapshot skipped", model.FieldString("file", path), model.FieldError(err))
+			skipped[path] = entry
+			continue
+		}
+
+		dataTime := hdr.dataTime
+		if dataTime.IsZero() {
+			dataTime = fi.ModTime().UTC()
+		}
+		versions = append(versions, &snapshot{
+			path:     path,
+			dataTime: dataTime,
+			modTime:  fi.ModTime(),
+			size:     fi.Size(),
+		})
+	}
+
+	// replaced and removed files stay mapped while lookups hold them
+	for _, v := range known {
+		v.dropped = true
+		s.closeIdle(v)
+	}
+
+	slices.SortFunc(versions, func(a, b *snapshot) int {
+		return a.dataTime.Compare(b.dataTime)
+	})
+	s.versions = versions
+	s.skipped = skipped
+	return nil
+}
+
+// evict closes least recently used unreferenced versions until the mapped size fits the budget.
+// The caller holds mu.
+func (s *SnapshotStore) evict() {
+	for s.mapped > s.budget {
+		var lru *snapshot
+		for _, v := range s.versions {
+			if v.base != nil && v.refs == 0 && (lru == nil || v.used < lru.used) {
+				lru = v
+			}
+		}
+		if lru == nil {
+			return // every mapped version is in use
+		}
+		s.closeIdle(lru)
+	}
+}
+
+// closeIdle unmaps an unreferenced version.
+func (s *SnapshotStore) closeIdle(v *snapshot) {
+	if v.base == nil || v.refs > 0 {
+		return
+	}
+
+	if err := v.base.Close(); err != nil {
+		s.log.Warn("base snapshot unmap failed", model.FieldString("file", v.path), model.FieldError(err))
+	}
+	v.base = nil
+	s.mapped -= v.size
+	s.log.Debug(
+		"base snapshot unmapped",
+		model.FieldString("file", v.path),
+		model.Field("mapped_bytes", s.mapped),
+	)
+}
@@ -0,0 +1,190 @@
+package ipbase_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eterline/ipcsv2base/internal/infra/ipbase"
+	logging "github.com/eterline/ipcsv2base/internal/infra/log"
+	mmaprc "github.com/eterline/ipcsv2base/pkg/mmapread"
+)
+
+var errUnsigned = errors.New("file is not in the manifest")
+
+// rejectVerifier - Verifier refusing every file.
+type rejectVerifier struct{}
+
+func (rejectVerifier) Verify(file, sum string) error { return errUnsigned }
+
+// newSnapshotDir returns a directory holding one compiled base of the test registry.
+func newSnapshotDir(t *testing.T) string {
+	t.Helper()
+
+	data, err := os.ReadFile(writeCompiledFile(t, newTestRegistryIP(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "base.ipc"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestSnapshotStoreVerifies(t *testing.T) {
+	log, err := logging.NewZapLoggerWithConfig(io.Discard, "error", false, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := newSnapshotDir(t)
+
+	store, err := ipbase.NewSnapshotStore(log, dir, mmaprc.AdviceRandom, 1<<30, ipbase.WithVerifier(rejectVerifier{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if _, _, _, err := store.Acquire(context.Background(), time.Now()); !errors.Is(err, errUnsigned) {
+		t.Fatalf("Acquire of an unverified snapshot: error = %v, want %v", err, errUnsigned)
+	}
+	if v := store.Versions(); len(v) != 1 || v[0].Loaded {
+		t.Fatalf("Versions = %+v, want one unmapped version", v)
+	}
+}
+
+func TestSnapshotStoreConcurrentAcquire(t *testing.T) {
+	log, err := logging.NewZapLoggerWithConfig(io.Discard, "error", false, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a zero budget unmaps every version once released
+	store, err := ipbase.NewSnapshotStore(log, newSnapshotDir(t), mmaprc.AdviceRandom, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	addrs := testAddrs()
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				base, _, release, err := store.Acquire(ctx, time.Now())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				for _, addr := range addrs {
+					if addr.IsValid() {
+						base.LookupIP(ctx, addr)
+					}
+				}
+				release()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if v := store.Versions(); len(v) != 1 || v[0].Loaded {
+		t.Fatalf("Versions = %+v, want one unmapped version", v)
+	}
+}
+
+func TestSnapshotStoreCloseKeepsHeldVersions(t *testing.T) {
+	log, err := logging.NewZapLoggerWithConfig(io.Discard, "error", false, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := ipbase.NewSnapshotStore(log, newSnapshotDir(t), mmaprc.AdviceRandom, 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	base, _, release, err := store.Acquire(ctx, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the held version is still mapped
+	for _, addr := range testAddrs() {
+		if addr.IsValid() {
+			base.LookupIP(ctx, addr)
+		}
+	}
+	release()
+
+	if v := store.Versions(); len(v) != 1 || v[0].Loaded {
+		t.Fatalf("Versions = %+v, want the version unmapped on release", v)
+	}
+	if _, _, _, err := store.Acquire(ctx, time.Now()); err == nil {
+		t.Fatal("Acquire of a closed store succeeded")
+	}
+}
+
+func TestSnapshotStoreRescansRewrittenFiles(t *testing.T) {
+	log, err := logging.NewZapLoggerWithConfig(io.Discard, "error", false, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := newSnapshotDir(t)
+	path := filepath.Join(dir, "base.ipc")
+
+	store, err := ipbase.NewSnapshotStore(log, dir, mmaprc.AdviceRandom, 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	_, _, release, err := store.Acquire(context.Background(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if v := store.Versions(); len(v) != 1 || !v[0].Loaded {
+		t.Fatalf("Versions = %+v, want one mapped version", v)
+	}
+
+	// rewriting the file in place keeps the modification time of the directory
+	dirSt, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rewritten := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(path, rewritten, rewritten); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(dir, dirSt.ModTime(), dirSt.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Second + 100*time.Millisecond) // snapshotRescanInterval
+
+	// the rewritten file is registered anew, the mapping of the old file is dropped
+	if v := store.Versions(); len(v) != 1 || v[0].Loaded {
+		t.Fatalf("Versions = %+v, want one unmapped version", v)
+	}
+}
@@ -0,0 +1,152 @@
+package ipbase
+
+import (
+	"sync"
+	"unsafe"
+
+	"github.com/eterline/ipcsv2base/internal/model"
+	"github.com/eterline/ipcsv2base/pkg/ipsetdata"
+)
+
+// Approximate heap costs of Go values, used by registry statistics.
+const (
+	stringSize   = int64(unsafe.Sizeof(""))
+	sliceSize    = int64(unsafe.Sizeof([]uint32(nil)))
+	pointerSize  = int64(unsafe.Sizeof(uintptr(0)))
+	mapEntrySize = 16 // per entry overhead of a map besides keys and values
+)
+
+// statsCache - Statistics of an immutable registry, computed on first use.
+type statsCache struct {
+	once  sync.Once
+	stats model.BaseStats
+}
+
+func (c *statsCache) get(compute func() model.BaseStats) model.BaseStats {
+	c.once.Do(func() {
+		c.stats = compute()
+	})
+	return c.stats
+}
+
+// setBaseStats converts statistics of a range set, its ranges and index are the first heap structures.
+func setBaseStats(st ipsetdata.SetStats) model.BaseStats {
+	return model.BaseStats{
+		Ranges4:     st.Ranges4,
+		Ranges6:     st.Ranges6,
+		Space4:      st.Space4,
+		Space6:      st.Space6,
+		Overlaps:    st.Overlaps,
+		Gaps4:       st.Gaps4,
+		Gaps6:       st.Gaps6,
+		Coalescable: st.Coalescable,
+		Heap: []model.HeapUsage{
+			{Structure: "ranges", Bytes: st.RangeBytes},
+			{Structure: "index", Bytes: st.IndexBytes},
+		},
+	}
+}
+
+// Stats returns structure statistics of the registry, computed once.
+func (base *RegistryIP) Stats() model.BaseStats {
+	return base.stats.get(func() model.BaseStats {
+		st := setBaseStats(base.reg.Stats())
+		st.Countries = len(base.countryTable)
+		st.ASes = len(base.asTable)
+		st.Heap = append(st.Heap,
+			model.HeapUsage{Structure: "country_table", Bytes: countryTableBytes(base.countryTable)},
+			model.HeapUsage{Structure: "as_table", Bytes: asTableBytes(base.asTable)},
+			model.HeapUsage{Structure: "reverse", Bytes: base.reverse.heapBytes()},
+			model.HeapUsage{Structure: "search", Bytes: base.search.heapBytes()},
+			model.HeapUsage{Structure: "origins", Bytes: base.origins.heapBytes()},
+		)
+		return st
+	})
+}
+
+// Stats returns structure statistics of the registry, computed once.
+func (base *RegistryIPTSV) Stats() model.BaseStats {
+	return base.stats.get(func() model.BaseStats {
+		st := setBaseStats(base.reg.Stats())
+		st.Countries = len(base.codes)
+		st.Heap = append(st.Heap,
+			model.HeapUsage{Structure: "country_codes", Bytes: int64(len(base.codes)) * (mapEntrySize + 2 + stringSize + 2)},
+			model.HeapUsage{Structure: "reverse", Bytes: base.reverse.heapBytes()},
+			model.HeapUsage{Structure: "origins", Bytes: base.origins.heapBytes()},
+		)
+		return st
+	})
+}
+
+func countryTableBytes(table []countryData) int64 {
+	n := int64(cap(table)) * int64(unsafe.Sizeof(countryData{}))
+	for _, c := range table {
+		n += int64(len(c.ContinentCode) + len(c.CountryCode) + len(c.CountryName) + len(c.RegionName) +
+			len(c.CityName) + len(c.RegisteredCountryCode) + len(c.RepresentedCountryCode))
+	}
+	return n
+}
+
+func asTableBytes(table []asData) int64 {
+	n := int64(cap(table)) * int64(unsafe.Sizeof(asData{}))
+	for _, a := range table {
+		n += int64(len(a.CountryCode) + len(a.Name) + len(a.Org) + len(a.Domain))
+	}
+	return n
+}
+
+// heapBytes returns the approximate heap of the index spans and summaries.
+func (x *reverseIndex) heapBytes() int64 {
+	entry := func(e *reverseEntry) int64 {
+		return mapEntrySize + pointerSize + int64(unsafe.Sizeof(reverseEntry{})) +
+			int64(cap(e.spans))*int64(unsafe.Sizeof(rangeUint128t{}))
+	}
+
+	var n int64
+	for cc, e := range x.country {
+		n += stringSize + int64(len(cc)) + entry(e)
+	}
+	for _, e := range x.as {
+		n += 4 + entry(e)
+	}
+	n += int64(len(x.pairs)) * (mapEntrySize + int64(unsafe.Sizeof(reversePair{})) + pointerSize + int64(unsafe.Sizeof(addrCount{})))
+
+	for _, s := range x.countrySummary {
+		n += mapEntrySize + stringSize + 2 + pointerSize + int64(unsafe.Sizeof(*s)) +
+			int64(cap(s.TopAS))*int64(unsafe.Sizeof(model.ASShare{})) + int64(len(s.CountryName))
+	}
+	for _, s := range x.asSummary {
+		n += mapEntrySize + 4 + pointerSize + int64(unsafe.Sizeof(*s)) +
+			int64(cap(s.Countries))*int64(unsafe.Sizeof(model.CountryShare{}))
+	}
+	return n
+}
+
+// heapBytes returns the approximate heap of documents, tokens and postings.
+func (x *asSearchIndex) heapBytes() int64 {
+	n := int64(cap(x.docs)) * int64(unsafe.Sizeof(asDoc{}))
+	for _, d := range x.docs {
+		n += int64(cap(d.fields)) * stringSize
+		for _, f := range d.fields {
+			n += int64(len(f))
+		}
+	}
+
+	n += int64(cap(x.tokens))*stringSize + int64(cap(x.postings))*sliceSize
+	for i, t := range x.tokens {
+		n += int64(len(t)) + int64(cap(x.postings[i]))*4
+	}
+
+	for d, ids := range x.domains {
+		n += mapEntrySize + stringSize + int64(len(d)) + sliceSize + int64(cap(ids))*4
+	}
+	return n
+}
+
+// heapBytes returns the approximate heap of recorded rows, zero when disabled.
+func (o *registryOrigins) heapBytes() int64 {
+	if o == nil {
+		return 0
+	}
+	return int64(cap(o.geo.rows)+cap(o.as.rows)) * int64(unsafe.Sizeof(rowOrigin{}))
+}
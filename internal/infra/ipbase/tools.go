@@ -1,11 +1,18 @@
 package ipbase
 
 import (
+	"bytes"
+	"context"
 	"encoding/csv"
+	"errors"
+	"fmt"
 	"io"
 	"net/netip"
+	"slices"
+	"strings"
+	"sync"
 
-	mmaprc "github.com/eterline/ipcsv2base/pkg/mmapread"
+	"go4.org/netipx"
 )
 
 // IPVersion represents the IP address version type.
@@ -45,51 +52,159 @@ func (v IPVersion) validate(ip netip.Addr) bool {
 
 // ==========================
 
-type csvEachFunc func(network netip.Prefix, fields []string) error
+type csvEachFunc func(rng netipx.IPRange, rec csvRecord) error
 
-// readAsnCSV reads ASN CSV file and updates the interner with ASN and organization info.
-func csvForEach(file string, fieldsCount int, verAllow IPVersion, do csvEachFunc) error {
-	f, err := mmaprc.OpenMMapReadCloser(file)
-	if err != nil {
-		return err
+// csvForEach reads a CSV file laid out by the schema and calls do for every record
+// with a parsable address key of the allowed IP version. Rows are counted in src.
+// Parts of large raw files are read concurrently, do must be safe for concurrent use.
+func csvForEach(ctx context.Context, file string, schema CSVSchema, verAllow IPVersion, src *sourceCounter, do csvEachFunc) error {
+	var index map[string]int
+	if !schema.Header {
+		var err error
+		if index, err = schema.resolve(nil); err != nil {
+			return err
+		}
 	}
-	defer f.Close()
 
-	asnRD := csv.NewReader(f)
-	asnRD.FieldsPerRecord = fieldsCount
+	head := func(line []byte) error {
+		rd, err := schema.newRecordReader(bytes.NewReader(line))
+		if err != nil {
+			return err
+		}
 
-	// skip header
-	if _, err := asnRD.Read(); err != nil {
+		header, err := rd.Read()
+		if err != nil {
+			return err
+		}
+
+		index, err = schema.resolve(header)
 		return err
 	}
 
+	return fileSource(file, schema.framing())(ctx, schema.Header, src, head,
+		func(ctx context.Context, part sourcePart, src *sourceCounter) error {
+			rd, err := schema.newRecordReader(part.r)
+			if err != nil {
+				return err
+			}
+
+			return readRecords(ctx, rd, part.line, src, func(line int64, recs []string) error {
+				rec := csvRecord{index: index, fields: recs, line: line}
+
+				rng, err := schema.parseKey(rec)
+				if err != nil {
+					return skipRow(SkipInvalidKey)
+				}
+				if !verAllow.validate(rng.From()) {
+					return errRowFiltered
+				}
+
+				return do(rng, rec)
+			})
+		},
+	)
+}
+
+// readRecords reads all records of rd and counts their outcome in src.
+// Line numbers of rd are shifted by lineBase. Malformed rows are skipped,
+// do receives the record line and its results are counted by sourceCounter.handle.
+// ctx is checked every rowsBatch rows.
+func readRecords(ctx context.Context, rd recordReader, lineBase int64, src *sourceCounter, do func(line int64, recs []string) error) error {
 	for {
-		recs, err := asnRD.Read()
+		if src.checkpoint() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+
+		recs, err := rd.Read()
 		if err != nil {
 			if err == io.EOF {
-				break
+				return nil
 			}
-			return err
-		}
 
-		pfx, err := netip.ParsePrefix(recs[0])
-		if err != nil || !verAllow.validate(pfx.Addr()) {
+			var pe *csv.ParseError
+			if !errors.As(err, &pe) {
+				return err
+			}
+
+			src.read()
+			if err := src.skip(lineBase+int64(pe.Line), SkipMalformedRow); err != nil {
+				return err
+			}
 			continue
 		}
 
-		if err := do(pfx, recs[1:]); err != nil {
+		src.read()
+		line := lineBase + rd.Line()
+		if err := src.handle(line, do(line, recs)); err != nil {
 			return err
 		}
 	}
+}
+
+// csvRecord is a CSV record with columns resolved by name.
+type csvRecord struct {
+	index  map[string]int
+	fields []string
+	line   int64 // line of the record in its source
+}
+
+// Get returns the value of the named column or an empty string when the column is absent.
+func (r csvRecord) Get(name string) string {
+	i, ok := r.index[name]
+	if !ok || i >= len(r.fields) {
+		return ""
+	}
+	return r.fields[i]
+}
+
+type csvNamedEachFunc func(rec csvRecord) error
+
+// csvNamedForEach reads a CSV source with a header line and calls do for every record.
+// All required columns must be present in the header. Rows are counted in src.
+// Parts of large raw files are read concurrently, do must be safe for concurrent use.
+func csvNamedForEach(ctx context.Context, read sourceReader, required []string, src *sourceCounter, do csvNamedEachFunc) error {
+	var index map[string]int
+
+	head := func(line []byte) error {
+		header, err := newCSVRecordReader(bytes.NewReader(line), ',', false, -1).Read()
+		if err != nil {
+			return fmt.Errorf("failed to read CSV header: %w", err)
+		}
+
+		index = make(map[string]int, len(header))
+		for i, name := range header {
+			index[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+		}
+
+		for _, name := range required {
+			if _, ok := index[name]; !ok {
+				return fmt.Errorf("missing CSV column %q", name)
+			}
+		}
+		return nil
+	}
+
+	return read(ctx, true, src, head,
+		func(ctx context.Context, part sourcePart, src *sourceCounter) error {
+			rd := newCSVRecordReader(part.r, ',', false, -1)
 
-	return nil
+			return readRecords(ctx, rd, part.line, src, func(line int64, fields []string) error {
+				return do(csvRecord{index: index, fields: fields, line: line})
+			})
+		},
+	)
 }
 
 // ==========================
 
 const maxMetaIds = 1 << 24
 
+// uniquePrefixTable interns data values and collects their prefixes.
+// Add is safe for concurrent use.
 type uniquePrefixTable[T comparable] struct {
+	mu    sync.Mutex
 	index map[T]uint32
 	data  []T
 	nets  [][]netip.Prefix
@@ -104,6 +219,9 @@ func newUniquePrefixTable[T comparable](capHint int) *uniquePrefixTable[T] {
 }
 
 func (t *uniquePrefixTable[T]) Add(pfx netip.Prefix, c T) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	if id, ok := t.index[c]; ok {
 		t.nets[id-1] = append(t.nets[id-1], pfx)
 		return
@@ -140,6 +258,70 @@ func (t *uniquePrefixTable[T]) Clear() {
 
 // ==============
 
+// idRange is an inclusive address range bound to a table id.
+type idRange struct {
+	start uint128t
+	end   uint128t
+	id    uint32
+}
+
+// uniqueRangeTable interns data values and collects their ranges.
+// Add is safe for concurrent use.
+type uniqueRangeTable[T comparable] struct {
+	mu     sync.Mutex
+	index  map[T]uint32
+	data   []T
+	ranges []idRange
+}
+
+func newUniqueRangeTable[T comparable](capHint int) *uniqueRangeTable[T] {
+	return &uniqueRangeTable[T]{
+		index:  make(map[T]uint32, capHint),
+		data:   make([]T, 0, capHint),
+		ranges: make([]idRange, 0, capHint),
+	}
+}
+
+func (t *uniqueRangeTable[T]) Add(start, end netip.Addr, c T) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id, ok := t.index[c]
+	if !ok {
+		id = uint32(len(t.data) + 1)
+		if id > maxMetaIds {
+			panic("too many indexes")
+		}
+		t.index[c] = id
+		t.data = append(t.data, c)
+	}
+
+	t.ranges = append(t.ranges, idRange{
+		start: Addr2Uint128t(start),
+		end:   Addr2Uint128t(end),
+		id:    id,
+	})
+}
+
+func (t *uniqueRangeTable[T]) Table() []T {
+	return t.data
+}
+
+// SortedRanges returns ranges sorted by start address.
+func (t *uniqueRangeTable[T]) SortedRanges() []idRange {
+	slices.SortFunc(t.ranges, func(a, b idRange) int {
+		return a.start.Compare(b.start)
+	})
+	return t.ranges
+}
+
+func (t *uniqueRangeTable[T]) Clear() {
+	t.ranges = nil
+	clrMap(&t.index)
+}
+
+// ==============
+
 func clrMap[K comparable, V any](mPtr *map[K]V) {
 	m := *mPtr
 	for key := range m {
@@ -2,6 +2,8 @@ package ipbase
 
 import (
 	"encoding/binary"
+	"errors"
+	"math/bits"
 	"net/netip"
 
 	"go4.org/netipx"
@@ -30,6 +32,64 @@ func Addr2Uint128t(a netip.Addr) (u uint128t) {
 	return u
 }
 
+// ParseUint128tDecimal parses an unsigned decimal integer of up to 128 bits.
+func ParseUint128tDecimal(s string) (u uint128t, err error) {
+	if s == "" {
+		return u, errors.New("empty decimal value")
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < '0' || c > '9' {
+			return uint128t{}, errors.New("invalid decimal value")
+		}
+
+		// u = u*10 + digit
+		hi, lo := bits.Mul64(u.lo, 10)
+		hiMul, hiOverflow := bits.Mul64(u.hi, 10)
+		hi, carry := bits.Add64(hi, hiOverflow, 0)
+		if hiMul != 0 || carry != 0 {
+			return uint128t{}, errors.New("decimal value overflows 128 bits")
+		}
+
+		lo, carry = bits.Add64(lo, uint64(c-'0'), 0)
+		hi, carry = bits.Add64(hi, 0, carry)
+		if carry != 0 {
+			return uint128t{}, errors.New("decimal value overflows 128 bits")
+		}
+
+		u = uint128t{hi: hi, lo: lo}
+	}
+
+	return u, nil
+}
+
+// Is32 reports whether the value fits into 32 bits.
+func (u uint128t) Is32() bool {
+	return u.hi == 0 && u.lo <= 0xffffffff
+}
+
+// ToAddr4 converts a 32-bit value to an IPv4 address.
+func (u uint128t) ToAddr4() netip.Addr {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(u.lo))
+	return netip.AddrFrom4(b)
+}
+
+// Inc returns u+1 and false on overflow.
+func (u uint128t) Inc() (uint128t, bool) {
+	lo, carry := bits.Add64(u.lo, 1, 0)
+	hi, carry := bits.Add64(u.hi, 0, carry)
+	return uint128t{hi: hi, lo: lo}, carry == 0
+}
+
+// Dec returns u-1 and false on underflow.
+func (u uint128t) Dec() (uint128t, bool) {
+	lo, borrow := bits.Sub64(u.lo, 1, 0)
+	hi, borrow := bits.Sub64(u.hi, 0, borrow)
+	return uint128t{hi: hi, lo: lo}, borrow == 0
+}
+
 func (u uint128t) Compare(v uint128t) int {
 	if u.hi < v.hi {
 		return -1
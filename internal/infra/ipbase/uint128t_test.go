@@ -0,0 +1,32 @@
+package ipbase
+
+import "testing"
+
+func TestParseUint128tDecimal(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    uint128t
+		wantErr bool
+	}{
+		{in: "0", want: uint128t{}},
+		{in: "4294967295", want: uint128t{lo: 0xffffffff}},
+		{in: "18446744073709551616", want: uint128t{hi: 1}},
+		{in: "340282366920938463463374607431768211455", want: uint128t{hi: ^uint64(0), lo: ^uint64(0)}},
+		{in: "340282366920938463463374607431768211456", wantErr: true},
+		{in: "3402823669209384634633746074317682114550", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "12a4", wantErr: true},
+		{in: "-1", wantErr: true},
+		{in: " 1", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseUint128tDecimal(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseUint128tDecimal(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseUint128tDecimal(%q) = %#x:%#x, want %#x:%#x", tt.in, got.hi, got.lo, tt.want.hi, tt.want.lo)
+		}
+	}
+}
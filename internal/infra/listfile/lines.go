@@ -0,0 +1,50 @@
+package listfile
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Line - Line of a list file split at its trailing comment.
+type Line struct {
+	Num     int    // 1-based line number
+	Text    string // whole line without surrounding spaces
+	Entry   string // text before the comment marker
+	Comment string // text after the comment marker
+	Marker  byte   // comment marker, '#' or ';', zero without a comment
+}
+
+/*
+ReadLines - Reads a list file line by line.
+
+	Text after '#' or ';' is a comment, entry and comment are trimmed.
+	Errors of do are returned unchanged and stop the read.
+*/
+func ReadLines(file string, do func(Line) error) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for num := 1; sc.Scan(); num++ {
+		ln := Line{Num: num, Text: strings.TrimSpace(sc.Text())}
+		ln.Entry = ln.Text
+
+		if i := strings.IndexAny(ln.Text, "#;"); i >= 0 {
+			ln.Marker = ln.Text[i]
+			ln.Entry, ln.Comment = strings.TrimSpace(ln.Text[:i]), strings.TrimSpace(ln.Text[i+1:])
+		}
+
+		if err := do(ln); err != nil {
+			return err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	return nil
+}
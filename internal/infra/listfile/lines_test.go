@@ -0,0 +1,48 @@
+package listfile_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/eterline/ipcsv2base/internal/infra/listfile"
+)
+
+func TestReadLines(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "list.txt")
+	data := "# header\n\n  1.0.0.0/24 ; SBL1  \n2.0.0.0#x;y\nExitAddress 3.0.0.1 2026-01-01\n"
+	if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []listfile.Line
+	if err := listfile.ReadLines(file, func(ln listfile.Line) error {
+		got = append(got, ln)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []listfile.Line{
+		{Num: 1, Text: "# header", Comment: "header", Marker: '#'},
+		{Num: 2},
+		{Num: 3, Text: "1.0.0.0/24 ; SBL1", Entry: "1.0.0.0/24", Comment: "SBL1", Marker: ';'},
+		{Num: 4, Text: "2.0.0.0#x;y", Entry: "2.0.0.0", Comment: "x;y", Marker: '#'},
+		{Num: 5, Text: "ExitAddress 3.0.0.1 2026-01-01", Entry: "ExitAddress 3.0.0.1 2026-01-01"},
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("ReadLines = %+v, want %+v", got, want)
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err := listfile.ReadLines(file, func(ln listfile.Line) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Fatalf("ReadLines stopped after %d lines with %v, want 1 line and %v", n, err, stop)
+	}
+}
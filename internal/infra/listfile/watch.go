@@ -0,0 +1,103 @@
+package listfile
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// Stat - Revision of a file, compared by modification time and size.
+type Stat struct {
+	modTime time.Time
+	size    int64
+}
+
+// StatOf - Returns the revision of a file described by st.
+func StatOf(st fs.FileInfo) Stat {
+	return Stat{modTime: st.ModTime(), size: st.Size()}
+}
+
+// StatFile - Returns the current revision of a file.
+func StatFile(file string) (Stat, error) {
+	st, err := os.Stat(file)
+	if err != nil {
+		return Stat{}, err
+	}
+	return StatOf(st), nil
+}
+
+// ModTime - Returns the modification time of the revision.
+func (s Stat) ModTime() time.Time {
+	return s.modTime
+}
+
+/*
+Watcher - Reloads a file once its modification time or size changes.
+
+	load reads the file and swaps the served data, a failed reload is
+	retried only once the file changes again. A Watcher is not safe for
+	concurrent use, it is owned by the reload loop.
+*/
+type Watcher struct {
+	file string
+	load func() error
+	stat Stat // revision of the last load attempt
+}
+
+// NewWatcher - Returns a watcher of file reloaded with load, nothing is loaded yet.
+func NewWatcher(file string, load func() error) *Watcher {
+	return &Watcher{file: file, load: load}
+}
+
+// Load - Loads the file, its revision is remembered on success.
+func (w *Watcher) Load() error {
+	st, err := StatFile(w.file)
+	if err != nil {
+		return err
+	}
+
+	if err := w.load(); err != nil {
+		return err
+	}
+	w.stat = st
+	return nil
+}
+
+/*
+Check - Reloads the file when it changed since the last load attempt.
+
+	changed reports a new revision, err is the reload error then and the
+	stat error of the file otherwise. A broken revision is remembered, so
+	it is reported once.
+*/
+func (w *Watcher) Check() (changed bool, err error) {
+	st, err := StatFile(w.file)
+	if err != nil {
+		return false, err
+	}
+	if st == w.stat {
+		return false, nil
+	}
+
+	if err := w.Load(); err != nil {
+		w.stat = st
+		return true, err
+	}
+	return true, nil
+}
+
+// RunEvery - Calls check every interval until ctx is done.
+func RunEvery(ctx context.Context, every time.Duration, check func()) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			check()
+		}
+	}
+}
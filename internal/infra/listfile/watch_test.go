@@ -0,0 +1,81 @@
+package listfile_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eterline/ipcsv2base/internal/infra/listfile"
+)
+
+func TestWatcher(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "list.txt")
+	modTime := time.Now().Add(-time.Hour)
+
+	// write replaces the file contents with a distinct modification time
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		modTime = modTime.Add(time.Second)
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		loads  int
+		broken = errors.New("broken")
+	)
+	w := listfile.NewWatcher(file, func() error {
+		loads++
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if string(data) == "broken" {
+			return broken
+		}
+		return nil
+	})
+
+	write("1.0.0.0/24")
+	if err := w.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name    string
+		write   string // new contents, empty keeps the file
+		changed bool
+		err     error
+		loads   int
+	}{
+		{name: "unchanged", loads: 1},
+		{name: "changed", write: "2.0.0.0/24", changed: true, loads: 2},
+		{name: "broken", write: "broken", changed: true, err: broken, loads: 3},
+		{name: "broken revision is not retried", loads: 3},
+		{name: "fixed", write: "3.0.0.0/24", changed: true, loads: 4},
+	}
+	for _, st := range steps {
+		if st.write != "" {
+			write(st.write)
+		}
+
+		changed, err := w.Check()
+		if changed != st.changed || !errors.Is(err, st.err) || loads != st.loads {
+			t.Fatalf("%s: Check = %v, %v after %d loads, want %v, %v after %d loads",
+				st.name, changed, err, loads, st.changed, st.err, st.loads)
+		}
+	}
+
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := w.Check(); changed || err == nil {
+		t.Fatalf("Check of a removed file = %v, %v, want a stat error", changed, err)
+	}
+}
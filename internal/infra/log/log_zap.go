@@ -60,6 +60,21 @@ func NewZapLoggerWithConfig(logWr io.Writer, levelStr string, dev, json, color b
 	return &ZapLogger{log: logger}, nil
 }
 
+func (z *ZapLogger) Enabled(level model.LogLevel) bool {
+	switch level {
+	case model.LevelDebug:
+		return z.canLog(zap.DebugLevel)
+	case model.LevelInfo:
+		return z.canLog(zap.InfoLevel)
+	case model.LevelWarn:
+		return z.canLog(zap.WarnLevel)
+	case model.LevelError:
+		return z.canLog(zap.ErrorLevel)
+	default:
+		return z.canLog(zap.FatalLevel)
+	}
+}
+
 func (z *ZapLogger) With(fields ...model.LogField) model.Logger {
 	var head *fieldNode
 	for i := len(fields) - 1; i >= 0; i-- {
@@ -0,0 +1,116 @@
+package netflags
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sync/atomic"
+	"time"
+
+	"github.com/eterline/ipcsv2base/internal/infra/listfile"
+	"github.com/eterline/ipcsv2base/internal/model"
+)
+
+/*
+Lists - Hot reloadable network flag lists, one file per list.
+
+	Every list is reloaded independently of the IP base and of the other
+	lists once its modification time or size changes. A failed reload keeps
+	serving the previous networks of the list.
+*/
+type Lists struct {
+	log   model.Logger
+	lists []*list
+}
+
+// list - Flag list backed by a file.
+type list struct {
+	Spec
+	nets  atomic.Pointer[listedNetworks]
+	watch *listfile.Watcher // owned by Run
+}
+
+// NewLists - Loads every flag list file.
+func NewLists(log model.Logger, specs []Spec) (*Lists, error) {
+	l := &Lists{
+		log:   log,
+		lists: make([]*list, 0, len(specs)),
+	}
+
+	names := make(map[string]struct{}, len(specs))
+	for _, spec := range specs {
+		if _, ok := names[spec.Name]; ok {
+			return nil, fmt.Errorf("duplicate flag list name %s", spec.Name)
+		}
+		names[spec.Name] = struct{}{}
+
+		fl := &list{Spec: spec}
+		fl.watch = listfile.NewWatcher(spec.File, fl.load)
+		if err := fl.watch.Load(); err != nil {
+			return nil, err
+		}
+		l.lists = append(l.lists, fl)
+	}
+	return l, nil
+}
+
+// LookupFlags - Returns a flag of every list holding addr, nil without a match.
+func (l *Lists) LookupFlags(addr netip.Addr) []model.IPFlag {
+	var flags []model.IPFlag
+	for _, fl := range l.lists {
+		if pfx, _, ok := fl.nets.Load().Get(addr); ok {
+			flags = append(flags, model.IPFlag{Flag: fl.Flag, List: fl.Name, Network: pfx})
+		}
+	}
+	return flags
+}
+
+// Size - Returns the number of listed ranges of all lists.
+func (l *Lists) Size() (n int) {
+	for _, fl := range l.lists {
+		n += fl.nets.Load().Size()
+	}
+	return n
+}
+
+// Run - Checks the list files every interval and reloads changed ones until ctx is done.
+func (l *Lists) Run(ctx context.Context, every time.Duration) {
+	listfile.RunEvery(ctx, every, func() {
+		for _, fl := range l.lists {
+			l.reloadChanged(fl)
+		}
+	})
+}
+
+func (l *Lists) reloadChanged(fl *list) {
+	changed, err := fl.watch.Check()
+	switch {
+	case !changed && err != nil:
+		l.log.Error("flag list check failed", model.FieldString("list", fl.Name), model.FieldError(err))
+	case err != nil:
+		l.log.Error(
+			"flag list reload failed, previous list is kept",
+			model.FieldString("list", fl.Name),
+			model.FieldString("file", fl.File),
+			model.FieldError(err),
+		)
+	case changed:
+		l.log.Info(
+			"flag list reloaded",
+			model.FieldString("list", fl.Name),
+			model.FieldStringer("flag", fl.Flag),
+			model.Field("ranges", fl.nets.Load().Size()),
+		)
+	}
+}
+
+// load reads the list file and swaps the served networks.
+func (fl *list) load() error {
+	nets, err := LoadFile(fl.File)
+	if err != nil {
+		return err
+	}
+
+	fl.nets.Store(nets)
+	return nil
+}
@@ -0,0 +1,97 @@
+package netflags
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/eterline/ipcsv2base/internal/infra/listfile"
+	"github.com/eterline/ipcsv2base/internal/model"
+	"github.com/eterline/ipcsv2base/pkg/ipsetdata"
+	"go4.org/netipx"
+)
+
+// Spec - Flag list file with its category and name.
+type Spec struct {
+	Flag model.NetworkFlag
+	Name string
+	File string
+}
+
+/*
+ParseSpec - Parses a flag list argument, "category[:name]=file".
+
+	The name defaults to the file name without its extension.
+*/
+func ParseSpec(s string) (Spec, error) {
+	head, file, ok := strings.Cut(s, "=")
+	if !ok || file == "" {
+		return Spec{}, fmt.Errorf("invalid flag list %q, expected category[:name]=file", s)
+	}
+
+	category, name, _ := strings.Cut(head, ":")
+	flag, err := model.ParseNetworkFlag(category)
+	if err != nil {
+		return Spec{}, err
+	}
+
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+	return Spec{Flag: flag, Name: name, File: file}, nil
+}
+
+// listedNetworks - Networks of a flag list, values are unused.
+type listedNetworks = ipsetdata.IPContainerSet[struct{}]
+
+/*
+LoadFile - Reads a flag list file of addresses, networks and ranges.
+
+	Every line holds an IP address, a CIDR network or a start-end range,
+	text after '#' or ';' is a comment. The Tor exit-addresses format is
+	read by its ExitAddress lines, the bulk exit list is a plain address
+	list. Overlapping entries are merged.
+*/
+func LoadFile(file string) (*listedNetworks, error) {
+	var b netipx.IPSetBuilder
+	err := listfile.ReadLines(file, func(ln listfile.Line) error {
+		fields := strings.Fields(ln.Entry)
+		if len(fields) == 0 {
+			return nil
+		}
+
+		entry := fields[0]
+		switch entry {
+		case "ExitNode", "Published", "LastStatus":
+			return nil
+		case "ExitAddress":
+			if len(fields) < 2 {
+				return fmt.Errorf("flag list %s line %d: ExitAddress without an address", file, ln.Num)
+			}
+			entry = fields[1]
+		}
+
+		rng, err := ipsetdata.ParseRange(entry)
+		if err != nil {
+			return fmt.Errorf("flag list %s line %d: %w", file, ln.Num, err)
+		}
+		b.AddRange(rng)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	set, err := b.IPSet()
+	if err != nil {
+		return nil, fmt.Errorf("flag list %s: %w", file, err)
+	}
+
+	ranges := set.Ranges()
+	nets := ipsetdata.NewIPContainerSet[struct{}](len(ranges))
+	for _, rng := range ranges {
+		nets.AddIPRange(rng, struct{}{})
+	}
+	nets.Prepare()
+	return nets, nil
+}
@@ -0,0 +1,107 @@
+package netflags_test
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eterline/ipcsv2base/internal/infra/netflags"
+	"github.com/eterline/ipcsv2base/internal/model"
+)
+
+func TestParseSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    netflags.Spec
+		wantErr bool
+	}{
+		{spec: "tor=/lists/tor-exits.txt", want: netflags.Spec{Flag: model.FlagTor, Name: "tor-exits", File: "/lists/tor-exits.txt"}},
+		{spec: "vpn:nord=lists/nord.netset", want: netflags.Spec{Flag: model.FlagVPN, Name: "nord", File: "lists/nord.netset"}},
+		{spec: "hosting:=cloud", want: netflags.Spec{Flag: model.FlagHosting, Name: "cloud", File: "cloud"}},
+		{spec: "proxy", wantErr: true},
+		{spec: "proxy=", wantErr: true},
+		{spec: "botnet=bots.txt", wantErr: true},
+		{spec: "=tor.txt", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := netflags.ParseSpec(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSpec(%q) error = %v, want error %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSpec(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		ranges  int
+		listed  []string
+		missing []string
+		wantErr bool
+	}{
+		{
+			name: "Tor exit addresses",
+			data: "ExitNode 0011BD2485AD45D984EC4159C88FC066E5E3300E\n" +
+				"Published 2026-10-17 18:27:44\n" +
+				"LastStatus 2026-10-18 09:00:00\n" +
+				"ExitAddress 162.247.74.201 2026-10-18 09:02:26\n" +
+				"ExitNode 0091174DE56EE1E8E6D6D6B8E5A1BF4B4B2C5A9C\n" +
+				"Published 2026-10-17 20:02:51\n" +
+				"LastStatus 2026-10-18 08:00:00\n" +
+				"ExitAddress 185.220.101.4 2026-10-18 08:14:02\n",
+			ranges:  2,
+			listed:  []string{"162.247.74.201", "185.220.101.4"},
+			missing: []string{"162.247.74.200", "185.220.101.5"},
+		},
+		{
+			name:    "addresses, networks and ranges",
+			data:    "# bulk exit list\n192.0.2.1\n198.51.100.0/24 ; documentation\n203.0.113.10-203.0.113.20\n2001:db8::/64\n\n",
+			ranges:  4,
+			listed:  []string{"192.0.2.1", "198.51.100.255", "203.0.113.15", "2001:db8::1"},
+			missing: []string{"192.0.2.2", "203.0.113.21", "2001:db8:0:1::"},
+		},
+		{
+			name:   "overlapping entries are merged",
+			data:   "10.0.0.0/24\n10.0.0.128/25\n10.0.1.0/24\n",
+			ranges: 1,
+			listed: []string{"10.0.0.200", "10.0.1.255"},
+		},
+		{name: "ExitAddress without an address", data: "ExitNode 00\nExitAddress\n", wantErr: true},
+		{name: "invalid entry", data: "192.0.2.1\nexample.com\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		file := filepath.Join(t.TempDir(), "list.txt")
+		if err := os.WriteFile(file, []byte(tt.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		nets, err := netflags.LoadFile(file)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+
+		if n := nets.Size(); n != tt.ranges {
+			t.Errorf("%s: %d ranges, want %d", tt.name, n, tt.ranges)
+		}
+		for _, addr := range tt.listed {
+			if _, _, ok := nets.Get(netip.MustParseAddr(addr)); !ok {
+				t.Errorf("%s: %s is not listed", tt.name, addr)
+			}
+		}
+		for _, addr := range tt.missing {
+			if _, _, ok := nets.Get(netip.MustParseAddr(addr)); ok {
+				t.Errorf("%s: %s is listed", tt.name, addr)
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package overlay
+
+import (
+	"context"
+	"net/netip"
+	"sync/atomic"
+	"time"
+
+	"github.com/eterline/ipcsv2base/internal/infra/listfile"
+	"github.com/eterline/ipcsv2base/internal/model"
+)
+
+/*
+Overlay - Hot reloadable network annotations backed by a file.
+
+	The file is reloaded independently of the IP base once its modification
+	time or size changes. A failed reload keeps serving the previous table.
+*/
+type Overlay struct {
+	log   model.Logger
+	file  string
+	table atomic.Pointer[Table]
+	watch *listfile.Watcher // owned by Run
+}
+
+// NewOverlay - Loads the overlay file.
+func NewOverlay(log model.Logger, file string) (*Overlay, error) {
+	o := &Overlay{
+		log:  log,
+		file: file,
+	}
+	o.watch = listfile.NewWatcher(file, o.load)
+
+	if err := o.Reload(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// LookupOverlay - Returns the annotation of the longest overlay prefix holding addr.
+func (o *Overlay) LookupOverlay(addr netip.Addr) (model.IPOverlay, bool) {
+	return o.table.Load().Lookup(addr)
+}
+
+// Size - Returns the number of annotated prefixes.
+func (o *Overlay) Size() int {
+	return o.table.Load().Size()
+}
+
+// Reload - Reads the overlay file and swaps the served table.
+func (o *Overlay) Reload() error {
+	return o.watch.Load()
+}
+
+// Run - Checks the overlay file every interval and reloads it on change until ctx is done.
+func (o *Overlay) Run(ctx context.Context, every time.Duration) {
+	listfile.RunEvery(ctx, every, o.reloadChanged)
+}
+
+func (o *Overlay) load() error {
+	table, err := LoadFile(o.file)
+	if err != nil {
+		return err
+	}
+
+	o.table.Store(table)
+	return nil
+}
+
+func (o *Overlay) reloadChanged() {
+	changed, err := o.watch.Check()
+	switch {
+	case !changed && err != nil:
+		o.log.Error("overlay file check failed", model.FieldString("file", o.file), model.FieldError(err))
+	case err != nil:
+		o.log.Error(
+			"overlay reload failed, previous overlay is kept",
+			model.FieldString("file", o.file),
+			model.FieldError(err),
+		)
+	case changed:
+		o.log.Info(
+			"overlay reloaded",
+			model.FieldString("file", o.file),
+			model.Field("networks", o.Size()),
+		)
+	}
+}
@@ -0,0 +1,200 @@
+package overlay
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/eterline/ipcsv2base/internal/model"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrUnknownFormat = errors.New("unknown overlay file format, expected .yaml, .yml or .csv")
+
+/*
+LoadFile - Reads an overlay file, the format is selected by the file extension.
+
+	YAML files hold a "networks" list of entries with network, label, owner,
+	country and tags keys. CSV files have a header with the same column names,
+	tags are separated by ';'. Only the network is required. A plain address
+	is read as a single host network.
+*/
+func LoadFile(file string) (*Table, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []entry
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		entries, err = parseYAML(data)
+	case ".csv":
+		entries, err = parseCSV(data)
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse overlay file %s: %w", file, err)
+	}
+
+	overlays := make([]model.IPOverlay, 0, len(entries))
+	seen := make(map[netip.Prefix]int, len(entries))
+
+	for i, e := range entries {
+		o, err := e.overlay()
+		if err != nil {
+			return nil, fmt.Errorf("overlay file %s entry %d: %w", file, i+1, err)
+		}
+
+		if prev, ok := seen[o.Network]; ok {
+			return nil, fmt.Errorf("overlay file %s entry %d: network %s duplicates entry %d", file, i+1, o.Network, prev)
+		}
+		seen[o.Network] = i + 1
+
+		overlays = append(overlays, o)
+	}
+
+	return newTable(overlays), nil
+}
+
+// entry is a raw overlay file record.
+type entry struct {
+	Network string   `yaml:"network"`
+	Label   string   `yaml:"label"`
+	Owner   string   `yaml:"owner"`
+	Country string   `yaml:"country"`
+	Tags    []string `yaml:"tags"`
+}
+
+func (e entry) overlay() (model.IPOverlay, error) {
+	pfx, err := parseNetwork(strings.TrimSpace(e.Network))
+	if err != nil {
+		return model.IPOverlay{}, err
+	}
+
+	o := model.IPOverlay{
+		Network: pfx,
+		Label:   strings.TrimSpace(e.Label),
+		Owner:   strings.TrimSpace(e.Owner),
+	}
+
+	if c := strings.TrimSpace(e.Country); c != "" {
+		o.CountryCode, err = model.NewGeoCode(strings.ToUpper(c))
+		if err != nil {
+			return model.IPOverlay{}, fmt.Errorf("country %q: %w", c, err)
+		}
+	}
+
+	for _, tag := range e.Tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			o.Tags = append(o.Tags, tag)
+		}
+	}
+
+	return o, nil
+}
+
+func parseNetwork(s string) (netip.Prefix, error) {
+	if s == "" {
+		return netip.Prefix{}, errors.New("network is required")
+	}
+
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+
+	pfx, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	if pfx.Addr().Is4In6() {
+		bits := pfx.Bits() - 96
+		if bits < 0 {
+			return netip.Prefix{}, fmt.Errorf("network %s is wider than the IPv4-mapped space", s)
+		}
+		pfx = netip.PrefixFrom(pfx.Addr().Unmap(), bits)
+	}
+
+	return pfx.Masked(), nil
+}
+
+func parseYAML(data []byte) ([]entry, error) {
+	var doc struct {
+		Networks []entry `yaml:"networks"`
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	if err := dec.Decode(&doc); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return doc.Networks, nil
+}
+
+func parseCSV(data []byte) ([]entry, error) {
+	rd := csv.NewReader(bytes.NewReader(data))
+	rd.Comment = '#'
+	rd.FieldsPerRecord = -1
+	rd.TrimLeadingSpace = true
+
+	header, err := rd.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := index["network"]; !ok {
+		return nil, errors.New(`missing CSV column "network"`)
+	}
+
+	get := func(rec []string, name string) string {
+		i, ok := index[name]
+		if !ok || i >= len(rec) {
+			return ""
+		}
+		return rec[i]
+	}
+
+	var entries []entry
+	for {
+		rec, err := rd.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		e := entry{
+			Network: get(rec, "network"),
+			Label:   get(rec, "label"),
+			Owner:   get(rec, "owner"),
+			Country: get(rec, "country"),
+		}
+		if tags := get(rec, "tags"); tags != "" {
+			e.Tags = strings.Split(tags, ";")
+		}
+
+		entries = append(entries, e)
+	}
+}
@@ -0,0 +1,78 @@
+package overlay
+
+import (
+	"net/netip"
+	"slices"
+
+	"github.com/eterline/ipcsv2base/internal/model"
+)
+
+/*
+Table - Immutable set of network annotations matched by longest prefix.
+
+	Prefixes are stored per length, a lookup probes only the lengths present
+	in the table from the longest one.
+*/
+type Table struct {
+	nets  map[netip.Prefix]model.IPOverlay
+	bits4 []int // distinct IPv4 prefix lengths, longest first
+	bits6 []int // distinct IPv6 prefix lengths, longest first
+}
+
+// newTable builds a table of masked, unique prefixes.
+func newTable(entries []model.IPOverlay) *Table {
+	t := &Table{nets: make(map[netip.Prefix]model.IPOverlay, len(entries))}
+
+	for _, e := range entries {
+		t.nets[e.Network] = e
+
+		bits := e.Network.Bits()
+		if e.Network.Addr().Is4() {
+			t.bits4 = appendUnique(t.bits4, bits)
+		} else {
+			t.bits6 = appendUnique(t.bits6, bits)
+		}
+	}
+
+	slices.SortFunc(t.bits4, descending)
+	slices.SortFunc(t.bits6, descending)
+	return t
+}
+
+// Lookup - Returns the annotation of the longest prefix holding addr.
+func (t *Table) Lookup(addr netip.Addr) (model.IPOverlay, bool) {
+	addr = addr.Unmap()
+
+	bits := t.bits6
+	if addr.Is4() {
+		bits = t.bits4
+	}
+
+	for _, b := range bits {
+		pfx, err := addr.Prefix(b)
+		if err != nil {
+			continue
+		}
+		if o, ok := t.nets[pfx]; ok {
+			return o, true
+		}
+	}
+
+	return model.IPOverlay{}, false
+}
+
+// Size - Returns the number of annotated prefixes.
+func (t *Table) Size() int {
+	return len(t.nets)
+}
+
+func appendUnique(s []int, v int) []int {
+	if slices.Contains(s, v) {
+		return s
+	}
+	return append(s, v)
+}
+
+func descending(a, b int) int {
+	return b - a
+}
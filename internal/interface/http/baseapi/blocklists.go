@@ -0,0 +1,128 @@
+package baseapi
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/eterline/ipcsv2base/internal/interface/http/api"
+	"github.com/eterline/ipcsv2base/internal/model"
+	"github.com/go-chi/chi/v5"
+)
+
+// BlocklistDTO - Loaded blocklist.
+type BlocklistDTO struct {
+	Name        string    `json:"name"`
+	File        string    `json:"file"`
+	Format      string    `json:"format"`
+	Description string    `json:"description,omitempty"`
+	Entries     int       `json:"entries"`
+	Ranges      int       `json:"ranges"`
+	ModTime     time.Time `json:"mod_time"`
+	LoadedAt    time.Time `json:"loaded_at"`
+}
+
+// ListingDTO - Blocklist entry holding an address.
+type ListingDTO struct {
+	List    string `json:"list"`
+	Network string `json:"network"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// BlocklistCheckDTO - Membership of an address in a blocklist.
+type BlocklistCheckDTO struct {
+	List    string `json:"list"`
+	IP      string `json:"ip"`
+	Listed  bool   `json:"listed"`
+	Network string `json:"network,omitempty"`
+	Comment string `json:"comment,omitempty"`
+}
+
+func domain2ListingDTO(l model.IPListing) ListingDTO {
+	return ListingDTO{
+		List:    l.List,
+		Network: l.Network.String(),
+		Comment: l.Comment,
+	}
+}
+
+// BlocklistsHandler - Returns the loaded blocklists with their formats and sizes.
+func (h *BaseAPIHandlerGroup) BlocklistsHandler(w http.ResponseWriter, r *http.Request) {
+	lists, ok := h.lookup.Blocklists()
+	if !ok {
+		api.NewResponse().
+			SetCode(http.StatusNotFound).
+			SetMessage("blocklists unavailable").
+			Write(w)
+		return
+	}
+
+	dto := make([]BlocklistDTO, 0, len(lists))
+	for _, l := range lists {
+		dto = append(dto, BlocklistDTO{
+			Name:        l.Name,
+			File:        l.File,
+			Format:      l.Format,
+			Description: l.Description,
+			Entries:     l.Entries,
+			Ranges:      l.Ranges,
+			ModTime:     l.ModTime,
+			LoadedAt:    l.LoadedAt,
+		})
+	}
+
+	api.NewResponse().
+		SetCode(http.StatusOK).
+		WrapData(dto).
+		Write(w)
+}
+
+// BlocklistCheckHandler - Reports whether a blocklist holds an address, with the comment of its entry.
+//
+// Path parameters:
+//   - name: blocklist name, the file name without its extension
+//   - ip: IPv4 or IPv6 address
+func (h *BaseAPIHandlerGroup) BlocklistCheckHandler(w http.ResponseWriter, r *http.Request) {
+	addr, err := h.extractIP(r)
+	if err != nil {
+		api.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetMessage(err.Error()).
+			Write(w)
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	listing, listed, err := h.lookup.CheckBlocklist(name, addr)
+	if err != nil {
+		if errors.Is(err, model.ErrNoBlocklist) {
+			api.NewResponse().
+				SetCode(http.StatusNotFound).
+				SetMessage("blocklist not found").
+				Write(w)
+			return
+		}
+
+		h.log.Error("blocklist check failed", model.FieldString("list", name), model.FieldError(err))
+		api.NewResponse().
+			SetCode(http.StatusInternalServerError).
+			SetMessage("blocklist check failed").
+			Write(w)
+		return
+	}
+
+	dto := BlocklistCheckDTO{
+		List:   name,
+		IP:     addr.String(),
+		Listed: listed,
+	}
+	if listed {
+		dto.Network = listing.Network.String()
+		dto.Comment = listing.Comment
+	}
+
+	api.NewResponse().
+		SetCode(http.StatusOK).
+		WrapData(dto).
+		Write(w)
+}
@@ -0,0 +1,80 @@
+package baseapi
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/eterline/ipcsv2base/internal/interface/http/api"
+)
+
+// Dataset - Named IP base served under /datasets/{name}, the default one also at the root routes.
+type Dataset struct {
+	Name        string
+	Description string
+	Default     bool
+	Handlers    *BaseAPIHandlerGroup
+}
+
+// DatasetDTO - Metadata of a served dataset.
+type DatasetDTO struct {
+	Name         string     `json:"name"`
+	Description  string     `json:"description,omitempty"`
+	Default      bool       `json:"default"`
+	Path         string     `json:"path"`
+	DataTime     *time.Time `json:"data_time,omitempty"`
+	AgeSec       int64      `json:"age_sec"`
+	Stale        bool       `json:"stale"`
+	RangesIPv4   int        `json:"ranges_ipv4"`
+	RangesIPv6   int        `json:"ranges_ipv6"`
+	Sources      []string   `json:"sources"`
+	PastVersions int        `json:"past_versions"`
+}
+
+// DatasetsHandler - Returns the served datasets with their freshness, size and sources.
+func DatasetsHandler(sets []Dataset) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+
+		list := make([]DatasetDTO, 0, len(sets))
+		for _, set := range sets {
+			list = append(list, set.dto(now))
+		}
+
+		api.NewResponse().
+			SetCode(http.StatusOK).
+			WrapData(list).
+			Write(w)
+	}
+}
+
+func (set Dataset) dto(now time.Time) DatasetDTO {
+	h := set.Handlers
+	dataTime, age, stale := h.freshness.Age(now)
+
+	dto := DatasetDTO{
+		Name:        set.Name,
+		Description: set.Description,
+		Default:     set.Default,
+		Path:        "/datasets/" + set.Name,
+		AgeSec:      int64(age.Seconds()),
+		Stale:       stale,
+		Sources:     []string{},
+	}
+	if !dataTime.IsZero() {
+		dto.DataTime = &dataTime
+	}
+
+	if report, ok := h.lookup.LoadReport(); ok {
+		for _, src := range report.Sources {
+			dto.Sources = append(dto.Sources, src.Path)
+		}
+	}
+	if st, ok := h.lookup.Stats(); ok {
+		dto.RangesIPv4, dto.RangesIPv6 = st.Ranges4, st.Ranges6
+	}
+	if versions, ok := h.lookup.Versions(); ok {
+		dto.PastVersions = len(versions) - 1 // the served base is listed last
+	}
+
+	return dto
+}
@@ -2,6 +2,7 @@ package baseapi
 
 import (
 	"net/netip"
+	"strconv"
 	"time"
 
 	"github.com/eterline/ipcsv2base/internal/model"
@@ -9,23 +10,38 @@ import (
 
 // IPMetadataDTO - Flat DTO for API responses.
 type IPMetadataDTO struct {
-	LookupDurationMs int64  `json:"lookup_duration_ms"`
-	Success          bool   `json:"success"`
-	RequestIP        string `json:"request_ip"`
-	NetworkType      string `json:"network_type"`
-	Network          string `json:"network,omitempty"`
-	ContinentCode    string `json:"continent_code,omitempty"`
-	CountryCode      string `json:"country_code,omitempty"`
-	CountryName      string `json:"country_name,omitempty"`
-	ASN              int32  `json:"asn,omitempty"`
-	ASNName          string `json:"asn_name,omitempty"`
-	ASNOrg           string `json:"asn_org,omitempty"`
-	ASNCountryCode   string `json:"asn_country_code,omitempty"`
-	Domain           string `json:"domain,omitempty"`
+	LookupDurationMs int64             `json:"lookup_duration_ms"`
+	Success          bool              `json:"success"`
+	RequestIP        string            `json:"request_ip"`
+	NetworkType      string            `json:"network_type"`
+	Network          string            `json:"network,omitempty"`
+	ContinentCode    string            `json:"continent_code,omitempty"`
+	CountryCode      string            `json:"country_code,omitempty"`
+	CountryName      string            `json:"country_name,omitempty"`
+	RegionName       string            `json:"region_name,omitempty"`
+	CityName         string            `json:"city_name,omitempty"`
+	RegisteredCode   string            `json:"registered_country_code,omitempty"`
+	RepresentedCode  string            `json:"represented_country_code,omitempty"`
+	AnonymousProxy   bool              `json:"is_anonymous_proxy,omitempty"`
+	Satellite        bool              `json:"is_satellite_provider,omitempty"`
+	ASN              int32             `json:"asn,omitempty"`
+	ASNName          string            `json:"asn_name,omitempty"`
+	ASNOrg           string            `json:"asn_org,omitempty"`
+	ASNCountryCode   string            `json:"asn_country_code,omitempty"`
+	Domain           string            `json:"domain,omitempty"`
+	OverlayNetwork   string            `json:"overlay_network,omitempty"`
+	Label            string            `json:"label,omitempty"`
+	Owner            string            `json:"owner,omitempty"`
+	Tags             []string          `json:"tags,omitempty"`
+	NetworkFlags     []NetworkFlagDTO  `json:"network_flags,omitempty"`
+	Blocklists       []ListingDTO      `json:"blocklists,omitempty"`
+	Sources          map[string]string `json:"sources,omitempty"`
+	BaseVersion      *time.Time        `json:"base_version,omitempty"` // data time of the version answering a lookup at a time
+	Explain          *ExplainDTO       `json:"explain,omitempty"`
 }
 
 func domain2IPMetadataDTO(m *model.IPMetadata, dur time.Duration, reqip netip.Addr) *IPMetadataDTO {
-	return &IPMetadataDTO{
+	dto := &IPMetadataDTO{
 		Success:          true,
 		RequestIP:        reqip.String(),
 		LookupDurationMs: dur.Milliseconds(),
@@ -34,10 +50,502 @@ func domain2IPMetadataDTO(m *model.IPMetadata, dur time.Duration, reqip netip.Ad
 		ContinentCode:    m.Geo.ContinentCode.String(),
 		CountryCode:      m.Geo.CountryCode.String(),
 		CountryName:      m.Geo.CountryName,
+		RegionName:       m.Geo.RegionName,
+		CityName:         m.Geo.CityName,
+		RegisteredCode:   m.Geo.RegisteredCountryCode.String(),
+		RepresentedCode:  m.Geo.RepresentedCountryCode.String(),
+		AnonymousProxy:   m.Geo.AnonymousProxy,
+		Satellite:        m.Geo.SatelliteProvider,
 		ASN:              m.ASN.ASN,
 		ASNName:          m.ASN.Name,
 		ASNOrg:           m.ASN.Org,
 		ASNCountryCode:   m.ASN.CountryCode.String(),
 		Domain:           m.ASN.Domain,
+		Sources:          m.Sources,
 	}
+
+	if o := m.Overlay; o != nil {
+		dto.OverlayNetwork = o.Network.String()
+		dto.Label = o.Label
+		dto.Owner = o.Owner
+		dto.Tags = o.Tags
+	}
+
+	for _, f := range m.Flags {
+		dto.NetworkFlags = append(dto.NetworkFlags, NetworkFlagDTO{
+			Flag:    f.Flag.String(),
+			List:    f.List,
+			Network: f.Network.String(),
+		})
+	}
+	for _, l := range m.Listed {
+		dto.Blocklists = append(dto.Blocklists, domain2ListingDTO(l))
+	}
+
+	return dto
+}
+
+// NetworkFlagDTO - Flag of the address with the list reporting it.
+type NetworkFlagDTO struct {
+	Flag    string `json:"flag"`
+	List    string `json:"list"`
+	Network string `json:"network"`
+}
+
+// LoadReportDTO - Base load report API response.
+type LoadReportDTO struct {
+	Totals  SourceLoadReportDTO   `json:"totals"`
+	Sources []SourceLoadReportDTO `json:"sources"`
+}
+
+// SourceLoadReportDTO - Row statistics of a single base source.
+type SourceLoadReportDTO struct {
+	Path         string           `json:"path,omitempty"`
+	RowsRead     int64            `json:"rows_read"`
+	RowsAccepted int64            `json:"rows_accepted"`
+	RowsFiltered int64            `json:"rows_filtered"`
+	RowsSkipped  int64            `json:"rows_skipped"`
+	SkipRate     float64          `json:"skip_rate"`
+	SkipReasons  map[string]int64 `json:"skip_reasons,omitempty"`
+	SkipSamples  []SkippedRowDTO  `json:"skip_samples,omitempty"`
+}
+
+// SkippedRowDTO - Rejected row reference.
+type SkippedRowDTO struct {
+	Line   int64  `json:"line"`
+	Reason string `json:"reason"`
+}
+
+func domain2SourceLoadReportDTO(r model.SourceLoadReport) SourceLoadReportDTO {
+	dto := SourceLoadReportDTO{
+		Path:         r.Path,
+		RowsRead:     r.RowsRead,
+		RowsAccepted: r.RowsAccepted,
+		RowsFiltered: r.RowsFiltered,
+		RowsSkipped:  r.RowsSkipped,
+		SkipRate:     r.SkipRate(),
+		SkipReasons:  r.SkipReasons,
+	}
+
+	for _, s := range r.SkipSamples {
+		dto.SkipSamples = append(dto.SkipSamples, SkippedRowDTO{Line: s.Line, Reason: s.Reason})
+	}
+
+	return dto
+}
+
+func domain2LoadReportDTO(r model.LoadReport) *LoadReportDTO {
+	dto := &LoadReportDTO{
+		Totals:  domain2SourceLoadReportDTO(r.Totals()),
+		Sources: make([]SourceLoadReportDTO, 0, len(r.Sources)),
+	}
+
+	for _, src := range r.Sources {
+		dto.Sources = append(dto.Sources, domain2SourceLoadReportDTO(src))
+	}
+
+	return dto
+}
+
+// BaseInfoDTO - Freshness metadata of the served base.
+type BaseInfoDTO struct {
+	LoadedAt       time.Time       `json:"loaded_at"`
+	LoadDurationMs int64           `json:"load_duration_ms"`
+	DataTime       *time.Time      `json:"data_time,omitempty"`
+	AgeSec         int64           `json:"age_sec"`
+	MaxAgeSec      int64           `json:"max_age_sec,omitempty"`
+	Stale          bool            `json:"stale"`
+	Sources        []SourceInfoDTO `json:"sources"`
+}
+
+// SourceInfoDTO - Freshness metadata of a single base source.
+type SourceInfoDTO struct {
+	Path           string     `json:"path"`
+	File           string     `json:"file"`
+	Size           int64      `json:"size"`
+	ModTime        time.Time  `json:"mod_time"`
+	SHA256         string     `json:"sha256"`
+	BuildDate      *time.Time `json:"build_date,omitempty"`
+	LoadDurationMs int64      `json:"load_duration_ms"`
+}
+
+func domain2BaseInfoDTO(r model.LoadReport, dataTime time.Time, age, maxAge time.Duration, stale bool) *BaseInfoDTO {
+	dto := &BaseInfoDTO{
+		LoadedAt:       r.LoadedAt,
+		LoadDurationMs: r.Duration.Milliseconds(),
+		AgeSec:         int64(age.Seconds()),
+		MaxAgeSec:      int64(maxAge.Seconds()),
+		Stale:          stale,
+		Sources:        make([]SourceInfoDTO, 0, len(r.Sources)),
+	}
+
+	if !dataTime.IsZero() {
+		dto.DataTime = &dataTime
+	}
+
+	for _, src := range r.Sources {
+		info := SourceInfoDTO{
+			Path:           src.Path,
+			File:           src.File.Path,
+			Size:           src.File.Size,
+			ModTime:        src.File.ModTime,
+			SHA256:         src.File.SHA256,
+			LoadDurationMs: src.Duration.Milliseconds(),
+		}
+		if !src.File.BuildDate.IsZero() {
+			info.BuildDate = &src.File.BuildDate
+		}
+		dto.Sources = append(dto.Sources, info)
+	}
+
+	return dto
+}
+
+// ExplainDTO - Decisions and stage timings of an explained lookup.
+type ExplainDTO struct {
+	NetworkType       string           `json:"network_type"`
+	Classification    string           `json:"classification"`
+	ClassifiedNetwork string           `json:"classified_network,omitempty"`
+	Cache             string           `json:"cache,omitempty"`
+	OverlayNetwork    string           `json:"overlay_network,omitempty"`
+	Matches           []LookupMatchDTO `json:"matches,omitempty"`
+	Stages            []LookupStageDTO `json:"stages"`
+	TotalNs           int64            `json:"total_ns"`
+}
+
+// LookupMatchDTO - Registry range that answered an explained lookup.
+type LookupMatchDTO struct {
+	Source  string         `json:"source,omitempty"`
+	Start   string         `json:"range_start,omitempty"`
+	End     string         `json:"range_end,omitempty"`
+	Network string         `json:"network,omitempty"`
+	Rows    []SourceRowDTO `json:"rows,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// SourceRowDTO - Source file row of a matched range.
+type SourceRowDTO struct {
+	Kind  string `json:"kind"`
+	Path  string `json:"path"`
+	File  string `json:"file,omitempty"`
+	Line  int64  `json:"line"`
+	Start string `json:"range_start"`
+	End   string `json:"range_end"`
+}
+
+// LookupStageDTO - Duration of a lookup stage.
+type LookupStageDTO struct {
+	Name       string `json:"name"`
+	DurationNs int64  `json:"duration_ns"`
+}
+
+func domain2ExplainDTO(e *model.LookupExplain) *ExplainDTO {
+	dto := &ExplainDTO{
+		NetworkType:    e.Classification.Type.String(),
+		Classification: e.Classification.Reason,
+		Cache:          e.Cache,
+		Stages:         make([]LookupStageDTO, 0, len(e.Stages)),
+		TotalNs:        e.Total.Nanoseconds(),
+	}
+
+	if e.Classification.Network.IsValid() {
+		dto.ClassifiedNetwork = e.Classification.Network.String()
+	}
+	if e.Overlay != nil {
+		dto.OverlayNetwork = e.Overlay.Network.String()
+	}
+
+	for _, m := range e.Matches {
+		match := LookupMatchDTO{
+			Source: m.Source,
+			Error:  m.Error,
+		}
+		if m.Start.IsValid() {
+			match.Start, match.End = m.Start.String(), m.End.String()
+		}
+		if m.Network.IsValid() {
+			match.Network = m.Network.String()
+		}
+
+		for _, r := range m.Rows {
+			match.Rows = append(match.Rows, SourceRowDTO{
+				Kind:  r.Kind,
+				Path:  r.Path,
+				File:  r.File,
+				Line:  r.Line,
+				Start: r.Start.String(),
+				End:   r.End.String(),
+			})
+		}
+		dto.Matches = append(dto.Matches, match)
+	}
+
+	for _, s := range e.Stages {
+		dto.Stages = append(dto.Stages, LookupStageDTO{Name: s.Name, DurationNs: s.Duration.Nanoseconds()})
+	}
+
+	return dto
+}
+
+// NetworkListDTO - Aggregated networks of a country or an AS.
+type NetworkListDTO struct {
+	CountryCode   string   `json:"country_code,omitempty"`
+	ASN           int32    `json:"asn,omitempty"`
+	IPVersion     string   `json:"ip_version"`
+	PrefixCount   int      `json:"prefix_count"`
+	IPv4Addresses uint64   `json:"ipv4_addresses"`
+	IPv6Addresses string   `json:"ipv6_addresses"` // decimal, exceeds 64 bits
+	Prefixes      []string `json:"prefixes"`
+}
+
+func domain2NetworkListDTO(l model.NetworkList, ver int) *NetworkListDTO {
+	v4, v6 := l.AddressCount()
+
+	dto := &NetworkListDTO{
+		IPVersion:     "all",
+		PrefixCount:   len(l.Prefixes),
+		IPv4Addresses: v4,
+		IPv6Addresses: v6.String(),
+		Prefixes:      make([]string, 0, len(l.Prefixes)),
+	}
+	if ver != 0 {
+		dto.IPVersion = strconv.Itoa(ver)
+	}
+
+	for _, p := range l.Prefixes {
+		dto.Prefixes = append(dto.Prefixes, p.String())
+	}
+	return dto
+}
+
+// CountrySummaryDTO - Statistics of a country.
+type CountrySummaryDTO struct {
+	CountryCode   string       `json:"country_code"`
+	ContinentCode string       `json:"continent_code,omitempty"`
+	CountryName   string       `json:"country_name,omitempty"`
+	PrefixCount   int          `json:"prefix_count"`
+	IPv4Addresses uint64       `json:"ipv4_addresses"`
+	IPv6Addresses string       `json:"ipv6_addresses"`
+	ASCount       int          `json:"asn_count"`
+	TopASNs       []ASShareDTO `json:"top_asns"`
+}
+
+// ASShareDTO - Address space of an AS inside a country.
+type ASShareDTO struct {
+	ASN           int32  `json:"asn"`
+	Name          string `json:"asn_name,omitempty"`
+	IPv4Addresses uint64 `json:"ipv4_addresses"`
+	IPv6Addresses string `json:"ipv6_addresses"`
+}
+
+func domain2CountrySummaryDTO(s model.CountrySummary) *CountrySummaryDTO {
+	dto := &CountrySummaryDTO{
+		CountryCode:   s.CountryCode.String(),
+		ContinentCode: s.ContinentCode.String(),
+		CountryName:   s.CountryName,
+		PrefixCount:   s.Space.Prefixes,
+		IPv4Addresses: s.Space.IPv4,
+		IPv6Addresses: s.Space.IPv6.String(),
+		ASCount:       s.ASCount,
+		TopASNs:       make([]ASShareDTO, 0, len(s.TopAS)),
+	}
+
+	for _, a := range s.TopAS {
+		dto.TopASNs = append(dto.TopASNs, ASShareDTO{
+			ASN:           a.ASN,
+			Name:          a.Name,
+			IPv4Addresses: a.IPv4,
+			IPv6Addresses: a.IPv6.String(),
+		})
+	}
+	return dto
+}
+
+// ASSummaryDTO - Statistics of an autonomous system.
+type ASSummaryDTO struct {
+	ASN           int32             `json:"asn"`
+	Name          string            `json:"asn_name,omitempty"`
+	Org           string            `json:"asn_org,omitempty"`
+	Domain        string            `json:"domain,omitempty"`
+	CountryCode   string            `json:"asn_country_code,omitempty"`
+	PrefixCount   int               `json:"prefix_count"`
+	IPv4Addresses uint64            `json:"ipv4_addresses"`
+	IPv6Addresses string            `json:"ipv6_addresses"`
+	Countries     []CountryShareDTO `json:"geo_countries"`
+}
+
+// CountryShareDTO - Address space of an AS geolocated to a country.
+type CountryShareDTO struct {
+	CountryCode   string `json:"country_code"`
+	IPv4Addresses uint64 `json:"ipv4_addresses"`
+	IPv6Addresses string `json:"ipv6_addresses"`
+}
+
+func domain2ASSummaryDTO(s model.ASSummary) *ASSummaryDTO {
+	dto := &ASSummaryDTO{
+		ASN:           s.AS.ASN,
+		Name:          s.AS.Name,
+		Org:           s.AS.Org,
+		Domain:        s.AS.Domain,
+		CountryCode:   s.AS.CountryCode.String(),
+		PrefixCount:   s.Space.Prefixes,
+		IPv4Addresses: s.Space.IPv4,
+		IPv6Addresses: s.Space.IPv6.String(),
+		Countries:     make([]CountryShareDTO, 0, len(s.Countries)),
+	}
+
+	for _, c := range s.Countries {
+		dto.Countries = append(dto.Countries, CountryShareDTO{
+			CountryCode:   c.CountryCode.String(),
+			IPv4Addresses: c.IPv4,
+			IPv6Addresses: c.IPv6.String(),
+		})
+	}
+	return dto
+}
+
+// ASRecordDTO - AS record of search and domain results.
+type ASRecordDTO struct {
+	ASN         int32    `json:"asn"`
+	Name        string   `json:"asn_name,omitempty"`
+	Org         string   `json:"asn_org,omitempty"`
+	Domain      string   `json:"domain,omitempty"`
+	CountryCode string   `json:"asn_country_code,omitempty"`
+	Score       *float64 `json:"score,omitempty"`
+}
+
+func domain2ASRecordDTO(a model.IPAS) ASRecordDTO {
+	return ASRecordDTO{
+		ASN:         a.ASN,
+		Name:        a.Name,
+		Org:         a.Org,
+		Domain:      a.Domain,
+		CountryCode: a.CountryCode.String(),
+	}
+}
+
+// SearchResultDTO - Page of AS search matches.
+type SearchResultDTO struct {
+	Query   string        `json:"query"`
+	Total   int           `json:"total"`
+	Offset  int           `json:"offset"`
+	Limit   int           `json:"limit"`
+	Results []ASRecordDTO `json:"results"`
+}
+
+func domain2SearchResultDTO(r model.ASSearchResult, query string, offset, limit int) *SearchResultDTO {
+	dto := &SearchResultDTO{
+		Query:   query,
+		Total:   r.Total,
+		Offset:  offset,
+		Limit:   limit,
+		Results: make([]ASRecordDTO, 0, len(r.Matches)),
+	}
+
+	for _, m := range r.Matches {
+		rec := domain2ASRecordDTO(m.AS)
+		rec.Score = &m.Score
+		dto.Results = append(dto.Results, rec)
+	}
+	return dto
+}
+
+// DomainASesDTO - Autonomous systems registered with a domain.
+type DomainASesDTO struct {
+	Domain        string        `json:"domain"`
+	MatchedDomain string        `json:"matched_domain"`
+	ASNs          []ASRecordDTO `json:"asns"`
+}
+
+func domain2DomainASesDTO(d model.DomainASes, domain string) *DomainASesDTO {
+	dto := &DomainASesDTO{
+		Domain:        domain,
+		MatchedDomain: d.Domain,
+		ASNs:          make([]ASRecordDTO, 0, len(d.AS)),
+	}
+
+	for _, a := range d.AS {
+		dto.ASNs = append(dto.ASNs, domain2ASRecordDTO(a))
+	}
+	return dto
+}
+
+// BaseStatsDTO - Structure statistics of the served base.
+type BaseStatsDTO struct {
+	Source        string         `json:"source,omitempty"`
+	RangesIPv4    int            `json:"ranges_ipv4"`
+	RangesIPv6    int            `json:"ranges_ipv6"`
+	IPv4Addresses uint64         `json:"ipv4_addresses"`
+	IPv6Addresses string         `json:"ipv6_addresses"` // decimal, exceeds 64 bits
+	Countries     int            `json:"country_records"`
+	ASes          int            `json:"as_records"`
+	Overlaps      int            `json:"overlaps"`
+	GapsIPv4      int            `json:"gaps_ipv4"`
+	GapsIPv6      int            `json:"gaps_ipv6"`
+	Coalescable   int            `json:"coalescable"`
+	HeapBytes     int64          `json:"heap_bytes"`
+	Heap          []HeapUsageDTO `json:"heap"`
+	Sources       []BaseStatsDTO `json:"sources,omitempty"`
+}
+
+// HeapUsageDTO - Approximate heap bytes of a base structure.
+type HeapUsageDTO struct {
+	Structure string `json:"structure"`
+	Bytes     int64  `json:"bytes"`
+}
+
+func domain2BaseStatsDTO(s model.BaseStats) BaseStatsDTO {
+	dto := BaseStatsDTO{
+		Source:        s.Source,
+		RangesIPv4:    s.Ranges4,
+		RangesIPv6:    s.Ranges6,
+		IPv4Addresses: s.Space4,
+		IPv6Addresses: "0",
+		Countries:     s.Countries,
+		ASes:          s.ASes,
+		Overlaps:      s.Overlaps,
+		GapsIPv4:      s.Gaps4,
+		GapsIPv6:      s.Gaps6,
+		Coalescable:   s.Coalescable,
+		HeapBytes:     s.HeapBytes(),
+		Heap:          make([]HeapUsageDTO, 0, len(s.Heap)),
+	}
+	if s.Space6 != nil {
+		dto.IPv6Addresses = s.Space6.String()
+	}
+
+	for _, h := range s.Heap {
+		dto.Heap = append(dto.Heap, HeapUsageDTO{Structure: h.Structure, Bytes: h.Bytes})
+	}
+	for _, src := range s.Sources {
+		dto.Sources = append(dto.Sources, domain2BaseStatsDTO(src))
+	}
+
+	return dto
+}
+
+// BaseVersionDTO - Base version answering lookups from its data time until the next one.
+type BaseVersionDTO struct {
+	DataTime *time.Time `json:"data_time,omitempty"`
+	File     string     `json:"file,omitempty"`
+	Size     int64      `json:"size,omitempty"`
+	Current  bool       `json:"current"`
+	Loaded   bool       `json:"loaded"`
+}
+
+func domain2BaseVersionsDTO(list []model.BaseVersion) []BaseVersionDTO {
+	dto := make([]BaseVersionDTO, 0, len(list))
+	for _, v := range list {
+		ver := BaseVersionDTO{
+			File:    v.File,
+			Size:    v.Size,
+			Current: v.Current,
+			Loaded:  v.Loaded,
+		}
+		if !v.DataTime.IsZero() {
+			ver.DataTime = &v.DataTime
+		}
+		dto = append(dto, ver)
+	}
+	return dto
 }
@@ -3,6 +3,7 @@ package baseapi
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/netip"
 	"strings"
@@ -17,20 +18,43 @@ import (
 type Lookuper interface {
 	LookupIP(context.Context, netip.Addr) (*model.IPMetadata, error)
 	LookupPrefix(context.Context, netip.Prefix) (*model.IPMetadata, error)
+	LookupIPExplain(context.Context, netip.Addr) (*model.IPMetadata, *model.LookupExplain, error)
+	LookupIPAt(context.Context, netip.Addr, time.Time) (*model.IPMetadata, time.Time, error)
+	LookupIPExplainAt(context.Context, netip.Addr, time.Time) (*model.IPMetadata, *model.LookupExplain, time.Time, error)
+	Versions() ([]model.BaseVersion, bool)
+	LoadReport() (model.LoadReport, bool)
+	Stats() (model.BaseStats, bool)
+	CountryPrefixes(cc model.GeoCode, ver int) (model.NetworkList, bool)
+	ASNPrefixes(asn int32, ver int) (model.NetworkList, bool)
+	CountrySummary(cc model.GeoCode) (model.CountrySummary, bool)
+	ASSummary(asn int32) (model.ASSummary, bool)
+	SearchAS(query string, offset, limit int) (model.ASSearchResult, bool)
+	ASByDomain(domain string) (model.DomainASes, bool)
+	Blocklists() ([]model.Blocklist, bool)
+	CheckBlocklist(name string, addr netip.Addr) (model.IPListing, bool, error)
+}
+
+// Freshness - Age tracking of the served base.
+type Freshness interface {
+	Age(now time.Time) (dataTime time.Time, age time.Duration, stale bool)
+	MaxAge() time.Duration
+	Ready() bool
 }
 
 type BaseAPIHandlerGroup struct {
-	lookup   Lookuper
-	log      model.Logger
-	ipLookup *security.IpExtractor
+	lookup    Lookuper
+	freshness Freshness
+	log       model.Logger
+	ipLookup  *security.IpExtractor
 }
 
 // NewBaseAPIHandlerGroup - Creates a new API handler group for IP base lookups.
-func NewBaseAPIHandlerGroup(log model.Logger, l Lookuper, lookupHeadersIp bool) *BaseAPIHandlerGroup {
+func NewBaseAPIHandlerGroup(log model.Logger, l Lookuper, f Freshness, lookupHeadersIp bool) *BaseAPIHandlerGroup {
 	return &BaseAPIHandlerGroup{
-		lookup:   l,
-		log:      log,
-		ipLookup: security.NewIpExtractor(lookupHeadersIp),
+		lookup:    l,
+		freshness: f,
+		log:       log,
+		ipLookup:  security.NewIpExtractor(lookupHeadersIp),
 	}
 }
 
@@ -64,6 +88,10 @@ func (h *BaseAPIHandlerGroup) extractIP(r *http.Request) (netip.Addr, error) {
 // Path parameters:
 //   - ip: IPv4 or IPv6 address
 //
+// Query parameters:
+//   - explain: 1 adds the lookup decisions and stage timings
+//   - at: date (YYYY-MM-DD, its start in UTC) or RFC 3339 time, looks up the base version in effect then
+//
 // Parsing errors are returned to the client.
 // Internal lookup errors are logged and hidden.
 func (h *BaseAPIHandlerGroup) LookupIPHandler(w http.ResponseWriter, r *http.Request) {
@@ -82,32 +110,127 @@ func (h *BaseAPIHandlerGroup) LookupIPHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	at, err := queryTime(r, "at")
+	if err != nil {
+		api.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetMessage(err.Error()).
+			Write(w)
+		return
+	}
+
 	// Prepare structured log
 	log := h.log.With(model.FieldStringer("ip", addr))
 
-	// Perform lookup
-	meta, err := h.lookup.LookupIP(ctx, addr)
-	if err != nil {
-		log.Error("ip lookup failed", model.FieldError(err))
+	h.lookupAddr(ctx, w, r, log, "ip lookup failed", addr, at, startAt, func(ctx context.Context) (*model.IPMetadata, error) {
+		return h.lookup.LookupIP(ctx, addr)
+	})
+}
+
+// lookupAddr - Performs the lookup and writes its result, failed lookups are logged with failure.
+// Explained requests look addr up with LookupIPExplain instead of lookup,
+// a non-zero at routes both to the base version in effect at that time.
+func (h *BaseAPIHandlerGroup) lookupAddr(
+	ctx context.Context,
+	w http.ResponseWriter,
+	r *http.Request,
+	log model.Logger,
+	failure string,
+	addr netip.Addr,
+	at time.Time,
+	startAt time.Time,
+	lookup func(ctx context.Context) (*model.IPMetadata, error),
+) {
+	var (
+		meta    *model.IPMetadata
+		ex      *model.LookupExplain
+		version time.Time
+		err     error
+	)
+
+	switch explain := wantExplain(r); {
+	case explain && at.IsZero():
+		meta, ex, err = h.lookup.LookupIPExplain(ctx, addr)
+	case explain:
+		meta, ex, version, err = h.lookup.LookupIPExplainAt(ctx, addr, at)
+	case at.IsZero():
+		meta, err = lookup(ctx)
+	default:
+		meta, version, err = h.lookup.LookupIPAt(ctx, addr, at)
+	}
+
+	if errors.Is(err, model.ErrNoBaseVersion) {
+		log.Debug("no base version at lookup time", model.FieldError(err))
 		api.NewResponse().
-			SetCode(http.StatusInternalServerError).
-			SetMessage("lookup failed").
+			SetCode(http.StatusNotFound).
+			SetMessage(err.Error()).
 			Write(w)
 		return
 	}
 
+	if err != nil {
+		log.Error(failure, model.FieldError(err))
+		resp := api.NewResponse().
+			SetCode(http.StatusInternalServerError).
+			SetMessage("lookup failed")
+		if ex != nil {
+			resp.WrapData(&IPMetadataDTO{RequestIP: addr.String(), Explain: domain2ExplainDTO(ex)})
+		}
+		resp.Write(w)
+		return
+	}
+
 	dto := domain2IPMetadataDTO(meta, time.Since(startAt), addr)
+	if ex != nil {
+		dto.Explain = domain2ExplainDTO(ex)
+	}
+	if !at.IsZero() && !version.IsZero() {
+		dto.BaseVersion = &version
+	}
+
 	api.NewResponse().
 		SetCode(http.StatusOK).
 		WrapData(dto).
 		Write(w)
 }
 
+// wantExplain - Reports whether the request asks for an explained lookup.
+func wantExplain(r *http.Request) bool {
+	switch r.URL.Query().Get("explain") {
+	case "1", "true", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+// queryTime - Parses a time query parameter, zero when absent.
+// A date is the start of the day in UTC.
+func queryTime(r *http.Request, name string) (time.Time, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.DateOnly, raw); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s time, expected YYYY-MM-DD or RFC 3339", name)
+	}
+	return t, nil
+}
+
 // LookupSubnetHandler - Handles metadata lookup for a network prefix.
 //
 // Path parameters:
 //   - net: network prefix in CIDR notation
 //
+// Query parameters:
+//   - explain: 1 adds the lookup decisions and stage timings
+//   - at: date (YYYY-MM-DD) or RFC 3339 time, looks up the base version in effect then
+//
 // Parsing errors are returned to the client.
 // Internal lookup errors are logged and hidden.
 func (h *BaseAPIHandlerGroup) LookupSubnetHandler(w http.ResponseWriter, r *http.Request) {
@@ -137,20 +260,103 @@ func (h *BaseAPIHandlerGroup) LookupSubnetHandler(w http.ResponseWriter, r *http
 		return
 	}
 
-	meta, err := h.lookup.LookupPrefix(ctx, pfx)
+	at, err := queryTime(r, "at")
 	if err != nil {
-		log.Error("prefix lookup failed", model.FieldError(err))
 		api.NewResponse().
-			SetCode(http.StatusInternalServerError).
-			SetMessage("lookup failed").
+			SetCode(http.StatusBadRequest).
+			SetMessage(err.Error()).
+			Write(w)
+		return
+	}
+
+	h.lookupAddr(ctx, w, r, log, "prefix lookup failed", pfx.Addr(), at, startAt, func(ctx context.Context) (*model.IPMetadata, error) {
+		return h.lookup.LookupPrefix(ctx, pfx)
+	})
+}
+
+// LoadReportHandler - Returns row statistics of the loaded IP base sources.
+func (h *BaseAPIHandlerGroup) LoadReportHandler(w http.ResponseWriter, r *http.Request) {
+	report, ok := h.lookup.LoadReport()
+	if !ok {
+		api.NewResponse().
+			SetCode(http.StatusNotFound).
+			SetMessage("load report unavailable").
 			Write(w)
 		return
 	}
 
-	dto := domain2IPMetadataDTO(meta, time.Since(startAt), pfx.Addr())
 	api.NewResponse().
 		SetCode(http.StatusOK).
-		WrapData(dto).
+		WrapData(domain2LoadReportDTO(report)).
+		Write(w)
+}
+
+// StatsHandler - Returns range, address space and heap statistics of the loaded IP base.
+func (h *BaseAPIHandlerGroup) StatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats, ok := h.lookup.Stats()
+	if !ok {
+		api.NewResponse().
+			SetCode(http.StatusNotFound).
+			SetMessage("base stats unavailable").
+			Write(w)
+		return
+	}
+
+	api.NewResponse().
+		SetCode(http.StatusOK).
+		WrapData(domain2BaseStatsDTO(stats)).
+		Write(w)
+}
+
+// VersionsHandler - Returns the served base and the past versions answering lookups with ?at=, oldest first.
+func (h *BaseAPIHandlerGroup) VersionsHandler(w http.ResponseWriter, r *http.Request) {
+	versions, ok := h.lookup.Versions()
+	if !ok {
+		api.NewResponse().
+			SetCode(http.StatusNotFound).
+			SetMessage("base versions unavailable").
+			Write(w)
+		return
+	}
+
+	api.NewResponse().
+		SetCode(http.StatusOK).
+		WrapData(domain2BaseVersionsDTO(versions)).
+		Write(w)
+}
+
+// BaseInfoHandler - Returns freshness metadata of the served base and its sources.
+func (h *BaseAPIHandlerGroup) BaseInfoHandler(w http.ResponseWriter, r *http.Request) {
+	report, ok := h.lookup.LoadReport()
+	if !ok {
+		api.NewResponse().
+			SetCode(http.StatusNotFound).
+			SetMessage("base info unavailable").
+			Write(w)
+		return
+	}
+
+	dataTime, age, stale := h.freshness.Age(time.Now())
+
+	api.NewResponse().
+		SetCode(http.StatusOK).
+		WrapData(domain2BaseInfoDTO(report, dataTime, age, h.freshness.MaxAge(), stale)).
+		Write(w)
+}
+
+// ReadyHandler - Readiness probe, fails while the base data is older than allowed.
+func (h *BaseAPIHandlerGroup) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.freshness.Ready() {
+		api.NewResponse().
+			SetCode(http.StatusServiceUnavailable).
+			SetMessage("base data is stale").
+			Write(w)
+		return
+	}
+
+	api.NewResponse().
+		SetCode(http.StatusOK).
+		SetMessage("ready").
 		Write(w)
 }
 
@@ -0,0 +1,226 @@
+package baseapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/eterline/ipcsv2base/internal/interface/http/api"
+	"github.com/eterline/ipcsv2base/internal/model"
+	"github.com/go-chi/chi/v5"
+)
+
+// CountrySummaryHandler - Returns the continent, totals and largest autonomous systems of a country.
+//
+// Path parameters:
+//   - cc: two letter country code
+func (h *BaseAPIHandlerGroup) CountrySummaryHandler(w http.ResponseWriter, r *http.Request) {
+	cc, err := parseCountryCode(chi.URLParam(r, "cc"))
+	if err != nil {
+		api.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetMessage(err.Error()).
+			Write(w)
+		return
+	}
+
+	sum, ok := h.lookup.CountrySummary(cc)
+	if !ok {
+		api.NewResponse().
+			SetCode(http.StatusNotFound).
+			SetMessage("country not found").
+			Write(w)
+		return
+	}
+
+	api.NewResponse().
+		SetCode(http.StatusOK).
+		WrapData(domain2CountrySummaryDTO(sum)).
+		Write(w)
+}
+
+// ASSummaryHandler - Returns the record, totals and geo countries of an autonomous system.
+//
+// Path parameters:
+//   - asn: AS number, with or without the AS prefix
+func (h *BaseAPIHandlerGroup) ASSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	asn, err := parseASN(chi.URLParam(r, "asn"))
+	if err != nil {
+		api.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetMessage(err.Error()).
+			Write(w)
+		return
+	}
+
+	sum, ok := h.lookup.ASSummary(asn)
+	if !ok {
+		api.NewResponse().
+			SetCode(http.StatusNotFound).
+			SetMessage("as not found").
+			Write(w)
+		return
+	}
+
+	api.NewResponse().
+		SetCode(http.StatusOK).
+		WrapData(domain2ASSummaryDTO(sum)).
+		Write(w)
+}
+
+// CountryPrefixesHandler - Returns the aggregated networks of a country.
+//
+// Path parameters:
+//   - cc: two letter country code
+//
+// Query parameters:
+//   - ver: 4 or 6 returns networks of one IP version
+//   - format: text returns one network per line, also selected by Accept: text/plain
+func (h *BaseAPIHandlerGroup) CountryPrefixesHandler(w http.ResponseWriter, r *http.Request) {
+	cc, err := parseCountryCode(chi.URLParam(r, "cc"))
+	if err != nil {
+		api.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetMessage(err.Error()).
+			Write(w)
+		return
+	}
+
+	ver, err := parseIPVersion(r)
+	if err != nil {
+		api.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetMessage(err.Error()).
+			Write(w)
+		return
+	}
+
+	list, ok := h.lookup.CountryPrefixes(cc, ver)
+	if !ok {
+		writeNoReverseIndex(w)
+		return
+	}
+
+	dto := domain2NetworkListDTO(list, ver)
+	dto.CountryCode = string(cc)
+	writeNetworkList(w, r, dto)
+}
+
+// ASNPrefixesHandler - Returns the aggregated networks of an autonomous system.
+//
+// Path parameters:
+//   - asn: AS number, with or without the AS prefix
+//
+// Query parameters:
+//   - ver: 4 or 6 returns networks of one IP version
+//   - format: text returns one network per line, also selected by Accept: text/plain
+func (h *BaseAPIHandlerGroup) ASNPrefixesHandler(w http.ResponseWriter, r *http.Request) {
+	asn, err := parseASN(chi.URLParam(r, "asn"))
+	if err != nil {
+		api.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetMessage(err.Error()).
+			Write(w)
+		return
+	}
+
+	ver, err := parseIPVersion(r)
+	if err != nil {
+		api.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetMessage(err.Error()).
+			Write(w)
+		return
+	}
+
+	list, ok := h.lookup.ASNPrefixes(asn, ver)
+	if !ok {
+		writeNoReverseIndex(w)
+		return
+	}
+
+	dto := domain2NetworkListDTO(list, ver)
+	dto.ASN = asn
+	writeNetworkList(w, r, dto)
+}
+
+func writeNoReverseIndex(w http.ResponseWriter) {
+	api.NewResponse().
+		SetCode(http.StatusNotFound).
+		SetMessage("reverse index unavailable").
+		Write(w)
+}
+
+// writeNetworkList - Writes the list as JSON or as plain text with one network per line.
+// Plain text carries the totals in X-Prefix-Count, X-IPv4-Addresses and X-IPv6-Addresses headers.
+func writeNetworkList(w http.ResponseWriter, r *http.Request, dto *NetworkListDTO) {
+	if !wantText(r) {
+		api.NewResponse().
+			SetCode(http.StatusOK).
+			WrapData(dto).
+			Write(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Prefix-Count", strconv.Itoa(dto.PrefixCount))
+	w.Header().Set("X-IPv4-Addresses", strconv.FormatUint(dto.IPv4Addresses, 10))
+	w.Header().Set("X-IPv6-Addresses", dto.IPv6Addresses)
+	w.WriteHeader(http.StatusOK)
+
+	var b strings.Builder
+	for _, p := range dto.Prefixes {
+		b.WriteString(p)
+		b.WriteByte('\n')
+	}
+	w.Write([]byte(b.String()))
+}
+
+// wantText - Reports whether the request asks for a plain text response.
+func wantText(r *http.Request) bool {
+	switch r.URL.Query().Get("format") {
+	case "text", "txt", "plain":
+		return true
+	case "json":
+		return false
+	}
+	return strings.HasPrefix(r.Header.Get("Accept"), "text/plain")
+}
+
+// parseCountryCode - Parses a two letter country code in any case.
+func parseCountryCode(s string) (model.GeoCode, error) {
+	cc, err := model.NewGeoCode(strings.ToUpper(s))
+	if err != nil {
+		return "", errors.New("invalid country code")
+	}
+	return cc, nil
+}
+
+// parseIPVersion - Parses the ver query parameter, 0 selects both IP versions.
+func parseIPVersion(r *http.Request) (int, error) {
+	switch strings.ToLower(r.URL.Query().Get("ver")) {
+	case "", "all", "any":
+		return 0, nil
+	case "4", "v4", "ipv4":
+		return 4, nil
+	case "6", "v6", "ipv6":
+		return 6, nil
+	default:
+		return 0, errors.New("invalid ip version, expected 4 or 6")
+	}
+}
+
+// parseASN - Parses an AS number in the 13335 or AS13335 form.
+func parseASN(s string) (int32, error) {
+	if len(s) > 2 && strings.EqualFold(s[:2], "AS") {
+		s = s[2:]
+	}
+
+	asn, err := strconv.ParseInt(s, 10, 32)
+	if err != nil || asn <= 0 {
+		return 0, fmt.Errorf("invalid as number %q", s)
+	}
+	return int32(asn), nil
+}
@@ -0,0 +1,116 @@
+package baseapi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/eterline/ipcsv2base/internal/interface/http/api"
+	"github.com/go-chi/chi/v5"
+)
+
+// Search page sizes.
+const (
+	searchDefaultLimit = 20
+	searchMaxLimit     = 100
+	searchMaxQuery     = 256
+)
+
+// SearchHandler - Searches autonomous systems by name, org and domain.
+//
+// Query parameters:
+//   - q: search text, matched by token prefix and small typos
+//   - limit: page size, 20 by default and 100 at most
+//   - offset: matches to skip
+func (h *BaseAPIHandlerGroup) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" || len(query) > searchMaxQuery {
+		api.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetMessage("invalid search query").
+			Write(w)
+		return
+	}
+
+	offset, limit, err := parsePage(r)
+	if err != nil {
+		api.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetMessage(err.Error()).
+			Write(w)
+		return
+	}
+
+	res, ok := h.lookup.SearchAS(query, offset, limit)
+	if !ok {
+		writeNoSearchIndex(w)
+		return
+	}
+
+	api.NewResponse().
+		SetCode(http.StatusOK).
+		WrapData(domain2SearchResultDTO(res, query, offset, limit)).
+		Write(w)
+}
+
+// DomainHandler - Returns the autonomous systems registered with a domain.
+//
+// Path parameters:
+//   - domain: domain name, subdomains resolve to their closest registered parent
+func (h *BaseAPIHandlerGroup) DomainHandler(w http.ResponseWriter, r *http.Request) {
+	domain := chi.URLParam(r, "domain")
+	if domain == "" || len(domain) > searchMaxQuery {
+		api.NewResponse().
+			SetCode(http.StatusBadRequest).
+			SetMessage("invalid domain").
+			Write(w)
+		return
+	}
+
+	res, ok := h.lookup.ASByDomain(domain)
+	if !ok {
+		writeNoSearchIndex(w)
+		return
+	}
+	if len(res.AS) == 0 {
+		api.NewResponse().
+			SetCode(http.StatusNotFound).
+			SetMessage("domain not found").
+			Write(w)
+		return
+	}
+
+	api.NewResponse().
+		SetCode(http.StatusOK).
+		WrapData(domain2DomainASesDTO(res, domain)).
+		Write(w)
+}
+
+func writeNoSearchIndex(w http.ResponseWriter) {
+	api.NewResponse().
+		SetCode(http.StatusNotFound).
+		SetMessage("search index unavailable").
+		Write(w)
+}
+
+// parsePage - Parses offset and limit query parameters.
+func parsePage(r *http.Request) (offset, limit int, err error) {
+	limit = searchDefaultLimit
+
+	if s := r.URL.Query().Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit <= 0 || limit > searchMaxLimit {
+			return 0, 0, errors.New("invalid limit, expected 1 to 100")
+		}
+	}
+
+	if s := r.URL.Query().Get("offset"); s != "" {
+		offset, err = strconv.Atoi(s)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("invalid offset")
+		}
+	}
+
+	return offset, limit, nil
+}
@@ -2,6 +2,7 @@ package model
 
 import (
 	"errors"
+	"fmt"
 	"net/netip"
 )
 
@@ -53,12 +54,22 @@ type (
 		Network netip.Prefix
 		Geo     IPGeo
 		ASN     IPAS
+		Overlay *IPOverlay        // user annotation of the network, nil without a match
+		Flags   []IPFlag          // flag lists holding the address
+		Listed  []IPListing       // blocklists holding the address
+		Sources map[string]string // field name to the source that supplied it, set by composite lookups
 	}
 
 	IPGeo struct {
-		ContinentCode GeoCode
-		CountryCode   GeoCode
-		CountryName   string
+		ContinentCode          GeoCode
+		CountryCode            GeoCode
+		CountryName            string
+		RegionName             string
+		CityName               string
+		RegisteredCountryCode  GeoCode // country where the network is registered, when it differs
+		RepresentedCountryCode GeoCode // country represented by users of the network (e.g. military bases)
+		AnonymousProxy         bool
+		SatelliteProvider      bool
 	}
 
 	IPAS struct {
@@ -70,11 +81,50 @@ type (
 	}
 )
 
+/*
+IPOverlay - User maintained annotation of an internal, VPN or partner network.
+
+	Empty fields leave the base metadata untouched.
+*/
+type IPOverlay struct {
+	Network     netip.Prefix
+	Label       string
+	Owner       string
+	CountryCode GeoCode // country override
+	Tags        []string
+}
+
+/*
+ApplyOverlay - Merges the overlay into the metadata.
+
+	A country override that differs from the base country drops the base
+	continent, country name, region and city as they describe another place.
+*/
+func (m *IPMetadata) ApplyOverlay(o IPOverlay) {
+	m.Overlay = &o
+
+	if o.CountryCode == "" || o.CountryCode == m.Geo.CountryCode {
+		return
+	}
+
+	m.Geo.ContinentCode = ""
+	m.Geo.CountryCode = o.CountryCode
+	m.Geo.CountryName = ""
+	m.Geo.RegionName = ""
+	m.Geo.CityName = ""
+}
+
 func (g IPGeo) FieldsLog() []LogField {
 	return []LogField{
 		FieldStringer("continent_code", g.ContinentCode),
 		FieldStringer("country_code", g.CountryCode),
 		FieldString("country_name", g.CountryName),
+		FieldString("region_name", g.RegionName),
+		FieldString("city_name", g.CityName),
+		FieldStringer("registered_country_code", g.RegisteredCountryCode),
+		FieldStringer("represented_country_code", g.RepresentedCountryCode),
+		Field("anonymous_proxy", g.AnonymousProxy),
+		Field("satellite_provider", g.SatelliteProvider),
 	}
 }
 
@@ -87,3 +137,35 @@ func (as IPAS) FieldsLog() []LogField {
 		FieldString("as_domain", as.Domain),
 	}
 }
+
+// NetworkFlag - Category of a network flag list.
+type NetworkFlag string
+
+// Network flag categories.
+const (
+	FlagTor     NetworkFlag = "tor"     // Tor exit node
+	FlagVPN     NetworkFlag = "vpn"     // commercial VPN endpoint
+	FlagProxy   NetworkFlag = "proxy"   // open or anonymizing proxy
+	FlagHosting NetworkFlag = "hosting" // hosting or cloud provider network
+)
+
+// ParseNetworkFlag - Parses a flag category name.
+func ParseNetworkFlag(s string) (NetworkFlag, error) {
+	switch f := NetworkFlag(s); f {
+	case FlagTor, FlagVPN, FlagProxy, FlagHosting:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown network flag %q, expected tor, vpn, proxy or hosting", s)
+	}
+}
+
+func (f NetworkFlag) String() string {
+	return string(f)
+}
+
+// IPFlag - Network flag of an address, reported by a flag list.
+type IPFlag struct {
+	Flag    NetworkFlag
+	List    string       // name of the list holding the address
+	Network netip.Prefix // listed network holding the address
+}
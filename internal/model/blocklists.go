@@ -0,0 +1,29 @@
+package model
+
+import (
+	"errors"
+	"net/netip"
+	"time"
+)
+
+// ErrNoBlocklist - No blocklist of the requested name is loaded.
+var ErrNoBlocklist = errors.New("blocklist not found")
+
+// Blocklist - Loaded blocklist file of a blocklists directory.
+type Blocklist struct {
+	Name        string // file name without its extension
+	File        string
+	Format      string // netset, drop or drop-json
+	Description string // first header comment of the file
+	Entries     int    // entries read from the file
+	Ranges      int    // disjoint ranges after merging the entries
+	ModTime     time.Time
+	LoadedAt    time.Time
+}
+
+// IPListing - Blocklist entry holding an address.
+type IPListing struct {
+	List    string       // name of the list holding the address
+	Network netip.Prefix // listed network holding the address
+	Comment string       // comment of the entry, the SBL id of Spamhaus DROP lists
+}
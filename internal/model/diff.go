@@ -0,0 +1,49 @@
+package model
+
+import "net/netip"
+
+type (
+	/*
+		BaseDiff - Changes of the networks answered by a new IP base version against the old one.
+
+			Space totals are complete, prefix and change lists may be cut at a
+			limit. Prefixes of a change kind are the minimal CIDRs of its
+			coalesced ranges.
+	*/
+	BaseDiff struct {
+		OldSpace        AddressSpace // covered by the old version
+		NewSpace        AddressSpace // covered by the new version
+		Added           AddressSpace // answered only by the new version
+		Removed         AddressSpace // answered only by the old version
+		CountryMoved    AddressSpace // answered by both with another country
+		ASMoved         AddressSpace // answered by both with another AS number
+		AddedPrefixes   []netip.Prefix
+		RemovedPrefixes []netip.Prefix
+		CountryChanges  []CountryChange
+		ASChanges       []ASChange
+		Countries       []CountryDelta // address space gained and lost per country, largest change first
+		Truncated       bool           // some list was cut at the limit
+	}
+
+	// CountryChange - Network answered with another country code.
+	CountryChange struct {
+		Network netip.Prefix
+		From    GeoCode
+		To      GeoCode
+	}
+
+	// ASChange - Network answered with another AS number, zero for none.
+	ASChange struct {
+		Network netip.Prefix
+		From    int32
+		To      int32
+	}
+
+	// CountryDelta - Address space a country gained and lost, by added, removed and moved networks.
+	// Prefixes of the spaces are not counted.
+	CountryDelta struct {
+		CountryCode GeoCode
+		Gained      AddressSpace
+		Lost        AddressSpace
+	}
+)
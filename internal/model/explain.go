@@ -0,0 +1,66 @@
+package model
+
+import (
+	"net/netip"
+	"time"
+)
+
+// Cache outcomes of an explained lookup.
+const (
+	CacheHit     = "hit"
+	CacheMiss    = "miss"
+	CacheSkipped = "skipped" // non-global networks and past base versions are not cached
+)
+
+type (
+	// LookupExplain - Decisions and stage timings of a single lookup.
+	LookupExplain struct {
+		Classification Classification
+		Cache          string
+		Overlay        *IPOverlay
+		Matches        []LookupMatch
+		Stages         []LookupStage
+		Total          time.Duration
+	}
+
+	// Classification - Network type decision of an address.
+	Classification struct {
+		Type    NetworkType
+		Network netip.Prefix // special purpose network, invalid for global addresses
+		Reason  string
+	}
+
+	// LookupMatch - Registry range that answered the lookup.
+	LookupMatch struct {
+		Source  string // composite source name, empty for a single registry
+		Start   netip.Addr
+		End     netip.Addr
+		Network netip.Prefix // network of the range holding the address
+		Rows    []SourceRow  // empty unless row origins were recorded on load
+		Error   string       // lookup error of the source
+	}
+
+	// SourceRow - Source file row a registry range was read from.
+	SourceRow struct {
+		Kind  string // geo or asn
+		Path  string
+		File  string
+		Line  int64
+		Start netip.Addr
+		End   netip.Addr
+	}
+
+	// LookupStage - Duration of a lookup stage.
+	LookupStage struct {
+		Name     string
+		Duration time.Duration
+	}
+)
+
+// AddStage - Records the duration of a stage started at start.
+func (e *LookupExplain) AddStage(name string, start time.Time) {
+	if e == nil {
+		return
+	}
+	e.Stages = append(e.Stages, LookupStage{Name: name, Duration: time.Since(start)})
+}
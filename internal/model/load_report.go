@@ -0,0 +1,131 @@
+package model
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// LoadReport - Summary of an IP base load over all its sources.
+	LoadReport struct {
+		LoadedAt time.Time
+		Duration time.Duration
+		Sources  []SourceLoadReport
+	}
+
+	// SourceLoadReport - Row statistics and freshness metadata of a single source file.
+	SourceLoadReport struct {
+		Path         string
+		File         SourceFile
+		Duration     time.Duration    // time spent reading the source
+		RowsRead     int64            // data rows read, header excluded
+		RowsAccepted int64            // rows stored in the base
+		RowsFiltered int64            // rows excluded on purpose (IP version selector, reserved space)
+		RowsSkipped  int64            // rows rejected as invalid
+		SkipReasons  map[string]int64 // rejected rows by reason
+		SkipSamples  []SkippedRow     // first rejected rows
+	}
+
+	// SkippedRow - Rejected row reference.
+	SkippedRow struct {
+		Line   int64
+		Reason string
+	}
+
+	// SourceFile - Metadata of the file on disk holding a source.
+	// Archive entries share the metadata of their archive.
+	SourceFile struct {
+		Path      string
+		Size      int64
+		ModTime   time.Time
+		SHA256    string    // empty for compiled bases mapped without a verifier
+		BuildDate time.Time // zero when the format embeds no build date
+	}
+)
+
+// DataTime - Returns the build date of the file, or its modification time when the format has none.
+func (f SourceFile) DataTime() time.Time {
+	if !f.BuildDate.IsZero() {
+		return f.BuildDate
+	}
+	return f.ModTime
+}
+
+// DataTime - Returns the data time of the oldest source, zero without sources.
+func (r LoadReport) DataTime() (oldest time.Time) {
+	for _, src := range r.Sources {
+		t := src.File.DataTime()
+		if t.IsZero() {
+			continue
+		}
+		if oldest.IsZero() || t.Before(oldest) {
+			oldest = t
+		}
+	}
+	return oldest
+}
+
+// SkipRate - Returns the share of rejected rows among read rows.
+func (r SourceLoadReport) SkipRate() float64 {
+	if r.RowsRead == 0 {
+		return 0
+	}
+	return float64(r.RowsSkipped) / float64(r.RowsRead)
+}
+
+// FieldsLog - Returns log fields of the source report.
+func (r SourceLoadReport) FieldsLog() []LogField {
+	fields := []LogField{
+		FieldString("source", r.Path),
+		Field("size", r.File.Size),
+		FieldString("mod_time", r.File.ModTime.Format(time.RFC3339)),
+		FieldString("sha256", r.File.SHA256),
+		Field("load_duration_ms", r.Duration.Milliseconds()),
+		Field("rows_read", r.RowsRead),
+		Field("rows_accepted", r.RowsAccepted),
+		Field("rows_filtered", r.RowsFiltered),
+		Field("rows_skipped", r.RowsSkipped),
+	}
+
+	if !r.File.BuildDate.IsZero() {
+		fields = append(fields, FieldString("build_date", r.File.BuildDate.Format(time.DateOnly)))
+	}
+
+	if r.RowsSkipped > 0 {
+		reasons := make([]string, 0, len(r.SkipReasons))
+		for _, reason := range slices.Sorted(maps.Keys(r.SkipReasons)) {
+			reasons = append(reasons, reason+"="+strconv.FormatInt(r.SkipReasons[reason], 10))
+		}
+
+		lines := make([]string, 0, len(r.SkipSamples))
+		for _, s := range r.SkipSamples {
+			lines = append(lines, s.Reason+"@"+strconv.FormatInt(s.Line, 10))
+		}
+
+		fields = append(fields,
+			FieldFloat("skip_rate", r.SkipRate(), 4),
+			FieldString("skip_reasons", strings.Join(reasons, ", ")),
+			FieldString("skip_samples", strings.Join(lines, ", ")),
+		)
+	}
+
+	return fields
+}
+
+// Totals - Returns row counters summed over all sources.
+func (r LoadReport) Totals() (total SourceLoadReport) {
+	total.SkipReasons = map[string]int64{}
+	for _, src := range r.Sources {
+		total.RowsRead += src.RowsRead
+		total.RowsAccepted += src.RowsAccepted
+		total.RowsFiltered += src.RowsFiltered
+		total.RowsSkipped += src.RowsSkipped
+		for reason, n := range src.SkipReasons {
+			total.SkipReasons[reason] += n
+		}
+	}
+	return total
+}
@@ -60,6 +60,17 @@ func Field(key string, v any) LogField {
 	return LogField{key: key, value: v}
 }
 
+// LogLevel - severity of a log message.
+type LogLevel int8
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelFatal
+)
+
 /*
 Logger - interface for a structured logger.
 
@@ -67,6 +78,9 @@ Logger - interface for a structured logger.
 	at different severity levels.
 */
 type Logger interface {
+	// Enabled - reports whether messages at the level are emitted, callers skip building fields otherwise.
+	Enabled(level LogLevel) bool
+
 	// With - returns a new Logger instance with additional contextual fields attached.
 	With(fields ...LogField) Logger
 
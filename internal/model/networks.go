@@ -0,0 +1,83 @@
+package model
+
+import (
+	"math/big"
+	"net/netip"
+)
+
+// NetworkList - Aggregated networks of a country or an AS, sorted by address.
+type NetworkList struct {
+	Prefixes []netip.Prefix
+}
+
+// Family - Returns the networks of one IP version, 4 or 6, any other version keeps all of them.
+func (l NetworkList) Family(ver int) NetworkList {
+	if ver != 4 && ver != 6 {
+		return l
+	}
+
+	out := NetworkList{Prefixes: make([]netip.Prefix, 0, len(l.Prefixes))}
+	for _, p := range l.Prefixes {
+		if p.Addr().Is4() == (ver == 4) {
+			out.Prefixes = append(out.Prefixes, p)
+		}
+	}
+	return out
+}
+
+// AddressCount - Returns the number of IPv4 and IPv6 addresses covered by the networks.
+func (l NetworkList) AddressCount() (v4 uint64, v6 *big.Int) {
+	v6 = new(big.Int)
+	one := big.NewInt(1)
+
+	for _, p := range l.Prefixes {
+		hostBits := p.Addr().BitLen() - p.Bits()
+		if p.Addr().Is4() {
+			v4 += 1 << hostBits
+			continue
+		}
+		v6.Add(v6, new(big.Int).Lsh(one, uint(hostBits)))
+	}
+	return v4, v6
+}
+
+type (
+	// AddressSpace - Aggregated networks count and addresses of a country or an AS.
+	AddressSpace struct {
+		Prefixes int
+		IPv4     uint64
+		IPv6     *big.Int
+	}
+
+	// CountrySummary - Registry statistics of a country.
+	CountrySummary struct {
+		CountryCode   GeoCode
+		ContinentCode GeoCode
+		CountryName   string
+		Space         AddressSpace
+		ASCount       int       // autonomous systems announcing space of the country
+		TopAS         []ASShare // largest autonomous systems by address space
+	}
+
+	// ASSummary - Registry statistics of an autonomous system.
+	ASSummary struct {
+		AS        IPAS
+		Space     AddressSpace
+		Countries []CountryShare // geo countries of the AS space by address space
+	}
+
+	// ASShare - Address space of an autonomous system inside a country.
+	ASShare struct {
+		ASN  int32
+		Name string
+		IPv4 uint64
+		IPv6 *big.Int
+	}
+
+	// CountryShare - Address space of an autonomous system geolocated to a country.
+	CountryShare struct {
+		CountryCode GeoCode
+		IPv4        uint64
+		IPv6        *big.Int
+	}
+)
@@ -0,0 +1,21 @@
+package model
+
+type (
+	// ASSearchResult - Page of autonomous systems matching a search query.
+	ASSearchResult struct {
+		Total   int // matches over all pages
+		Matches []ASMatch
+	}
+
+	// ASMatch - Autonomous system found by a search with its relevance.
+	ASMatch struct {
+		AS    IPAS
+		Score float64
+	}
+
+	// DomainASes - Autonomous systems registered with a domain.
+	DomainASes struct {
+		Domain string // registered domain the query matched, a parent of subdomain queries
+		AS     []IPAS
+	}
+)
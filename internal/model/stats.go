@@ -0,0 +1,93 @@
+package model
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+type (
+	// BaseStats - Structure statistics of a loaded IP base.
+	// Counters of a composed base are summed over its sources, listed in Sources.
+	BaseStats struct {
+		Source      string // source name inside a composed base
+		Ranges4     int
+		Ranges6     int
+		Space4      uint64   // IPv4 addresses covered, overlapping ranges counted once
+		Space6      *big.Int // IPv6 addresses covered
+		Countries   int      // unique country records
+		ASes        int      // unique AS records
+		Overlaps    int      // ranges overlapping a preceding range
+		Gaps4       int      // uncovered holes between IPv4 ranges
+		Gaps6       int      // uncovered holes between IPv6 ranges
+		Coalescable int      // adjacent ranges with equal data that could be merged
+		Heap        []HeapUsage
+		Sources     []BaseStats
+	}
+
+	// HeapUsage - Approximate heap bytes of a base structure.
+	HeapUsage struct {
+		Structure string
+		Bytes     int64
+	}
+)
+
+// HeapBytes - Returns the approximate heap bytes of all structures.
+func (s BaseStats) HeapBytes() (n int64) {
+	for _, h := range s.Heap {
+		n += h.Bytes
+	}
+	return n
+}
+
+// Add - Sums counters and heap usage of a source into s and lists the source.
+func (s *BaseStats) Add(src BaseStats) {
+	s.Ranges4 += src.Ranges4
+	s.Ranges6 += src.Ranges6
+	s.Space4 += src.Space4
+	if s.Space6 == nil {
+		s.Space6 = new(big.Int)
+	}
+	if src.Space6 != nil {
+		s.Space6.Add(s.Space6, src.Space6)
+	}
+	s.Countries += src.Countries
+	s.ASes += src.ASes
+	s.Overlaps += src.Overlaps
+	s.Gaps4 += src.Gaps4
+	s.Gaps6 += src.Gaps6
+	s.Coalescable += src.Coalescable
+
+	for _, h := range src.Heap {
+		s.Heap = append(s.Heap, HeapUsage{Structure: src.Source + "." + h.Structure, Bytes: h.Bytes})
+	}
+	s.Sources = append(s.Sources, src)
+}
+
+// FieldsLog - Returns log fields of the statistics.
+func (s BaseStats) FieldsLog() []LogField {
+	space6 := "0"
+	if s.Space6 != nil {
+		space6 = s.Space6.String()
+	}
+
+	heap := make([]string, 0, len(s.Heap))
+	for _, h := range s.Heap {
+		heap = append(heap, h.Structure+"="+strconv.FormatInt(h.Bytes, 10))
+	}
+
+	return []LogField{
+		Field("ranges_v4", s.Ranges4),
+		Field("ranges_v6", s.Ranges6),
+		Field("space_v4", s.Space4),
+		FieldString("space_v6", space6),
+		Field("countries", s.Countries),
+		Field("ases", s.ASes),
+		Field("overlaps", s.Overlaps),
+		Field("gaps_v4", s.Gaps4),
+		Field("gaps_v6", s.Gaps6),
+		Field("coalescable", s.Coalescable),
+		Field("heap_bytes", s.HeapBytes()),
+		FieldString("heap", strings.Join(heap, ", ")),
+	}
+}
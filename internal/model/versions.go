@@ -0,0 +1,18 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNoBaseVersion - No base version was in effect at the requested time.
+var ErrNoBaseVersion = errors.New("no base version at the requested time")
+
+// BaseVersion - Version of the IP base answering lookups from its data time until the next version.
+type BaseVersion struct {
+	DataTime time.Time
+	File     string // compiled base file of a past version, empty for the served base
+	Size     int64  // file size in bytes
+	Current  bool   // served base answering lookups without a time
+	Loaded   bool   // mapped and answering lookups without reopening
+}
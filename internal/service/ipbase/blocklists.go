@@ -0,0 +1,46 @@
+package ipbase
+
+import (
+	"net/netip"
+
+	"github.com/eterline/ipcsv2base/internal/model"
+)
+
+/*
+BlocklistLookuper - Interface for IP blocklists, every list holding the address reports its entry.
+
+	CheckList returns model.ErrNoBlocklist for names of lists not loaded.
+*/
+type BlocklistLookuper interface {
+	LookupListings(addr netip.Addr) []model.IPListing
+	CheckList(name string, addr netip.Addr) (model.IPListing, bool, error)
+	Lists() []model.Blocklist
+}
+
+// Blocklists - Returns the loaded blocklists when blocklists are enabled.
+func (b *IPBaseService) Blocklists() ([]model.Blocklist, bool) {
+	if b.blocklists == nil {
+		return nil, false
+	}
+	return b.blocklists.Lists(), true
+}
+
+/*
+CheckBlocklist - Returns the entry of the named blocklist holding the address.
+
+	Reports false without an entry, model.ErrNoBlocklist is returned for unknown
+	lists and when blocklists are disabled.
+*/
+func (b *IPBaseService) CheckBlocklist(name string, addr netip.Addr) (model.IPListing, bool, error) {
+	if b.blocklists == nil {
+		return model.IPListing{}, false, model.ErrNoBlocklist
+	}
+	return b.blocklists.CheckList(name, addr)
+}
+
+func (b *IPBaseService) lookupListings(addr netip.Addr) []model.IPListing {
+	if b.blocklists == nil {
+		return nil
+	}
+	return b.blocklists.LookupListings(addr)
+}
@@ -0,0 +1,466 @@
+package ipbase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eterline/ipcsv2base/internal/model"
+)
+
+// NamedLookuper - Metadata source of a composite lookup.
+type NamedLookuper struct {
+	Name   string
+	Lookup MetaLookuper
+}
+
+// Field groups accepted as precedence keys besides single field names.
+const (
+	FieldGroupGeo = "geo"
+	FieldGroupASN = "asn"
+)
+
+// FieldNetwork - Provenance key of the reported network.
+const FieldNetwork = "network"
+
+/*
+metaField - Field of IPMetadata merged by a composite lookup.
+
+	Dependent fields (names, region, city, AS details) are taken only from a source
+	agreeing on their key field (country code, AS number) already chosen, so a city
+	of one country is never reported under the country code of another.
+*/
+type metaField struct {
+	name    string
+	group   string
+	isSet   func(m *model.IPMetadata) bool
+	copy    func(dst, src *model.IPMetadata)
+	sameKey func(dst, src *model.IPMetadata) bool // nil for key and independent fields
+}
+
+func sameCountry(dst, src *model.IPMetadata) bool {
+	return dst.Geo.CountryCode == "" || dst.Geo.CountryCode == src.Geo.CountryCode
+}
+
+func sameAS(dst, src *model.IPMetadata) bool {
+	return dst.ASN.ASN == 0 || dst.ASN.ASN == src.ASN.ASN
+}
+
+// metaFields - Merged fields, key fields go before their dependents.
+var metaFields = []metaField{
+	{
+		name: "country_code", group: FieldGroupGeo,
+		isSet: func(m *model.IPMetadata) bool { return m.Geo.CountryCode != "" },
+		copy:  func(dst, src *model.IPMetadata) { dst.Geo.CountryCode = src.Geo.CountryCode },
+	},
+	{
+		name: "continent_code", group: FieldGroupGeo, sameKey: sameCountry,
+		isSet: func(m *model.IPMetadata) bool { return m.Geo.ContinentCode != "" },
+		copy:  func(dst, src *model.IPMetadata) { dst.Geo.ContinentCode = src.Geo.ContinentCode },
+	},
+	{
+		name: "country_name", group: FieldGroupGeo, sameKey: sameCountry,
+		isSet: func(m *model.IPMetadata) bool { return m.Geo.CountryName != "" },
+		copy:  func(dst, src *model.IPMetadata) { dst.Geo.CountryName = src.Geo.CountryName },
+	},
+	{
+		name: "region_name", group: FieldGroupGeo, sameKey: sameCountry,
+		isSet: func(m *model.IPMetadata) bool { return m.Geo.RegionName != "" },
+		copy:  func(dst, src *model.IPMetadata) { dst.Geo.RegionName = src.Geo.RegionName },
+	},
+	{
+		name: "city_name", group: FieldGroupGeo, sameKey: sameCountry,
+		isSet: func(m *model.IPMetadata) bool { return m.Geo.CityName != "" },
+		copy:  func(dst, src *model.IPMetadata) { dst.Geo.CityName = src.Geo.CityName },
+	},
+	{
+		name: "registered_country_code", group: FieldGroupGeo,
+		isSet: func(m *model.IPMetadata) bool { return m.Geo.RegisteredCountryCode != "" },
+		copy:  func(dst, src *model.IPMetadata) { dst.Geo.RegisteredCountryCode = src.Geo.RegisteredCountryCode },
+	},
+	{
+		name: "represented_country_code", group: FieldGroupGeo,
+		isSet: func(m *model.IPMetadata) bool { return m.Geo.RepresentedCountryCode != "" },
+		copy:  func(dst, src *model.IPMetadata) { dst.Geo.RepresentedCountryCode = src.Geo.RepresentedCountryCode },
+	},
+	{
+		name: "anonymous_proxy", group: FieldGroupGeo,
+		isSet: func(m *model.IPMetadata) bool { return m.Geo.AnonymousProxy },
+		copy:  func(dst, src *model.IPMetadata) { dst.Geo.AnonymousProxy = src.Geo.AnonymousProxy },
+	},
+	{
+		name: "satellite_provider", group: FieldGroupGeo,
+		isSet: func(m *model.IPMetadata) bool { return m.Geo.SatelliteProvider },
+		copy:  func(dst, src *model.IPMetadata) { dst.Geo.SatelliteProvider = src.Geo.SatelliteProvider },
+	},
+	{
+		name: "as_number", group: FieldGroupASN,
+		isSet: func(m *model.IPMetadata) bool { return m.ASN.ASN != 0 },
+		copy:  func(dst, src *model.IPMetadata) { dst.ASN.ASN = src.ASN.ASN },
+	},
+	{
+		name: "as_country_code", group: FieldGroupASN, sameKey: sameAS,
+		isSet: func(m *model.IPMetadata) bool { return m.ASN.CountryCode != "" },
+		copy:  func(dst, src *model.IPMetadata) { dst.ASN.CountryCode = src.ASN.CountryCode },
+	},
+	{
+		name: "as_name", group: FieldGroupASN, sameKey: sameAS,
+		isSet: func(m *model.IPMetadata) bool { return m.ASN.Name != "" },
+		copy:  func(dst, src *model.IPMetadata) { dst.ASN.Name = src.ASN.Name },
+	},
+	{
+		name: "as_org", group: FieldGroupASN, sameKey: sameAS,
+		isSet: func(m *model.IPMetadata) bool { return m.ASN.Org != "" },
+		copy:  func(dst, src *model.IPMetadata) { dst.ASN.Org = src.ASN.Org },
+	},
+	{
+		name: "as_domain", group: FieldGroupASN, sameKey: sameAS,
+		isSet: func(m *model.IPMetadata) bool { return m.ASN.Domain != "" },
+		copy:  func(dst, src *model.IPMetadata) { dst.ASN.Domain = src.ASN.Domain },
+	},
+}
+
+/*
+CompositeLookuper - MetaLookuper merging partial results of several sources field by field.
+
+	Every field is taken from the first source of its precedence list holding a value.
+	Fields without a precedence rule use all sources in their configured order.
+	The reported network is the most specific network of the sources that supplied
+	any field, the supplying source of every field is recorded in IPMetadata.Sources.
+	Reverse lookups, summaries and AS search are answered by the first source
+	of the country_code or as_number precedence that has an answer.
+*/
+type CompositeLookuper struct {
+	sources []NamedLookuper
+	order   [][]int   // per metaFields entry, source indexes by precedence
+	scratch sync.Pool // *lookupScratch of LookupIPInto
+}
+
+// lookupScratch holds per source results of a lookup.
+type lookupScratch struct {
+	metas   []model.IPMetadata
+	results []*model.IPMetadata
+}
+
+/*
+NewCompositeLookuper - Creates a composite lookuper.
+
+Parameters:
+  - sources: metadata sources in default precedence order, names must be unique
+  - precedence: field name or field group (geo, asn) to the source names allowed
+    to supply it, in precedence order; single fields override their group
+*/
+func NewCompositeLookuper(sources []NamedLookuper, precedence map[string][]string) (*CompositeLookuper, error) {
+	names := make([]string, 0, len(sources))
+	for _, src := range sources {
+		names = append(names, src.Name)
+	}
+
+	order, err := precedenceOrder(names, precedence)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CompositeLookuper{
+		sources: sources,
+		order:   order,
+	}, nil
+}
+
+// CheckPrecedence - Validates precedence rules against source names before the sources are loaded.
+func CheckPrecedence(names []string, precedence map[string][]string) error {
+	_, err := precedenceOrder(names, precedence)
+	return err
+}
+
+// precedenceOrder resolves source indexes of every merged field.
+func precedenceOrder(names []string, precedence map[string][]string) ([][]int, error) {
+	if len(names) == 0 {
+		return nil, errors.New("composite lookup requires at least one source")
+	}
+
+	index := make(map[string]int, len(names))
+	defaultOrder := make([]int, 0, len(names))
+	for i, name := range names {
+		if _, ok := index[name]; ok {
+			return nil, fmt.Errorf("duplicate composite source %q", name)
+		}
+		index[name] = i
+		defaultOrder = append(defaultOrder, i)
+	}
+
+	rules := make(map[string][]int, len(precedence))
+	for key, list := range precedence {
+		if !isFieldKey(key) {
+			return nil, fmt.Errorf("unknown precedence field %q", key)
+		}
+		if len(list) == 0 {
+			return nil, fmt.Errorf("precedence of %q lists no sources", key)
+		}
+
+		order := make([]int, 0, len(list))
+		for _, name := range list {
+			i, ok := index[name]
+			if !ok {
+				return nil, fmt.Errorf("precedence of %q: unknown source %q", key, name)
+			}
+			if slices.Contains(order, i) {
+				return nil, fmt.Errorf("precedence of %q: duplicate source %q", key, name)
+			}
+			order = append(order, i)
+		}
+		rules[key] = order
+	}
+
+	order := make([][]int, len(metaFields))
+	for i, f := range metaFields {
+		switch {
+		case rules[f.name] != nil:
+			order[i] = rules[f.name]
+		case rules[f.group] != nil:
+			order[i] = rules[f.group]
+		default:
+			order[i] = defaultOrder
+		}
+	}
+
+	return order, nil
+}
+
+func isFieldKey(key string) bool {
+	if key == FieldGroupGeo || key == FieldGroupASN {
+		return true
+	}
+	return slices.ContainsFunc(metaFields, func(f metaField) bool { return f.name == key })
+}
+
+// LookupIP - Looks the address up in all sources and merges their results.
+func (c *CompositeLookuper) LookupIP(ctx context.Context, addr netip.Addr) (*model.IPMetadata, error) {
+	meta := &model.IPMetadata{}
+	if err := c.LookupIPInto(ctx, addr, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+/*
+LookupIPInto - Looks the address up in all sources and merges their results into dst.
+
+	Sources implementing MetaIntoLookuper fill pooled metadata, the Sources map
+	of dst is reused, so a lookup over such sources does not allocate once dst
+	has been filled before.
+*/
+func (c *CompositeLookuper) LookupIPInto(ctx context.Context, addr netip.Addr, dst *model.IPMetadata) error {
+	s, _ := c.scratch.Get().(*lookupScratch)
+	if s == nil {
+		s = &lookupScratch{
+			metas:   make([]model.IPMetadata, len(c.sources)),
+			results: make([]*model.IPMetadata, len(c.sources)),
+		}
+	}
+	defer func() {
+		clear(s.results) // results of LookupIP are not retained
+		c.scratch.Put(s)
+	}()
+
+	var errs []error
+	for i, src := range c.sources {
+		var err error
+		if into, ok := src.Lookup.(MetaIntoLookuper); ok {
+			if err = into.LookupIPInto(ctx, addr, &s.metas[i]); err == nil {
+				s.results[i] = &s.metas[i]
+			}
+		} else {
+			s.results[i], err = src.Lookup.LookupIP(ctx, addr)
+		}
+
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", src.Name, err))
+		}
+	}
+
+	return c.mergeInto(dst, s.results, errs)
+}
+
+// ExplainIP - Looks the address up in all sources and merges their results, reporting the matches of every source.
+func (c *CompositeLookuper) ExplainIP(ctx context.Context, addr netip.Addr) (*model.IPMetadata, []model.LookupMatch, error) {
+	results := make([]*model.IPMetadata, len(c.sources))
+	matches := make([]model.LookupMatch, 0, len(c.sources))
+
+	var errs []error
+	for i, src := range c.sources {
+		var (
+			meta  *model.IPMetadata
+			found []model.LookupMatch
+			err   error
+		)
+		if e, ok := src.Lookup.(MetaExplainer); ok {
+			meta, found, err = e.ExplainIP(ctx, addr)
+		} else if meta, err = src.Lookup.LookupIP(ctx, addr); err == nil {
+			found = []model.LookupMatch{{Network: meta.Network}}
+		}
+
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, nil, ctxErr
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", src.Name, err))
+			matches = append(matches, model.LookupMatch{Source: src.Name, Error: err.Error()})
+			continue
+		}
+
+		results[i] = meta
+		for _, m := range found {
+			m.Source = src.Name
+			matches = append(matches, m)
+		}
+	}
+
+	meta := &model.IPMetadata{}
+	if err := c.mergeInto(meta, results, errs); err != nil {
+		return nil, nil, err
+	}
+	return meta, matches, nil
+}
+
+// mergeInto combines source results into out by field precedence, errs are returned when no source answered.
+func (c *CompositeLookuper) mergeInto(out *model.IPMetadata, results []*model.IPMetadata, errs []error) error {
+	if !slices.ContainsFunc(results, func(r *model.IPMetadata) bool { return r != nil }) {
+		return errors.Join(errs...)
+	}
+
+	sources := out.Sources
+	if sources == nil {
+		sources = make(map[string]string, len(metaFields)+1)
+	}
+	clear(sources)
+	*out = model.IPMetadata{
+		Type:    model.NetworkGlobal,
+		Sources: sources,
+	}
+
+	for i, f := range metaFields {
+		for _, j := range c.order[i] {
+			r := results[j]
+			if r == nil || !f.isSet(r) || (f.sameKey != nil && !f.sameKey(out, r)) {
+				continue
+			}
+
+			f.copy(out, r)
+			out.Sources[f.name] = c.sources[j].Name
+			break
+		}
+	}
+
+	network := -1
+	for j, r := range results {
+		if r == nil || !r.Network.IsValid() || !c.supplied(out.Sources, j) {
+			continue
+		}
+		if network < 0 || r.Network.Bits() > out.Network.Bits() {
+			out.Network = r.Network
+			network = j
+		}
+	}
+	if network >= 0 {
+		out.Sources[FieldNetwork] = c.sources[network].Name
+	}
+
+	return nil
+}
+
+// supplied reports whether the source at index j supplied any field of sources.
+func (c *CompositeLookuper) supplied(sources map[string]string, j int) bool {
+	for _, name := range sources {
+		if name == c.sources[j].Name {
+			return true
+		}
+	}
+	return false
+}
+
+// Size - Returns the number of networks over all sources reporting their size.
+func (c *CompositeLookuper) Size() (n int) {
+	for _, src := range c.sources {
+		if s, ok := src.Lookup.(interface{ Size() int }); ok {
+			n += s.Size()
+		}
+	}
+	return n
+}
+
+// LoadReport - Returns the source reports of all sources, their load durations summed.
+func (c *CompositeLookuper) LoadReport() model.LoadReport {
+	var report model.LoadReport
+
+	for _, src := range c.sources {
+		rep, ok := src.Lookup.(LoadReporter)
+		if !ok {
+			continue
+		}
+
+		r := rep.LoadReport()
+		if r.LoadedAt.After(report.LoadedAt) {
+			report.LoadedAt = r.LoadedAt
+		}
+		report.Duration += r.Duration
+		report.Sources = append(report.Sources, r.Sources...)
+	}
+
+	if report.LoadedAt.IsZero() {
+		report.LoadedAt = time.Now()
+	}
+	return report
+}
+
+// Stats - Returns statistics of the sources reporting them, counters summed over sources.
+func (c *CompositeLookuper) Stats() model.BaseStats {
+	var stats model.BaseStats
+
+	for _, src := range c.sources {
+		st, ok := src.Lookup.(StatsReporter)
+		if !ok {
+			continue
+		}
+
+		s := st.Stats()
+		s.Source = src.Name
+		stats.Add(s)
+	}
+
+	return stats
+}
+
+// ParsePrecedence - Parses precedence rules in the "field=source1,source2" form.
+func ParsePrecedence(rules []string) (map[string][]string, error) {
+	precedence := make(map[string][]string, len(rules))
+
+	for _, rule := range rules {
+		key, list, ok := strings.Cut(rule, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid precedence rule %q, expected field=source1,source2", rule)
+		}
+		if _, ok := precedence[key]; ok {
+			return nil, fmt.Errorf("duplicate precedence rule for %q", key)
+		}
+
+		var names []string
+		for name := range strings.SplitSeq(list, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+		precedence[key] = names
+	}
+
+	return precedence, nil
+}
@@ -0,0 +1,171 @@
+package ipbase_test
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net/netip"
+	"testing"
+
+	"github.com/eterline/ipcsv2base/internal/model"
+	"github.com/eterline/ipcsv2base/internal/service/ipbase"
+)
+
+var errNoMatch = errors.New("no match")
+
+// staticLookuper answers every address with meta, nil meta fails the lookup.
+type staticLookuper struct {
+	meta *model.IPMetadata
+}
+
+func (l staticLookuper) LookupIP(ctx context.Context, addr netip.Addr) (*model.IPMetadata, error) {
+	if l.meta == nil {
+		return nil, errNoMatch
+	}
+	meta := *l.meta
+	return &meta, nil
+}
+
+// intoLookuper is a staticLookuper filling caller metadata.
+type intoLookuper struct {
+	staticLookuper
+}
+
+func (l intoLookuper) LookupIPInto(ctx context.Context, addr netip.Addr, dst *model.IPMetadata) error {
+	if l.meta == nil {
+		return errNoMatch
+	}
+	*dst = *l.meta
+	return nil
+}
+
+// compositeSources - Sources disagreeing on the country and AS of 1.0.0.1.
+func compositeSources(into bool) []ipbase.NamedLookuper {
+	metas := []struct {
+		name string
+		meta model.IPMetadata
+	}{
+		{"city", model.IPMetadata{
+			Network: netip.MustParsePrefix("1.0.0.0/24"),
+			Geo:     model.IPGeo{CountryCode: "AU", CountryName: "Australia", CityName: "Sydney"},
+		}},
+		{"country", model.IPMetadata{
+			Network: netip.MustParsePrefix("1.0.0.0/16"),
+			Geo:     model.IPGeo{ContinentCode: "AS", CountryCode: "JP", CountryName: "Japan", RegionName: "Tokyo"},
+			ASN:     model.IPAS{ASN: 2497, Name: "IIJ"},
+		}},
+		{"asn", model.IPMetadata{
+			Network: netip.MustParsePrefix("1.0.0.0/20"),
+			ASN:     model.IPAS{ASN: 13335, Name: "CLOUDFLARENET", Org: "Cloudflare", Domain: "cloudflare.com"},
+		}},
+	}
+
+	sources := make([]ipbase.NamedLookuper, 0, len(metas))
+	for _, m := range metas {
+		var l ipbase.MetaLookuper = staticLookuper{meta: &m.meta}
+		if into {
+			l = intoLookuper{staticLookuper{meta: &m.meta}}
+		}
+		sources = append(sources, ipbase.NamedLookuper{Name: m.name, Lookup: l})
+	}
+	return sources
+}
+
+func TestCompositeLookuperPrecedence(t *testing.T) {
+	tests := []struct {
+		name       string
+		precedence map[string][]string
+		want       model.IPMetadata
+	}{
+		{
+			// dependent fields of the country source are dropped under the city source country code
+			name: "configured order",
+			want: model.IPMetadata{
+				Network: netip.MustParsePrefix("1.0.0.0/24"),
+				Geo:     model.IPGeo{CountryCode: "AU", CountryName: "Australia", CityName: "Sydney"},
+				ASN:     model.IPAS{ASN: 2497, Name: "IIJ"},
+				Sources: map[string]string{
+					"country_code": "city", "country_name": "city", "city_name": "city",
+					"as_number": "country", "as_name": "country", ipbase.FieldNetwork: "city",
+				},
+			},
+		},
+		{
+			name:       "group rules",
+			precedence: map[string][]string{ipbase.FieldGroupGeo: {"country", "city"}, ipbase.FieldGroupASN: {"asn"}},
+			want: model.IPMetadata{
+				Network: netip.MustParsePrefix("1.0.0.0/20"),
+				Geo:     model.IPGeo{ContinentCode: "AS", CountryCode: "JP", CountryName: "Japan", RegionName: "Tokyo"},
+				ASN:     model.IPAS{ASN: 13335, Name: "CLOUDFLARENET", Org: "Cloudflare", Domain: "cloudflare.com"},
+				Sources: map[string]string{
+					"country_code": "country", "continent_code": "country", "country_name": "country", "region_name": "country",
+					"as_number": "asn", "as_name": "asn", "as_org": "asn", "as_domain": "asn", ipbase.FieldNetwork: "asn",
+				},
+			},
+		},
+		{
+			// the AS name of the country source belongs to another AS number and is not taken
+			name:       "field rule over group rule",
+			precedence: map[string][]string{ipbase.FieldGroupASN: {"country"}, "as_number": {"asn"}, "as_name": {"country", "asn"}},
+			want: model.IPMetadata{
+				Network: netip.MustParsePrefix("1.0.0.0/24"),
+				Geo:     model.IPGeo{CountryCode: "AU", CountryName: "Australia", CityName: "Sydney"},
+				ASN:     model.IPAS{ASN: 13335, Name: "CLOUDFLARENET"},
+				Sources: map[string]string{
+					"country_code": "city", "country_name": "city", "city_name": "city",
+					"as_number": "asn", "as_name": "asn", ipbase.FieldNetwork: "city",
+				},
+			},
+		},
+	}
+
+	addr := netip.MustParseAddr("1.0.0.1")
+	for _, into := range []bool{false, true} {
+		for _, tt := range tests {
+			c, err := ipbase.NewCompositeLookuper(compositeSources(into), tt.precedence)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := c.LookupIP(context.Background(), addr)
+			if err != nil {
+				t.Fatalf("%s: LookupIP error = %v", tt.name, err)
+			}
+			tt.want.Type = model.NetworkGlobal
+			if got.Network != tt.want.Network || got.Geo != tt.want.Geo || got.ASN != tt.want.ASN {
+				t.Errorf("%s, into %v: LookupIP = %s %+v %+v, want %s %+v %+v", tt.name, into,
+					got.Network, got.Geo, got.ASN, tt.want.Network, tt.want.Geo, tt.want.ASN)
+			}
+			if !maps.Equal(got.Sources, tt.want.Sources) {
+				t.Errorf("%s, into %v: sources = %v, want %v", tt.name, into, got.Sources, tt.want.Sources)
+			}
+		}
+	}
+}
+
+func TestCompositeLookuperFailures(t *testing.T) {
+	sources := []ipbase.NamedLookuper{
+		{Name: "empty", Lookup: staticLookuper{}},
+		{Name: "asn", Lookup: intoLookuper{staticLookuper{meta: &model.IPMetadata{
+			Network: netip.MustParsePrefix("1.0.0.0/24"),
+			ASN:     model.IPAS{ASN: 13335},
+		}}}},
+	}
+	addr := netip.MustParseAddr("1.0.0.1")
+
+	c, err := ipbase.NewCompositeLookuper(sources, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.LookupIP(context.Background(), addr); err != nil || got.ASN.ASN != 13335 {
+		t.Errorf("LookupIP with a failed source = %+v, %v, want the answer of the other source", got, err)
+	}
+
+	c, err = ipbase.NewCompositeLookuper(sources[:1], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.LookupIP(context.Background(), addr); !errors.Is(err, errNoMatch) {
+		t.Errorf("LookupIP without answers error = %v, want %v", err, errNoMatch)
+	}
+}
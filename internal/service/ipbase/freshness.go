@@ -0,0 +1,96 @@
+package ipbase
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/eterline/ipcsv2base/internal/model"
+)
+
+// ReportFunc - Returns the report of the currently served base.
+type ReportFunc func() (model.LoadReport, bool)
+
+/*
+FreshnessMonitor - Tracks the age of the served base data.
+
+	The data age is measured from the oldest source build date, or its file
+	modification time when the format embeds no date. A base older than maxAge
+	is logged as stale and turns the readiness signal off.
+*/
+type FreshnessMonitor struct {
+	log    model.Logger
+	maxAge time.Duration
+	report ReportFunc
+	stale  atomic.Bool
+}
+
+// NewFreshnessMonitor - Creates a monitor of the base age, zero maxAge disables the age limit.
+func NewFreshnessMonitor(log model.Logger, maxAge time.Duration, report ReportFunc) *FreshnessMonitor {
+	return &FreshnessMonitor{
+		log:    log,
+		maxAge: maxAge,
+		report: report,
+	}
+}
+
+// MaxAge - Returns the configured age limit, zero when disabled.
+func (m *FreshnessMonitor) MaxAge() time.Duration {
+	return m.maxAge
+}
+
+// Age - Returns the data time of the base and its age at now.
+// stale is set when the age exceeds the limit, dataTime is zero when unknown.
+func (m *FreshnessMonitor) Age(now time.Time) (dataTime time.Time, age time.Duration, stale bool) {
+	report, ok := m.report()
+	if !ok {
+		return time.Time{}, 0, false
+	}
+
+	dataTime = report.DataTime()
+	if dataTime.IsZero() {
+		return dataTime, 0, false
+	}
+
+	age = now.Sub(dataTime)
+	return dataTime, age, m.maxAge > 0 && age > m.maxAge
+}
+
+// Check - Measures the base age at now, updates the readiness signal and logs stale data.
+func (m *FreshnessMonitor) Check(now time.Time) (stale bool) {
+	dataTime, age, stale := m.Age(now)
+	m.stale.Store(stale)
+
+	if stale {
+		m.log.Warn(
+			"ip base data is older than allowed",
+			model.FieldString("data_time", dataTime.Format(time.RFC3339)),
+			model.Field("age_hours", int64(age.Hours())),
+			model.Field("max_age_hours", int64(m.maxAge.Hours())),
+		)
+	}
+
+	return stale
+}
+
+// Run - Checks the base age every interval until ctx is done.
+func (m *FreshnessMonitor) Run(ctx context.Context, every time.Duration) {
+	m.Check(time.Now())
+
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.Check(now)
+		}
+	}
+}
+
+// Ready - Reports whether the base data is within the age limit.
+func (m *FreshnessMonitor) Ready() bool {
+	return !m.stale.Load()
+}
@@ -0,0 +1,65 @@
+package ipbase_test
+
+import (
+	"context"
+	"io"
+	"net/netip"
+	"testing"
+
+	"github.com/eterline/ipcsv2base/internal/infra/log"
+	"github.com/eterline/ipcsv2base/internal/model"
+	"github.com/eterline/ipcsv2base/internal/service/ipbase"
+)
+
+// hitCache answers every address with the same metadata.
+type hitCache struct {
+	meta *model.IPMetadata
+}
+
+func (c hitCache) LookupIP(ctx context.Context, addr netip.Addr) (*model.IPMetadata, bool) {
+	return c.meta, true
+}
+
+func (c hitCache) SaveIP(addr netip.Addr, meta *model.IPMetadata) {}
+
+// BenchmarkLookupIPCacheHit - Cached lookup with debug and info logging disabled, expected to be allocation free.
+func BenchmarkLookupIPCacheHit(b *testing.B) {
+	logger, err := log.NewZapLoggerWithConfig(io.Discard, "warn", false, true, false)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	meta := &model.IPMetadata{Type: model.NetworkGlobal, Network: netip.MustParsePrefix("1.0.0.0/24")}
+	srv := ipbase.NewIPBaseService(logger, nil, nil, nil, nil, hitCache{meta: meta}, nil)
+
+	ctx := context.Background()
+	addr := netip.MustParseAddr("1.0.0.1")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := srv.LookupIP(ctx, addr); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkCompositeLookupInto - Composite lookup over sources filling caller metadata, expected to be allocation free.
+func BenchmarkCompositeLookupInto(b *testing.B) {
+	c, err := ipbase.NewCompositeLookuper(compositeSources(true), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	ctx := context.Background()
+	addr := netip.MustParseAddr("1.0.0.1")
+
+	var meta model.IPMetadata
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := c.LookupIPInto(ctx, addr, &meta); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
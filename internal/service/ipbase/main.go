@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"net/netip"
+	"time"
 
 	"github.com/eterline/ipcsv2base/internal/model"
 )
@@ -16,6 +17,22 @@ type MetaLookuper interface {
 	LookupIP(ctx context.Context, addr netip.Addr) (*model.IPMetadata, error)
 }
 
+/*
+MetaExplainer - Optional interface of lookupers reporting the ranges behind a result.
+Matches carry the source file rows when the lookuper recorded them.
+*/
+type MetaExplainer interface {
+	ExplainIP(ctx context.Context, addr netip.Addr) (*model.IPMetadata, []model.LookupMatch, error)
+}
+
+/*
+MetaIntoLookuper - Optional interface of lookupers filling caller owned metadata.
+Implementations are expected not to allocate on the lookup path.
+*/
+type MetaIntoLookuper interface {
+	LookupIPInto(ctx context.Context, addr netip.Addr, dst *model.IPMetadata) error
+}
+
 /*
 MetaCache - Interface for IP metadata caching layer.
 Used to speed up repeated lookups and reduce pressure on the main lookup source.
@@ -25,14 +42,31 @@ type MetaCache interface {
 	SaveIP(addr netip.Addr, meta *model.IPMetadata)
 }
 
+/*
+OverlayLookuper - Interface for user annotations of networks.
+Matches are expected to be resolved by the longest prefix.
+*/
+type OverlayLookuper interface {
+	LookupOverlay(addr netip.Addr) (model.IPOverlay, bool)
+}
+
+// FlagLookuper - Interface for network flag lists, every list holding the address reports a flag.
+type FlagLookuper interface {
+	LookupFlags(addr netip.Addr) []model.IPFlag
+}
+
 /*
 IPBaseService - Core service for IP metadata lookup with cache and logging support.
 It classifies network type, handles cache hits, and delegates lookups to MetaLookuper.
 */
 type IPBaseService struct {
-	lookup MetaLookuper
-	cache  MetaCache
-	log    model.Logger
+	lookup     MetaLookuper
+	overlay    OverlayLookuper
+	flags      FlagLookuper
+	blocklists BlocklistLookuper
+	cache      MetaCache
+	versions   VersionStore
+	log        model.Logger
 }
 
 /*
@@ -41,17 +75,29 @@ NewIPBaseService - Constructs a new IPBaseService instance.
 Parameters:
   - log: structured logger instance
   - l: primary metadata lookuper
-  - c: cache implementation
+  - o: network annotations overlay, nil disables it
+  - f: network flag lists, nil disables them
+  - bl: IP blocklists, nil disables them
+  - c: cache implementation, nil disables caching
+  - v: past base versions for lookups at a time, nil disables them
 */
 func NewIPBaseService(
 	log model.Logger,
 	l MetaLookuper,
+	o OverlayLookuper,
+	f FlagLookuper,
+	bl BlocklistLookuper,
 	c MetaCache,
+	v VersionStore,
 ) *IPBaseService {
 	return &IPBaseService{
-		lookup: l,
-		cache:  c,
-		log:    log,
+		lookup:     l,
+		overlay:    o,
+		flags:      f,
+		blocklists: bl,
+		cache:      c,
+		versions:   v,
+		log:        log,
 	}
 }
 
@@ -61,52 +107,247 @@ LookupIP - Performs metadata lookup for a single IP address.
 Lookup flow:
  1. Detect network type (global / private / test).
  2. Reject unknown network areas.
- 3. Return minimal metadata for private and test networks.
- 4. Try cache lookup.
- 5. Fallback to primary lookuper.
- 6. Save result to cache asynchronously.
+ 3. Match the overlay, its fields are merged into the result.
+ 4. Match the network flag lists, their flags are added to the result.
+ 5. Match the blocklists, their entries are added to the result.
+ 6. Return minimal metadata for private and test networks.
+ 7. Try cache lookup.
+ 8. Fallback to primary lookuper, overlay, flag and blocklist matches missing in the base are still answered.
+ 9. Save result to cache asynchronously.
+
+Cached results hold base metadata only, so overlay, flag list and blocklist reloads apply immediately.
 */
 func (b *IPBaseService) LookupIP(ctx context.Context, addr netip.Addr) (*model.IPMetadata, error) {
+	return b.lookupIP(ctx, addr, nil)
+}
 
-	nt, pfx := NetworkTypeFromAddrWithSubnet(addr)
-	log := b.log.With(
-		model.FieldStringer("ip", addr),
-		model.FieldStringer("network_type", nt),
-	)
+/*
+LookupIPExplain - Performs LookupIP recording its decisions.
 
-	switch nt {
-	case model.NetworkUnknown:
-		log.Error("lookup aborted: unknown network type")
+	The explain holds the network classification, the cache outcome, the overlay
+	match, the registry ranges with their source rows and the timing of every stage.
+	Source rows are reported when the base was loaded with row origins.
+*/
+func (b *IPBaseService) LookupIPExplain(ctx context.Context, addr netip.Addr) (*model.IPMetadata, *model.LookupExplain, error) {
+	ex := &model.LookupExplain{}
+	meta, err := b.lookupIP(ctx, addr, ex)
+	return meta, ex, err
+}
+
+// lookupIP performs the lookup flow, ex is filled when not nil.
+func (b *IPBaseService) lookupIP(ctx context.Context, addr netip.Addr, ex *model.LookupExplain) (*model.IPMetadata, error) {
+	if ex != nil {
+		startAt := time.Now()
+		defer func() { ex.Total = time.Since(startAt) }()
+	}
+
+	stageAt := stageStart(ex)
+	class := ClassifyAddr(addr)
+	nt, pfx := class.Type, class.Network
+	if ex != nil {
+		ex.Classification = class
+		ex.AddStage("classify", stageAt)
+	}
+
+	ll := lookupLog{log: b.log, addr: addr, nt: nt}
+
+	if nt == model.NetworkUnknown {
+		if log, ok := ll.at(model.LevelError); ok {
+			log.Error("lookup aborted: unknown network type")
+		}
 		return nil, errors.New("unknown network area")
+	}
+
+	// Overlay lookup
+	stageAt = stageStart(ex)
+	overlay, hasOverlay := b.lookupOverlay(addr)
+	if log, ok := ll.at(model.LevelDebug); ok && hasOverlay {
+		log.Debug("overlay match", model.FieldStringer("overlay_network", overlay.Network))
+	}
+	if ex != nil {
+		if hasOverlay {
+			matched := overlay // a copy keeps overlay off the heap without explain
+			ex.Overlay = &matched
+		}
+		ex.AddStage("overlay", stageAt)
+	}
+
+	// Flag lists lookup
+	stageAt = stageStart(ex)
+	flags := b.lookupFlags(addr)
+	if ex != nil {
+		ex.AddStage("flags", stageAt)
+	}
+
+	// Blocklists lookup
+	stageAt = stageStart(ex)
+	listed := b.lookupListings(addr)
+	if ex != nil {
+		ex.AddStage("blocklists", stageAt)
+	}
 
+	annotate := func(meta *model.IPMetadata) *model.IPMetadata {
+		if !hasOverlay && flags == nil && listed == nil {
+			return meta
+		}
+		merged := *meta
+		if hasOverlay {
+			merged.ApplyOverlay(overlay)
+		}
+		merged.Flags = flags
+		merged.Listed = listed
+		return &merged
+	}
+
+	switch nt {
 	case model.NetworkPrivate,
 		model.NetworkTest,
 		model.NetworkLoopback:
-		log.Debug("lookup skipped: non-global network")
-		return &model.IPMetadata{Type: nt, Network: pfx}, nil
+		if log, ok := ll.at(model.LevelDebug); ok {
+			log.Debug("lookup skipped: non-global network")
+		}
+		if ex != nil {
+			ex.Cache = model.CacheSkipped
+		}
+		return annotate(&model.IPMetadata{Type: nt, Network: pfx}), nil
 	}
 
 	// Cache lookup
-	if meta, ok := b.cache.LookupIP(ctx, addr); ok {
-		log.Info("cache hit")
-		return meta, nil
+	var (
+		cached *model.IPMetadata
+		hit    bool
+	)
+	if b.cache != nil {
+		stageAt = stageStart(ex)
+		cached, hit = b.cache.LookupIP(ctx, addr)
+		if ex != nil {
+			ex.Cache = model.CacheMiss
+			if hit {
+				ex.Cache = model.CacheHit
+			}
+			ex.AddStage("cache", stageAt)
+		}
+	} else if ex != nil {
+		ex.Cache = model.CacheSkipped
+	}
+
+	if hit {
+		if log, ok := ll.at(model.LevelInfo); ok {
+			log.Info("cache hit")
+		}
+		if ex != nil {
+			// the cached result is served, the base is asked only to explain it
+			stageAt = stageStart(ex)
+			_, ex.Matches, _ = b.explainBase(ctx, addr)
+			ex.AddStage("base_explain", stageAt)
+		}
+		return annotate(cached), nil
 	}
 
 	// Primary lookup
-	meta, err := b.lookup.LookupIP(ctx, addr)
+	stageAt = stageStart(ex)
+	var (
+		meta *model.IPMetadata
+		err  error
+	)
+	if ex != nil {
+		meta, ex.Matches, err = b.explainBase(ctx, addr)
+	} else {
+		meta, err = b.lookup.LookupIP(ctx, addr)
+	}
+	ex.AddStage("base", stageAt)
+
 	if err != nil {
-		log.Error("lookup failed", model.FieldError(err))
+		// Annotated, flagged and listed networks are answered even when the base does not cover them
+		if (hasOverlay || flags != nil || listed != nil) && ctx.Err() == nil {
+			if log, ok := ll.at(model.LevelDebug); ok {
+				log.Debug("base lookup failed, overlay, flags and blocklists only result", model.FieldError(err))
+			}
+			var network netip.Prefix
+			switch {
+			case hasOverlay:
+				network = overlay.Network
+			case flags != nil:
+				network = flags[0].Network
+			default:
+				network = listed[0].Network
+			}
+			return annotate(&model.IPMetadata{Type: nt, Network: network}), nil
+		}
+
+		if log, ok := ll.at(model.LevelError); ok {
+			log.Error("lookup failed", model.FieldError(err))
+		}
 		return nil, err
 	}
 
 	// Async cache save
-	go func() {
-		log.Debug("saving result to cache")
-		b.cache.SaveIP(addr, meta)
-	}()
+	if b.cache != nil {
+		go func() {
+			if log, ok := ll.at(model.LevelDebug); ok {
+				log.Debug("saving result to cache")
+			}
+			b.cache.SaveIP(addr, meta)
+		}()
+	}
+
+	if log, ok := ll.at(model.LevelDebug); ok {
+		log.Debug("lookup finished")
+	}
+	return annotate(meta), nil
+}
 
-	log.Debug("lookup finished")
-	return meta, nil
+// lookupLog - Logger of a single lookup, its fields are built only for enabled levels.
+type lookupLog struct {
+	log  model.Logger
+	addr netip.Addr
+	nt   model.NetworkType
+}
+
+// at returns the logger with the lookup fields when the level is enabled.
+func (l lookupLog) at(level model.LogLevel) (model.Logger, bool) {
+	if !l.log.Enabled(level) {
+		return nil, false
+	}
+	return l.log.With(
+		model.FieldStringer("ip", l.addr),
+		model.FieldStringer("network_type", l.nt),
+	), true
+}
+
+// stageStart returns the start time of a lookup stage, zero without explain.
+func stageStart(ex *model.LookupExplain) time.Time {
+	if ex == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// explainBase looks the address up in the primary lookuper with its matched ranges when it can explain them.
+func (b *IPBaseService) explainBase(ctx context.Context, addr netip.Addr) (*model.IPMetadata, []model.LookupMatch, error) {
+	if e, ok := b.lookup.(MetaExplainer); ok {
+		return e.ExplainIP(ctx, addr)
+	}
+
+	meta, err := b.lookup.LookupIP(ctx, addr)
+	if err != nil {
+		return nil, []model.LookupMatch{{Error: err.Error()}}, err
+	}
+	return meta, []model.LookupMatch{{Network: meta.Network}}, nil
+}
+
+func (b *IPBaseService) lookupOverlay(addr netip.Addr) (model.IPOverlay, bool) {
+	if b.overlay == nil {
+		return model.IPOverlay{}, false
+	}
+	return b.overlay.LookupOverlay(addr)
+}
+
+func (b *IPBaseService) lookupFlags(addr netip.Addr) []model.IPFlag {
+	if b.flags == nil {
+		return nil
+	}
+	return b.flags.LookupFlags(addr)
 }
 
 /*
@@ -116,3 +357,31 @@ Currently resolves metadata based on the prefix address.
 func (b *IPBaseService) LookupPrefix(ctx context.Context, pfx netip.Prefix) (*model.IPMetadata, error) {
 	return b.LookupIP(ctx, pfx.Addr())
 }
+
+// LoadReporter - Optional interface of lookupers exposing the report of their base load.
+type LoadReporter interface {
+	LoadReport() model.LoadReport
+}
+
+// LoadReport - Returns the base load report when the primary lookuper provides one.
+func (b *IPBaseService) LoadReport() (model.LoadReport, bool) {
+	rep, ok := b.lookup.(LoadReporter)
+	if !ok {
+		return model.LoadReport{}, false
+	}
+	return rep.LoadReport(), true
+}
+
+// StatsReporter - Optional interface of lookupers exposing structure statistics of their base.
+type StatsReporter interface {
+	Stats() model.BaseStats
+}
+
+// Stats - Returns structure statistics of the base when the primary lookuper provides them.
+func (b *IPBaseService) Stats() (model.BaseStats, bool) {
+	st, ok := b.lookup.(StatsReporter)
+	if !ok {
+		return model.BaseStats{}, false
+	}
+	return st.Stats(), true
+}
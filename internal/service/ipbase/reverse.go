@@ -0,0 +1,125 @@
+package ipbase
+
+import (
+	"net/netip"
+	"slices"
+
+	"github.com/eterline/ipcsv2base/internal/model"
+)
+
+/*
+ReverseLookuper - Optional interface of lookupers indexing their networks by country code and AS number.
+Returned networks are aggregated CIDRs sorted by address.
+*/
+type ReverseLookuper interface {
+	CountryPrefixes(cc string) []netip.Prefix
+	ASNPrefixes(asn int32) []netip.Prefix
+}
+
+// CountryPrefixes - Returns the networks answered with the country code, ver 4 or 6 selects one IP version.
+// False is returned when the primary lookuper keeps no reverse index.
+func (b *IPBaseService) CountryPrefixes(cc model.GeoCode, ver int) (model.NetworkList, bool) {
+	rev, ok := b.lookup.(ReverseLookuper)
+	if !ok {
+		return model.NetworkList{}, false
+	}
+	return model.NetworkList{Prefixes: rev.CountryPrefixes(string(cc))}.Family(ver), true
+}
+
+// ASNPrefixes - Returns the networks answered with the AS number, ver 4 or 6 selects one IP version.
+// False is returned when the primary lookuper keeps no reverse index.
+func (b *IPBaseService) ASNPrefixes(asn int32, ver int) (model.NetworkList, bool) {
+	rev, ok := b.lookup.(ReverseLookuper)
+	if !ok {
+		return model.NetworkList{}, false
+	}
+	return model.NetworkList{Prefixes: rev.ASNPrefixes(asn)}.Family(ver), true
+}
+
+/*
+SummaryLookuper - Optional interface of lookupers keeping statistics per country and per AS.
+Summaries are precomputed on load.
+*/
+type SummaryLookuper interface {
+	CountrySummary(cc string) (model.CountrySummary, bool)
+	ASSummary(asn int32) (model.ASSummary, bool)
+}
+
+// CountrySummary - Returns the statistics of the country, false for unknown countries or without summaries.
+func (b *IPBaseService) CountrySummary(cc model.GeoCode) (model.CountrySummary, bool) {
+	sum, ok := b.lookup.(SummaryLookuper)
+	if !ok {
+		return model.CountrySummary{}, false
+	}
+	return sum.CountrySummary(string(cc))
+}
+
+// ASSummary - Returns the statistics of the AS, false for unknown numbers or without summaries.
+func (b *IPBaseService) ASSummary(asn int32) (model.ASSummary, bool) {
+	sum, ok := b.lookup.(SummaryLookuper)
+	if !ok {
+		return model.ASSummary{}, false
+	}
+	return sum.ASSummary(asn)
+}
+
+/*
+CountryPrefixes - Returns the networks of the country code from the first source
+by country_code precedence that has any of them.
+
+	Sources are not unioned, a lower source may place the same networks elsewhere.
+	Country summaries are picked the same way.
+*/
+func (c *CompositeLookuper) CountryPrefixes(cc string) (prefixes []netip.Prefix) {
+	c.byPrecedence("country_code", func(src MetaLookuper) bool {
+		if rev, ok := src.(ReverseLookuper); ok {
+			prefixes = rev.CountryPrefixes(cc)
+		}
+		return len(prefixes) > 0
+	})
+	return prefixes
+}
+
+// ASNPrefixes - Returns the networks of the AS number from the first source by as_number precedence that has any of them.
+func (c *CompositeLookuper) ASNPrefixes(asn int32) (prefixes []netip.Prefix) {
+	c.byPrecedence("as_number", func(src MetaLookuper) bool {
+		if rev, ok := src.(ReverseLookuper); ok {
+			prefixes = rev.ASNPrefixes(asn)
+		}
+		return len(prefixes) > 0
+	})
+	return prefixes
+}
+
+// CountrySummary - Returns the country statistics of the first source by country_code precedence knowing the country.
+func (c *CompositeLookuper) CountrySummary(cc string) (sum model.CountrySummary, found bool) {
+	c.byPrecedence("country_code", func(src MetaLookuper) bool {
+		if s, ok := src.(SummaryLookuper); ok {
+			sum, found = s.CountrySummary(cc)
+		}
+		return found
+	})
+	return sum, found
+}
+
+// ASSummary - Returns the AS statistics of the first source by as_number precedence knowing the AS.
+func (c *CompositeLookuper) ASSummary(asn int32) (sum model.ASSummary, found bool) {
+	c.byPrecedence("as_number", func(src MetaLookuper) bool {
+		if s, ok := src.(SummaryLookuper); ok {
+			sum, found = s.ASSummary(asn)
+		}
+		return found
+	})
+	return sum, found
+}
+
+// byPrecedence calls try with the sources allowed to supply field in precedence order until it returns true.
+func (c *CompositeLookuper) byPrecedence(field string, try func(MetaLookuper) bool) {
+	i := slices.IndexFunc(metaFields, func(f metaField) bool { return f.name == field })
+
+	for _, j := range c.order[i] {
+		if try(c.sources[j].Lookup) {
+			return
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package ipbase
+
+import (
+	"github.com/eterline/ipcsv2base/internal/model"
+)
+
+/*
+ASSearcher - Optional interface of lookupers indexing AS names, orgs and domains.
+Indexes are built on load.
+*/
+type ASSearcher interface {
+	SearchAS(query string, offset, limit int) model.ASSearchResult
+	ASByDomain(domain string) model.DomainASes
+}
+
+// SearchAS - Returns the page of autonomous systems matching query, false when the base has no search index.
+func (b *IPBaseService) SearchAS(query string, offset, limit int) (model.ASSearchResult, bool) {
+	s, ok := b.lookup.(ASSearcher)
+	if !ok {
+		return model.ASSearchResult{}, false
+	}
+	return s.SearchAS(query, offset, limit), true
+}
+
+// ASByDomain - Returns the autonomous systems registered with the domain, false when the base has no search index.
+func (b *IPBaseService) ASByDomain(domain string) (model.DomainASes, bool) {
+	s, ok := b.lookup.(ASSearcher)
+	if !ok {
+		return model.DomainASes{}, false
+	}
+	return s.ASByDomain(domain), true
+}
+
+// SearchAS - Returns the matches of the first source by as_number precedence that has any.
+func (c *CompositeLookuper) SearchAS(query string, offset, limit int) (res model.ASSearchResult) {
+	c.byPrecedence("as_number", func(src MetaLookuper) bool {
+		if s, ok := src.(ASSearcher); ok {
+			res = s.SearchAS(query, offset, limit)
+		}
+		return res.Total > 0
+	})
+	return res
+}
+
+// ASByDomain - Returns the domain autonomous systems of the first source by as_number precedence knowing the domain.
+func (c *CompositeLookuper) ASByDomain(domain string) (res model.DomainASes) {
+	c.byPrecedence("as_number", func(src MetaLookuper) bool {
+		if s, ok := src.(ASSearcher); ok {
+			res = s.ASByDomain(domain)
+		}
+		return len(res.AS) > 0
+	})
+	return res
+}
@@ -6,6 +6,38 @@ import (
 	"github.com/eterline/ipcsv2base/internal/model"
 )
 
+// ClassifyAddr - Returns the network type decision of NetworkTypeFromAddrWithSubnet with its reason.
+func ClassifyAddr(addr netip.Addr) model.Classification {
+	t, pfx := NetworkTypeFromAddrWithSubnet(addr)
+	c := model.Classification{Type: t, Network: pfx}
+
+	switch t {
+	case model.NetworkLoopback:
+		c.Reason = "loopback address"
+	case model.NetworkTest:
+		c.Reason = "documentation and test range " + pfx.String()
+	case model.NetworkPrivate:
+		c.Reason = "private range " + pfx.String()
+	case model.NetworkGlobal:
+		c.Reason = "global unicast address"
+	default:
+		switch {
+		case !addr.IsValid():
+			c.Reason = "invalid address"
+		case addr.IsUnspecified():
+			c.Reason = "unspecified address"
+		case addr.IsMulticast():
+			c.Reason = "multicast address"
+		case addr.IsLinkLocalUnicast():
+			c.Reason = "link-local address"
+		default:
+			c.Reason = "not a global unicast address"
+		}
+	}
+
+	return c
+}
+
 func NetworkTypeFromAddrWithSubnet(addr netip.Addr) (t model.NetworkType, p netip.Prefix) {
 	// Loopback
 	if addr.IsLoopback() {
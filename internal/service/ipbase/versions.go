@@ -0,0 +1,85 @@
+package ipbase
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/eterline/ipcsv2base/internal/model"
+)
+
+/*
+VersionStore - Interface for past versions of the IP base.
+
+	Acquire returns the lookuper of the newest version built at or before at,
+	it stays usable until release is called. model.ErrNoBaseVersion is
+	returned when every version is newer.
+*/
+type VersionStore interface {
+	Acquire(ctx context.Context, at time.Time) (l MetaLookuper, dataTime time.Time, release func(), err error)
+	Versions() []model.BaseVersion
+}
+
+/*
+LookupIPAt - Performs metadata lookup in the base version in effect at the given time.
+
+	Times at or after the data time of the served base are answered by
+	LookupIP. A served base without a data time can not be placed among the
+	versions, every time is then answered by the past versions when they are
+	configured. Past versions are looked up without the cache and the overlay,
+	annotations describe the networks of today. The data time of the
+	answering version is returned with the result.
+*/
+func (b *IPBaseService) LookupIPAt(ctx context.Context, addr netip.Addr, at time.Time) (*model.IPMetadata, time.Time, error) {
+	return b.lookupAt(ctx, addr, at, nil)
+}
+
+// LookupIPExplainAt - Performs LookupIPAt recording its decisions, as LookupIPExplain.
+func (b *IPBaseService) LookupIPExplainAt(ctx context.Context, addr netip.Addr, at time.Time) (*model.IPMetadata, *model.LookupExplain, time.Time, error) {
+	ex := &model.LookupExplain{}
+	meta, dataTime, err := b.lookupAt(ctx, addr, at, ex)
+	return meta, ex, dataTime, err
+}
+
+// lookupAt routes the lookup to the version in effect at the given time, ex is filled when not nil.
+func (b *IPBaseService) lookupAt(ctx context.Context, addr netip.Addr, at time.Time, ex *model.LookupExplain) (*model.IPMetadata, time.Time, error) {
+	current := b.dataTime()
+	switch {
+	case current.IsZero() && b.versions == nil, !current.IsZero() && !at.Before(current):
+		meta, err := b.lookupIP(ctx, addr, ex)
+		return meta, current, err
+	case b.versions == nil:
+		return nil, time.Time{}, fmt.Errorf("%w: %s is before the served base", model.ErrNoBaseVersion, at.Format(time.RFC3339))
+	}
+
+	l, dataTime, release, err := b.versions.Acquire(ctx, at)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer release()
+
+	past := IPBaseService{lookup: l, log: b.log}
+	meta, err := past.lookupIP(ctx, addr, ex)
+	return meta, dataTime, err
+}
+
+// dataTime returns the data time of the served base, zero when unknown.
+func (b *IPBaseService) dataTime() time.Time {
+	report, ok := b.LoadReport()
+	if !ok {
+		return time.Time{}
+	}
+	return report.DataTime()
+}
+
+// Versions - Returns the served base and the past versions, oldest first.
+// Reports false when no past versions are configured.
+func (b *IPBaseService) Versions() ([]model.BaseVersion, bool) {
+	if b.versions == nil {
+		return nil, false
+	}
+
+	list := b.versions.Versions()
+	return append(list, model.BaseVersion{DataTime: b.dataTime(), Current: true, Loaded: true}), true
+}
@@ -0,0 +1,99 @@
+package ipbase_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/eterline/ipcsv2base/internal/infra/log"
+	"github.com/eterline/ipcsv2base/internal/model"
+	"github.com/eterline/ipcsv2base/internal/service/ipbase"
+)
+
+// datedLookuper answers every address with the same country, built at dataTime.
+type datedLookuper struct {
+	country  string
+	dataTime time.Time
+}
+
+func (l datedLookuper) LookupIP(ctx context.Context, addr netip.Addr) (*model.IPMetadata, error) {
+	return &model.IPMetadata{
+		Type:    model.NetworkGlobal,
+		Network: netip.PrefixFrom(addr, addr.BitLen()),
+		Geo:     model.IPGeo{CountryCode: model.GeoCode(l.country)},
+	}, nil
+}
+
+func (l datedLookuper) LoadReport() model.LoadReport {
+	return model.LoadReport{Sources: []model.SourceLoadReport{{File: model.SourceFile{BuildDate: l.dataTime}}}}
+}
+
+// versionList holds past versions, oldest first.
+type versionList []datedLookuper
+
+func (v versionList) Acquire(ctx context.Context, at time.Time) (ipbase.MetaLookuper, time.Time, func(), error) {
+	for i := len(v) - 1; i >= 0; i-- {
+		if !v[i].dataTime.After(at) {
+			return v[i], v[i].dataTime, func() {}, nil
+		}
+	}
+	return nil, time.Time{}, nil, model.ErrNoBaseVersion
+}
+
+func (v versionList) Versions() []model.BaseVersion {
+	list := make([]model.BaseVersion, len(v))
+	for i, l := range v {
+		list[i] = model.BaseVersion{DataTime: l.dataTime}
+	}
+	return list
+}
+
+func TestLookupIPAt(t *testing.T) {
+	logger, err := log.NewZapLoggerWithConfig(io.Discard, "error", false, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 0, 0, 0, 0, time.UTC) }
+	past := versionList{{country: "DE", dataTime: day(1)}, {country: "FR", dataTime: day(8)}}
+
+	tests := []struct {
+		name        string
+		current     datedLookuper
+		versions    ipbase.VersionStore
+		at          time.Time
+		wantCountry string
+		wantTime    time.Time
+		wantErr     error
+	}{
+		{"current base", datedLookuper{"US", day(15)}, past, day(16), "US", day(15), nil},
+		{"past version", datedLookuper{"US", day(15)}, past, day(9), "FR", day(8), nil},
+		{"oldest version", datedLookuper{"US", day(15)}, past, day(1), "DE", day(1), nil},
+		{"before every version", datedLookuper{"US", day(15)}, past, day(0), "", time.Time{}, model.ErrNoBaseVersion},
+		{"without versions", datedLookuper{"US", day(15)}, nil, day(9), "", time.Time{}, model.ErrNoBaseVersion},
+		// a current base without data time can not be ordered among the versions
+		{"undated current base", datedLookuper{"US", time.Time{}}, past, day(9), "FR", day(8), nil},
+		{"undated current base, late time", datedLookuper{"US", time.Time{}}, past, day(20), "FR", day(8), nil},
+		{"undated current base, early time", datedLookuper{"US", time.Time{}}, past, day(0), "", time.Time{}, model.ErrNoBaseVersion},
+		{"undated current base without versions", datedLookuper{"US", time.Time{}}, nil, day(9), "US", time.Time{}, nil},
+	}
+	for _, tt := range tests {
+		srv := ipbase.NewIPBaseService(logger, tt.current, nil, nil, nil, nil, tt.versions)
+
+		meta, dataTime, err := srv.LookupIPAt(context.Background(), netip.MustParseAddr("1.0.0.1"), tt.at)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if string(meta.Geo.CountryCode) != tt.wantCountry || !dataTime.Equal(tt.wantTime) {
+			t.Errorf("%s: answered by %s built %s, want %s built %s",
+				tt.name, meta.Geo.CountryCode, dataTime, tt.wantCountry, tt.wantTime)
+		}
+	}
+}
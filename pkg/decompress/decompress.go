@@ -0,0 +1,256 @@
+package decompress
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	mmaprc "github.com/eterline/ipcsv2base/pkg/mmapread"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Format - Container format of a source stream.
+type Format uint8
+
+const (
+	FormatRaw Format = iota
+	FormatGzip
+	FormatZstd
+	FormatBzip2
+	FormatXz
+	FormatZip
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatGzip:
+		return "gzip"
+	case FormatZstd:
+		return "zstd"
+	case FormatBzip2:
+		return "bzip2"
+	case FormatXz:
+		return "xz"
+	case FormatZip:
+		return "zip"
+	default:
+		return "raw"
+	}
+}
+
+// EntrySep - Separator of an archive path and an entry name, e.g. "base.zip#country.csv".
+const EntrySep = "#"
+
+var magics = []struct {
+	format Format
+	magic  []byte
+}{
+	{FormatGzip, []byte{0x1f, 0x8b}},
+	{FormatZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{FormatBzip2, []byte("BZh")},
+	{FormatXz, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{FormatZip, []byte{'P', 'K', 0x03, 0x04}},
+}
+
+// MagicLen - Number of leading bytes required by Detect.
+const MagicLen = 6
+
+// Detect - Detects the format of a stream by its leading magic bytes.
+func Detect(head []byte) Format {
+	for _, m := range magics {
+		if bytes.HasPrefix(head, m.magic) {
+			return m.format
+		}
+	}
+	return FormatRaw
+}
+
+/*
+Open - Opens a source file and returns a stream of its decompressed content.
+
+	gzip, zstd, bzip2 and xz are detected by magic bytes and decoded on the fly.
+	Zip archives select the entry named after EntrySep ("base.zip#file.csv"),
+	archives with a single file need no entry name. Raw files are read through mmap.
+*/
+func Open(name string) (io.ReadCloser, error) {
+	file, entry := SplitEntry(name)
+
+	src, err := mmaprc.OpenMMapReadCloser(file)
+	if err != nil {
+		return nil, err
+	}
+
+	head := make([]byte, MagicLen)
+	n, _ := src.ReadAt(head, 0)
+
+	format := Detect(head[:n])
+	if entry != "" && format != FormatZip {
+		src.Close()
+		return nil, fmt.Errorf("%s is not a zip archive", file)
+	}
+
+	if format == FormatZip {
+		rc, err := OpenEntry(src, src.Len(), entry)
+		if err != nil {
+			src.Close()
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		return &stream{Reader: rc, closers: []io.Closer{rc, src}}, nil
+	}
+
+	r, closers, err := decoder(src, format)
+	if err != nil {
+		src.Close()
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return &stream{Reader: r, closers: append(closers, src)}, nil
+}
+
+// Wrap - Detects the format of r and returns a stream of its decompressed content.
+// Closing the stream releases decoders only, r stays open. Zip archives are not supported on plain streams.
+func Wrap(r io.Reader) (io.ReadCloser, Format, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(MagicLen)
+
+	format := Detect(head)
+	if format == FormatZip {
+		return nil, format, errors.New("zip archive requires random access")
+	}
+
+	dr, closers, err := decoder(br, format)
+	if err != nil {
+		return nil, format, err
+	}
+	return &stream{Reader: dr, closers: closers}, format, nil
+}
+
+// SplitEntry - Splits "archive.zip#entry" into the archive path and the entry name.
+// Names of existing files and names without EntrySep are returned as is.
+func SplitEntry(name string) (file, entry string) {
+	i := strings.LastIndex(name, EntrySep)
+	if i < 0 {
+		return name, ""
+	}
+
+	if _, err := os.Stat(name); err == nil {
+		return name, ""
+	}
+
+	return name[:i], name[i+len(EntrySep):]
+}
+
+// decoder wraps r with the decoder of the format and returns the decoder closers.
+func decoder(r io.Reader, format Format) (io.Reader, []io.Closer, error) {
+	switch format {
+	case FormatGzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, []io.Closer{zr}, nil
+
+	case FormatZstd:
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, []io.Closer{zr.IOReadCloser()}, nil
+
+	case FormatBzip2:
+		return bzip2.NewReader(r), nil, nil
+
+	case FormatXz:
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return xr, nil, nil
+
+	default:
+		return r, nil, nil
+	}
+}
+
+/*
+OpenEntry - Opens an entry of a zip archive of size bytes read from ra.
+
+	The entry is decompressed when it is compressed itself, an empty entry
+	name selects the single file of the archive.
+*/
+func OpenEntry(ra io.ReaderAt, size int64, entry string) (io.ReadCloser, error) {
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*zip.File
+	for _, f := range zr.File {
+		if !f.FileInfo().IsDir() {
+			files = append(files, f)
+		}
+	}
+
+	var found *zip.File
+
+	switch {
+	case entry != "":
+		for _, f := range files {
+			if f.Name == entry || path.Base(f.Name) == entry {
+				found = f
+				break
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("zip entry %q not found", entry)
+		}
+
+	case len(files) == 1:
+		found = files[0]
+
+	default:
+		names := make([]string, 0, len(files))
+		for _, f := range files {
+			names = append(names, f.Name)
+		}
+		return nil, fmt.Errorf("zip archive has %d entries, select one with %q: %s",
+			len(files), EntrySep, strings.Join(names, ", "))
+	}
+
+	rc, err := found.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	inner, _, err := Wrap(rc)
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("zip entry %q: %w", found.Name, err)
+	}
+
+	return &stream{Reader: inner, closers: []io.Closer{inner, rc}}, nil
+}
+
+// stream - Decompressed reader closing its whole decoder chain.
+type stream struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (s *stream) Close() error {
+	var errs []error
+	for _, c := range s.closers {
+		if err := c.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,242 @@
+package decompress_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eterline/ipcsv2base/pkg/decompress"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const content = "network,country_code\n1.0.0.0/24,AU\n"
+
+// bzip2Content - content compressed by bzip2 -9, the standard library has no bzip2 writer.
+var bzip2Content = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xc8, 0xdb,
+	0xee, 0x60, 0x00, 0x00, 0x0b, 0xdf, 0x80, 0x00, 0x10, 0x00, 0x05, 0xf4,
+	0x00, 0x20, 0x00, 0x02, 0x00, 0x8e, 0x09, 0x96, 0xa0, 0x20, 0x00, 0x31,
+	0x46, 0x8c, 0x81, 0xa3, 0x4c, 0x8d, 0x0a, 0x1a, 0x18, 0x46, 0x86, 0x86,
+	0x8a, 0x87, 0x93, 0x38, 0x94, 0x44, 0xd1, 0x2e, 0xea, 0x0d, 0xb6, 0xe2,
+	0x7b, 0xaf, 0x21, 0x71, 0x70, 0x02, 0xf8, 0xbb, 0x92, 0x29, 0xc2, 0x84,
+	0x86, 0x46, 0xdf, 0x73, 0x00,
+}
+
+func gzipData(t *testing.T, data string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(w, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zstdData(t *testing.T, data string) []byte {
+	t.Helper()
+
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer enc.Close()
+	return enc.EncodeAll([]byte(data), nil)
+}
+
+func xzData(t *testing.T, data string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := xz.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// zipData returns a zip archive of the named entries in the given order, names ending with "/" are directories.
+func zipData(t *testing.T, entries ...[2]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, e := range entries {
+		f, err := w.Create(e[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(f, e[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		head []byte
+		want decompress.Format
+	}{
+		{gzipData(t, content), decompress.FormatGzip},
+		{zstdData(t, content), decompress.FormatZstd},
+		{bzip2Content, decompress.FormatBzip2},
+		{xzData(t, content), decompress.FormatXz},
+		{zipData(t, [2]string{"country.csv", content}), decompress.FormatZip},
+		{[]byte(content), decompress.FormatRaw},
+		{[]byte{0x1f}, decompress.FormatRaw}, // shorter than the gzip magic
+		{nil, decompress.FormatRaw},
+	}
+	for _, tt := range tests {
+		head := tt.head[:min(len(tt.head), decompress.MagicLen)]
+		if got := decompress.Detect(head); got != tt.want {
+			t.Errorf("Detect(% x) = %s, want %s", head, got, tt.want)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"country.csv":     []byte(content),
+		"country.csv.gz":  gzipData(t, content),
+		"country.csv.zst": zstdData(t, content),
+		"country.csv.bz2": bzip2Content,
+		"country.csv.xz":  xzData(t, content),
+		"single.zip":      zipData(t, [2]string{"data/", ""}, [2]string{"data/country.csv", content}),
+		"bundle.zip": zipData(t,
+			[2]string{"GeoLite2-Country-CSV/", ""},
+			[2]string{"GeoLite2-Country-CSV/country.csv", content},
+			[2]string{"GeoLite2-Country-CSV/asn.csv", "network,asn\n"},
+			[2]string{"country.csv.gz", string(gzipData(t, content))},
+		),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr string
+	}{
+		{name: "country.csv", want: content},
+		{name: "country.csv.gz", want: content},
+		{name: "country.csv.zst", want: content},
+		{name: "country.csv.bz2", want: content},
+		{name: "country.csv.xz", want: content},
+		{name: "single.zip", want: content},
+		{name: "single.zip#country.csv", want: content},
+		{name: "bundle.zip#GeoLite2-Country-CSV/asn.csv", want: "network,asn\n"},
+		{name: "bundle.zip#asn.csv", want: "network,asn\n"},
+		{name: "bundle.zip#country.csv.gz", want: content},
+		{name: "bundle.zip", wantErr: "GeoLite2-Country-CSV/country.csv, GeoLite2-Country-CSV/asn.csv, country.csv.gz"},
+		{name: "bundle.zip#city.csv", wantErr: `zip entry "city.csv" not found`},
+		{name: "country.csv.gz#country.csv", wantErr: "is not a zip archive"},
+	}
+	for _, tt := range tests {
+		rc, err := decompress.Open(filepath.Join(dir, tt.name))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Open(%s) error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			if err == nil {
+				rc.Close()
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Open(%s) error = %v", tt.name, err)
+			continue
+		}
+
+		got, err := io.ReadAll(rc)
+		if err != nil {
+			t.Errorf("Open(%s) read error = %v", tt.name, err)
+		}
+		if err := rc.Close(); err != nil {
+			t.Errorf("Open(%s) close error = %v", tt.name, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("Open(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		format  decompress.Format
+		wantErr bool
+	}{
+		{name: "raw", data: []byte(content), format: decompress.FormatRaw},
+		{name: "gzip", data: gzipData(t, content), format: decompress.FormatGzip},
+		{name: "zstd", data: zstdData(t, content), format: decompress.FormatZstd},
+		{name: "bzip2", data: bzip2Content, format: decompress.FormatBzip2},
+		{name: "xz", data: xzData(t, content), format: decompress.FormatXz},
+		{name: "zip", data: zipData(t, [2]string{"country.csv", content}), format: decompress.FormatZip, wantErr: true},
+		{name: "truncated gzip", data: gzipData(t, content)[:8], format: decompress.FormatGzip, wantErr: true},
+	}
+	for _, tt := range tests {
+		rc, format, err := decompress.Wrap(bytes.NewReader(tt.data))
+		if format != tt.format {
+			t.Errorf("%s: format = %s, want %s", tt.name, format, tt.format)
+		}
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || string(got) != content {
+			t.Errorf("%s: read %q, %v, want %q", tt.name, got, err, content)
+		}
+	}
+}
+
+func TestSplitEntry(t *testing.T) {
+	dir := t.TempDir()
+	hashed := filepath.Join(dir, "base#1.csv")
+	if err := os.WriteFile(hashed, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		file, entry string
+	}{
+		{"base.zip#country.csv", "base.zip", "country.csv"},
+		{"base.zip#dir/country.csv", "base.zip", "dir/country.csv"},
+		{"base.zip", "base.zip", ""},
+		{hashed, hashed, ""}, // existing files keep their name
+	}
+	for _, tt := range tests {
+		if file, entry := decompress.SplitEntry(tt.name); file != tt.file || entry != tt.entry {
+			t.Errorf("SplitEntry(%s) = %s, %s, want %s, %s", tt.name, file, entry, tt.file, tt.entry)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package ipsetdata
+
+import (
+	"slices"
+
+	"go4.org/netipx"
+)
+
+/*
+Union - Returns a new prepared set holding the addresses of both sets.
+
+	Where the sets overlap the data of cset is kept. Both sets must be prepared.
+*/
+func (cset *IPContainerSet[T]) Union(other *IPContainerSet[T]) *IPContainerSet[T] {
+	a := cset.segments()
+	return newSegmentSet(mergeSegments(a, subtractSegments(other.segments(), coverage(a))))
+}
+
+// Intersect - Returns a new prepared set of the cset addresses also held by other, with the data of cset.
+func (cset *IPContainerSet[T]) Intersect(other *IPContainerSet[T]) *IPContainerSet[T] {
+	return newSegmentSet(intersectSegments(cset.segments(), coverage(other.segments())))
+}
+
+// Difference - Returns a new prepared set of the cset addresses not held by other.
+func (cset *IPContainerSet[T]) Difference(other *IPContainerSet[T]) *IPContainerSet[T] {
+	return newSegmentSet(subtractSegments(cset.segments(), coverage(other.segments())))
+}
+
+// UnionIPSet - Returns a new prepared set adding the addresses of s missing from cset with value.
+func (cset *IPContainerSet[T]) UnionIPSet(s *netipx.IPSet, value T) *IPContainerSet[T] {
+	a := cset.segments()
+
+	add := make([]container[T], 0, len(s.Ranges()))
+	for _, r := range ipSetCoverage(s) {
+		add = append(add, container[T]{rng: r, data: value})
+	}
+	return newSegmentSet(mergeSegments(a, subtractSegments(add, coverage(a))))
+}
+
+// IntersectIPSet - Returns a new prepared set of the cset addresses held by s.
+func (cset *IPContainerSet[T]) IntersectIPSet(s *netipx.IPSet) *IPContainerSet[T] {
+	return newSegmentSet(intersectSegments(cset.segments(), ipSetCoverage(s)))
+}
+
+// DifferenceIPSet - Returns a new prepared set of the cset addresses not held by s.
+func (cset *IPContainerSet[T]) DifferenceIPSet(s *netipx.IPSet) *IPContainerSet[T] {
+	return newSegmentSet(subtractSegments(cset.segments(), ipSetCoverage(s)))
+}
+
+/*
+segments - Returns disjoint sorted ranges of the prepared set.
+
+	Nested or overlapping ranges are split, every address keeps the data of
+	the narrowest range holding it, the latest starting one for partial overlaps.
+*/
+func (cset *IPContainerSet[T]) segments() []container[T] {
+	if len(cset.set4) == 0 && cset.disjoint {
+		return cset.set
+	}
+
+	sorted := make([]container[T], 0, cset.Size())
+	cset.each(func(_ int, c container[T]) bool {
+		sorted = append(sorted, c)
+		return true
+	})
+	if cset.disjoint {
+		return sorted
+	}
+
+	// outer ranges first when ranges share the start, equal ranges keep the stored order
+	slices.SortStableFunc(sorted, func(a, b container[T]) int {
+		if c := a.rng.start.Compare(b.rng.start); c != 0 {
+			return c
+		}
+		return b.rng.end.Compare(a.rng.end)
+	})
+
+	out := make([]container[T], 0, len(sorted))
+	ownedSegments(sorted, func(rng rangeUint128t, data T) {
+		out = append(out, container[T]{rng: rng, data: data})
+	})
+	return out
+}
+
+// ownedSegments splits sorted ranges into non-overlapping segments owned by the innermost open range.
+func ownedSegments[T comparable](sorted []container[T], emit func(rangeUint128t, T)) {
+	var (
+		stack []*container[T]
+		pos   uint128t // first address not emitted yet
+		done  bool     // the last address was emitted
+	)
+
+	// flush emits open ranges up to the address before limit, all of them without a limit
+	flush := func(limit uint128t, all bool) {
+		for len(stack) > 0 && !done {
+			top := stack[len(stack)-1]
+
+			if all || top.rng.end.Less(limit) {
+				if !top.rng.end.Less(pos) {
+					emit(rangeUint128t{start: pos, end: top.rng.end}, top.data)
+					next, ok := top.rng.end.Inc()
+					if !ok {
+						done = true
+						return
+					}
+					pos = next
+				}
+				stack = stack[:len(stack)-1]
+				continue
+			}
+
+			if pos.Less(limit) {
+				last, _ := limit.Dec()
+				emit(rangeUint128t{start: pos, end: last}, top.data)
+				pos = limit
+			}
+			return
+		}
+	}
+
+	for i := range sorted {
+		c := &sorted[i]
+		flush(c.rng.start, false)
+		if done {
+			return
+		}
+
+		stack = append(stack, c)
+		if pos.Less(c.rng.start) {
+			pos = c.rng.start
+		}
+	}
+	flush(uint128t{}, true)
+}
+
+// coverage returns the ranges of disjoint sorted segments.
+func coverage[T comparable](segs []container[T]) []rangeUint128t {
+	out := make([]rangeUint128t, len(segs))
+	for i, c := range segs {
+		out[i] = c.rng
+	}
+	return out
+}
+
+// ipSetCoverage returns the ranges of s sorted in the uint128 order, IPv4 ranges are mapped.
+func ipSetCoverage(s *netipx.IPSet) []rangeUint128t {
+	ranges := s.Ranges()
+
+	out := make([]rangeUint128t, len(ranges))
+	for i, r := range ranges {
+		out[i] = rangeUint128t{start: Addr2Uint128t(r.From()), end: Addr2Uint128t(r.To())}
+	}
+	slices.SortFunc(out, func(a, b rangeUint128t) int {
+		return a.start.Compare(b.start)
+	})
+	return out
+}
+
+// intersectSegments returns the parts of disjoint sorted segments inside disjoint sorted cov.
+func intersectSegments[T comparable](segs []container[T], cov []rangeUint128t) []container[T] {
+	var (
+		out []container[T]
+		j   int
+	)
+
+	for _, c := range segs {
+		for j < len(cov) && cov[j].end.Less(c.rng.start) {
+			j++
+		}
+
+		for k := j; k < len(cov) && !c.rng.end.Less(cov[k].start); k++ {
+			rng := c.rng
+			if rng.start.Less(cov[k].start) {
+				rng.start = cov[k].start
+			}
+			if cov[k].end.Less(rng.end) {
+				rng.end = cov[k].end
+			}
+			out = append(out, container[T]{rng: rng, data: c.data})
+		}
+	}
+	return out
+}
+
+// subtractSegments returns the parts of disjoint sorted segments outside disjoint sorted cov.
+func subtractSegments[T comparable](segs []container[T], cov []rangeUint128t) []container[T] {
+	var (
+		out []container[T]
+		j   int
+	)
+
+	for _, c := range segs {
+		for j < len(cov) && cov[j].end.Less(c.rng.start) {
+			j++
+		}
+
+		start, alive := c.rng.start, true
+		for k := j; k < len(cov) && !c.rng.end.Less(cov[k].start); k++ {
+			if start.Less(cov[k].start) {
+				end, _ := cov[k].start.Dec()
+				out = append(out, container[T]{rng: rangeUint128t{start: start, end: end}, data: c.data})
+			}
+			if !cov[k].end.Less(c.rng.end) {
+				alive = false
+				break
+			}
+			start, _ = cov[k].end.Inc() // below c.rng.end, no overflow
+		}
+
+		if alive {
+			out = append(out, container[T]{rng: rangeUint128t{start: start, end: c.rng.end}, data: c.data})
+		}
+	}
+	return out
+}
+
+// mergeSegments merges two disjoint sorted segment lists not overlapping each other.
+func mergeSegments[T comparable](a, b []container[T]) []container[T] {
+	out := make([]container[T], 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		if a[0].rng.start.Less(b[0].rng.start) {
+			out, a = append(out, a[0]), a[1:]
+		} else {
+			out, b = append(out, b[0]), b[1:]
+		}
+	}
+	out = append(out, a...)
+	return append(out, b...)
+}
+
+// IPv4-mapped block boundaries, IPv4 ranges are stored inside it.
+var (
+	mapped4Start = uint128t{lo: 0xffff_0000_0000}
+	mapped4End   = uint128t{lo: 0xffff_ffff_ffff}
+)
+
+// newSegmentSet - Builds a prepared set of disjoint sorted segments, coalescing adjacent ones with equal data.
+func newSegmentSet[T comparable](segs []container[T]) *IPContainerSet[T] {
+	cset := &IPContainerSet[T]{disjoint: true}
+	for _, c := range coalesceSegments(segs) {
+		cset.add(c)
+	}
+
+	cset.set = slices.Clip(cset.set)
+	cset.set4 = slices.Clip(cset.set4)
+	return cset
+}
+
+/*
+coalesceSegments - Coalesces adjacent disjoint sorted segments with equal data.
+
+	IPv6 segments spanning the IPv4-mapped block are split at its boundaries,
+	so every returned range converts to a valid single family netipx.IPRange.
+*/
+func coalesceSegments[T comparable](segs []container[T]) []container[T] {
+	set := make([]container[T], 0, len(segs))
+
+	add := func(c container[T]) {
+		if n := len(set); n > 0 {
+			last := &set[n-1]
+			next, ok := last.rng.end.Inc()
+			if ok && next == c.rng.start && last.data == c.data && last.rng.end.is4() == c.rng.start.is4() {
+				last.rng.end = c.rng.end
+				return
+			}
+		}
+		set = append(set, c)
+	}
+
+	for _, c := range segs {
+		if c.rng.start.Less(mapped4Start) && !c.rng.end.Less(mapped4Start) {
+			head := c
+			head.rng.end, _ = mapped4Start.Dec()
+			add(head)
+			c.rng.start = mapped4Start
+		}
+		if !mapped4End.Less(c.rng.start) && mapped4End.Less(c.rng.end) {
+			head := c
+			head.rng.end = mapped4End
+			add(head)
+			c.rng.start, _ = mapped4End.Inc()
+		}
+		add(c)
+	}
+
+	return set
+}
@@ -0,0 +1,296 @@
+package ipsetdata_test
+
+import (
+	"math/rand"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/eterline/ipcsv2base/pkg/ipsetdata"
+	"go4.org/netipx"
+)
+
+// newRandomSet returns a prepared set of ranges valued by their position plus base, with the reference set of its addresses.
+func newRandomSet(r *rand.Rand, n, base int) (*ipsetdata.IPContainerSet[int], *netipx.IPSet, []netipx.IPRange) {
+	ranges := randomRanges(r, n)
+
+	set := ipsetdata.NewIPContainerSet[int](n)
+	var b netipx.IPSetBuilder
+	for i, rng := range ranges {
+		set.AddIPRange(rng, base+i)
+		addUnmapped(&b, rng)
+	}
+	set.Prepare()
+
+	ref, err := b.IPSet()
+	if err != nil {
+		panic(err)
+	}
+	return set, ref, ranges
+}
+
+// addUnmapped adds a range as the set stores it, parts inside the IPv4-mapped block as IPv4.
+func addUnmapped(b *netipx.IPSetBuilder, rng netipx.IPRange) {
+	mapped := netipx.RangeOfPrefix(netip.MustParsePrefix("::ffff:0:0/96"))
+	if !rng.Overlaps(mapped) {
+		b.AddRange(rng)
+		return
+	}
+
+	if rng.From().Less(mapped.From()) {
+		b.AddRange(netipx.IPRangeFrom(rng.From(), mapped.From().Prev()))
+	}
+	if mapped.To().Less(rng.To()) {
+		b.AddRange(netipx.IPRangeFrom(mapped.To().Next(), rng.To()))
+	}
+
+	from, to := rng.From(), rng.To()
+	if from.Less(mapped.From()) {
+		from = mapped.From()
+	}
+	if mapped.To().Less(to) {
+		to = mapped.To()
+	}
+	b.AddRange(netipx.IPRangeFrom(from.Unmap(), to.Unmap()))
+}
+
+// segmentsSet returns the addresses of the set segments, failing on unsorted or overlapping segments.
+func segmentsSet(t *testing.T, set *ipsetdata.IPContainerSet[int]) *netipx.IPSet {
+	t.Helper()
+
+	var (
+		b    netipx.IPSetBuilder
+		prev netipx.IPRange
+	)
+	for rng := range set.Segments() {
+		if !rng.IsValid() {
+			t.Fatalf("invalid segment %s", rng)
+		}
+		if prev.IsValid() && rng.From().Unmap().Compare(prev.To().Unmap()) <= 0 && rng.From().Is4() == prev.To().Is4() {
+			t.Fatalf("segment %s does not follow %s", rng, prev)
+		}
+		b.AddRange(rng)
+		prev = rng
+	}
+
+	s, err := b.IPSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSetAlgebra(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+
+	for round := range 30 {
+		a, refA, rangesA := newRandomSet(r, 150, 0)
+		b, refB, rangesB := newRandomSet(r, 150, 1000)
+		probes := probeAddrs(append(slices.Clone(rangesA), rangesB...))
+
+		// value of an address per set, as resolved by Get
+		valueOf := func(set *ipsetdata.IPContainerSet[int], addr netip.Addr) (int, bool) {
+			_, v, ok := set.Get(addr)
+			return v, ok
+		}
+
+		var ub, ib, db netipx.IPSetBuilder
+		ub.AddSet(refA)
+		ub.AddSet(refB)
+		ib.AddSet(refA)
+		ib.Intersect(refB)
+		db.AddSet(refA)
+		db.RemoveSet(refB)
+		refUnion, _ := ub.IPSet()
+		refIntersect, _ := ib.IPSet()
+		refDifference, _ := db.IPSet()
+
+		const extra = -1
+		tests := []struct {
+			name string
+			got  *ipsetdata.IPContainerSet[int]
+			ref  *netipx.IPSet
+			want func(addr netip.Addr) (int, bool) // expected value of an address of the result
+		}{
+			{"Union", a.Union(b), refUnion, func(addr netip.Addr) (int, bool) {
+				if v, ok := valueOf(a, addr); ok {
+					return v, true
+				}
+				return valueOf(b, addr)
+			}},
+			{"Intersect", a.Intersect(b), refIntersect, func(addr netip.Addr) (int, bool) {
+				return valueOf(a, addr)
+			}},
+			{"Difference", a.Difference(b), refDifference, func(addr netip.Addr) (int, bool) {
+				return valueOf(a, addr)
+			}},
+			{"UnionIPSet", a.UnionIPSet(refB, extra), refUnion, func(addr netip.Addr) (int, bool) {
+				if v, ok := valueOf(a, addr); ok {
+					return v, true
+				}
+				return extra, true
+			}},
+			{"IntersectIPSet", a.IntersectIPSet(refB), refIntersect, func(addr netip.Addr) (int, bool) {
+				return valueOf(a, addr)
+			}},
+			{"DifferenceIPSet", a.DifferenceIPSet(refB), refDifference, func(addr netip.Addr) (int, bool) {
+				return valueOf(a, addr)
+			}},
+		}
+
+		for _, tt := range tests {
+			if got := segmentsSet(t, tt.got); !got.Equal(tt.ref) {
+				t.Fatalf("round %d: %s covers %v, want %v", round, tt.name, got.Ranges(), tt.ref.Ranges())
+			}
+			if got := tt.got.IPSet(); !got.Equal(tt.ref) {
+				t.Fatalf("round %d: %s IPSet differs from its segments", round, tt.name)
+			}
+
+			for _, addr := range probes {
+				if !addr.IsValid() || !tt.ref.Contains(addr.Unmap()) {
+					continue
+				}
+				v, ok := valueOf(tt.got, addr)
+				want, _ := tt.want(addr)
+				if !ok || v != want {
+					t.Fatalf("round %d: %s value of %s = %d, %v; want %d", round, tt.name, addr, v, ok, want)
+				}
+			}
+		}
+	}
+}
+
+func TestSegments(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+
+	for round := range 30 {
+		set, ref, ranges := newRandomSet(r, 200, 0)
+
+		if got := segmentsSet(t, set); !got.Equal(ref) {
+			t.Fatalf("round %d: segments cover %v, want %v", round, got.Ranges(), ref.Ranges())
+		}
+		if got := set.IPSet(); !got.Equal(ref) {
+			t.Fatalf("round %d: IPSet covers %v, want %v", round, got.Ranges(), ref.Ranges())
+		}
+
+		// every address keeps the value of the narrowest stored range holding it
+		for _, addr := range probeAddrs(ranges) {
+			if !addr.IsValid() || !ref.Contains(addr.Unmap()) {
+				continue
+			}
+
+			want, size := -1, ^uint64(0)
+			for i, rng := range ranges {
+				if !holds(rng, addr) {
+					continue
+				}
+				if n := rangeSize(rng); n < size || (n == size && i > want) {
+					want, size = i, n
+				}
+			}
+			if narrowest := nested(ranges, want, addr); !narrowest {
+				continue // partial overlaps resolve by start, not by size
+			}
+
+			for rng, v := range set.Segments() {
+				if rng.Contains(addr.Unmap()) {
+					if ranges[v] != ranges[want] { // equal ranges may resolve to any of them
+						t.Fatalf("round %d: segment %s of %s holds %d, want %d (%s)", round, rng, addr, v, want, ranges[want])
+					}
+					break
+				}
+			}
+		}
+	}
+}
+
+// nested reports whether every range holding addr nests with range i, so the narrowest one is defined.
+func nested(ranges []netipx.IPRange, i int, addr netip.Addr) bool {
+	in := func(a, b netipx.IPRange) bool {
+		return b.From().Compare(a.From()) <= 0 && a.To().Compare(b.To()) <= 0
+	}
+	for _, rng := range ranges {
+		if holds(rng, addr) && !in(ranges[i], rng) {
+			return false
+		}
+	}
+	return true
+}
+
+// holds reports whether a range holds the address as the set stores it, IPv6 ranges spanning the IPv4-mapped block hold IPv4 addresses.
+func holds(rng netipx.IPRange, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return rng.Contains(addr) || rng.Contains(mappedAddr(addr))
+}
+
+// rangeSize returns the number of addresses of a range, saturated at the uint64 maximum.
+func rangeSize(rng netipx.IPRange) uint64 {
+	pfx := rng.Prefixes()
+	var n uint64
+	for _, p := range pfx {
+		host := p.Addr().BitLen() - p.Bits()
+		if host >= 64 {
+			return ^uint64(0)
+		}
+		n += 1 << host
+	}
+	return n
+}
+
+func TestOverlapping(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+
+	for round := range 30 {
+		set, _, ranges := newRandomSet(r, 200, 0)
+
+		for _, addr := range probeAddrs(ranges)[:60] {
+			if !addr.IsValid() {
+				continue
+			}
+			addr = addr.Unmap()
+			pfx := netip.PrefixFrom(addr, addr.BitLen()-r.Intn(12)).Masked()
+			q := netipx.RangeOfPrefix(pfx)
+
+			var want []int
+			for i, rng := range ranges {
+				if rng.From().Is4() == pfx.Addr().Is4() && rng.Overlaps(q) || crossesInto(rng, q) {
+					want = append(want, i)
+				}
+			}
+
+			var (
+				got  []int
+				prev netip.Addr
+			)
+			for rng, v := range set.Overlapping(pfx) {
+				if prev.IsValid() && mappedAddr(rng.From()).Less(prev) {
+					t.Fatalf("round %d: Overlapping(%s) yields %s out of start order", round, pfx, rng)
+				}
+				prev = mappedAddr(rng.From())
+				got = append(got, v)
+			}
+
+			slices.Sort(got)
+			if !slices.Equal(got, want) {
+				t.Fatalf("round %d: Overlapping(%s) = %v, want %v", round, pfx, got, want)
+			}
+		}
+	}
+}
+
+// crossesInto reports whether an IPv6 range spanning the IPv4-mapped block overlaps the IPv4 range q.
+func crossesInto(rng, q netipx.IPRange) bool {
+	if rng.From().Is4() || !q.From().Is4() {
+		return false
+	}
+	from, to := mappedAddr(q.From()), mappedAddr(q.To())
+	return rng.From().Compare(to) <= 0 && from.Compare(rng.To()) <= 0
+}
+
+// mappedAddr returns IPv4 addresses in the IPv4-mapped form, so both families order in one space.
+func mappedAddr(a netip.Addr) netip.Addr {
+	if a.Is4() {
+		return netip.AddrFrom16(a.As16())
+	}
+	return a
+}
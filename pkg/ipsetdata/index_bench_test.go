@@ -0,0 +1,140 @@
+package ipsetdata_test
+
+import (
+	"math/rand"
+	"net/netip"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/eterline/ipcsv2base/pkg/ipsetdata"
+)
+
+const (
+	benchRanges  = 1 << 19
+	benchQueries = 1 << 16
+)
+
+var benchIndexes = []struct {
+	name string
+	kind ipsetdata.IndexKind
+}{
+	{"sorted", ipsetdata.IndexSorted},
+	{"poptrie", ipsetdata.IndexPoptrie},
+}
+
+// benchPrefixes returns disjoint random prefixes shaped like a country base, sorted by address.
+func benchPrefixes(v6 bool) []netip.Prefix {
+	r := rand.New(rand.NewSource(1))
+
+	cands := make([]netip.Prefix, 0, benchRanges)
+	for range benchRanges {
+		if v6 {
+			var a [16]byte
+			a[0] = 0x20
+			r.Read(a[1:8])
+			cands = append(cands, netip.PrefixFrom(netip.AddrFrom16(a), 32+r.Intn(17)).Masked())
+		} else {
+			var a [4]byte
+			r.Read(a[:])
+			cands = append(cands, netip.PrefixFrom(netip.AddrFrom4(a), 16+r.Intn(13)).Masked())
+		}
+	}
+	slices.SortFunc(cands, func(a, b netip.Prefix) int {
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c
+		}
+		return a.Bits() - b.Bits()
+	})
+
+	// a prefix overlapping a kept one lies inside the last kept
+	out := cands[:0]
+	for _, pfx := range cands {
+		if n := len(out); n > 0 && out[n-1].Overlaps(pfx) {
+			continue
+		}
+		out = append(out, pfx)
+	}
+	return out
+}
+
+// benchQueryAddrs returns addresses inside and around the prefixes.
+func benchQueryAddrs(prefixes []netip.Prefix) []netip.Addr {
+	r := rand.New(rand.NewSource(2))
+
+	out := make([]netip.Addr, benchQueries)
+	for i := range out {
+		a := prefixes[r.Intn(len(prefixes))].Addr().AsSlice()
+		a[len(a)-1] ^= byte(r.Intn(256))
+		a[len(a)-3] ^= byte(r.Intn(4))
+		out[i], _ = netip.AddrFromSlice(a)
+	}
+	return out
+}
+
+func newBenchSet(kind ipsetdata.IndexKind, prefixes []netip.Prefix) *ipsetdata.IPContainerSet[uint32] {
+	set := ipsetdata.NewIPContainerSet[uint32](len(prefixes), ipsetdata.WithIndex(kind))
+	for i, pfx := range prefixes {
+		set.AddPrefix(pfx, uint32(i))
+	}
+	set.Prepare()
+	return set
+}
+
+func benchFamilies(b *testing.B, fn func(b *testing.B, kind ipsetdata.IndexKind, prefixes []netip.Prefix)) {
+	for _, fam := range []struct {
+		name string
+		v6   bool
+	}{{"v4", false}, {"v6", true}} {
+		prefixes := benchPrefixes(fam.v6)
+		for _, idx := range benchIndexes {
+			b.Run(fam.name+"/"+idx.name, func(b *testing.B) {
+				fn(b, idx.kind, prefixes)
+			})
+		}
+	}
+}
+
+// BenchmarkIndexLookup - Get latency per index.
+func BenchmarkIndexLookup(b *testing.B) {
+	benchFamilies(b, func(b *testing.B, kind ipsetdata.IndexKind, prefixes []netip.Prefix) {
+		set := newBenchSet(kind, prefixes)
+		queries := benchQueryAddrs(prefixes)
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			set.Get(queries[i&(benchQueries-1)])
+		}
+	})
+}
+
+// BenchmarkIndexBuild - Prepare time per index.
+func BenchmarkIndexBuild(b *testing.B) {
+	benchFamilies(b, func(b *testing.B, kind ipsetdata.IndexKind, prefixes []netip.Prefix) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			newBenchSet(kind, prefixes)
+		}
+	})
+}
+
+// BenchmarkIndexMemory - Live heap of a prepared set per index, reported as heap-bytes.
+func BenchmarkIndexMemory(b *testing.B) {
+	benchFamilies(b, func(b *testing.B, kind ipsetdata.IndexKind, prefixes []netip.Prefix) {
+		var heap uint64
+		for i := 0; i < b.N; i++ {
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+
+			set := newBenchSet(kind, prefixes)
+
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			heap = after.HeapAlloc - before.HeapAlloc
+			runtime.KeepAlive(set)
+		}
+		b.ReportMetric(float64(heap), "heap-bytes")
+	})
+}
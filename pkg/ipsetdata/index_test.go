@@ -0,0 +1,134 @@
+package ipsetdata_test
+
+import (
+	"math/rand"
+	"net/netip"
+	"testing"
+
+	"github.com/eterline/ipcsv2base/pkg/ipsetdata"
+	"go4.org/netipx"
+)
+
+func TestGetNestedRanges(t *testing.T) {
+	for _, idx := range benchIndexes {
+		t.Run(idx.name, func(t *testing.T) {
+			set := ipsetdata.NewIPContainerSet[string](0, ipsetdata.WithIndex(idx.kind))
+			set.AddPrefix(netip.MustParsePrefix("1.0.5.0/24"), "inner")
+			set.AddPrefix(netip.MustParsePrefix("1.0.0.0/16"), "outer")
+			set.AddPrefix(netip.MustParsePrefix("2001:db8::/32"), "outer6")
+			set.AddPrefix(netip.MustParsePrefix("2001:db8:5::/48"), "inner6")
+			set.Prepare()
+
+			tests := []struct {
+				addr string
+				pfx  string
+				data string
+				ok   bool
+			}{
+				{"1.0.5.1", "1.0.5.0/24", "inner", true},
+				{"1.0.200.1", "1.0.0.0/16", "outer", true},
+				{"1.0.0.0", "1.0.0.0/16", "outer", true},
+				{"::ffff:1.0.200.1", "1.0.0.0/16", "outer", true},
+				{"1.1.0.0", "", "", false},
+				{"2001:db8:5::1", "2001:db8:5::/48", "inner6", true},
+				{"2001:db8:ffff::1", "2001:db8::/32", "outer6", true},
+				{"2001:db9::", "", "", false},
+			}
+			for _, tt := range tests {
+				pfx, data, ok := set.Get(netip.MustParseAddr(tt.addr))
+				if ok != tt.ok || data != tt.data || (ok && pfx.String() != tt.pfx) {
+					t.Errorf("Get(%s) = %s, %q, %v; want %s, %q, %v", tt.addr, pfx, data, ok, tt.pfx, tt.data, tt.ok)
+				}
+			}
+		})
+	}
+}
+
+// randomRanges returns overlapping ranges of both families, some nested, some crossing the IPv4-mapped block.
+func randomRanges(r *rand.Rand, n int) []netipx.IPRange {
+	out := make([]netipx.IPRange, 0, n)
+	for range n {
+		switch r.Intn(4) {
+		case 0: // IPv4 prefix in a small space, so prefixes nest
+			a := netip.AddrFrom4([4]byte{10, byte(r.Intn(4)), byte(r.Intn(256)), byte(r.Intn(256))})
+			out = append(out, netipx.RangeOfPrefix(netip.PrefixFrom(a, 12+r.Intn(21)).Masked()))
+		case 1: // IPv4 range, partially overlapping others
+			from := netip.AddrFrom4([4]byte{10, byte(r.Intn(4)), byte(r.Intn(256)), byte(r.Intn(256))})
+			to := from
+			for range r.Intn(2000) {
+				to = to.Next()
+			}
+			out = append(out, netipx.IPRangeFrom(from, to))
+		case 2: // IPv6 prefix
+			var a [16]byte
+			a[0], a[1], a[2] = 0x20, 0x01, byte(r.Intn(4))
+			a[3] = byte(r.Intn(256))
+			out = append(out, netipx.RangeOfPrefix(netip.PrefixFrom(netip.AddrFrom16(a), 16+r.Intn(25)).Masked()))
+		default: // IPv6 range around the IPv4-mapped block
+			from := netip.MustParseAddr("::fffe:ffff:ff00")
+			to := netip.MustParseAddr("::ffff:10.0.0.0")
+			if r.Intn(2) == 0 {
+				from, to = netip.MustParseAddr("::ffff:10.3.255.0"), netip.MustParseAddr("::1:0:0:ff")
+			}
+			out = append(out, netipx.IPRangeFrom(from, to))
+		}
+	}
+	return out
+}
+
+// probeAddrs returns the bounds of every range and their neighbours.
+func probeAddrs(ranges []netipx.IPRange) []netip.Addr {
+	var out []netip.Addr
+	for _, rng := range ranges {
+		for _, a := range []netip.Addr{rng.From(), rng.To()} {
+			out = append(out, a, a.Next(), a.Prev())
+		}
+	}
+	return out
+}
+
+func TestIndexesAgree(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for round := range 20 {
+		ranges := randomRanges(r, 300)
+
+		sets := make([]*ipsetdata.IPContainerSet[int], len(benchIndexes))
+		for i, idx := range benchIndexes {
+			sets[i] = ipsetdata.NewIPContainerSet[int](len(ranges), ipsetdata.WithIndex(idx.kind))
+			for j, rng := range ranges {
+				sets[i].AddIPRange(rng, j)
+			}
+			sets[i].Prepare()
+		}
+
+		type segment struct {
+			rng  netipx.IPRange
+			data int
+		}
+		var segs []segment
+		for rng, data := range sets[0].Segments() {
+			segs = append(segs, segment{rng, data})
+		}
+
+		for _, addr := range probeAddrs(ranges) {
+			if !addr.IsValid() {
+				continue
+			}
+			want, wantOK := -1, false
+			for _, s := range segs {
+				if s.rng.Contains(addr.Unmap()) {
+					want, wantOK = s.data, true
+					break
+				}
+			}
+
+			for i, set := range sets {
+				_, data, ok := set.Get(addr)
+				if ok != wantOK || (ok && data != want) {
+					t.Fatalf("round %d: %s Get(%s) = %d, %v; Segments hold %d, %v", round, benchIndexes[i].name, addr, data, ok, want, wantOK)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package ipsetdata
+
+import (
+	"iter"
+	"net/netip"
+	"sort"
+
+	"go4.org/netipx"
+)
+
+/*
+All - Iterates over stored ranges and their data in start address order.
+
+	The set must be prepared and not modified while iterating.
+*/
+func (cset *IPContainerSet[T]) All() iter.Seq2[netipx.IPRange, T] {
+	return func(yield func(netipx.IPRange, T) bool) {
+		cset.each(func(_ int, c container[T]) bool {
+			return yield(c.rng.ToIPRange(), c.data)
+		})
+	}
+}
+
+/*
+Overlapping - Iterates over stored ranges overlapping the prefix in start address order.
+
+	Ranges are yielded whole, not clipped to the prefix.
+*/
+func (cset *IPContainerSet[T]) Overlapping(pfx netip.Prefix) iter.Seq2[netipx.IPRange, T] {
+	return func(yield func(netipx.IPRange, T) bool) {
+		if !pfx.IsValid() {
+			return
+		}
+		q := rangeOfPrefix(pfx)
+
+		// ranges past j start after the prefix
+		first6, j6 := cset.overlapping6(q)
+		first4, j4 := cset.overlapping4(q)
+
+		// both runs are in start order, merged like each
+		for first6 < j6 || first4 < j4 {
+			var c container[T]
+			if first4 < j4 && (first6 == j6 || cset.set4[first4].widen().rng.start.Less(cset.set[first6].rng.start)) {
+				c = cset.set4[first4].widen()
+				first4++
+			} else {
+				c = cset.set[first6]
+				first6++
+			}
+
+			if c.rng.end.Less(q.start) {
+				continue
+			}
+			if !yield(c.rng.ToIPRange(), c.data) {
+				return
+			}
+		}
+	}
+}
+
+// overlapping6 returns the run of IPv6 ranges that may overlap q.
+func (cset *IPContainerSet[T]) overlapping6(q rangeUint128t) (first, j int) {
+	j = sort.Search(len(cset.set), func(i int) bool {
+		return q.end.Less(cset.set[i].rng.start)
+	})
+
+	first = j
+	if cset.disjoint {
+		// ends grow with starts, the overlapping ranges are a run before j
+		for first > 0 && !cset.set[first-1].rng.end.Less(q.start) {
+			first--
+		}
+		return first, j
+	}
+
+	maxEnd := cset.runningMaxEnd().v6
+	for first > 0 && !maxEnd[first-1].Less(q.start) {
+		first--
+	}
+	return first, j
+}
+
+// overlapping4 returns the run of IPv4 ranges that may overlap q.
+func (cset *IPContainerSet[T]) overlapping4(q rangeUint128t) (first, j int) {
+	if q.end.Less(mapped4Start) || mapped4End.Less(q.start) {
+		return 0, 0
+	}
+
+	// q clipped to the IPv4-mapped block
+	start, end := uint32(0), uint32(0xffff_ffff)
+	if mapped4Start.Less(q.start) {
+		start = uint32(q.start.lo)
+	}
+	if q.end.Less(mapped4End) {
+		end = uint32(q.end.lo)
+	}
+
+	j = sort.Search(len(cset.set4), func(i int) bool {
+		return end < cset.set4[i].start
+	})
+
+	first = j
+	if cset.disjoint {
+		for first > 0 && cset.set4[first-1].end >= start {
+			first--
+		}
+		return first, j
+	}
+
+	maxEnd := cset.runningMaxEnd().v4
+	for first > 0 && maxEnd[first-1] >= start {
+		first--
+	}
+	return first, j
+}
+
+// runningEnds - Running maximum of range ends per address family.
+type runningEnds struct {
+	v6 []uint128t
+	v4 []uint32
+}
+
+// runningMaxEnd returns the maximum range end of every set prefix, built on first use.
+func (cset *IPContainerSet[T]) runningMaxEnd() *runningEnds {
+	if p := cset.maxEnd.Load(); p != nil {
+		return p
+	}
+
+	ends := &runningEnds{
+		v6: make([]uint128t, len(cset.set)),
+		v4: make([]uint32, len(cset.set4)),
+	}
+
+	var m uint128t
+	for i, c := range cset.set {
+		if m.Less(c.rng.end) {
+			m = c.rng.end
+		}
+		ends.v6[i] = m
+	}
+
+	var m4 uint32
+	for i, c := range cset.set4 {
+		m4 = max(m4, c.end)
+		ends.v4[i] = m4
+	}
+
+	cset.maxEnd.Store(ends)
+	return ends
+}
+
+/*
+Segments - Iterates over disjoint ranges of the set with their data in address order.
+
+	Nested ranges are resolved to the narrowest one, adjacent ranges with
+	equal data are merged.
+*/
+func (cset *IPContainerSet[T]) Segments() iter.Seq2[netipx.IPRange, T] {
+	return func(yield func(netipx.IPRange, T) bool) {
+		for _, c := range coalesceSegments(cset.segments()) {
+			if !yield(c.rng.ToIPRange(), c.data) {
+				return
+			}
+		}
+	}
+}
+
+// AllPrefixes - Iterates over the minimal CIDRs of Segments with their data.
+func (cset *IPContainerSet[T]) AllPrefixes() iter.Seq2[netip.Prefix, T] {
+	return func(yield func(netip.Prefix, T) bool) {
+		var buf []netip.Prefix
+		for rng, data := range cset.Segments() {
+			buf = rng.AppendPrefixes(buf[:0])
+			for _, p := range buf {
+				if !yield(p, data) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Prefixes - Returns the minimal CIDR list covering the set, data is ignored.
+func (cset *IPContainerSet[T]) Prefixes() []netip.Prefix {
+	return cset.IPSet().Prefixes()
+}
+
+/*
+IPSet - Returns the addresses covered by the set.
+
+	Built from Segments, so ranges spanning the IPv4-mapped block are split
+	into valid single family ranges instead of being dropped.
+*/
+func (cset *IPContainerSet[T]) IPSet() *netipx.IPSet {
+	var b netipx.IPSetBuilder
+	for rng := range cset.Segments() {
+		b.AddRange(rng)
+	}
+
+	s, _ := b.IPSet() // segments are valid by construction
+	return s
+}
@@ -0,0 +1,218 @@
+package ipsetdata
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"net/netip"
+	"slices"
+)
+
+// Key bits consumed per trie level and by the direct table in front of the root.
+const (
+	poptrieStride = 6
+	poptrieDirect = 16
+)
+
+// directLeaf - Flag of direct table entries holding a leaf instead of a node index.
+const directLeaf = 1 << 31
+
+/*
+popTrie - Multibit trie compressed with population counts (poptrie).
+
+	The first 16 key bits index a direct table of leaves and top nodes. Every
+	node covers 64 children of the next 6 key bits. vector marks the children
+	that are internal nodes, stored contiguously from base1. Other children
+	are leaves, runs of equal leaves are stored once from base0 and leafvec
+	marks the first child of every run. Keys are left aligned, IPv4 keys use
+	the top 32 bits of hi.
+*/
+type popTrie struct {
+	direct []uint32 // directLeaf with the leaf plus one, or a node index
+	nodes  []popNode
+	leaves []int32 // container index, -1 for addresses outside the set
+}
+
+type popNode struct {
+	vector  uint64
+	leafvec uint64
+	base0   uint32
+	base1   uint32
+}
+
+// lookup4 returns the leaf of a left aligned IPv4 key.
+func (t *popTrie) lookup4(key uint64) int32 {
+	d := t.direct[key>>(64-poptrieDirect)]
+	if d&directLeaf != 0 {
+		return int32(d&^directLeaf) - 1
+	}
+	n := &t.nodes[d]
+	key <<= poptrieDirect
+
+	for {
+		v := key >> (64 - poptrieStride)
+		bit := uint64(1) << v
+		if n.vector&bit == 0 {
+			return t.leaves[n.base0+uint32(bits.OnesCount64(n.leafvec&(bit<<1-1)))-1]
+		}
+		n = &t.nodes[n.base1+uint32(bits.OnesCount64(n.vector&(bit-1)))]
+		key <<= poptrieStride
+	}
+}
+
+// ========================================
+
+// triePrefix - Left aligned key of a prefix with its leaf value.
+type triePrefix struct {
+	hi, lo uint64
+	bits   int
+	value  int32
+}
+
+// chunk returns width key bits starting at bit depth.
+func (p triePrefix) chunk(depth, width int) uint64 {
+	hi := p.hi
+	switch {
+	case depth >= 64:
+		hi = p.lo << (depth - 64)
+	case depth > 0:
+		hi = p.hi<<depth | p.lo>>(64-depth)
+	}
+	return hi >> (64 - width)
+}
+
+// trieTask - Node to compile, prefixes under it sorted by key.
+type trieTask struct {
+	prefixes []triePrefix
+	depth    int
+}
+
+// splitChunks assigns prefixes of a level to its slots, short ones fill leaves, longer ones are grouped per slot.
+func splitChunks(prefixes []triePrefix, depth, width int, leaves []int32, children [][]triePrefix) {
+	for v := range leaves {
+		leaves[v] = -1
+	}
+
+	for j := 0; j < len(prefixes); {
+		p := prefixes[j]
+		v := p.chunk(depth, width)
+
+		if rem := p.bits - depth; rem <= width {
+			// short prefixes cover a run of slots
+			for k := v; k < v+uint64(1)<<(width-rem); k++ {
+				leaves[k] = p.value
+			}
+			j++
+			continue
+		}
+
+		// longer prefixes of a slot are contiguous in key order
+		end := j + 1
+		for end < len(prefixes) {
+			q := prefixes[end]
+			if q.bits-depth <= width || q.chunk(depth, width) != v {
+				break
+			}
+			end++
+		}
+		children[v] = prefixes[j:end]
+		j = end
+	}
+}
+
+/*
+compilePoptrie - Builds a trie of disjoint prefixes sorted by key.
+
+	Nodes are compiled breadth first straight from the prefix list, so children
+	of a node are contiguous and no uncompressed nodes are kept in memory.
+*/
+func compilePoptrie(prefixes []triePrefix) *popTrie {
+	t := &popTrie{direct: make([]uint32, 1<<poptrieDirect)}
+	var queue []trieTask
+
+	{
+		leaves := make([]int32, 1<<poptrieDirect)
+		children := make([][]triePrefix, 1<<poptrieDirect)
+		splitChunks(prefixes, 0, poptrieDirect, leaves, children)
+
+		for v := range t.direct {
+			if children[v] == nil {
+				t.direct[v] = directLeaf | uint32(leaves[v]+1)
+				continue
+			}
+			t.direct[v] = uint32(len(queue))
+			queue = append(queue, trieTask{prefixes: children[v], depth: poptrieDirect})
+		}
+	}
+	t.nodes = make([]popNode, len(queue))
+
+	var (
+		leaves   [1 << poptrieStride]int32
+		children [1 << poptrieStride][]triePrefix
+	)
+	for i := 0; i < len(queue); i++ {
+		task := queue[i]
+		queue[i] = trieTask{} // release the prefix list
+
+		clear(children[:])
+		splitChunks(task.prefixes, task.depth, poptrieStride, leaves[:], children[:])
+
+		pn := popNode{
+			base0: uint32(len(t.leaves)),
+			base1: uint32(len(queue)),
+		}
+
+		var (
+			last    int32
+			hasLeaf bool
+		)
+		for v := range children {
+			if children[v] != nil {
+				pn.vector |= 1 << v
+				queue = append(queue, trieTask{prefixes: children[v], depth: task.depth + poptrieStride})
+				t.nodes = append(t.nodes, popNode{})
+				continue
+			}
+			if !hasLeaf || leaves[v] != last {
+				pn.leafvec |= 1 << v
+				t.leaves = append(t.leaves, leaves[v])
+				last, hasLeaf = leaves[v], true
+			}
+		}
+
+		t.nodes[i] = pn
+	}
+
+	t.nodes = slices.Clip(t.nodes)
+	t.leaves = slices.Clip(t.leaves)
+	return t
+}
+
+// ========================================
+
+/*
+buildPoptrie4 - Builds the IPv4 trie of resolved segments holding range indexes.
+
+	Parts of IPv6 ranges inside the IPv4-mapped block are looked up through it.
+*/
+func buildPoptrie4(segs []container[int32]) *popTrie {
+	var (
+		p4  []triePrefix
+		buf []netip.Prefix
+	)
+	for _, seg := range segs {
+		if !seg.rng.start.is4() {
+			continue
+		}
+		buf = seg.rng.ToIPRange().AppendPrefixes(buf[:0])
+		for _, p := range buf {
+			p4 = append(p4, triePrefix{hi: key4(p.Addr()), bits: p.Bits(), value: seg.data})
+		}
+	}
+	return compilePoptrie(p4)
+}
+
+// key4 returns the left aligned trie key of an IPv4 or IPv4-mapped address.
+func key4(a netip.Addr) uint64 {
+	as4 := a.As4()
+	return uint64(binary.BigEndian.Uint32(as4[:])) << 32
+}
@@ -1,9 +1,16 @@
 package ipsetdata
 
 import (
+	"cmp"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"net/netip"
+	"slices"
 	"sort"
+	"strings"
+	"sync/atomic"
+	"unsafe"
 
 	"go4.org/netipx"
 )
@@ -14,29 +21,121 @@ type container[T comparable] struct {
 	data T
 }
 
+// container4 - IPv4 range with associated data, a quarter of the container bounds size.
+type container4[T comparable] struct {
+	start uint32
+	end   uint32
+	data  T
+}
+
+// widen returns the range in the uint128 space of container.
+func (c container4[T]) widen() container[T] {
+	return container[T]{
+		rng:  rangeUint128t{start: uint128tFrom4(c.start), end: uint128tFrom4(c.end)},
+		data: c.data,
+	}
+}
+
 /*
 IPContainerSet - Sorted set of IP ranges with associated data.
 
-	Lookup is performed using binary search.
+	Lookup is performed using binary search. Ranges may overlap, lookups,
+	range queries and set operations resolve nested ranges to the narrowest
+	one and partial overlaps to the latest starting one, whatever the index.
+	IPv4 ranges are kept apart with 32-bit bounds and lookups are dispatched
+	by address family. Ranges are numbered IPv6 first, then IPv4.
 */
 type IPContainerSet[T comparable] struct {
-	set []container[T]
+	set      []container[T]  // IPv6 ranges, including ones crossing the IPv4-mapped block
+	set4     []container4[T] // IPv4 ranges
+	prep     int
+	disjoint bool                        // no stored ranges overlap, set by Prepare
+	maxEnd   atomic.Pointer[runningEnds] // running maximum of range ends of overlapping sets, built on demand
+	index    IndexKind
+	trie4    *popTrie       // IndexPoptrie only, built by Prepare
+	resolved *resolvedIndex // overlapping sets only, built by Prepare
+	bits     []uint8        // prefix length of every CIDR aligned range, unalignedBits otherwise, set by Prepare
+}
+
+// unalignedBits - Prefix length marker of ranges that are not a single CIDR.
+const unalignedBits = 0xff
+
+// IndexKind - Lookup structure of a prepared set.
+type IndexKind uint8
+
+const (
+	// IndexSorted - Binary search over ranges sorted by start, no memory beyond the ranges
+	// for disjoint sets. Overlapping sets also keep their resolved disjoint segments.
+	IndexSorted IndexKind = iota
+	// IndexPoptrie - Population count compressed multibit trie of IPv4 ranges.
+	// IPv4 lookups take a few memory reads at the cost of build time and trie memory.
+	// IPv6 lookups use the sorted index: a trie of /32 to /48 networks was slower
+	// than binary search and took three times its memory.
+	IndexPoptrie
+)
+
+// ParseIndexKind - Parses an index name, "sorted" or "poptrie".
+func ParseIndexKind(s string) (IndexKind, error) {
+	switch s {
+	case "", "sorted":
+		return IndexSorted, nil
+	case "poptrie":
+		return IndexPoptrie, nil
+	default:
+		return 0, fmt.Errorf("unknown lookup index %q, expected sorted or poptrie", s)
+	}
+}
+
+// SetOption - Functional option of IPContainerSet.
+type SetOption func(*setOptions)
+
+type setOptions struct {
+	index IndexKind
+}
+
+// WithIndex - Selects the lookup structure built by Prepare, IndexSorted by default.
+func WithIndex(kind IndexKind) SetOption {
+	return func(o *setOptions) {
+		o.index = kind
+	}
 }
 
 // NewIPContainerSet - Creates a new IPContainerSet with preallocated capacity.
-func NewIPContainerSet[T comparable](prep int) *IPContainerSet[T] {
+func NewIPContainerSet[T comparable](prep int, opts ...SetOption) *IPContainerSet[T] {
+	var o setOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	return &IPContainerSet[T]{
-		set: make([]container[T], 0, prep),
+		prep:  prep,
+		index: o.index,
 	}
 }
 
+// add stores a range by its address family, the first range of a family preallocates its slice.
+func (cset *IPContainerSet[T]) add(c container[T]) {
+	if c.rng.start.is4() && c.rng.end.is4() {
+		if cset.set4 == nil {
+			cset.set4 = make([]container4[T], 0, max(cset.prep, 1))
+		}
+		cset.set4 = append(cset.set4, container4[T]{start: uint32(c.rng.start.lo), end: uint32(c.rng.end.lo), data: c.data})
+		return
+	}
+
+	if cset.set == nil {
+		cset.set = make([]container[T], 0, max(cset.prep/8, 1))
+	}
+	cset.set = append(cset.set, c)
+}
+
 /*
 AddIPRange - Adds an IP range with associated value to the set.
 
-	The range is stored internally as uint128 boundaries.
+	IPv4 ranges are stored with uint32 boundaries, others as uint128 boundaries.
 */
 func (cset *IPContainerSet[T]) AddIPRange(rng netipx.IPRange, value T) {
-	cset.set = append(cset.set, container[T]{
+	cset.add(container[T]{
 		rng: rangeUint128t{
 			start: Addr2Uint128t(rng.From()),
 			end:   Addr2Uint128t(rng.To()),
@@ -47,7 +146,7 @@ func (cset *IPContainerSet[T]) AddIPRange(rng netipx.IPRange, value T) {
 
 // AddStartEnd - Adds a CIDR prefix with associated value to the set.
 func (cset *IPContainerSet[T]) AddStartEnd(start, end netip.Addr, value T) {
-	cset.set = append(cset.set, container[T]{
+	cset.add(container[T]{
 		rng: rangeUint128t{
 			start: Addr2Uint128t(start),
 			end:   Addr2Uint128t(end),
@@ -72,23 +171,122 @@ func (cset *IPContainerSet[T]) AddStartEndStrings(start, end string, value T) er
 	return nil
 }
 
+/*
+ParseRange - Parses an IP address, a CIDR network or a start-end range.
+
+	IPv4-mapped addresses are unmapped, as the set stores IPv4 ranges apart.
+*/
+func ParseRange(s string) (netipx.IPRange, error) {
+	var rng netipx.IPRange
+	switch {
+	case strings.Contains(s, "/"):
+		pfx, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netipx.IPRange{}, err
+		}
+		rng = netipx.RangeOfPrefix(pfx.Masked())
+	case strings.Contains(s, "-"):
+		r, err := netipx.ParseIPRange(s)
+		if err != nil {
+			return netipx.IPRange{}, err
+		}
+		rng = r
+	default:
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netipx.IPRange{}, err
+		}
+		rng = netipx.IPRangeFrom(addr, addr)
+	}
+
+	from, to := rng.From(), rng.To()
+	if from.Is4In6() != to.Is4In6() {
+		return netipx.IPRange{}, errors.New("range crosses the IPv4-mapped space")
+	}
+	if from.Is4In6() {
+		rng = netipx.IPRangeFrom(from.Unmap(), to.Unmap())
+	}
+	if !rng.IsValid() {
+		return netipx.IPRange{}, fmt.Errorf("invalid range %s", s)
+	}
+	return rng, nil
+}
+
 // AddPrefix - Adds a CIDR prefix with associated value to the set.
 func (cset *IPContainerSet[T]) AddPrefix(pfx netip.Prefix, value T) {
 	cset.AddIPRange(netipx.RangeOfPrefix(pfx), value)
 }
 
 /*
-Prepare - Sorts internal ranges by start address.
+Prepare - Sorts internal ranges by start address, outer ranges first on equal starts.
 
-	Must be called before any Get() calls.
+	Must be called before any Get() calls. Preallocated capacity is released
+	and prefix lengths of CIDR aligned ranges are computed here. Overlapping
+	sets resolve their disjoint segments and sets built with IndexPoptrie
+	compile their trie, again after every modification.
 */
 func (cset *IPContainerSet[T]) Prepare() {
-	sort.Slice(cset.set, func(i, j int) bool {
-		return cset.set[i].rng.start.Less(cset.set[j].rng.start)
+	slices.SortFunc(cset.set, func(a, b container[T]) int {
+		if c := a.rng.start.Compare(b.rng.start); c != 0 {
+			return c
+		}
+		return b.rng.end.Compare(a.rng.end)
+	})
+	slices.SortFunc(cset.set4, func(a, b container4[T]) int {
+		if c := cmp.Compare(a.start, b.start); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.end, a.end)
 	})
 
 	// Force capacity to length to prevent accidental reallocation
-	cset.set = cset.set[:len(cset.set):len(cset.set)]
+	cset.set = compact(cset.set)
+	cset.set4 = compact(cset.set4)
+
+	cset.disjoint = true
+	var (
+		prev    rangeUint128t
+		hasPrev bool
+	)
+	cset.each(func(_ int, c container[T]) bool {
+		if hasPrev && !prev.end.Less(c.rng.start) {
+			cset.disjoint = false
+			return false
+		}
+		prev, hasPrev = c.rng, true
+		return true
+	})
+	cset.maxEnd.Store(nil)
+
+	cset.bits = make([]uint8, cset.Size())
+	for i := range cset.bits {
+		cset.bits[i] = unalignedBits
+		if p, ok := cset.at(i).rng.ToIPRange().Prefix(); ok {
+			cset.bits[i] = uint8(p.Bits())
+		}
+	}
+
+	cset.trie4, cset.resolved = nil, nil
+	if cset.disjoint && cset.index != IndexPoptrie {
+		return
+	}
+
+	segs := indexedSegments(cset)
+	if cset.index == IndexPoptrie {
+		cset.trie4 = buildPoptrie4(segs)
+	}
+	if !cset.disjoint {
+		// IPv4 segments are looked up in the trie when there is one
+		cset.resolved = newResolvedIndex(segs, cset.trie4 == nil)
+	}
+}
+
+// compact returns s with capacity equal to its length, reallocated when preallocation left much unused.
+func compact[S ~[]E, E any](s S) S {
+	if cap(s) > len(s)+len(s)/8 {
+		return slices.Clone(s)[:len(s):len(s)]
+	}
+	return s[:len(s):len(s)]
 }
 
 /*
@@ -97,31 +295,194 @@ Get - Finds the IP range containing the given address.
 	Returns the matching prefix, associated data and true on success.
 */
 func (cset *IPContainerSet[T]) Get(ip netip.Addr) (pfx netip.Prefix, data T, ok bool) {
-	ipvec := Addr2Uint128t(ip)
+	i := cset.lookup(ip)
+	if i < 0 {
+		var zero T
+		return netip.Prefix{}, zero, false
+	}
+
+	c := cset.at(i)
+	return cset.prefixOf(i, c.rng, ip), c.data, true
+}
 
-	i := sort.Search(len(cset.set), func(i int) bool {
-		return !cset.set[i].rng.start.Less(ipvec)
+// prefixOf returns the prefix of the range i holding ip, precomputed by Prepare for CIDR aligned ranges.
+func (cset *IPContainerSet[T]) prefixOf(i int, rng rangeUint128t, ip netip.Addr) netip.Prefix {
+	if i < len(cset.bits) && cset.bits[i] != unalignedBits {
+		return netip.PrefixFrom(rng.start.ToAddr(), int(cset.bits[i]))
+	}
+	return rng.PrefixOf(ip)
+}
+
+/*
+GetRange - Finds the IP range containing the given address.
+
+	Returns the whole matching range, associated data and true on success.
+*/
+func (cset *IPContainerSet[T]) GetRange(ip netip.Addr) (rng netipx.IPRange, data T, ok bool) {
+	i := cset.lookup(ip)
+	if i < 0 {
+		var zero T
+		return netipx.IPRange{}, zero, false
+	}
+
+	c := cset.at(i)
+	return c.rng.ToIPRange(), c.data, true
+}
+
+// lookup returns the index of the range containing ip or -1 with the index selected at construction.
+func (cset *IPContainerSet[T]) lookup(ip netip.Addr) int {
+	if ip.Is4() || ip.Is4In6() {
+		if cset.trie4 != nil {
+			return int(cset.trie4.lookup4(key4(ip)))
+		}
+
+		as4 := ip.As4()
+		ip4 := binary.BigEndian.Uint32(as4[:])
+		if cset.resolved != nil {
+			return cset.resolved.find4(ip4)
+		}
+
+		// IPv6 ranges may span the IPv4-mapped block and hold IPv4 addresses too
+		if j := findRange4(cset.set4, ip4); j >= 0 {
+			return len(cset.set) + j
+		}
+	}
+
+	if cset.resolved != nil {
+		return cset.resolved.find6(Addr2Uint128t(ip))
+	}
+	return findRange(cset.set, Addr2Uint128t(ip))
+}
+
+// findRange returns the index of the range of disjoint sorted ranges containing ipvec or -1.
+func findRange[T comparable](set []container[T], ipvec uint128t) int {
+	i := sort.Search(len(set), func(i int) bool {
+		return !set[i].rng.start.Less(ipvec)
 	})
 
 	// Check exact index
-	if i < len(cset.set) && cset.set[i].rng.Contains(ipvec) {
-		if p, ok := cset.set[i].rng.ToIPRange().Prefix(); ok {
-			return p, cset.set[i].data, true
-		}
+	if i < len(set) && set[i].rng.Contains(ipvec) {
+		return i
 	}
 
 	// Check previous range
-	if i > 0 && cset.set[i-1].rng.Contains(ipvec) {
-		if p, ok := cset.set[i-1].rng.ToIPRange().Prefix(); ok {
-			return p, cset.set[i-1].data, true
+	if i > 0 && set[i-1].rng.Contains(ipvec) {
+		return i - 1
+	}
+
+	return -1
+}
+
+// findRange4 returns the index of the IPv4 range of disjoint sorted ranges containing ip or -1.
+func findRange4[T comparable](set []container4[T], ip uint32) int {
+	i := sort.Search(len(set), func(i int) bool {
+		return set[i].start >= ip
+	})
+
+	if i < len(set) && set[i].start <= ip && ip <= set[i].end {
+		return i
+	}
+	if i > 0 && set[i-1].start <= ip && ip <= set[i-1].end {
+		return i - 1
+	}
+
+	return -1
+}
+
+/*
+resolvedIndex - Disjoint segments of an overlapping set with the index of the range owning each.
+
+	Segments are resolved as by segments, so binary search over them answers
+	like the poptrie and Segments do. v4 is empty when the set has a trie.
+*/
+type resolvedIndex struct {
+	v6 []container[int32]
+	v4 []container4[int32]
+}
+
+// newResolvedIndex splits resolved segments by family, IPv4 ones are kept only with keep4.
+func newResolvedIndex(segs []container[int32], keep4 bool) *resolvedIndex {
+	r := &resolvedIndex{}
+	for _, c := range segs {
+		// segments never cross the IPv4-mapped block boundaries
+		if c.rng.start.is4() {
+			if keep4 {
+				r.v4 = append(r.v4, container4[int32]{start: uint32(c.rng.start.lo), end: uint32(c.rng.end.lo), data: c.data})
+			}
+			continue
 		}
+		r.v6 = append(r.v6, c)
 	}
 
-	var zero T
-	return netip.Prefix{}, zero, false
+	r.v6 = slices.Clip(r.v6)
+	r.v4 = slices.Clip(r.v4)
+	return r
+}
+
+func (r *resolvedIndex) find6(ipvec uint128t) int {
+	if j := findRange(r.v6, ipvec); j >= 0 {
+		return int(r.v6[j].data)
+	}
+	return -1
+}
+
+func (r *resolvedIndex) find4(ip uint32) int {
+	if j := findRange4(r.v4, ip); j >= 0 {
+		return int(r.v4[j].data)
+	}
+	return -1
+}
+
+// heapBytes returns the approximate heap of the segments, zero for nil.
+func (r *resolvedIndex) heapBytes() int64 {
+	if r == nil {
+		return 0
+	}
+	return int64(cap(r.v6))*int64(unsafe.Sizeof(container[int32]{})) + int64(cap(r.v4))*int64(unsafe.Sizeof(container4[int32]{}))
+}
+
+// indexedSegments returns the resolved disjoint segments of a prepared set holding range indexes.
+func indexedSegments[T comparable](cset *IPContainerSet[T]) []container[int32] {
+	idx := make([]container[int32], 0, cset.Size())
+	cset.each(func(i int, c container[T]) bool {
+		idx = append(idx, container[int32]{rng: c.rng, data: int32(i)})
+		return true
+	})
+	indexed := &IPContainerSet[int32]{set: idx, disjoint: cset.disjoint}
+	return coalesceSegments(indexed.segments())
+}
+
+// at returns the range of index i in the uint128 space.
+func (cset *IPContainerSet[T]) at(i int) container[T] {
+	if i < len(cset.set) {
+		return cset.set[i]
+	}
+	return cset.set4[i-len(cset.set)].widen()
+}
+
+// each calls yield with the index and range of every stored range in start address order until it returns false.
+func (cset *IPContainerSet[T]) each(yield func(i int, c container[T]) bool) {
+	i6, i4 := 0, 0
+	for i6 < len(cset.set) || i4 < len(cset.set4) {
+		if i4 < len(cset.set4) {
+			c4 := cset.set4[i4].widen()
+			if i6 == len(cset.set) || c4.rng.start.Less(cset.set[i6].rng.start) {
+				if !yield(len(cset.set)+i4, c4) {
+					return
+				}
+				i4++
+				continue
+			}
+		}
+
+		if !yield(i6, cset.set[i6]) {
+			return
+		}
+		i6++
+	}
 }
 
 // Size - Returns number of stored ranges.
 func (cset *IPContainerSet[T]) Size() int {
-	return len(cset.set)
+	return len(cset.set) + len(cset.set4)
 }
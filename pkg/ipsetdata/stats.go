@@ -0,0 +1,130 @@
+package ipsetdata
+
+import (
+	"math/big"
+	"math/bits"
+	"unsafe"
+)
+
+/*
+SetStats - Structure statistics of a prepared set.
+
+	Address space counts overlapping ranges once. Gaps are uncovered holes
+	between covered ranges of the same family, holes at the IPv4-mapped
+	block boundaries are not counted. Heap bytes are approximate and
+	exclude memory referenced by range data.
+*/
+type SetStats struct {
+	Ranges4     int      // IPv4 ranges
+	Ranges6     int      // IPv6 ranges, including ones crossing the IPv4-mapped block
+	Space4      uint64   // IPv4 addresses covered
+	Space6      *big.Int // IPv6 addresses covered
+	Overlaps    int      // ranges overlapping a preceding range
+	Gaps4       int
+	Gaps6       int
+	Coalescable int   // ranges adjacent to the preceding range with equal data, removable by merging
+	RangeBytes  int64 // ranges and their prefix lengths
+	IndexBytes  int64 // poptrie, resolved segments and running range ends, zero for a disjoint sorted set without range queries
+}
+
+// Stats - Returns structure statistics of the set, walks all ranges once.
+func (cset *IPContainerSet[T]) Stats() SetStats {
+	st := SetStats{
+		Ranges4:    len(cset.set4),
+		Ranges6:    len(cset.set),
+		Space6:     new(big.Int),
+		RangeBytes: int64(cap(cset.set))*int64(unsafe.Sizeof(container[T]{})) + int64(cap(cset.set4))*int64(unsafe.Sizeof(container4[T]{})) + int64(cap(cset.bits)),
+		IndexBytes: cset.trie4.heapBytes() + cset.resolved.heapBytes(),
+	}
+	if ends := cset.maxEnd.Load(); ends != nil {
+		st.IndexBytes += int64(cap(ends.v6))*int64(unsafe.Sizeof(uint128t{})) + int64(cap(ends.v4))*4
+	}
+
+	var (
+		run     rangeUint128t // covered run of overlapping and adjacent ranges
+		prev    container[T]
+		hasPrev bool
+	)
+	cset.each(func(_ int, c container[T]) bool {
+		if !hasPrev {
+			run, prev, hasPrev = c.rng, c, true
+			return true
+		}
+
+		if !run.end.Less(c.rng.start) {
+			st.Overlaps++
+			if run.end.Less(c.rng.end) {
+				run.end = c.rng.end
+			}
+			prev = c
+			return true
+		}
+
+		next, _ := run.end.Inc()
+		switch {
+		case next == c.rng.start:
+			if prevNext, _ := prev.rng.end.Inc(); prevNext == c.rng.start && prev.data == c.data {
+				st.Coalescable++
+			}
+			run.end = c.rng.end
+			prev = c
+			return true
+
+		case run.end.is4() && c.rng.start.is4():
+			st.Gaps4++
+		case !run.end.is4() && !c.rng.start.is4():
+			st.Gaps6++
+		}
+
+		st.addSpace(run)
+		run, prev = c.rng, c
+		return true
+	})
+	if hasPrev {
+		st.addSpace(run)
+	}
+
+	return st
+}
+
+// addSpace counts the addresses of a covered run, the part inside the IPv4-mapped block as IPv4.
+func (st *SetStats) addSpace(r rangeUint128t) {
+	total := r.end.sub(r.start).bigInt()
+	total.Add(total, big.NewInt(1))
+
+	start, end := r.start, r.end
+	if start.Less(mapped4Start) {
+		start = mapped4Start
+	}
+	if mapped4End.Less(end) {
+		end = mapped4End
+	}
+	if !end.Less(start) {
+		v4 := end.lo - start.lo + 1
+		st.Space4 += v4
+		total.Sub(total, new(big.Int).SetUint64(v4))
+	}
+
+	st.Space6.Add(st.Space6, total)
+}
+
+// sub returns u-v modulo 2^128.
+func (u uint128t) sub(v uint128t) uint128t {
+	lo, borrow := bits.Sub64(u.lo, v.lo, 0)
+	hi, _ := bits.Sub64(u.hi, v.hi, borrow)
+	return uint128t{hi: hi, lo: lo}
+}
+
+func (u uint128t) bigInt() *big.Int {
+	b := new(big.Int).SetUint64(u.hi)
+	b.Lsh(b, 64)
+	return b.Or(b, new(big.Int).SetUint64(u.lo))
+}
+
+// heapBytes returns the approximate heap of the trie, zero for nil.
+func (t *popTrie) heapBytes() int64 {
+	if t == nil {
+		return 0
+	}
+	return int64(cap(t.direct))*4 + int64(cap(t.nodes))*int64(unsafe.Sizeof(popNode{})) + int64(cap(t.leaves))*4
+}
@@ -2,6 +2,7 @@ package ipsetdata
 
 import (
 	"encoding/binary"
+	"math/bits"
 	"net/netip"
 
 	"go4.org/netipx"
@@ -84,3 +85,68 @@ func (r rangeUint128t) Contains(u uint128t) bool {
 func (r rangeUint128t) ToIPRange() netipx.IPRange {
 	return IPRangeFromUint128ts(r.start, r.end)
 }
+
+// PrefixOf - Returns the prefix of the range that contains the address, as PrefixIn.
+func (r rangeUint128t) PrefixOf(ip netip.Addr) netip.Prefix {
+	return PrefixIn(r.ToIPRange(), ip)
+}
+
+/*
+PrefixIn - Returns the prefix of the range that contains the address.
+
+	Ranges that are not CIDR aligned return the widest prefix inside the
+	range containing the address. IPv4-mapped addresses of IPv4 ranges are
+	unmapped.
+*/
+func PrefixIn(rng netipx.IPRange, ip netip.Addr) netip.Prefix {
+	if p, ok := rng.Prefix(); ok {
+		return p
+	}
+	if rng.From().Is4() {
+		ip = ip.Unmap()
+	}
+
+	for bits := 0; bits < ip.BitLen(); bits++ {
+		p, err := ip.Prefix(bits)
+		if err != nil {
+			break
+		}
+
+		pr := netipx.RangeOfPrefix(p)
+		if rng.From().Compare(pr.From()) <= 0 && pr.To().Compare(rng.To()) <= 0 {
+			return p
+		}
+	}
+
+	return netip.PrefixFrom(ip, ip.BitLen())
+}
+
+// Inc - Returns u+1 and false on overflow.
+func (u uint128t) Inc() (uint128t, bool) {
+	lo, carry := bits.Add64(u.lo, 1, 0)
+	hi, carry := bits.Add64(u.hi, 0, carry)
+	return uint128t{hi: hi, lo: lo}, carry == 0
+}
+
+// Dec - Returns u-1 and false on underflow.
+func (u uint128t) Dec() (uint128t, bool) {
+	lo, borrow := bits.Sub64(u.lo, 1, 0)
+	hi, borrow := bits.Sub64(u.hi, 0, borrow)
+	return uint128t{hi: hi, lo: lo}, borrow == 0
+}
+
+// is4 - Reports whether u is an IPv4-mapped address.
+func (u uint128t) is4() bool {
+	return u.hi == 0 && u.lo>>32 == 0xffff
+}
+
+// uint128tFrom4 - Returns the IPv4-mapped address of an IPv4 address value.
+func uint128tFrom4(v uint32) uint128t {
+	return uint128t{lo: 0xffff_0000_0000 | uint64(v)}
+}
+
+// rangeOfPrefix - Converts a prefix to its uint128 boundaries.
+func rangeOfPrefix(pfx netip.Prefix) rangeUint128t {
+	r := netipx.RangeOfPrefix(pfx.Masked())
+	return rangeUint128t{start: Addr2Uint128t(r.From()), end: Addr2Uint128t(r.To())}
+}
@@ -0,0 +1,30 @@
+package ipsetdata_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/eterline/ipcsv2base/pkg/ipsetdata"
+	"go4.org/netipx"
+)
+
+func TestPrefixIn(t *testing.T) {
+	tests := []struct {
+		rng  string
+		addr string
+		want string
+	}{
+		{"10.0.0.0-10.0.0.255", "10.0.0.7", "10.0.0.0/24"},
+		{"10.0.0.1-10.0.0.6", "10.0.0.5", "10.0.0.4/31"},
+		{"10.0.0.1-10.0.0.6", "10.0.0.1", "10.0.0.1/32"},
+		{"10.0.0.0-10.0.2.255", "10.0.2.9", "10.0.2.0/24"},
+		{"10.0.0.0-10.0.2.255", "::ffff:10.0.1.9", "10.0.0.0/23"},
+		{"2001:db8::-2001:db8:2::ffff", "2001:db8:1::1", "2001:db8::/47"},
+	}
+	for _, tt := range tests {
+		rng := netipx.MustParseIPRange(tt.rng)
+		if got := ipsetdata.PrefixIn(rng, netip.MustParseAddr(tt.addr)); got.String() != tt.want {
+			t.Errorf("PrefixIn(%s, %s) = %s, want %s", tt.rng, tt.addr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrNotListed     = errors.New("file is not listed in the manifest")
+	ErrMismatch      = errors.New("file checksum does not match the manifest")
+	ErrBadSignature  = errors.New("manifest signature verification failed")
+	ErrInvalidFormat = errors.New("invalid manifest format")
+)
+
+// SigSuffix - Default suffix of a detached manifest signature file.
+const SigSuffix = ".sig"
+
+/*
+Manifest - SHA-256 checksums of files keyed by their path relative to the manifest directory.
+
+	Names are slash separated, so files of the same name in different
+	directories have distinct entries. The text form is compatible with
+	sha256sum run from the manifest directory: "<hex>  <name>" per line.
+*/
+type Manifest map[string]string
+
+// Build - Hashes files and returns their manifest written into dir, every file is listed once.
+func Build(dir string, files ...string) (Manifest, error) {
+	m := make(Manifest, len(files))
+
+	for _, file := range files {
+		name, err := Name(dir, file)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := m[name]; ok {
+			return nil, fmt.Errorf("duplicate file name %q", name)
+		}
+
+		sum, err := HashFile(file)
+		if err != nil {
+			return nil, err
+		}
+		m[name] = sum
+	}
+
+	return m, nil
+}
+
+// Name - Returns the manifest name of file for a manifest in dir.
+func Name(dir, file string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(absDir, absFile)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// HashFile - Returns the hex encoded SHA-256 of a file.
+func HashFile(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Parse - Parses the sha256sum text form of a manifest, a name listed twice is invalid.
+func Parse(data []byte) (Manifest, error) {
+	m := Manifest{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		sum, name, ok := strings.Cut(text, " ")
+		name = strings.TrimPrefix(strings.TrimSpace(name), "*")
+
+		if !ok || name == "" || len(sum) != hex.EncodedLen(sha256.Size) {
+			return nil, fmt.Errorf("%w: line %d", ErrInvalidFormat, line)
+		}
+		if _, err := hex.DecodeString(sum); err != nil {
+			return nil, fmt.Errorf("%w: line %d", ErrInvalidFormat, line)
+		}
+
+		name = path.Clean(filepath.ToSlash(name))
+		if _, ok := m[name]; ok {
+			return nil, fmt.Errorf("%w: line %d: duplicate file name %q", ErrInvalidFormat, line, name)
+		}
+		m[name] = strings.ToLower(sum)
+	}
+
+	return m, sc.Err()
+}
+
+// Marshal - Returns the sha256sum text form with names sorted.
+func (m Manifest) Marshal() []byte {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s  %s\n", m[name], name)
+	}
+	return buf.Bytes()
+}
+
+// Check - Compares a checksum with the manifest entry of name.
+func (m Manifest) Check(name, sum string) error {
+	want, ok := m[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotListed, name)
+	}
+	if !strings.EqualFold(want, sum) {
+		return fmt.Errorf("%w: %s", ErrMismatch, name)
+	}
+	return nil
+}
+
+// ==========================
+
+// Sign - Returns the base64 encoded ed25519 signature of the manifest text.
+func Sign(data []byte, key ed25519.PrivateKey) []byte {
+	sig := ed25519.Sign(key, data)
+	return []byte(base64.StdEncoding.EncodeToString(sig) + "\n")
+}
+
+// VerifySignature - Verifies a base64 encoded ed25519 signature of the manifest text.
+func VerifySignature(data, sig []byte, key ed25519.PublicKey) error {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrBadSignature, err)
+	}
+	if !ed25519.Verify(key, data, raw) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+/*
+Verifier - Checks files against a signed manifest.
+
+	The manifest signature is verified once on load, files are checked by their SHA-256
+	against the entry of their path relative to the manifest directory.
+*/
+type Verifier struct {
+	manifest Manifest
+	dir      string
+}
+
+// LoadVerifier - Reads a manifest, verifies its detached signature with the public key and returns its verifier.
+func LoadVerifier(manifestFile, sigFile, pubKeyFile string) (*Verifier, error) {
+	data, err := os.ReadFile(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := os.ReadFile(sigFile)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ReadPublicKey(pubKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := VerifySignature(data, sig, key); err != nil {
+		return nil, err
+	}
+
+	m, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Verifier{manifest: m, dir: filepath.Dir(manifestFile)}, nil
+}
+
+// Verify - Checks the SHA-256 of a file against the manifest.
+func (v *Verifier) Verify(file, sum string) error {
+	name, err := Name(v.dir, file)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrNotListed, file, err)
+	}
+	return v.manifest.Check(name, sum)
+}
+
+// ==========================
+
+// GenerateKey - Creates an ed25519 key pair in PEM form (PKCS#8 private, PKIX public).
+func GenerateKey() (priv, pub []byte, err error) {
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(privKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pubDER, err := x509.MarshalPKIXPublicKey(pubKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	priv = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER})
+	pub = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+	return priv, pub, nil
+}
+
+// ReadPrivateKey - Reads a PEM encoded PKCS#8 ed25519 private key.
+func ReadPrivateKey(file string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(file, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 private key", file)
+	}
+	return priv, nil
+}
+
+// ReadPublicKey - Reads a PEM encoded PKIX ed25519 public key.
+func ReadPublicKey(file string) (ed25519.PublicKey, error) {
+	der, err := readPEM(file, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 public key", file)
+	}
+	return pub, nil
+}
+
+func readPEM(file, blockType string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s has no PEM %s block", file, blockType)
+	}
+	return block.Bytes, nil
+}
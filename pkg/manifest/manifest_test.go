@@ -0,0 +1,131 @@
+package manifest_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eterline/ipcsv2base/pkg/manifest"
+)
+
+// writeFile writes data into dir/name, creating its directories.
+func writeFile(t *testing.T, dir, name, data string) string {
+	t.Helper()
+
+	file := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestVerifierKeysByRelativePath(t *testing.T) {
+	dir := t.TempDir()
+	early := writeFile(t, dir, "GeoLite2-Country-CSV_20260101/GeoLite2-Country-Blocks-IPv4.csv", "early")
+	late := writeFile(t, dir, "GeoLite2-Country-CSV_20260201/GeoLite2-Country-Blocks-IPv4.csv", "late")
+	unlisted := writeFile(t, dir, "other/GeoLite2-Country-Blocks-IPv4.csv", "early")
+
+	m, err := manifest.Build(dir, early, late)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	priv, pub, err := manifest.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := writeFile(t, dir, "key.pem", string(priv))
+	pubFile := writeFile(t, dir, "key.pub", string(pub))
+	key, err := manifest.ReadPrivateKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := m.Marshal()
+	manifestFile := writeFile(t, dir, "manifest.sha256", string(data))
+	sigFile := writeFile(t, dir, "manifest.sha256.sig", string(manifest.Sign(data, key)))
+
+	v, err := manifest.LoadVerifier(manifestFile, sigFile, pubFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := func(file string) string {
+		s, err := manifest.HashFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name string
+		file string
+		sum  string
+		want error
+	}{
+		{"first bundle", early, sum(early), nil},
+		{"second bundle", late, sum(late), nil},
+		{"same name, other bundle", early, sum(late), manifest.ErrMismatch},
+		{"same name, unlisted directory", unlisted, sum(unlisted), manifest.ErrNotListed},
+	}
+	for _, tt := range tests {
+		if err := v.Verify(tt.file, tt.sum); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Verify(%s) error = %v, want %v", tt.name, tt.file, err, tt.want)
+		}
+	}
+}
+
+func TestBuildRejectsDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	file := writeFile(t, dir, "country.csv", "data")
+
+	if _, err := manifest.Build(dir, file, filepath.Join(dir, ".", "country.csv")); err == nil {
+		t.Fatal("Build of a file listed twice succeeded")
+	}
+}
+
+func TestParse(t *testing.T) {
+	const sum = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	tests := []struct {
+		name    string
+		data    string
+		want    manifest.Manifest
+		wantErr bool
+	}{
+		{
+			name: "sha256sum output",
+			data: "# bases\n" + sum + "  a/country.csv\n" + sum + " *b/./country.csv\n",
+			want: manifest.Manifest{"a/country.csv": sum, "b/country.csv": sum},
+		},
+		{name: "duplicate name", data: sum + "  a/country.csv\n" + sum + "  a//country.csv\n", wantErr: true},
+		{name: "short checksum", data: "e3b0  country.csv\n", wantErr: true},
+		{name: "missing name", data: sum + "\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := manifest.Parse([]byte(tt.data))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			if !errors.Is(err, manifest.ErrInvalidFormat) {
+				t.Errorf("%s: error = %v, want %v", tt.name, err, manifest.ErrInvalidFormat)
+			}
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: Parse = %v, want %v", tt.name, got, tt.want)
+		}
+		for name, s := range tt.want {
+			if got[name] != s {
+				t.Errorf("%s: entry %s = %q, want %q", tt.name, name, got[name], s)
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package mmaprc
+
+import (
+	"fmt"
+	"os"
+)
+
+// Advice - Expected access pattern of a mapping, passed to the kernel with madvise.
+type Advice uint8
+
+const (
+	AdviceNormal     Advice = iota // no special treatment
+	AdviceRandom                   // random page access, read-ahead is disabled
+	AdviceSequential               // sequential access, pages are read ahead aggressively
+	AdviceWillNeed                 // pages are read ahead of the first access
+	AdviceDontNeed                 // resident pages may be dropped and are read again on access
+)
+
+// ParseAdvice - Parses an advice name: normal, random, sequential, willneed or dontneed.
+func ParseAdvice(s string) (Advice, error) {
+	switch s {
+	case "", "normal":
+		return AdviceNormal, nil
+	case "random":
+		return AdviceRandom, nil
+	case "sequential":
+		return AdviceSequential, nil
+	case "willneed":
+		return AdviceWillNeed, nil
+	case "dontneed":
+		return AdviceDontNeed, nil
+	default:
+		return 0, fmt.Errorf("unknown mmap advice %q", s)
+	}
+}
+
+/*
+Mapping - Read-only memory mapping of a whole file.
+
+	Pages are loaded by the kernel on first access and may be reclaimed
+	under memory pressure, so resident memory follows the working set.
+	Bytes of the mapping stay valid until Close.
+*/
+type Mapping struct {
+	data []byte
+}
+
+// Map - Maps the file at path read-only.
+func Map(path string) (*Mapping, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return MapFile(f)
+}
+
+// MapFile - Maps the open file read-only, the mapping stays valid after the file is closed.
+func MapFile(f *os.File) (*Mapping, error) {
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	size := st.Size()
+	if size == 0 {
+		return &Mapping{}, nil
+	}
+	if int64(int(size)) != size {
+		return nil, fmt.Errorf("file %s is too large to map", f.Name())
+	}
+
+	data, err := mmapFile(f, int(size))
+	if err != nil {
+		return nil, fmt.Errorf("mmap %s: %w", f.Name(), err)
+	}
+
+	return &Mapping{data: data}, nil
+}
+
+// Bytes - Returns the mapped file contents, must not be modified or used after Close.
+func (m *Mapping) Bytes() []byte {
+	return m.data
+}
+
+// Len - Returns the length of the mapping.
+func (m *Mapping) Len() int {
+	return len(m.data)
+}
+
+// Advise - Hints the kernel about the access pattern of the whole mapping.
+func (m *Mapping) Advise(a Advice) error {
+	return m.AdviseRange(a, 0, len(m.data))
+}
+
+/*
+AdviseRange - Hints the kernel about the access pattern of n bytes at off.
+
+	The range is widened to page boundaries. Platforms without madvise
+	ignore the hint.
+*/
+func (m *Mapping) AdviseRange(a Advice, off, n int) error {
+	if off < 0 || n < 0 || off+n > len(m.data) {
+		return fmt.Errorf("advise range %d+%d out of mapping of %d bytes", off, n, len(m.data))
+	}
+	if n == 0 {
+		return nil
+	}
+
+	page := os.Getpagesize()
+	start := off &^ (page - 1)
+	return madvise(m.data[start:off+n], a)
+}
+
+// Close - Unmaps the file, the mapping must not be used afterwards.
+func (m *Mapping) Close() error {
+	if m.data == nil {
+		return nil
+	}
+
+	err := munmap(m.data)
+	m.data = nil
+	return err
+}
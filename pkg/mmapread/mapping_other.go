@@ -0,0 +1,25 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package mmaprc
+
+import (
+	"io"
+	"os"
+)
+
+// mmapFile reads the whole file where mmap with madvise is not available.
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	b := make([]byte, size)
+	if _, err := io.ReadFull(f, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func munmap([]byte) error {
+	return nil
+}
+
+func madvise([]byte, Advice) error {
+	return nil
+}
@@ -0,0 +1,32 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package mmaprc
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+var adviceFlags = [...]int{
+	AdviceNormal:     unix.MADV_NORMAL,
+	AdviceRandom:     unix.MADV_RANDOM,
+	AdviceSequential: unix.MADV_SEQUENTIAL,
+	AdviceWillNeed:   unix.MADV_WILLNEED,
+	AdviceDontNeed:   unix.MADV_DONTNEED,
+}
+
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	return unix.Mmap(int(f.Fd()), 0, size, unix.PROT_READ, unix.MAP_SHARED)
+}
+
+func munmap(b []byte) error {
+	return unix.Munmap(b)
+}
+
+func madvise(b []byte, a Advice) error {
+	if int(a) >= len(adviceFlags) {
+		return nil
+	}
+	return unix.Madvise(b, adviceFlags[a])
+}
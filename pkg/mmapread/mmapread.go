@@ -64,6 +64,16 @@ func (m *MMapReadCloser) Seek(offset int64, whence int) (int64, error) {
 	return m.pos, nil
 }
 
+// ReadAt reads from the underlying mapping at the given offset without moving the position.
+func (m *MMapReadCloser) ReadAt(p []byte, off int64) (int, error) {
+	return m.r.ReadAt(p, off)
+}
+
+// Len returns the length of the underlying mapping.
+func (m *MMapReadCloser) Len() int64 {
+	return int64(m.r.Len())
+}
+
 func (m *MMapReadCloser) Pos() int64 {
 	return m.pos
 }